@@ -0,0 +1,441 @@
+// Package config loads the settings of this application
+// which are not covered by gorest
+//
+// gorest loads the .env file into the environment,
+// so Config must be called after gconfig.Config
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration - application specific settings
+type Configuration struct {
+	Cache      CacheConfig
+	Avatar     AvatarConfig
+	Nickname   NicknameConfig
+	Deletion   DeletionConfig
+	DataExport DataExportConfig
+	OAuth      OAuthConfig
+	OAuth2     OAuth2Config
+	Email      EmailConfig
+	WebAuthn   WebAuthnConfig
+	Lockout    LockoutConfig
+	Session    SessionConfig
+	Notes      NotesConfig
+}
+
+// CacheConfig - read-through cache of user profiles and notes
+type CacheConfig struct {
+	TTL       time.Duration
+	LocalSize int
+	LocalTTL  time.Duration
+}
+
+// AvatarConfig - storage and caching of profile pictures
+type AvatarConfig struct {
+	Dir    string
+	MaxAge time.Duration
+}
+
+// NicknameConfig - limits of nickname changes
+type NicknameConfig struct {
+	ChangeInterval time.Duration
+	Cooldown       time.Duration
+}
+
+// DeletionConfig - deletion of accounts requested by their users
+type DeletionConfig struct {
+	GracePeriod   time.Duration
+	PurgeInterval time.Duration
+}
+
+// DataExportConfig - archives of the data held about a user
+type DataExportConfig struct {
+	Dir string
+	TTL time.Duration
+}
+
+// OAuthConfig - social login with OAuth2/OIDC providers
+type OAuthConfig struct {
+	// RedirectURL - base of the callbacks registered at the providers,
+	// the callback of a provider is <RedirectURL>/<name>/callback
+	RedirectURL string
+	StateTTL    time.Duration
+	Providers   []OAuthProviderConfig
+}
+
+// OAuthProviderConfig - a provider and the credentials of this
+// application registered there
+//
+// Type is oidc or github, the endpoints of an OIDC provider left
+// empty are discovered from its issuer
+type OAuthProviderConfig struct {
+	Name         string
+	Type         string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Scopes       []string
+}
+
+// OAuth2Config - authorization server for third-party applications
+type OAuth2Config struct {
+	Activate        bool
+	CodeTTL         time.Duration
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// EmailConfig - emails sent to users and the flows using them
+//
+// the settings of Postmark are read by gorest, see gconfig.EmailConfig;
+// the smtp and file providers render the templates in TemplateDir
+type EmailConfig struct {
+	Activate        bool
+	Provider        string
+	VerifyEmail     bool
+	RecoverPassword bool
+	SMTP            SMTPConfig
+	// FileDir - directory of the .eml files of the file provider
+	FileDir     string
+	TemplateDir string
+	// QueueSize - emails waiting to be sent, more are refused
+	QueueSize     int
+	RetryAttempts int
+	// RetryDelay - wait before the first retry, doubled after each
+	RetryDelay time.Duration
+	MagicLink  MagicLinkConfig
+	// InvitationTemplateID and InvitationTag - emails of workspace
+	// invitations, Postmark only
+	InvitationTemplateID int64
+	InvitationTag        string
+}
+
+// MagicLinkConfig - passwordless login with a link sent by email
+//
+// the link is <URL>?code=<code>, a page of the frontend which posts
+// the code to /login/magic-link/verify; at most Limit links of an
+// account are valid at the same time, more requests are ignored
+type MagicLinkConfig struct {
+	Activate bool
+	URL      string
+	TTL      time.Duration
+	Limit    int
+	// TemplateID and Tag - Postmark only
+	TemplateID int64
+	Tag        string
+}
+
+// SMTPConfig - server of the smtp provider
+//
+// TLS is starttls, tls (implicit) or none
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	TLS      string
+}
+
+// WebAuthnConfig - passkeys for the passwordless login and as second factor
+//
+// RPID is the domain the passkeys are scoped to, Origins are the
+// frontends on it which use them; UserVerification is required,
+// preferred or discouraged
+type WebAuthnConfig struct {
+	Activate         bool
+	RPID             string
+	RPName           string
+	Origins          []string
+	Timeout          time.Duration
+	UserVerification string
+}
+
+// LockoutConfig - throttling of failed logins and 2FA validations
+//
+// the failures of an account and of an IP are counted apart: the
+// first FreeAttempts are free, the next ones delay the next attempt by
+// Delay, doubled up to MaxDelay; from Threshold on, logins are locked
+// for Duration, doubled up to MaxDuration; failures are forgotten
+// Window after the last one
+type LockoutConfig struct {
+	Activate       bool
+	FreeAttempts   int
+	Delay          time.Duration
+	MaxDelay       time.Duration
+	Threshold      int
+	Duration       time.Duration
+	MaxDuration    time.Duration
+	Window         time.Duration
+	IPFreeAttempts int
+	IPThreshold    int
+	// TemplateID and Tag - Postmark only
+	TemplateID int64
+	Tag        string
+}
+
+// SessionConfig - sessions of the logins with JWTs
+//
+// TrackedSince is the time sessions were first tracked, JWTs issued
+// before it are accepted without a session until they expire
+type SessionConfig struct {
+	TrackedSince time.Time
+}
+
+// NotesConfig - features of notes implemented for the RDBMS storage only
+//
+// DeltaSync - sync of offline-first clients
+// KeySharing - public keys of users and end-to-end encrypted notes
+// shared with them
+type NotesConfig struct {
+	DeltaSync  bool
+	KeySharing bool
+}
+
+var configAll *Configuration
+
+// Config reads all settings from the environment
+func Config() {
+	configAll = &Configuration{
+		Cache:      cache(),
+		Avatar:     avatar(),
+		Nickname:   nickname(),
+		Deletion:   deletion(),
+		DataExport: dataExport(),
+		OAuth:      oauth(),
+		OAuth2:     oauth2(),
+		Email:      email(),
+		WebAuthn:   webAuthn(),
+		Lockout:    lockout(),
+		Session:    session(),
+		Notes:      notes(),
+	}
+}
+
+// GetConfig returns all settings
+func GetConfig() *Configuration {
+	return configAll
+}
+
+// cache - CACHE_* variables
+//
+// a TTL below 1 second falls back to the default,
+// Redis refuses to set a key with an expiry of 0
+func cache() CacheConfig {
+	ttl := getEnvInt("CACHE_TTL", 300)
+	if ttl < 1 {
+		ttl = 300
+	}
+	return CacheConfig{
+		TTL:       time.Duration(ttl) * time.Second,
+		LocalSize: getEnvInt("CACHE_LOCAL_SIZE", 10000),
+		LocalTTL:  time.Duration(getEnvInt("CACHE_LOCAL_TTL", 10)) * time.Second,
+	}
+}
+
+// avatar - AVATAR_* variables
+func avatar() AvatarConfig {
+	return AvatarConfig{
+		Dir:    getEnv("AVATAR_DIR", "data/avatars"),
+		MaxAge: time.Duration(getEnvInt("AVATAR_MAX_AGE", 3600)) * time.Second,
+	}
+}
+
+// nickname - NICKNAME_* variables
+func nickname() NicknameConfig {
+	day := 24 * time.Hour
+	return NicknameConfig{
+		ChangeInterval: time.Duration(getEnvInt("NICKNAME_CHANGE_INTERVAL", 30)) * day,
+		Cooldown:       time.Duration(getEnvInt("NICKNAME_COOLDOWN", 90)) * day,
+	}
+}
+
+// deletion - ACCOUNT_DELETION_* variables
+func deletion() DeletionConfig {
+	return DeletionConfig{
+		GracePeriod:   time.Duration(getEnvInt("ACCOUNT_DELETION_GRACE_PERIOD", 30)) * 24 * time.Hour,
+		PurgeInterval: time.Duration(getEnvInt("ACCOUNT_DELETION_PURGE_INTERVAL", 3600)) * time.Second,
+	}
+}
+
+// dataExport - DATA_EXPORT_* variables
+func dataExport() DataExportConfig {
+	return DataExportConfig{
+		Dir: getEnv("DATA_EXPORT_DIR", "data/exports"),
+		TTL: time.Duration(getEnvInt("DATA_EXPORT_TTL", 24)) * time.Hour,
+	}
+}
+
+// oauth - OAUTH_* variables
+//
+// OAUTH_PROVIDERS lists the names of the providers, each of them
+// is configured with OAUTH_<NAME>_* variables, providers without
+// client ID are skipped
+func oauth() OAuthConfig {
+	configureOAuth := OAuthConfig{
+		RedirectURL: strings.TrimSuffix(getEnv("OAUTH_REDIRECT_URL", "http://localhost:8999/api/v1/oauth"), "/"),
+		StateTTL:    time.Duration(getEnvInt("OAUTH_STATE_TTL", 600)) * time.Second,
+	}
+
+	for _, name := range strings.Split(os.Getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+
+		// google and github need no more than the credentials
+		providerType, issuer := "oidc", ""
+		switch name {
+		case "google":
+			issuer = "https://accounts.google.com"
+		case "github":
+			providerType = "github"
+		}
+
+		provider := OAuthProviderConfig{
+			Name:         name,
+			Type:         getEnv(prefix+"TYPE", providerType),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Issuer:       getEnv(prefix+"ISSUER", issuer),
+			AuthURL:      getEnv(prefix+"AUTH_URL", ""),
+			TokenURL:     getEnv(prefix+"TOKEN_URL", ""),
+			UserInfoURL:  getEnv(prefix+"USERINFO_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "")),
+		}
+		if provider.ClientID == "" {
+			continue
+		}
+		configureOAuth.Providers = append(configureOAuth.Providers, provider)
+	}
+	return configureOAuth
+}
+
+// oauth2 - ACTIVATE_OAUTH2_SERVER and OAUTH2_* variables
+func oauth2() OAuth2Config {
+	return OAuth2Config{
+		Activate:        getEnv("ACTIVATE_OAUTH2_SERVER", "no") == "yes",
+		CodeTTL:         time.Duration(getEnvInt("OAUTH2_CODE_TTL", 600)) * time.Second,
+		AccessTokenTTL:  time.Duration(getEnvInt("OAUTH2_ACCESS_TOKEN_TTL", 3600)) * time.Second,
+		RefreshTokenTTL: time.Duration(getEnvInt("OAUTH2_REFRESH_TOKEN_TTL", 30)) * 24 * time.Hour,
+	}
+}
+
+// email - ACTIVATE_EMAIL_SERVICE, EMAIL_SERVICE_PROVIDER,
+// VERIFY_EMAIL and RECOVER_PASSWORD variables
+func email() EmailConfig {
+	return EmailConfig{
+		Activate:        getEnv("ACTIVATE_EMAIL_SERVICE", "no") == "yes",
+		Provider:        strings.ToLower(getEnv("EMAIL_SERVICE_PROVIDER", "postmark")),
+		VerifyEmail:     getEnv("VERIFY_EMAIL", "no") == "yes",
+		RecoverPassword: getEnv("RECOVER_PASSWORD", "no") == "yes",
+		SMTP: SMTPConfig{
+			Host:     getEnv("EMAIL_SMTP_HOST", "localhost"),
+			Port:     getEnvInt("EMAIL_SMTP_PORT", 587),
+			Username: getEnv("EMAIL_SMTP_USERNAME", ""),
+			Password: getEnv("EMAIL_SMTP_PASSWORD", ""),
+			TLS:      strings.ToLower(getEnv("EMAIL_SMTP_TLS", "starttls")),
+		},
+		FileDir:       getEnv("EMAIL_FILE_DIR", "data/emails"),
+		TemplateDir:   getEnv("EMAIL_TEMPLATE_DIR", "templates/email"),
+		QueueSize:     getEnvInt("EMAIL_QUEUE_SIZE", 1000),
+		RetryAttempts: getEnvInt("EMAIL_RETRY_ATTEMPTS", 5),
+		RetryDelay:    time.Duration(getEnvInt("EMAIL_RETRY_DELAY", 30)) * time.Second,
+		MagicLink: MagicLinkConfig{
+			Activate:   getEnv("MAGIC_LINK", "no") == "yes",
+			URL:        getEnv("MAGIC_LINK_URL", ""),
+			TTL:        time.Duration(getEnvInt("MAGIC_LINK_VALIDITY_PERIOD", 600)) * time.Second,
+			Limit:      getEnvInt("MAGIC_LINK_LIMIT", 3),
+			TemplateID: int64(getEnvInt("EMAIL_MAGIC_LINK_TEMPLATE_ID", 0)),
+			Tag:        getEnv("EMAIL_MAGIC_LINK_TAG", "magicLink"),
+		},
+		InvitationTemplateID: int64(getEnvInt("EMAIL_WORKSPACE_INVITATION_TEMPLATE_ID", 0)),
+		InvitationTag:        getEnv("EMAIL_WORKSPACE_INVITATION_TAG", "workspaceInvitation"),
+	}
+}
+
+// webAuthn - WEBAUTHN and WEBAUTHN_* variables
+func webAuthn() WebAuthnConfig {
+	origins := []string{}
+	for _, origin := range strings.Split(getEnv("WEBAUTHN_ORIGINS", "http://localhost:3000"), ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return WebAuthnConfig{
+		Activate:         getEnv("WEBAUTHN", "no") == "yes",
+		RPID:             getEnv("WEBAUTHN_RP_ID", "localhost"),
+		RPName:           getEnv("WEBAUTHN_RP_NAME", getEnv("APP_NAME", "apidev")),
+		Origins:          origins,
+		Timeout:          time.Duration(getEnvInt("WEBAUTHN_TIMEOUT", 300)) * time.Second,
+		UserVerification: strings.ToLower(getEnv("WEBAUTHN_USER_VERIFICATION", "preferred")),
+	}
+}
+
+// lockout - LOCKOUT and LOCKOUT_* variables
+func lockout() LockoutConfig {
+	return LockoutConfig{
+		Activate:       getEnv("LOCKOUT", "yes") == "yes",
+		FreeAttempts:   getEnvInt("LOCKOUT_FREE_ATTEMPTS", 3),
+		Delay:          time.Duration(getEnvInt("LOCKOUT_DELAY", 1)) * time.Second,
+		MaxDelay:       time.Duration(getEnvInt("LOCKOUT_MAX_DELAY", 60)) * time.Second,
+		Threshold:      getEnvInt("LOCKOUT_THRESHOLD", 10),
+		Duration:       time.Duration(getEnvInt("LOCKOUT_DURATION", 900)) * time.Second,
+		MaxDuration:    time.Duration(getEnvInt("LOCKOUT_MAX_DURATION", 86400)) * time.Second,
+		Window:         time.Duration(getEnvInt("LOCKOUT_WINDOW", 86400)) * time.Second,
+		IPFreeAttempts: getEnvInt("LOCKOUT_IP_FREE_ATTEMPTS", 20),
+		IPThreshold:    getEnvInt("LOCKOUT_IP_THRESHOLD", 100),
+		TemplateID:     int64(getEnvInt("EMAIL_ACCOUNT_LOCKED_TEMPLATE_ID", 0)),
+		Tag:            getEnv("EMAIL_ACCOUNT_LOCKED_TAG", "accountLocked"),
+	}
+}
+
+// notes - DELTA_SYNC and E2EE_KEY_SHARING variables
+func notes() NotesConfig {
+	return NotesConfig{
+		DeltaSync:  getEnv("DELTA_SYNC", "yes") == "yes",
+		KeySharing: getEnv("E2EE_KEY_SHARING", "yes") == "yes",
+	}
+}
+
+// session - SESSION_* variables
+func session() SessionConfig {
+	return SessionConfig{
+		TrackedSince: getEnvTime("SESSION_TRACKING_SINCE"),
+	}
+}
+
+// getEnv returns a variable or def when it is empty
+func getEnv(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvInt returns an integer variable or def when it is empty or invalid
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvTime returns an RFC 3339 time variable or zero when it is empty
+// or invalid
+func getEnvTime(key string) time.Time {
+	value, err := time.Parse(time.RFC3339, strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return time.Time{}
+	}
+	return value
+}
@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gmodel "github.com/pilinux/gorest/database/model"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/handler"
+)
+
+// DeleteAccount - DELETE /users
+// schedule the deletion of the account of the logged-in user
+// - after ACCOUNT_DELETION_GRACE_PERIOD days the profile, all notes,
+// keys and credentials are deleted permanently and all issued
+// tokens are rejected
+// - until then the deletion can be canceled with POST /users/restore
+func DeleteAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.DeleteAccount(userIDAuth, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// RestoreAccount - POST /users/restore
+// cancel the scheduled deletion of the account
+func RestoreAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.RestoreAccount(userIDAuth, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// RevokedJWTChecker rejects the tokens of purged, logged out and suspended accounts
+// and of revoked sessions, must be used after gmiddleware.JWT or gmiddleware.RefreshJWT
+//
+// gorest keeps the jti of a token in the context but not its issue
+// time, it is read from the claims of the raw token of the request
+func RevokedJWTChecker() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokens := []struct{ jti, raw string }{
+			{c.GetString("jtiAccess"), requestJWT(c, "accessJWT")},
+			{c.GetString("jtiRefresh"), requestJWT(c, "refreshJWT")},
+		}
+
+		// the oldest token decides, an unknown issue time counts as
+		// older than any revocation
+		issuedAt := time.Now()
+		issued := make([]time.Time, len(tokens))
+		for i, token := range tokens {
+			if token.jti == "" {
+				continue
+			}
+			issued[i] = handler.JWTIssuedAt(token.raw, token.jti)
+			if issued[i].Before(issuedAt) {
+				issuedAt = issued[i]
+			}
+		}
+
+		resp, statusCode := handler.CheckRevokedJWT(c.GetUint64("authID"), issuedAt)
+		if statusCode != http.StatusOK {
+			c.AbortWithStatusJSON(statusCode, resp)
+			return
+		}
+
+		// revoked sessions, without relying on the Redis blacklist of gorest
+		for i, token := range tokens {
+			resp, statusCode := handler.CheckSession(token.jti, issued[i])
+			if statusCode != http.StatusOK {
+				c.AbortWithStatusJSON(statusCode, resp)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// KeepBody keeps a copy of the request body for the handlers after
+// the next middleware which consumes it, e.g. the refresh token read
+// by gmiddleware.RefreshJWT for RevokedJWTChecker
+func KeepBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Set(gin.BodyBytesKey, body)
+		c.Next()
+	}
+}
+
+// requestJWT returns a raw JWT of the request from where gorest reads
+// it: the cookie, else the bearer token for the access token or the
+// body kept by KeepBody for the refresh token
+func requestJWT(c *gin.Context, name string) string {
+	if value, err := c.Cookie(name); err == nil && value != "" {
+		return value
+	}
+
+	if name == "accessJWT" {
+		value := c.GetHeader("Authorization")
+		if !strings.HasPrefix(value, "Bearer ") {
+			return ""
+		}
+		return strings.TrimSpace(strings.TrimPrefix(value, "Bearer "))
+	}
+
+	payload := gmodel.JWTPayload{}
+	if body, ok := c.Get(gin.BodyBytesKey); ok {
+		if data, ok := body.([]byte); ok {
+			_ = json.Unmarshal(data, &payload)
+		}
+	}
+	return payload.RefreshJWT
+}
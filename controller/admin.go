@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+	"apidev/lib/rbac"
+)
+
+// RequirePermission rejects users without a role granting the permission,
+// must be used after gmiddleware.JWT
+func RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		resp, statusCode := handler.CheckPermission(c.GetUint64("authID"), permission)
+		if statusCode != http.StatusOK {
+			c.AbortWithStatusJSON(statusCode, resp)
+			return
+		}
+		c.Next()
+	}
+}
+
+// SearchUsers - GET /admin/users
+// profiles of all users ordered by ID, requires users.read
+//
+// filters:
+// - nickName: part of the nickname, case is ignored
+// - after: nextAfterID of the previous page
+// - limit: page size, default 50
+func SearchUsers(c *gin.Context) {
+	resp, statusCode := handler.SearchUsers(c.Request.URL.Query())
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetAccount - GET /admin/users/:authID
+// profile, roles and suspension of an account, requires users.read
+func GetAccount(c *gin.Context) {
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+
+	resp, statusCode := handler.GetAccount(id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// SuspendAccount - POST /admin/users/:authID/suspend
+// reject all tokens of an account, requires users.suspend
+// =================================
+//
+//	{
+//	   "reason": "reason_shown_to_administrators"
+//	}
+//
+// =================================
+func SuspendAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+	suspension := model.AuthSuspension{}
+
+	// bind JSON, the reason is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&suspension); err != nil {
+			grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, statusCode := handler.SuspendAccount(userIDAuth, id, suspension, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// UnsuspendAccount - DELETE /admin/users/:authID/suspend
+// lift the suspension of an account, requires users.suspend
+func UnsuspendAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+
+	resp, statusCode := handler.UnsuspendAccount(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// LogoutAccount - POST /admin/users/:authID/logout
+// reject all JWTs issued so far and delete the access tokens,
+// requires users.logout
+func LogoutAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+
+	resp, statusCode := handler.LogoutAccount(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetRoleGrants - GET /admin/roles
+// accounts with a role, requires roles.manage
+//
+// GET /admin/roles?role=admin returns the grants of one role
+func GetRoleGrants(c *gin.Context) {
+	role := strings.TrimSpace(c.Query("role"))
+
+	resp, statusCode := handler.GetRoleGrants(role)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GrantRole - PUT /admin/users/:authID/roles/:role
+// grant a role to an account, requires roles.manage
+//
+// role is one of admin, moderator or support
+func GrantRole(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+	role := strings.TrimSpace(c.Params.ByName("role"))
+
+	resp, statusCode := handler.GrantRole(userIDAuth, id, role, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// RevokeRole - DELETE /admin/users/:authID/roles/:role
+// revoke a role from an account, requires roles.manage
+func RevokeRole(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+	role := strings.TrimSpace(c.Params.ByName("role"))
+
+	resp, statusCode := handler.RevokeRole(userIDAuth, id, role, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// ModerateNote - DELETE /admin/notes/:id
+// soft delete a note of any user, requires content.moderate
+func ModerateNote(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.ModerateNote(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetAuditEvents - GET /audit
+// changes made by the authorized user to their profile and notes,
+// newest first
+//
+// filters:
+// - action=note.update, resourceType=note, resourceID=5
+// - since, until: RFC 3339 timestamps
+// - before: nextBeforeID of the previous page
+// - limit: page size, default 50
+func GetAuditEvents(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetAuditEvents(userIDAuth, c.Request.URL.Query())
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetAllAuditEvents - GET /audit/all
+// changes made by all users, requires the audit.read permission
+//
+// accepts the filters of GetAuditEvents and actor=<authID>
+func GetAllAuditEvents(c *gin.Context) {
+	resp, statusCode := handler.GetAllAuditEvents(c.Request.URL.Query())
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// clientInfo returns the IP address and user agent of the client
+//
+// the IP address is resolved by gin, see TRUSTED_PLATFORM
+func clientInfo(c *gin.Context) model.ClientInfo {
+	return model.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
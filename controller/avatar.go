@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/handler"
+	"apidev/lib/avatar"
+)
+
+// UpdateAvatar - PUT /users/avatar
+// upload a profile picture as multipart/form-data, field avatar
+// - PNG, JPEG or GIF, at most 5 MiB
+// - cropped to a square and resized to 64, 128, 256 and 512 px
+func UpdateAvatar(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	// room for the multipart headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, avatar.MaxUploadSize+64<<10)
+	file, _, err := c.Request.FormFile("avatar")
+	if err != nil {
+		grenderer.Render(c, gin.H{"message": "avatar file is required, at most 5 MiB"}, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	resp, statusCode := handler.UpdateAvatar(userIDAuth, file, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteAvatar - DELETE /users/avatar
+// remove the profile picture
+func DeleteAvatar(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.DeleteAvatar(userIDAuth, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetAvatar - GET /avatars/:userID?size=128&v=<version>
+// serve the profile picture of a user, public so it can be used in img tags
+// - size is one of 64, 128 (default), 256, 512
+// - avatarURL of the profile includes v, such URLs are cached for a year,
+// others for AVATAR_MAX_AGE
+// - supports conditional requests with If-None-Match
+func GetAvatar(c *gin.Context) {
+	id := strings.TrimSpace(c.Params.ByName("userID"))
+	size := strings.TrimSpace(c.Query("size"))
+	version := strings.TrimSpace(c.Query("v"))
+
+	resp, statusCode := handler.GetAvatar(id, size, version)
+
+	img, ok := resp.Message.(model.AvatarImage)
+	if !ok {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	cacheControl := "public, max-age=" + strconv.Itoa(int(config.GetConfig().Avatar.MaxAge.Seconds()))
+	if img.Immutable {
+		cacheControl = "public, max-age=31536000, immutable"
+	}
+	c.Header("Cache-Control", cacheControl)
+	c.Header("Content-Type", img.ContentType)
+	c.Header("ETag", img.ETag)
+
+	// answers conditional requests with 304 Not Modified
+	http.ServeContent(c.Writer, c.Request, "", img.ModTime, bytes.NewReader(img.Data))
+}
@@ -0,0 +1,16 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/handler"
+)
+
+// GetCacheStats - GET /cache/stats
+// hit and miss counters of the read-through caches, requires system.read
+func GetCacheStats(c *gin.Context) {
+	resp, statusCode := handler.GetCacheStats()
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetUserKeys - GET /keys
+// list all public keys of the logged-in user
+func GetUserKeys(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetUserKeys(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetPublicKeys - GET /keys/users/:userID
+// list all public keys of another user to share
+// end-to-end encrypted notes with him
+func GetPublicKeys(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	userID := strings.TrimSpace(c.Params.ByName("userID"))
+
+	resp, statusCode := handler.GetPublicKeys(userIDAuth, userID)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// AddUserKey - POST /keys
+// the private key never leaves the client
+// ===========================================
+//
+//	{
+//	   "algorithm": "X25519",
+//	   "publicKey": "base64_encoded_public_key"
+//	}
+//
+// ===========================================
+func AddUserKey(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	key := model.UserKey{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&key); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.AddUserKey(userIDAuth, key)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteUserKey - DELETE /keys/:id
+// all note keys wrapped with this public key are deleted as well
+func DeleteUserKey(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DeleteUserKey(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetNoteKeys - GET /notes/:id/keys
+// wrapped content keys of an end-to-end encrypted note
+func GetNoteKeys(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetNoteKeys(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// AddNoteKey - POST /notes/:id/keys
+// share an end-to-end encrypted note with another user
+// ===============================================
+//
+//	{
+//	   "userID": 2,
+//	   "keyID": 5,
+//	   "algorithm": "X25519",
+//	   "wrappedKey": "base64_encoded_wrapped_key"
+//	}
+//
+// ===============================================
+func AddNoteKey(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	noteKey := model.NoteKey{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&noteKey); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.AddNoteKey(userIDAuth, id, noteKey)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteNoteKey - DELETE /notes/:id/keys/:noteKeyID
+// revoke a share of an end-to-end encrypted note
+func DeleteNoteKey(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	noteKeyID := strings.TrimSpace(c.Params.ByName("noteKeyID"))
+
+	resp, statusCode := handler.DeleteNoteKey(userIDAuth, id, noteKeyID)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetSharedNotes - GET /notes/shared
+// end-to-end encrypted notes other users shared with the logged-in user
+func GetSharedNotes(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetSharedNotes(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetSharedNote - GET /notes/shared/:id
+// fetch an end-to-end encrypted note shared with the logged-in user
+func GetSharedNote(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetSharedNote(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
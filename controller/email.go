@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	gmodel "github.com/pilinux/gorest/database/model"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// VerifyEmail - POST /verify
+// verify the email of an account with the code sent to it
+// =================================
+//
+//	{
+//	   "code": "code of the verification email"
+//	}
+//
+// =================================
+func VerifyEmail(c *gin.Context) {
+	payload := model.EmailCode{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.VerifyEmail(payload, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// ResendVerificationEmail - POST /resend-verification-email
+// send a new verification code to an unverified account
+// =================================
+//
+//	{
+//	   "email": "user@example.com"
+//	}
+//
+// =================================
+func ResendVerificationEmail(c *gin.Context) {
+	payload := model.EmailRequest{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.ResendVerificationEmail(payload)
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// ForgotPassword - POST /password/forgot
+// send a recovery code to the email of an account
+// =================================
+//
+//	{
+//	   "email": "user@example.com"
+//	}
+//
+// =================================
+func ForgotPassword(c *gin.Context) {
+	payload := model.EmailRequest{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.ForgotPassword(payload)
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// ResetPassword - POST /password/reset
+// set a new password with the recovery code, all logins end
+// =================================
+//
+//	{
+//	   "code": "code of the recovery email",
+//	   "password": "new password"
+//	}
+//
+// =================================
+func ResetPassword(c *gin.Context) {
+	payload := model.PasswordReset{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.ResetPassword(payload, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// StartEmailVerification sends a verification code to the email of an
+// account created by the wrapped gorest controller
+func StartEmailVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		writer := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if writer.Status() != http.StatusCreated && writer.Status() != http.StatusOK {
+			return
+		}
+
+		auth := struct {
+			AuthID uint64 `json:"authID"`
+		}{}
+		payload := gmodel.AuthPayload{}
+		_ = json.Unmarshal(writer.body.Bytes(), &auth)
+		_ = json.Unmarshal(body, &payload)
+		if auth.AuthID == 0 || payload.Email == "" {
+			return
+		}
+		handler.StartEmailVerification(auth.AuthID, payload.Email)
+	}
+}
+
+// RequireVerifiedEmail rejects a login by the wrapped gorest controller
+// to an account whose email is not verified yet, the response with the
+// JWTs is held back until the account is checked
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &responseBuffer{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() == http.StatusOK {
+			payload := issuedJWTs(writer.Header(), writer.body.Bytes())
+			resp, statusCode := handler.CheckVerifiedLogin(payload)
+			if statusCode != http.StatusOK {
+				// drop the cookies with the JWTs
+				c.Writer.Header().Del("Set-Cookie")
+				grenderer.Render(c, resp, statusCode)
+				return
+			}
+		}
+		_, _ = c.Writer.Write(writer.body.Bytes())
+	}
+}
+
+// responseRecorder keeps a copy of the body written by the next handlers
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes the data to the connection and to the copy
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes the string to the connection and to the copy
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetDataExports - GET /users/data-export
+// data exports requested by the logged-in user, newest first
+func GetDataExports(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetDataExports(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CreateDataExport - POST /users/data-export
+// request an archive of all data held about the logged-in user
+// - the archive is built in the background, poll
+// GET /users/data-export/:id until the status is ready
+// - ZIP of JSON files: auth, twoFA, profile, settings, notes, workspaces, auditEvents
+// - one export at a time, every request is recorded in the audit log
+func CreateDataExport(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.CreateDataExport(userIDAuth, c.GetString("email"), clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetDataExport - GET /users/data-export/:id
+// status of a data export: pending, ready or failed
+// - downloadURL is set once the export is ready
+func GetDataExport(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetDataExport(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DownloadDataExport - GET /users/data-export/:id/download
+// download the archive of a ready data export
+// - available for DATA_EXPORT_TTL hours, afterwards 410 Gone
+func DownloadDataExport(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DownloadDataExport(userIDAuth, id, clientInfo(c))
+
+	archive, ok := resp.Message.(model.DataExportArchive)
+	if !ok {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	// personal data must not be kept by shared caches
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Disposition", `attachment; filename="`+archive.FileName+`"`)
+	c.Data(statusCode, archive.ContentType, archive.Data)
+}
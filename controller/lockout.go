@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gmodel "github.com/pilinux/gorest/database/model"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/handler"
+)
+
+// ThrottleLogin rejects a login by the wrapped gorest controller while
+// the account or the IP is delayed or locked after failed logins; the
+// login is counted as failed before it is made and settled after it
+func ThrottleLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		payload := gmodel.AuthPayload{}
+		_ = json.Unmarshal(body, &payload)
+
+		attempt, retryAfter, resp, statusCode := handler.CheckLoginAttempt(payload.Email, clientInfo(c))
+		if statusCode != http.StatusOK {
+			renderThrottled(c, retryAfter, resp, statusCode)
+			return
+		}
+
+		c.Next()
+
+		handler.FinishLoginAttempt(attempt, c.Writer.Status(), clientInfo(c))
+	}
+}
+
+// ThrottleTwoFA rejects a validation of the second factor by the wrapped
+// controller (TOTP of gorest or passkey) while the account or the IP is
+// delayed or locked after failed validations; the validation is counted
+// as failed before it is made and settled after it
+func ThrottleTwoFA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDAuth := c.GetUint64("authID")
+
+		attempt, retryAfter, resp, statusCode := handler.CheckTwoFAAttempt(userIDAuth, clientInfo(c))
+		if statusCode != http.StatusOK {
+			renderThrottled(c, retryAfter, resp, statusCode)
+			return
+		}
+
+		c.Next()
+
+		handler.FinishLoginAttempt(attempt, c.Writer.Status(), clientInfo(c))
+	}
+}
+
+// UnlockAccount - DELETE /admin/users/:authID/lockout
+// lift the lockout of an account after failed logins, requires users.suspend
+func UnlockAccount(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("authID"))
+
+	resp, statusCode := handler.UnlockAccount(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// UnlockIP - DELETE /admin/ips/:ip/lockout
+// lift the lockout of an IP after failed logins, requires users.suspend
+func UnlockIP(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	ip := strings.TrimSpace(c.Params.ByName("ip"))
+
+	resp, statusCode := handler.UnlockIP(userIDAuth, ip)
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// renderThrottled aborts a rejected attempt with the seconds to wait
+// in the Retry-After header
+func renderThrottled(c *gin.Context, retryAfter time.Duration, resp gmodel.HTTPResponse, statusCode int) {
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	grenderer.Render(c, resp, statusCode)
+	c.Abort()
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// RequestMagicLink - POST /login/magic-link
+// email a link to log in without the password
+// =================================
+//
+//	{
+//	   "email": "user@example.com",
+//	   "device": "optional random key kept by the client"
+//	}
+//
+// =================================
+func RequestMagicLink(c *gin.Context) {
+	payload := model.MagicLinkRequest{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.RequestMagicLink(payload)
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// MagicLinkLogin - POST /login/magic-link/verify
+// log in with the code of a magic link, returns the JWTs like POST /login
+// =================================
+//
+//	{
+//	   "code": "code of the magic link",
+//	   "device": "key given with the request of the link"
+//	}
+//
+// =================================
+func MagicLinkLogin(c *gin.Context) {
+	payload := model.MagicLinkLogin{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.MagicLinkLogin(payload, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
@@ -15,10 +15,25 @@ import (
 // GetNotes - GET /notes
 // no note is in public mode
 // only an authorized user can access his notes
+//
+// location filters:
+// - GET /notes?near=lat,lng&radius=km notes within the radius (default 10 km),
+// ordered by distance, each note includes its distance in km
+// - GET /notes?bbox=minLng,minLat,maxLng,maxLat notes inside the box
+//
+// GET /notes?sort=position returns the notes in manual order
+//
+// GET /notes?workspace=id returns the notes of a workspace
+// the user is a member of, the filters above apply as well
 func GetNotes(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
+	workspace := strings.TrimSpace(c.Query("workspace"))
+	near := strings.TrimSpace(c.Query("near"))
+	radius := strings.TrimSpace(c.Query("radius"))
+	bbox := strings.TrimSpace(c.Query("bbox"))
+	sort := strings.TrimSpace(c.Query("sort"))
 
-	resp, statusCode := handler.GetNotes(userIDAuth)
+	resp, statusCode := handler.GetNotes(userIDAuth, workspace, near, radius, bbox, sort)
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -32,11 +47,15 @@ func GetNotes(c *gin.Context) {
 // fetch a note by its ID
 // no note is in public mode
 // only an authorized user can access his notes
+//
+// GET /notes/:id?as=markdown converts the body to text,
+// markdown, html or json and reports lossy conversions
 func GetNote(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
 	id := strings.TrimSpace(c.Params.ByName("id"))
+	as := strings.TrimSpace(c.Query("as"))
 
-	resp, statusCode := handler.GetNote(userIDAuth, id)
+	resp, statusCode := handler.GetNote(userIDAuth, id, as)
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -56,6 +75,56 @@ func GetNote(c *gin.Context) {
 //	}
 //
 // =================================
+//
+// location, captured on site
+// =================================
+//
+//	{
+//	   "title": "title_of_the_note",
+//	   "body": "body_of_the_note",
+//	   "latitude": 52.520008,
+//	   "longitude": 13.404954,
+//	   "accuracy": 15,
+//	   "placeName": "Alexanderplatz"
+//	}
+//
+// =================================
+//
+// rich content, contentType is one of text (default),
+// markdown, html (sanitized) or json (rich-text document)
+// =================================
+//
+//	{
+//	   "title": "title_of_the_note",
+//	   "contentType": "json",
+//	   "body": "{\"type\":\"doc\",\"content\":[{\"type\":\"paragraph\",\"content\":[{\"type\":\"text\",\"text\":\"hello\"}]}]}"
+//	}
+//
+// =================================
+//
+// end-to-end encrypted note, encrypted on the client
+// =================================
+//
+//	{
+//	   "e2ee": true,
+//	   "ciphertext": "base64_encoded_ciphertext",
+//	   "algorithm": "AES-256-GCM",
+//	   "keyID": "client_side_key_id",
+//	   "nonce": "base64_encoded_nonce"
+//	}
+//
+// =================================
+//
+// note of a workspace, requires the editor role
+// =================================
+//
+//	{
+//	   "workspaceID": 1,
+//	   "title": "title_of_the_note",
+//	   "body": "body_of_the_note"
+//	}
+//
+// =================================
 func CreateNote(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
 	note := model.Note{}
@@ -66,7 +135,7 @@ func CreateNote(c *gin.Context) {
 		return
 	}
 
-	resp, statusCode := handler.CreateNote(userIDAuth, note)
+	resp, statusCode := handler.CreateNote(userIDAuth, note, clientInfo(c))
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -97,7 +166,7 @@ func UpdateNote(c *gin.Context) {
 		return
 	}
 
-	resp, statusCode := handler.UpdateNote(userIDAuth, id, note)
+	resp, statusCode := handler.UpdateNote(userIDAuth, id, note, clientInfo(c))
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -114,7 +183,7 @@ func DeleteNote(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
 	id := strings.TrimSpace(c.Params.ByName("id"))
 
-	resp, statusCode := handler.DeleteNote(userIDAuth, id)
+	resp, statusCode := handler.DeleteNote(userIDAuth, id, clientInfo(c))
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -123,3 +192,36 @@ func DeleteNote(c *gin.Context) {
 
 	grenderer.Render(c, resp, statusCode)
 }
+
+// MoveNote - POST /notes/:id/move
+// place a note in the manual order (GET /notes?sort=position)
+// - before: ID of the note which follows the moved note
+// - after: ID of the note which precedes the moved note
+// =====================================
+//
+//	{
+//	   "after": 12,
+//	   "before": 7
+//	}
+//
+// =====================================
+func MoveNote(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	move := model.NoteMove{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&move); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.MoveNote(userIDAuth, id, move, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
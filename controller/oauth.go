@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetOAuthProviders - GET /oauth/providers
+// names of the providers of the social login
+func GetOAuthProviders(c *gin.Context) {
+	resp, statusCode := handler.GetOAuthProviders()
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// OAuthLogin - GET /oauth/:provider/login
+// redirect the browser to the provider to sign in
+//
+// the provider redirects back to GET /oauth/:provider/callback
+func OAuthLogin(c *gin.Context) {
+	name := strings.TrimSpace(c.Params.ByName("provider"))
+
+	resp, statusCode := handler.StartOAuthLogin(0, name)
+
+	if login, ok := resp.Message.(model.OAuthLogin); ok {
+		c.Redirect(http.StatusFound, login.URL)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// OAuthCallback - GET /oauth/:provider/callback
+// complete a login started with GET /oauth/:provider/login
+// or POST /oauth/:provider/link
+//
+// a login returns the JWTs like POST /login, a link the linked identity
+func OAuthCallback(c *gin.Context) {
+	name := strings.TrimSpace(c.Params.ByName("provider"))
+
+	resp, statusCode := handler.OAuthCallback(name, c.Request.URL.Query(), clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// LinkOAuthProvider - POST /oauth/:provider/link
+// URL of the provider to link to the account of the logged-in user,
+// the browser must be sent there
+//
+//	{
+//	   "url": "https://provider/authorize?..."
+//	}
+func LinkOAuthProvider(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	name := strings.TrimSpace(c.Params.ByName("provider"))
+
+	resp, statusCode := handler.StartOAuthLogin(userIDAuth, name)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetOAuthIdentities - GET /oauth/identities
+// providers linked to the account of the logged-in user
+func GetOAuthIdentities(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetOAuthIdentities(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteOAuthIdentity - DELETE /oauth/identities/:provider
+// unlink a provider from the account of the logged-in user
+func DeleteOAuthIdentity(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	name := strings.TrimSpace(c.Params.ByName("provider"))
+
+	resp, statusCode := handler.DeleteOAuthIdentity(userIDAuth, name, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
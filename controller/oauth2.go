@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetOAuthClients - GET /oauth2/clients
+// OAuth2 clients registered by the logged-in user, without their secrets
+func GetOAuthClients(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetOAuthClients(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CreateOAuthClient - POST /oauth2/clients
+// register a third-party application, the secret is shown only once
+// =================================
+//
+//	{
+//	   "name": "Notes Sync",
+//	   "redirectURIs": ["https://app.example.com/callback"],
+//	   "confidential": true
+//	}
+//
+// =================================
+//
+// confidential clients run on a server and keep a secret,
+// public clients (browser and native apps) get none
+func CreateOAuthClient(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	oauthClient := model.OAuthClient{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&oauthClient); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.CreateOAuthClient(userIDAuth, oauthClient, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteOAuthClient - DELETE /oauth2/clients/:clientID
+// delete an OAuth2 client and revoke all tokens issued to it
+func DeleteOAuthClient(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	clientID := strings.TrimSpace(c.Params.ByName("clientID"))
+
+	resp, statusCode := handler.DeleteOAuthClient(userIDAuth, clientID, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// Authorize - GET /oauth2/authorize
+// authorization request of a client, RFC 6749 section 4.1.1
+//
+// shows the consent screen templates/oauth2-consent.html if views are
+// activated, otherwise returns the request for a frontend to show;
+// the decision is sent to POST /oauth2/authorize
+//
+// browsers reach this route with the JWT in a cookie
+func Authorize(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.StartAuthorization(userIDAuth, c.Request.URL.Query())
+
+	if redirect, ok := resp.Message.(model.OAuthRedirect); ok {
+		c.Redirect(http.StatusFound, redirect.URL)
+		return
+	}
+	if consent, ok := resp.Message.(model.OAuthConsent); ok {
+		if gconfig.GetConfig().ViewConfig.Activate == gconfig.Activated {
+			// the consent screen must not be framed by other sites
+			c.Header("X-Frame-Options", "DENY")
+			c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+			grenderer.Render(c, gin.H{
+				"consent":     consent.Consent,
+				"clientName":  consent.ClientName,
+				"redirectURI": consent.RedirectURI,
+				"scopes":      consent.Scopes,
+			}, statusCode, "oauth2-consent.html")
+			return
+		}
+		grenderer.Render(c, consent, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// Consent - POST /oauth2/authorize
+// decision of the logged-in user on an authorization request
+// =================================
+//
+//	{
+//	   "consent": "consent of GET /oauth2/authorize",
+//	   "approve": true
+//	}
+//
+// =================================
+//
+// a form submitted by the consent screen is redirected to the client,
+// a JSON request gets the URL to send the browser to
+func Consent(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	decision := model.OAuthDecision{}
+
+	// bind JSON or form
+	if err := c.ShouldBind(&decision); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.CompleteAuthorization(userIDAuth, decision, clientInfo(c))
+
+	if redirect, ok := resp.Message.(model.OAuthRedirect); ok {
+		if c.ContentType() == gin.MIMEPOSTForm {
+			c.Redirect(http.StatusFound, redirect.URL)
+			return
+		}
+		grenderer.Render(c, redirect, http.StatusOK)
+		return
+	}
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetOAuthAuthorizations - GET /oauth2/authorizations
+// clients the logged-in user has granted access to
+func GetOAuthAuthorizations(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetOAuthAuthorizations(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteOAuthAuthorization - DELETE /oauth2/authorizations/:clientID
+// revoke the access of a client to the account of the logged-in user
+func DeleteOAuthAuthorization(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	clientID := strings.TrimSpace(c.Params.ByName("clientID"))
+
+	resp, statusCode := handler.DeleteOAuthAuthorization(userIDAuth, clientID, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// OAuthToken - POST /oauth2/token
+// token endpoint, RFC 6749 section 3.2
+//
+// form encoded, grant_type authorization_code or refresh_token,
+// the client authenticates with HTTP Basic or client_id and client_secret
+func OAuthToken(c *gin.Context) {
+	clientID, clientSecret := oauthClientCredentials(c)
+
+	resp, statusCode := handler.IssueOAuthTokens(c.Request.PostForm, clientID, clientSecret)
+
+	renderOAuth(c, resp, statusCode)
+}
+
+// RevokeOAuthToken - POST /oauth2/revoke
+// token revocation, RFC 7009
+func RevokeOAuthToken(c *gin.Context) {
+	clientID, clientSecret := oauthClientCredentials(c)
+
+	resp, statusCode := handler.RevokeOAuthToken(c.Request.PostForm, clientID, clientSecret)
+
+	renderOAuth(c, resp, statusCode)
+}
+
+// IntrospectOAuthToken - POST /oauth2/introspect
+// token introspection, RFC 7662
+func IntrospectOAuthToken(c *gin.Context) {
+	clientID, clientSecret := oauthClientCredentials(c)
+
+	resp, statusCode := handler.IntrospectOAuthToken(c.Request.PostForm, clientID, clientSecret)
+
+	renderOAuth(c, resp, statusCode)
+}
+
+// oauthClientCredentials parses the form and returns the credentials of
+// the client from HTTP Basic authentication, whose values are form
+// encoded (RFC 6749 section 2.3.1), or from the form
+func oauthClientCredentials(c *gin.Context) (clientID, clientSecret string) {
+	_ = c.Request.ParseForm()
+
+	if username, password, ok := c.Request.BasicAuth(); ok {
+		clientID, _ = url.QueryUnescape(username)
+		clientSecret, _ = url.QueryUnescape(password)
+		return
+	}
+	return c.Request.PostForm.Get("client_id"), c.Request.PostForm.Get("client_secret")
+}
+
+// renderOAuth renders a response of the token, revocation and
+// introspection endpoints, which must not be cached
+func renderOAuth(c *gin.Context, resp gmodel.HTTPResponse, statusCode int) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	if statusCode == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Basic realm="oauth2"`)
+	}
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
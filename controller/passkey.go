@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// BeginPasskeyRegistration - POST /passkeys/register/begin
+// options to pass to navigator.credentials.create
+func BeginPasskeyRegistration(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.BeginPasskeyRegistration(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// FinishPasskeyRegistration - POST /passkeys/register/finish
+// save the passkey created with the options of the registration
+// =================================
+//
+//	{
+//	   "name": "optional name, e.g. laptop",
+//	   "credential": "PublicKeyCredential.toJSON() of the new passkey"
+//	}
+//
+// =================================
+func FinishPasskeyRegistration(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	payload := model.PasskeyRegistration{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.FinishPasskeyRegistration(userIDAuth, payload, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetPasskeys - GET /passkeys
+// passkeys of the logged-in user, oldest first
+func GetPasskeys(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetPasskeys(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeletePasskey - DELETE /passkeys/:id
+// the passkey can no longer be used to log in
+func DeletePasskey(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DeletePasskey(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// BeginPasskeyLogin - POST /login/passkey/begin
+// options to pass to navigator.credentials.get
+func BeginPasskeyLogin(c *gin.Context) {
+	resp, statusCode := handler.BeginPasskeyLogin()
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// FinishPasskeyLogin - POST /login/passkey/finish
+// log in with a passkey, returns the JWTs like POST /login
+// =================================
+//
+//	{
+//	   "credential": "PublicKeyCredential.toJSON() of the assertion"
+//	}
+//
+// =================================
+func FinishPasskeyLogin(c *gin.Context) {
+	payload := model.PasskeyAssertion{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.FinishPasskeyLogin(payload, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// BeginPasskeyTwoFA - POST /2fa/passkey/begin
+// options to pass to navigator.credentials.get,
+// limited to the passkeys of the logged-in user
+func BeginPasskeyTwoFA(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.BeginPasskeyTwoFA(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// ValidatePasskeyTwoFA - POST /2fa/passkey/validate
+// the second factor with a passkey instead of the TOTP,
+// returns the JWTs like POST /2fa/validate
+// =================================
+//
+//	{
+//	   "credential": "PublicKeyCredential.toJSON() of the assertion"
+//	}
+//
+// =================================
+func ValidatePasskeyTwoFA(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	payload := model.PasskeyAssertion{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.ValidatePasskeyTwoFA(userIDAuth, c.GetString("jtiAccess"), payload, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	gmodel "github.com/pilinux/gorest/database/model"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/handler"
+)
+
+// GetSessions - GET /sessions
+// active logins of the logged-in user, newest first,
+// the session of the request is marked as current
+func GetSessions(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetSessions(userIDAuth, c.GetString("jtiAccess"))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteSession - DELETE /sessions/:id
+// revoke a login, its JWTs are rejected from the next request on
+func DeleteSession(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DeleteSession(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// DeleteSessions - DELETE /sessions
+// log out everywhere else, all sessions except the one of the request
+// are revoked
+func DeleteSessions(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.DeleteSessions(userIDAuth, c.GetString("jtiAccess"), clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// TrackSession records the JWTs issued by the wrapped gorest
+// controller (login, refresh, 2FA) in the session of the user
+//
+// the JWTs are read from the response body or from the cookies set by
+// gorest, a pair issued in exchange for the JWTs of the request
+// continues their session; the response is held back until they are
+// recorded and replaced by an error if that fails
+func TrackSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &responseBuffer{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() == http.StatusOK {
+			payload := issuedJWTs(writer.Header(), writer.body.Bytes())
+			err := handler.TrackSession(c.GetString("jtiAccess"), c.GetString("jtiRefresh"), payload, clientInfo(c))
+			if err != nil {
+				// drop the cookies with the JWTs
+				c.Writer.Header().Del("Set-Cookie")
+				grenderer.Render(c, gin.H{"message": "internal server error"}, http.StatusInternalServerError)
+				return
+			}
+		}
+		_, _ = c.Writer.Write(writer.body.Bytes())
+	}
+}
+
+// EndSession revokes the session of a successful logout by the wrapped
+// gorest controller, with or without the Redis blacklist of gorest
+func EndSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.Writer.Status() != http.StatusOK {
+			return
+		}
+		handler.EndSession(c.GetString("jtiAccess"), c.GetString("jtiRefresh"))
+	}
+}
+
+// issuedJWTs returns the JWTs written by a gorest controller
+// to the response body or to the cookies
+func issuedJWTs(header http.Header, body []byte) gmodel.JWTPayload {
+	payload := gmodel.JWTPayload{}
+	_ = json.Unmarshal(body, &payload)
+	for _, cookie := range (&http.Response{Header: header}).Cookies() {
+		switch cookie.Name {
+		case "accessJWT":
+			payload.AccessJWT = cookie.Value
+		case "refreshJWT":
+			payload.RefreshJWT = cookie.Value
+		}
+	}
+	return payload
+}
+
+// responseBuffer holds back the body written by the next handlers,
+// the status and the headers are kept by the wrapped writer
+type responseBuffer struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write writes the data to the buffer
+func (w *responseBuffer) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// WriteString writes the string to the buffer
+func (w *responseBuffer) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
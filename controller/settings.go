@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/handler"
+)
+
+// GetSettingsSchema - GET /users/settings/schema
+// declared settings with their type, default and allowed values
+func GetSettingsSchema(c *gin.Context) {
+	resp, statusCode := handler.GetSettingsSchema()
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetUserSettings - GET /users/settings
+// settings of the logged-in user, merged with the defaults
+func GetUserSettings(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetUserSettings(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// ReplaceUserSettings - PUT /users/settings
+// replace all settings of the logged-in user
+// ===============================
+//
+//	{
+//	   "editor.fontSize": 16,
+//	   "notes.view": "grid"
+//	}
+//
+// ===============================
+//
+// omitted keys fall back to their default, unknown keys and values
+// of the wrong type are rejected
+func ReplaceUserSettings(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	values := map[string]interface{}{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&values); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.ReplaceUserSettings(userIDAuth, values)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// UpdateUserSettings - PATCH /users/settings
+// change some settings of the logged-in user
+// ===============================
+//
+//	{
+//	   "editor.fontSize": null,
+//	   "sidebar.collapsed": true
+//	}
+//
+// ===============================
+//
+// omitted keys are kept, null resets a key to its default
+func UpdateUserSettings(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	values := map[string]interface{}{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&values); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.UpdateUserSettings(userIDAuth, values)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetSync - GET /sync?since=<token>&limit=<n>
+// - without a token, all existing notes are returned
+// - with a token, all notes created, updated and deleted since then
+// - keep calling with the returned syncToken while hasMore is true
+func GetSync(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	since := strings.TrimSpace(c.Query("since"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	resp, statusCode := handler.GetSync(userIDAuth, since, limit)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// PushSync - POST /sync
+// apply a batch of changes recorded by an offline client
+// - changes made on top of an outdated version are reported as conflicts
+// ===================================================
+//
+//	{
+//	   "changes": [
+//	      {"op": "create", "clientRef": "tmp-1", "note": {"title": "new"}},
+//	      {"op": "update", "noteID": 5, "baseVersion": 3, "note": {"title": "edited"}},
+//	      {"op": "delete", "noteID": 6, "baseVersion": 2}
+//	   ]
+//	}
+//
+// ===================================================
+func PushSync(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	push := model.SyncPush{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&push); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.PushSync(userIDAuth, push, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
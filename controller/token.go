@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+	"apidev/lib/scope"
+)
+
+// AccessToken authenticates requests sending a personal access token
+// as `Authorization: Bearer pat_...` or an access token issued to an
+// OAuth2 client as `Authorization: Bearer oat_...` and sets authID
+// like gmiddleware.JWT
+//
+// - safe methods (GET, HEAD) require the read scope, all others the write scope
+// - requests without an access token are passed on to the JWT middlewares,
+// which must be wrapped in UnlessAccessToken
+func AccessToken(read, write scope.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := bearerAccessToken(c)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		required := write
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = read
+		}
+
+		if strings.HasPrefix(raw, handler.OAuthAccessTokenPrefix) {
+			token, resp, statusCode := handler.CheckOAuthToken(raw, required)
+			if statusCode != http.StatusOK {
+				c.AbortWithStatusJSON(statusCode, resp)
+				return
+			}
+
+			c.Set("authID", token.IDAuth)
+			c.Set("oauthTokenID", token.TokenID)
+			c.Next()
+			return
+		}
+
+		token, resp, statusCode := handler.CheckAccessToken(raw, required)
+		if statusCode != http.StatusOK {
+			c.AbortWithStatusJSON(statusCode, resp)
+			return
+		}
+
+		c.Set("authID", token.IDAuth)
+		c.Set("accessTokenID", token.TokenID)
+		c.Next()
+	}
+}
+
+// UnlessAccessToken skips a middleware for requests authenticated
+// by AccessToken, such as gmiddleware.JWT and gmiddleware.TwoFA
+func UnlessAccessToken(middleware gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetUint64("accessTokenID") != 0 || c.GetUint64("oauthTokenID") != 0 {
+			c.Next()
+			return
+		}
+		middleware(c)
+	}
+}
+
+// bearerAccessToken returns the personal access token or the
+// OAuth2 access token of the Authorization header
+func bearerAccessToken(c *gin.Context) (string, bool) {
+	raw := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+	if !strings.HasPrefix(raw, handler.AccessTokenPrefix) && !strings.HasPrefix(raw, handler.OAuthAccessTokenPrefix) {
+		return "", false
+	}
+	return raw, true
+}
+
+// GetAccessTokens - GET /tokens
+// personal access tokens of the logged-in user, without their secrets
+func GetAccessTokens(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetAccessTokens(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CreateAccessToken - POST /tokens
+// create a personal access token, it is shown only once
+// =================================
+//
+//	{
+//	   "name": "ci_job",
+//	   "scopes": ["notes:read", "notes:write"],
+//	   "expiresAt": "2030-01-01T00:00:00Z"
+//	}
+//
+// =================================
+//
+// scopes: notes:read, notes:write, profile:read, profile:write
+//
+// expiresAt is optional, without it the token is valid until it is revoked
+func CreateAccessToken(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	token := model.AccessToken{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&token); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.CreateAccessToken(userIDAuth, token, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteAccessToken - DELETE /tokens/:id
+// revoke a personal access token
+func DeleteAccessToken(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DeleteAccessToken(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
@@ -39,6 +39,8 @@ func GetUserProfile(c *gin.Context) {
 //	}
 //
 // ===============================
+//
+// accepts the optional fields of UpdateUserProfile
 func CreateUserProfile(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
 	user := model.User{}
@@ -49,7 +51,7 @@ func CreateUserProfile(c *gin.Context) {
 		return
 	}
 
-	resp, statusCode := handler.CreateUserProfile(userIDAuth, user)
+	resp, statusCode := handler.CreateUserProfile(userIDAuth, user, clientInfo(c))
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
@@ -63,24 +65,74 @@ func CreateUserProfile(c *gin.Context) {
 // - only a registered user can update his existing personal profile
 // - authID is fetched from the access token
 // - if the user has no profile, he has to create a new one
+// - omitted fields keep their stored value, empty ones are cleared
 // ===================================
 //
 //	{
-//	   "nickName": "your_new_nickname"
+//	   "nickName": "your_new_nickname",
+//	   "bio": "about_you",
+//	   "timezone": "Europe/Berlin",
+//	   "locale": "de-DE",
+//	   "preferences": {
+//	      "theme": "dark",
+//	      "timeFormat": "24h",
+//	      "localTime": true
+//	   }
 //	}
 //
 // ===================================
+//
+// nickName has 3 to 30 letters or digits, separated by single . _ -,
+// it is unique regardless of case and can be changed once
+// every NICKNAME_CHANGE_INTERVAL days
+//
+// theme is one of system (default), light, dark,
+// timeFormat one of 24h (default), 12h,
+// localTime renders timestamps in the timezone of the user
 func UpdateUserProfile(c *gin.Context) {
 	userIDAuth := c.GetUint64("authID")
-	user := model.User{}
+	update := model.UserUpdate{}
 
 	// bind JSON
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&update); err != nil {
 		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	resp, statusCode := handler.UpdateUserProfile(userIDAuth, user)
+	resp, statusCode := handler.UpdateUserProfile(userIDAuth, update, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CheckNickname - GET /users/nickname-available?n=<nickName>
+// - no authentication, used by the signup form
+// - nicknames are compared case-insensitively, reserved words
+// and nicknames given up recently are not available
+func CheckNickname(c *gin.Context) {
+	nickName := c.Query("n")
+
+	resp, statusCode := handler.CheckNickname(nickName)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetPublicProfile - GET /profiles/:nickName
+// - no authentication
+// - returns the nickname, bio, avatar and the date the profile was created
+func GetPublicProfile(c *gin.Context) {
+	nickName := c.Params.ByName("nickName")
+
+	resp, statusCode := handler.GetPublicProfile(nickName)
 
 	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
 		grenderer.Render(c, resp, statusCode)
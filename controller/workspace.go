@@ -0,0 +1,284 @@
+package controller
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	grenderer "github.com/pilinux/gorest/lib/renderer"
+
+	"apidev/database/model"
+	"apidev/handler"
+)
+
+// GetWorkspaces - GET /workspaces
+// workspaces the logged-in user is a member of, with their role
+func GetWorkspaces(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetWorkspaces(userIDAuth)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// GetWorkspace - GET /workspaces/:id
+// fetch a workspace the user is a member of
+func GetWorkspace(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetWorkspace(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CreateWorkspace - POST /workspaces
+// the logged-in user becomes the owner of the new workspace
+// =================================
+//
+//	{
+//	   "name": "name_of_the_workspace"
+//	}
+//
+// =================================
+func CreateWorkspace(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	workspace := model.Workspace{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&workspace); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.CreateWorkspace(userIDAuth, workspace, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// UpdateWorkspace - PUT /workspaces/:id
+// rename a workspace, requires the admin role
+// =================================
+//
+//	{
+//	   "name": "new_name_of_the_workspace"
+//	}
+//
+// =================================
+func UpdateWorkspace(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	workspace := model.Workspace{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&workspace); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.UpdateWorkspace(userIDAuth, id, workspace, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteWorkspace - DELETE /workspaces/:id
+// delete a workspace with its notes, only the owner can do it
+func DeleteWorkspace(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.DeleteWorkspace(userIDAuth, id, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetWorkspaceMembers - GET /workspaces/:id/members
+// members of a workspace with their role and nickname
+func GetWorkspaceMembers(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetWorkspaceMembers(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// UpdateWorkspaceMember - PUT /workspaces/:id/members/:userID
+// change the role of a member, requires the admin role
+// =================================
+//
+//	{
+//	   "role": "editor"
+//	}
+//
+// =================================
+//
+// role is one of admin, editor or viewer
+func UpdateWorkspaceMember(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	userID := strings.TrimSpace(c.Params.ByName("userID"))
+	member := model.WorkspaceMember{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&member); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.UpdateWorkspaceMember(userIDAuth, id, userID, member, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteWorkspaceMember - DELETE /workspaces/:id/members/:userID
+// remove a member from a workspace, or leave it with the own user ID
+func DeleteWorkspaceMember(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	userID := strings.TrimSpace(c.Params.ByName("userID"))
+
+	resp, statusCode := handler.DeleteWorkspaceMember(userIDAuth, id, userID, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetWorkspaceInvitations - GET /workspaces/:id/invitations
+// pending invitations of a workspace, requires the admin role
+func GetWorkspaceInvitations(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+
+	resp, statusCode := handler.GetWorkspaceInvitations(userIDAuth, id)
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// CreateWorkspaceInvitation - POST /workspaces/:id/invitations
+// invite a user by nickname or email, requires the admin role
+// =================================
+//
+//	{
+//	   "nickName": "nickname_of_the_user",
+//	   "role": "editor"
+//	}
+//
+// =================================
+//
+//	{
+//	   "email": "user@example.com",
+//	   "role": "viewer"
+//	}
+//
+// =================================
+func CreateWorkspaceInvitation(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	invitation := model.WorkspaceInvitation{}
+
+	// bind JSON
+	if err := c.ShouldBindJSON(&invitation); err != nil {
+		grenderer.Render(c, gin.H{"message": err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	resp, statusCode := handler.CreateWorkspaceInvitation(userIDAuth, id, invitation, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeleteWorkspaceInvitation - DELETE /workspaces/:id/invitations/:invitationID
+// withdraw an invitation, requires the admin role
+func DeleteWorkspaceInvitation(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	id := strings.TrimSpace(c.Params.ByName("id"))
+	invitationID := strings.TrimSpace(c.Params.ByName("invitationID"))
+
+	resp, statusCode := handler.DeleteWorkspaceInvitation(userIDAuth, id, invitationID, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
+
+// GetMyInvitations - GET /workspaces/invitations
+// pending invitations addressed to the logged-in user
+// or to the email address of their account
+func GetMyInvitations(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+
+	resp, statusCode := handler.GetMyInvitations(userIDAuth, c.GetString("email"))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// AcceptInvitation - POST /workspaces/invitations/:invitationID/accept
+// join a workspace with the role of the invitation
+func AcceptInvitation(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	invitationID := strings.TrimSpace(c.Params.ByName("invitationID"))
+
+	resp, statusCode := handler.AcceptInvitation(userIDAuth, c.GetString("email"), invitationID, clientInfo(c))
+
+	if reflect.TypeOf(resp.Message).Kind() == reflect.String {
+		grenderer.Render(c, resp, statusCode)
+		return
+	}
+
+	grenderer.Render(c, resp.Message, statusCode)
+}
+
+// DeclineInvitation - DELETE /workspaces/invitations/:invitationID
+// decline an invitation addressed to the logged-in user
+func DeclineInvitation(c *gin.Context) {
+	userIDAuth := c.GetUint64("authID")
+	invitationID := strings.TrimSpace(c.Params.ByName("invitationID"))
+
+	resp, statusCode := handler.DeclineInvitation(userIDAuth, c.GetString("email"), invitationID, clientInfo(c))
+
+	grenderer.Render(c, resp, statusCode)
+}
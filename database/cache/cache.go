@@ -0,0 +1,135 @@
+// Package cache provides a two-tier read-through cache:
+// a local in-process LRU in front of Redis
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DeleteHold - time a deleted key cannot be set again, longer than
+// a read of the database
+//
+// a reader may load a record before a writer commits its change and
+// set it after the writer deleted the key, the hold keeps that stale
+// record out of the cache
+const DeleteHold = 10 * time.Second
+
+// Cache - key-value cache of encoded records
+type Cache interface {
+	// Get returns the value of a key and whether it was found
+	Get(key string) ([]byte, bool)
+	// Set stores the value of a key, unless the key was deleted
+	// within the DeleteHold
+	Set(key string, value []byte)
+	// Delete removes keys and holds them for the DeleteHold
+	Delete(keys ...string)
+}
+
+// Stats - hit and miss counters of a tiered cache
+type Stats struct {
+	LocalHits uint64 `json:"localHits"`
+	RedisHits uint64 `json:"redisHits"`
+	Misses    uint64 `json:"misses"`
+}
+
+// Tiered - local LRU in front of Redis
+//
+// - reads try the local tier first, then Redis
+// - values found in Redis are copied into the local tier
+// - writes and deletes go to both tiers
+//
+// the local tier of other instances cannot be invalidated,
+// its TTL should therefore be short
+type Tiered struct {
+	local *LRU
+	redis Cache
+
+	localHits uint64
+	redisHits uint64
+	misses    uint64
+}
+
+// registry of all tiered caches by name
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]*Tiered{}
+)
+
+// NewTiered returns a tiered cache registered under the name
+// - local: nil to disable the local tier
+// - redis: nil to disable the Redis tier
+func NewTiered(name string, local *LRU, redis Cache) *Tiered {
+	t := &Tiered{local: local, redis: redis}
+
+	registryMu.Lock()
+	registry[name] = t
+	registryMu.Unlock()
+
+	return t
+}
+
+// Get returns the value of a key and whether it was found
+func (t *Tiered) Get(key string) ([]byte, bool) {
+	if t.local != nil {
+		if value, ok := t.local.Get(key); ok {
+			atomic.AddUint64(&t.localHits, 1)
+			return value, true
+		}
+	}
+
+	if t.redis != nil {
+		if value, ok := t.redis.Get(key); ok {
+			atomic.AddUint64(&t.redisHits, 1)
+			if t.local != nil {
+				t.local.Set(key, value)
+			}
+			return value, true
+		}
+	}
+
+	atomic.AddUint64(&t.misses, 1)
+	return nil, false
+}
+
+// Set stores the value of a key in both tiers
+func (t *Tiered) Set(key string, value []byte) {
+	if t.local != nil {
+		t.local.Set(key, value)
+	}
+	if t.redis != nil {
+		t.redis.Set(key, value)
+	}
+}
+
+// Delete removes keys from both tiers
+func (t *Tiered) Delete(keys ...string) {
+	if t.local != nil {
+		t.local.Delete(keys...)
+	}
+	if t.redis != nil {
+		t.redis.Delete(keys...)
+	}
+}
+
+// Stats returns the counters of the cache
+func (t *Tiered) Stats() Stats {
+	return Stats{
+		LocalHits: atomic.LoadUint64(&t.localHits),
+		RedisHits: atomic.LoadUint64(&t.redisHits),
+		Misses:    atomic.LoadUint64(&t.misses),
+	}
+}
+
+// AllStats returns the counters of all tiered caches by name
+func AllStats() map[string]Stats {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	stats := make(map[string]Stats, len(registry))
+	for name, t := range registry {
+		stats[name] = t.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/mediocregopher/radix/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// Redis - cache tier shared by all instances of the application
+//
+// Redis errors are logged and treated as cache misses,
+// the database stays the source of truth; a deleted key
+// is held with an empty value, see DeleteHold
+type Redis struct {
+	client  radix.Client
+	prefix  string
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+// NewRedis returns a Redis tier
+// - prefix: namespace of the keys
+// - ttl: expiry of the keys
+// - timeout: limit of every Redis command
+func NewRedis(client radix.Client, prefix string, ttl, timeout time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, ttl: ttl, timeout: timeout}
+}
+
+// Get returns the value of a key
+func (c *Redis) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var value []byte
+	mb := radix.Maybe{Rcv: &value}
+	if err := c.client.Do(ctx, radix.Cmd(&mb, "GET", c.prefix+key)); err != nil {
+		log.WithError(err).Error("error code: 1601")
+		return nil, false
+	}
+	if mb.Null || len(value) == 0 {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set stores the value of a key with the configured TTL
+// unless the key exists, a held key included
+func (c *Redis) Set(key string, value []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := c.client.Do(ctx, radix.FlatCmd(nil, "SET", c.prefix+key, value, "PX", c.ttl.Milliseconds(), "NX")); err != nil {
+		log.WithError(err).Error("error code: 1602")
+	}
+}
+
+// Delete replaces the values of keys with an empty one
+// for the DeleteHold
+func (c *Redis) Delete(keys ...string) {
+	for _, key := range keys {
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := c.client.Do(ctx, radix.FlatCmd(nil, "SET", c.prefix+key, "", "PX", DeleteHold.Milliseconds()))
+		cancel()
+		if err != nil {
+			log.WithError(err).Error("error code: 1603")
+		}
+	}
+}
@@ -16,12 +16,60 @@ type auth gmodel.Auth
 type twoFA gmodel.TwoFA
 type user model.User
 type note model.Note
+type syncCounter model.SyncCounter
+type userKey model.UserKey
+type noteKey model.NoteKey
+type auditEvent model.AuditEvent
+type nicknameReservation model.NicknameReservation
+type authRevocation model.AuthRevocation
+type authRole model.AuthRole
+type authSuspension model.AuthSuspension
+type accessToken model.AccessToken
+type authIdentity model.AuthIdentity
+type oauthState model.OAuthState
+type oauthClient model.OAuthClient
+type oauthCode model.OAuthCode
+type oauthToken model.OAuthToken
+type session model.Session
+type sessionToken model.SessionToken
+type emailToken model.EmailToken
+type passkey model.Passkey
+type passkeyChallenge model.PasskeyChallenge
+type dataExport model.DataExport
+type userSettings model.UserSettings
+type workspace model.Workspace
+type workspaceMember model.WorkspaceMember
+type workspaceInvitation model.WorkspaceInvitation
 
 // DropAllTables - careful! It will drop all the tables!
 func DropAllTables() error {
 	db := gdatabase.GetDB()
 
 	if err := db.Migrator().DropTable(
+		&passkeyChallenge{},
+		&passkey{},
+		&emailToken{},
+		&sessionToken{},
+		&session{},
+		&oauthToken{},
+		&oauthCode{},
+		&oauthClient{},
+		&oauthState{},
+		&authIdentity{},
+		&accessToken{},
+		&authSuspension{},
+		&authRole{},
+		&workspaceInvitation{},
+		&workspaceMember{},
+		&workspace{},
+		&userSettings{},
+		&dataExport{},
+		&authRevocation{},
+		&nicknameReservation{},
+		&auditEvent{},
+		&noteKey{},
+		&userKey{},
+		&syncCounter{},
 		&note{},
 		&user{},
 		&twoFA{},
@@ -49,6 +97,30 @@ func StartMigration(configure gconfig.Configuration) error {
 			&twoFA{},
 			&user{},
 			&note{},
+			&syncCounter{},
+			&userKey{},
+			&noteKey{},
+			&auditEvent{},
+			&nicknameReservation{},
+			&authRevocation{},
+			&dataExport{},
+			&userSettings{},
+			&workspace{},
+			&workspaceMember{},
+			&workspaceInvitation{},
+			&authRole{},
+			&authSuspension{},
+			&accessToken{},
+			&authIdentity{},
+			&oauthState{},
+			&oauthClient{},
+			&oauthCode{},
+			&oauthToken{},
+			&session{},
+			&sessionToken{},
+			&emailToken{},
+			&passkey{},
+			&passkeyChallenge{},
 		); err != nil {
 			return err
 		}
@@ -62,14 +134,58 @@ func StartMigration(configure gconfig.Configuration) error {
 		&twoFA{},
 		&user{},
 		&note{},
+		&syncCounter{},
+		&userKey{},
+		&noteKey{},
+		&auditEvent{},
+		&nicknameReservation{},
+		&authRevocation{},
+		&dataExport{},
+		&userSettings{},
+		&workspace{},
+		&workspaceMember{},
+		&workspaceInvitation{},
+		&authRole{},
+		&authSuspension{},
+		&accessToken{},
+		&authIdentity{},
+		&oauthState{},
+		&oauthClient{},
+		&oauthCode{},
+		&oauthToken{},
+		&session{},
+		&sessionToken{},
+		&emailToken{},
+		&passkey{},
+		&passkeyChallenge{},
 	); err != nil {
 		return err
 	}
 
+	if driver == "postgres" {
+		setPostGIS()
+	}
+
 	fmt.Println("new tables are  migrated successfully!")
 	return nil
 }
 
+// setPostGIS - enable PostGIS and index the location of notes
+// - PostGIS is optional, without it nearby queries use the haversine formula
+func setPostGIS() {
+	db := gdatabase.GetDB()
+
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS postgis").Error; err != nil {
+		fmt.Println("PostGIS is not available, nearby queries use the haversine formula")
+		return
+	}
+
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_notes_geog ON notes USING GIST " +
+		"((geography(ST_MakePoint(longitude, latitude)))) WHERE latitude IS NOT NULL").Error; err != nil {
+		fmt.Println("failed to create the PostGIS index of notes:", err)
+	}
+}
+
 // SetPkFk - manually set foreign key for MySQL and PostgreSQL
 func SetPkFk() error {
 	db := gdatabase.GetDB()
@@ -81,5 +197,19 @@ func SetPkFk() error {
 		}
 	}
 
+	if !db.Migrator().HasConstraint(&user{}, "Keys") {
+		err := db.Migrator().CreateConstraint(&user{}, "Keys")
+		if err != nil {
+			return err
+		}
+	}
+
+	if !db.Migrator().HasConstraint(&note{}, "NoteKeys") {
+		err := db.Migrator().CreateConstraint(&note{}, "NoteKeys")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
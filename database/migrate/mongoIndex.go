@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gdatabase "github.com/pilinux/gorest/database"
+	"github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	moptions "go.mongodb.org/mongo-driver/mongo/options"
+
+	"apidev/database/model"
+)
+
+// SetMongoIndexes - create the indexes of all MongoDB collections
+// - existing indexes with the same keys are left untouched
+func SetMongoIndexes(configure gconfig.Configuration) error {
+	configureDB := configure.Database.MongoDB
+	db := gdatabase.GetMongo().Database(configureDB.Env.AppName)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(configureDB.Env.ConnTTL)*time.Second)
+	defer cancel()
+
+	// profile lookup by the ID of the access token,
+	// unique nicknames, profiles without nickname key are not indexed,
+	// accounts scheduled for deletion
+	if err := db.Collection(model.MongoCollectionUsers).CreateIndexes(ctx, []options.IndexModel{
+		{Key: []string{"idAuth", "deletedAt"}},
+		{
+			Key: []string{"nickKey"},
+			IndexOptions: moptions.Index().
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"nickKey": bson.M{"$type": "string"}}),
+		},
+		{Key: []string{"deleteAfter"}},
+	}); err != nil {
+		return err
+	}
+
+	// notes of a user, location queries by bounding box,
+	// manual order, notes of a workspace
+	// - no delta sync, see DELTA_SYNC
+	if err := db.Collection(model.MongoCollectionNotes).CreateIndexes(ctx, []options.IndexModel{
+		{Key: []string{"idUser", "deletedAt"}},
+		{Key: []string{"idUser", "latitude", "longitude"}},
+		{Key: []string{"idUser", "position"}},
+		{Key: []string{"idWorkspace", "position"}},
+	}); err != nil {
+		return err
+	}
+
+	// audit log of a user or a resource, newest first
+	if err := db.Collection(model.MongoCollectionAudit).CreateIndexes(ctx, []options.IndexModel{
+		{Key: []string{"idAuth", "-_id"}},
+		{Key: []string{"resourceType", "resourceID", "-_id"}},
+		{Key: []string{"createdAt"}},
+	}); err != nil {
+		return err
+	}
+
+	// data exports of a user, expired exports
+	if err := db.Collection(model.MongoCollectionExports).CreateIndexes(ctx, []options.IndexModel{
+		{Key: []string{"idAuth", "-_id"}},
+		{Key: []string{"expiresAt"}},
+	}); err != nil {
+		return err
+	}
+
+	// one membership per workspace and user, workspaces of a user
+	if err := db.Collection(model.MongoCollectionMembers).CreateIndexes(ctx, []options.IndexModel{
+		{
+			Key:          []string{"idWorkspace", "idUser"},
+			IndexOptions: moptions.Index().SetUnique(true),
+		},
+		{Key: []string{"idUser"}},
+	}); err != nil {
+		return err
+	}
+
+	// invitations of a workspace, of a user or an email address,
+	// expired invitations
+	if err := db.Collection(model.MongoCollectionInvitations).CreateIndexes(ctx, []options.IndexModel{
+		{Key: []string{"idWorkspace", "-_id"}},
+		{Key: []string{"idUser"}},
+		{Key: []string{"email"}},
+		{Key: []string{"expiresAt"}},
+	}); err != nil {
+		return err
+	}
+
+	fmt.Println("mongo indexes are created successfully!")
+	return nil
+}
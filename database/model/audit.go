@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// AuditEvent model - `audit_events` table
+//
+// append-only record of a change made by a user,
+// events are never updated or deleted by the API,
+// only erased with the account of the user
+type AuditEvent struct {
+	EventID      uint64                 `gorm:"primaryKey" json:"eventID"`
+	CreatedAt    time.Time              `gorm:"index" json:"createdAt"`
+	IDAuth       uint64                 `gorm:"index" json:"actorAuthID"`
+	Action       string                 `gorm:"size:64;index" json:"action"`
+	ResourceType string                 `gorm:"size:32;index:idx_audit_resource,priority:1" json:"resourceType"`
+	ResourceID   uint64                 `gorm:"index:idx_audit_resource,priority:2" json:"resourceID"`
+	Changes      map[string]AuditChange `gorm:"serializer:json" json:"changes,omitempty"`
+	ClientIP     string                 `gorm:"size:64" json:"clientIP,omitempty"`
+	UserAgent    string                 `json:"userAgent,omitempty"`
+}
+
+// AuditChange - value of a field before and after a change
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter - criteria of an audit log query
+//
+// zero values do not filter, events are returned newest first
+type AuditFilter struct {
+	IDAuth       uint64
+	Action       string
+	ResourceType string
+	ResourceID   uint64
+	Since        time.Time
+	Until        time.Time
+	BeforeID     uint64
+	Limit        int
+}
+
+// AuditPage - one page of audit events
+//
+// NextBeforeID is the cursor of the next (older) page, 0 if there is none
+type AuditPage struct {
+	Events       []AuditEvent `json:"events"`
+	NextBeforeID uint64       `json:"nextBeforeID,omitempty"`
+}
+
+// ClientInfo - details of the HTTP client making a request
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
@@ -0,0 +1,391 @@
+package model
+
+import (
+	"time"
+
+	"apidev/lib/webauthn"
+)
+
+// reasons of a revocation
+const (
+	RevocationDeleted = "deleted"
+	RevocationLogout  = "logout"
+)
+
+// AuthRevocation model - `auth_revocations` table
+//
+// JWTs of an auth ID issued until RevokedAt are rejected, because the
+// account was purged or logged out by an administrator, the revocation
+// is kept until ExpiresAt when all of them have expired
+//
+// revocations saved before Reason was introduced are of purged accounts
+type AuthRevocation struct {
+	IDAuth    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	RevokedAt time.Time
+	ExpiresAt time.Time `gorm:"index"`
+	Reason    string    `gorm:"size:16"`
+}
+
+// AuthRole model - `auth_roles` table
+//
+// a role granted to an auth ID, see lib/rbac
+type AuthRole struct {
+	IDAuth      uint64    `gorm:"primaryKey;autoIncrement:false" json:"authID"`
+	Role        string    `gorm:"primaryKey;size:32" json:"role"`
+	CreatedAt   time.Time `json:"createdAt"`
+	IDGrantedBy uint64    `json:"grantedBy,omitempty"`
+}
+
+// AuthSuspension model - `auth_suspensions` table
+//
+// all JWTs of a suspended auth ID are rejected until it is unsuspended
+type AuthSuspension struct {
+	IDAuth        uint64    `gorm:"primaryKey;autoIncrement:false" json:"authID"`
+	CreatedAt     time.Time `json:"suspendedAt"`
+	Reason        string    `gorm:"size:500" json:"reason,omitempty"`
+	IDSuspendedBy uint64    `json:"suspendedBy"`
+}
+
+// AdminAccount - an account as shown to administrators
+//
+// Profile is nil if the user has not created one yet
+type AdminAccount struct {
+	IDAuth     uint64          `json:"authID"`
+	Profile    *User           `json:"profile,omitempty"`
+	Roles      []string        `json:"roles"`
+	Suspension *AuthSuspension `json:"suspension,omitempty"`
+}
+
+// AccessToken model - `access_tokens` table
+//
+// a personal access token of a user for scripts and CI jobs, sent as
+// `Authorization: Bearer pat_<tokenID>_<secret>`, only the argon2 hash
+// of the secret is saved
+//
+// Token is set once in the response to the creation
+type AccessToken struct {
+	TokenID    uint64     `gorm:"primaryKey" json:"tokenID"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	IDAuth     uint64     `gorm:"index" json:"-"`
+	Name       string     `gorm:"size:100" json:"name"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	Hash       string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	Token      string     `gorm:"-" json:"token,omitempty"`
+}
+
+// AuthIdentity model - `auth_identities` table
+//
+// an account of a user at an OAuth2/OIDC provider linked to an auth ID,
+// at most one per provider and auth ID
+type AuthIdentity struct {
+	Provider  string    `gorm:"primaryKey;size:32" json:"provider"`
+	Subject   string    `gorm:"primaryKey;size:255" json:"subject"`
+	IDAuth    uint64    `gorm:"index" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	Email     string    `json:"email,omitempty"`
+}
+
+// OAuthState model - `oauth_states` table
+//
+// a login with a provider waiting for its callback, IDAuth is set
+// when a logged-in user links the provider to their account
+type OAuthState struct {
+	State     string    `gorm:"primaryKey;size:64"`
+	Provider  string    `gorm:"size:32"`
+	Verifier  string    `gorm:"size:64"`
+	IDAuth    uint64    `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// TableName - gorm would name the table o_auth_states
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// OAuthLogin - URL of the provider the user is sent to
+type OAuthLogin struct {
+	URL string `json:"url"`
+}
+
+// OAuthClient model - `oauth_clients` table
+//
+// a third-party application registered by a user, confidential clients
+// authenticate at the token endpoint with their secret, public clients
+// (browser and native apps) with PKCE only, only the argon2 hash of the
+// secret is saved
+//
+// Secret is set once in the response to the registration
+type OAuthClient struct {
+	ClientID     string    `gorm:"primaryKey;size:64" json:"clientID"`
+	CreatedAt    time.Time `json:"createdAt"`
+	IDAuth       uint64    `gorm:"index" json:"-"`
+	Name         string    `gorm:"size:100" json:"name"`
+	RedirectURIs []string  `gorm:"serializer:json" json:"redirectURIs"`
+	Confidential bool      `json:"confidential"`
+	Hash         string    `json:"-"`
+	Secret       string    `gorm:"-" json:"clientSecret,omitempty"`
+}
+
+// TableName - gorm would name the table o_auth_clients
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthCode model - `oauth_codes` table
+//
+// an authorization request of a client, waiting for the consent of the
+// user until it is Approved, then the authorization code the client
+// exchanges once for tokens
+type OAuthCode struct {
+	CodeID      uint64   `gorm:"primaryKey"`
+	ClientID    string   `gorm:"index;size:64"`
+	IDAuth      uint64   `gorm:"index"`
+	RedirectURI string   `gorm:"size:500"`
+	Scopes      []string `gorm:"serializer:json"`
+	State       string   `gorm:"size:500"`
+	Challenge   string   `gorm:"size:64"`
+	Approved    bool
+	Hash        string
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// TableName - gorm would name the table o_auth_codes
+func (OAuthCode) TableName() string {
+	return "oauth_codes"
+}
+
+// kinds of OAuth2 tokens
+const (
+	OAuthTokenAccess  = "access"
+	OAuthTokenRefresh = "refresh"
+)
+
+// OAuthToken model - `oauth_tokens` table
+//
+// an access or refresh token issued to a client, access tokens are sent as
+// `Authorization: Bearer oat_<tokenID>_<secret>`, only the argon2 hash of
+// the secret is saved
+//
+// IDRefresh links an access token to the refresh token it was issued with
+type OAuthToken struct {
+	TokenID   uint64 `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Kind      string   `gorm:"size:16"`
+	ClientID  string   `gorm:"index;size:64"`
+	IDAuth    uint64   `gorm:"index"`
+	IDRefresh uint64   `gorm:"index"`
+	Scopes    []string `gorm:"serializer:json"`
+	Hash      string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// TableName - gorm would name the table o_auth_tokens
+func (OAuthToken) TableName() string {
+	return "oauth_tokens"
+}
+
+// OAuthConsent - an authorization request shown to the user,
+// Consent is sent back with the decision
+type OAuthConsent struct {
+	Consent     string   `json:"consent"`
+	ClientID    string   `json:"clientID"`
+	ClientName  string   `json:"clientName"`
+	RedirectURI string   `json:"redirectURI"`
+	Scopes      []string `json:"scopes"`
+}
+
+// OAuthDecision - the answer of the user to an authorization request
+type OAuthDecision struct {
+	Consent string `json:"consent" form:"consent"`
+	Approve bool   `json:"approve" form:"approve"`
+}
+
+// OAuthRedirect - URL of the client the user is sent back to
+type OAuthRedirect struct {
+	URL string `json:"url"`
+}
+
+// OAuthAuthorization - a client holding tokens of a user
+type OAuthAuthorization struct {
+	ClientID   string    `json:"clientID"`
+	ClientName string    `json:"clientName"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// OAuthTokenResponse - successful response of the token endpoint,
+// RFC 6749 section 5.1
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthError - error response of the token, revocation and introspection
+// endpoints, RFC 6749 section 5.2
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// OAuthIntrospection - response of the introspection endpoint,
+// RFC 7662 section 2.2, Subject is the auth ID
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Session model - `sessions` table
+//
+// a login of a user with a password, a provider or 2FA, tracked from the
+// first token pair until its last refresh token expires, a revoked
+// session is kept until ExpiresAt so that its tokens stay rejected
+//
+// Current marks the session of the request
+type Session struct {
+	SessionID   uint64     `gorm:"primaryKey" json:"sessionID"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	IDAuth      uint64     `gorm:"index" json:"-"`
+	UserAgent   string     `json:"userAgent"`
+	IP          string     `gorm:"size:64" json:"ip"`
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	ExpiresAt   time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt   *time.Time `json:"-"`
+	Device      string     `gorm:"-" json:"device"`
+	Current     bool       `gorm:"-" json:"current"`
+}
+
+// SessionToken model - `session_tokens` table
+//
+// a JWT issued to a session, identified by its jti, a refresh token is
+// Replaced once it has been exchanged for a new token pair
+type SessionToken struct {
+	JTI       string `gorm:"primaryKey;size:64"`
+	IDSession uint64 `gorm:"index"`
+	Replaced  bool
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// kinds of email tokens
+const (
+	EmailTokenVerify    = "verify"
+	EmailTokenRecover   = "recover"
+	EmailTokenMagicLink = "magicLink"
+)
+
+// EmailToken model - `email_tokens` table
+//
+// a code emailed to a user to verify the address, to reset the
+// password or to log in, sent as `<tokenID>_<secret>`, only the argon2
+// hash of the secret is saved, each code can be used once
+//
+// Device - SHA-256 of the device key given with the request of a magic
+// link, the link only works with the same key; empty if not bound
+type EmailToken struct {
+	TokenID   uint64 `gorm:"primaryKey"`
+	CreatedAt time.Time
+	Kind      string `gorm:"size:16"`
+	IDAuth    uint64 `gorm:"index"`
+	Hash      string
+	Device    string    `gorm:"size:64"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// EmailRequest - an address to send a code to
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+// EmailCode - a code received by email
+type EmailCode struct {
+	Code string `json:"code"`
+}
+
+// PasswordReset - a new password and the recovery code received by email
+type PasswordReset struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+// MagicLinkRequest - an address to send a login link to
+//
+// Device - optional random key kept by the client, e.g. in local
+// storage, the link then works only when verified with the same key
+type MagicLinkRequest struct {
+	Email  string `json:"email"`
+	Device string `json:"device"`
+}
+
+// MagicLinkLogin - the code of a login link and the device key
+// of its request
+type MagicLinkLogin struct {
+	Code   string `json:"code"`
+	Device string `json:"device"`
+}
+
+// kinds of passkey ceremonies
+const (
+	PasskeyRegister = "register"
+	PasskeyLogin    = "login"
+	PasskeyTwoFA    = "2fa"
+)
+
+// Passkey model - `passkeys` table
+//
+// a WebAuthn credential of a user for the passwordless login and as
+// second factor, CredentialID is base64url encoded; UserHandle is the
+// random user handle of the account, the same for all its passkeys
+type Passkey struct {
+	PasskeyID      uint64     `gorm:"primaryKey" json:"passkeyID"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	IDAuth         uint64     `gorm:"index" json:"-"`
+	Name           string     `gorm:"size:100" json:"name"`
+	CredentialID   string     `gorm:"uniqueIndex;size:255" json:"-"`
+	UserHandle     []byte     `json:"-"`
+	PublicKey      []byte     `json:"-"`
+	SignCount      uint32     `json:"-"`
+	AAGUID         string     `gorm:"size:36" json:"aaguid"`
+	Transports     []string   `gorm:"serializer:json" json:"transports"`
+	BackupEligible bool       `json:"backupEligible"`
+	LastUsedAt     *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// PasskeyChallenge model - `passkey_challenges` table
+//
+// a started WebAuthn ceremony, found by its base64url challenge the
+// response is signed for; IDAuth is 0 for a passwordless login,
+// UserHandle is set for a registration
+type PasskeyChallenge struct {
+	Challenge  string `gorm:"primaryKey;size:64"`
+	Kind       string `gorm:"size:16"`
+	IDAuth     uint64
+	UserHandle []byte
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+// PasskeyRegistration - the name and the response of a new passkey
+type PasskeyRegistration struct {
+	Name       string                `json:"name"`
+	Credential webauthn.Registration `json:"credential"`
+}
+
+// PasskeyAssertion - the response of an authentication with a passkey
+type PasskeyAssertion struct {
+	Credential webauthn.Assertion `json:"credential"`
+}
+
+// AccountLockout - logins of an account locked after too many failed
+// attempts, recorded in the audit log
+type AccountLockout struct {
+	Failures    int64     `json:"failures"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+// DataExport model - `data_exports` table
+//
+// archive of all data held about a user, built in the background
+// and available for download until ExpiresAt
+type DataExport struct {
+	ExportID    uint64     `gorm:"primaryKey" json:"exportID"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	IDAuth      uint64     `gorm:"index" json:"-"`
+	Status      string     `gorm:"size:16" json:"status"`
+	Size        int64      `json:"size,omitempty"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+	DownloadURL string     `gorm:"-" json:"downloadURL,omitempty"`
+}
+
+// DataExportArchive - archive of an export, served as a file
+type DataExportArchive struct {
+	Data        []byte
+	ContentType string
+	FileName    string
+	ModTime     time.Time
+}
+
+// ExportAuth - credentials of a user in a data export, without secrets
+type ExportAuth struct {
+	AuthID        uint64    `json:"authID"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"emailVerified"`
+}
+
+// ExportTwoFA - state of two-factor authentication in a data export
+type ExportTwoFA struct {
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ExportNote - note in a data export, soft deleted notes included
+type ExportNote struct {
+	Note
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
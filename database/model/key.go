@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserKey model - `user_keys` table
+//
+// public key of a user, used by other users to wrap
+// the keys of end-to-end encrypted notes they share
+type UserKey struct {
+	KeyID     uint64         `gorm:"primaryKey" json:"keyID,omitempty"`
+	CreatedAt time.Time      `json:"createdAt,omitempty"`
+	UpdatedAt time.Time      `json:"updatedAt,omitempty"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Algorithm string         `json:"algorithm,omitempty"`
+	PublicKey string         `json:"publicKey,omitempty"`
+	IDUser    uint64         `gorm:"index" json:"userID,omitempty"`
+}
+
+// NoteKey model - `note_keys` table
+//
+// content key of an end-to-end encrypted note, wrapped (encrypted)
+// by the client with the public key of the recipient
+type NoteKey struct {
+	NoteKeyID  uint64         `gorm:"primaryKey" json:"noteKeyID,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt,omitempty"`
+	UpdatedAt  time.Time      `json:"updatedAt,omitempty"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	Algorithm  string         `json:"algorithm,omitempty"`
+	WrappedKey string         `json:"wrappedKey,omitempty"`
+	IDUserKey  uint64         `json:"keyID,omitempty"`
+	IDNote     uint64         `gorm:"index" json:"noteID,omitempty"`
+	IDUser     uint64         `gorm:"index" json:"userID,omitempty"`
+	IDSharedBy uint64         `json:"sharedBy,omitempty"`
+}
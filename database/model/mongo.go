@@ -0,0 +1,253 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MongoDB collections
+const (
+	MongoCollectionCounters = "counters"
+	MongoCollectionUsers    = "users"
+	MongoCollectionNotes    = "notes"
+	MongoCollectionAudit    = "auditEvents"
+	MongoCollectionNickname = "nicknameReservations"
+	MongoCollectionExports  = "dataExports"
+	MongoCollectionSettings = "userSettings"
+
+	MongoCollectionWorkspaces  = "workspaces"
+	MongoCollectionMembers     = "workspaceMembers"
+	MongoCollectionInvitations = "workspaceInvitations"
+)
+
+// MongoCounter - document in `counters` collection
+//
+// MongoDB has no auto-increment, numeric IDs are
+// allocated from one counter per collection
+type MongoCounter struct {
+	Name string `bson:"_id"`
+	Seq  uint64 `bson:"seq"`
+}
+
+// MongoUser - document in `users` collection
+type MongoUser struct {
+	UserID      uint64          `bson:"_id"`
+	CreatedAt   time.Time       `bson:"createdAt"`
+	UpdatedAt   time.Time       `bson:"updatedAt"`
+	DeletedAt   *time.Time      `bson:"deletedAt"`
+	NickName    string          `bson:"nickName"`
+	NickKey     *string         `bson:"nickKey"`
+	NickChanged *time.Time      `bson:"nickChanged"`
+	Bio         string          `bson:"bio"`
+	Timezone    string          `bson:"timezone"`
+	Locale      string          `bson:"locale"`
+	Preferences UserPreferences `bson:"preferences"`
+	Avatar      string          `bson:"avatar"`
+	DeleteAfter *time.Time      `bson:"deleteAfter"`
+	IDAuth      uint64          `bson:"idAuth"`
+}
+
+// MongoUserSettings - document in `userSettings` collection
+type MongoUserSettings struct {
+	IDUser    uint64                 `bson:"_id"`
+	UpdatedAt time.Time              `bson:"updatedAt"`
+	Values    map[string]interface{} `bson:"values"`
+}
+
+// MongoNicknameReservation - document in `nicknameReservations` collection
+type MongoNicknameReservation struct {
+	NickKey   string    `bson:"_id"`
+	IDUser    uint64    `bson:"idUser"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+// MongoDataExport - document in `dataExports` collection
+type MongoDataExport struct {
+	ExportID  uint64     `bson:"_id"`
+	CreatedAt time.Time  `bson:"createdAt"`
+	UpdatedAt time.Time  `bson:"updatedAt"`
+	IDAuth    uint64     `bson:"idAuth"`
+	Status    string     `bson:"status"`
+	Size      int64      `bson:"size"`
+	ExpiresAt *time.Time `bson:"expiresAt"`
+}
+
+// MongoNote - document in `notes` collection
+type MongoNote struct {
+	NoteID      uint64     `bson:"_id"`
+	CreatedAt   time.Time  `bson:"createdAt"`
+	UpdatedAt   time.Time  `bson:"updatedAt"`
+	DeletedAt   *time.Time `bson:"deletedAt"`
+	Title       string     `bson:"title"`
+	Body        string     `bson:"body"`
+	ContentType string     `bson:"contentType"`
+	E2EE        bool       `bson:"e2ee"`
+	Ciphertext  string     `bson:"ciphertext"`
+	Algorithm   string     `bson:"algorithm"`
+	KeyID       string     `bson:"keyID"`
+	Nonce       string     `bson:"nonce"`
+	Latitude    *float64   `bson:"latitude"`
+	Longitude   *float64   `bson:"longitude"`
+	Accuracy    *float64   `bson:"accuracy"`
+	PlaceName   string     `bson:"placeName"`
+	Position    string     `bson:"position"`
+	Version     uint64     `bson:"version"`
+	IDUser      uint64     `bson:"idUser"`
+	IDWorkspace *uint64    `bson:"idWorkspace,omitempty"`
+}
+
+// MongoWorkspace - document in `workspaces` collection
+type MongoWorkspace struct {
+	WorkspaceID uint64    `bson:"_id"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+	Name        string    `bson:"name"`
+}
+
+// MongoWorkspaceMember - document in `workspaceMembers` collection
+type MongoWorkspaceMember struct {
+	IDWorkspace uint64    `bson:"idWorkspace"`
+	IDUser      uint64    `bson:"idUser"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+	Role        string    `bson:"role"`
+}
+
+// MongoWorkspaceInvitation - document in `workspaceInvitations` collection
+type MongoWorkspaceInvitation struct {
+	InvitationID uint64    `bson:"_id"`
+	CreatedAt    time.Time `bson:"createdAt"`
+	ExpiresAt    time.Time `bson:"expiresAt"`
+	IDWorkspace  uint64    `bson:"idWorkspace"`
+	Role         string    `bson:"role"`
+	IDUser       *uint64   `bson:"idUser"`
+	NickName     string    `bson:"nickName"`
+	Email        string    `bson:"email"`
+	IDInvitedBy  uint64    `bson:"idInvitedBy"`
+}
+
+// MongoAuditEvent - document in `auditEvents` collection
+type MongoAuditEvent struct {
+	EventID      uint64                 `bson:"_id"`
+	CreatedAt    time.Time              `bson:"createdAt"`
+	IDAuth       uint64                 `bson:"idAuth"`
+	Action       string                 `bson:"action"`
+	ResourceType string                 `bson:"resourceType"`
+	ResourceID   uint64                 `bson:"resourceID"`
+	Changes      map[string]AuditChange `bson:"changes"`
+	ClientIP     string                 `bson:"clientIP"`
+	UserAgent    string                 `bson:"userAgent"`
+}
+
+// User converts the document to the model used in API responses
+func (doc MongoUser) User() User {
+	return User{
+		UserID:      doc.UserID,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+		NickName:    doc.NickName,
+		NickKey:     doc.NickKey,
+		NickChanged: doc.NickChanged,
+		Bio:         doc.Bio,
+		Timezone:    doc.Timezone,
+		Locale:      doc.Locale,
+		Preferences: doc.Preferences,
+		Avatar:      doc.Avatar,
+		DeleteAfter: doc.DeleteAfter,
+		IDAuth:      doc.IDAuth,
+	}
+}
+
+// Note converts the document to the model used in API responses
+func (doc MongoNote) Note() Note {
+	note := Note{
+		NoteID:      doc.NoteID,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+		Title:       doc.Title,
+		Body:        doc.Body,
+		ContentType: doc.ContentType,
+		E2EE:        doc.E2EE,
+		Ciphertext:  doc.Ciphertext,
+		Algorithm:   doc.Algorithm,
+		KeyID:       doc.KeyID,
+		Nonce:       doc.Nonce,
+		Latitude:    doc.Latitude,
+		Longitude:   doc.Longitude,
+		Accuracy:    doc.Accuracy,
+		PlaceName:   doc.PlaceName,
+		Position:    doc.Position,
+		Version:     doc.Version,
+		IDUser:      doc.IDUser,
+		IDWorkspace: doc.IDWorkspace,
+	}
+	if doc.DeletedAt != nil {
+		note.DeletedAt = gorm.DeletedAt{Time: *doc.DeletedAt, Valid: true}
+	}
+	return note
+}
+
+// AuditEvent converts the document to the model used in API responses
+func (doc MongoAuditEvent) AuditEvent() AuditEvent {
+	return AuditEvent{
+		EventID:      doc.EventID,
+		CreatedAt:    doc.CreatedAt,
+		IDAuth:       doc.IDAuth,
+		Action:       doc.Action,
+		ResourceType: doc.ResourceType,
+		ResourceID:   doc.ResourceID,
+		Changes:      doc.Changes,
+		ClientIP:     doc.ClientIP,
+		UserAgent:    doc.UserAgent,
+	}
+}
+
+// DataExport converts the document to the model used in API responses
+func (doc MongoDataExport) DataExport() DataExport {
+	return DataExport{
+		ExportID:  doc.ExportID,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+		IDAuth:    doc.IDAuth,
+		Status:    doc.Status,
+		Size:      doc.Size,
+		ExpiresAt: doc.ExpiresAt,
+	}
+}
+
+// Workspace converts the document to the model used in API responses
+func (doc MongoWorkspace) Workspace() Workspace {
+	return Workspace{
+		WorkspaceID: doc.WorkspaceID,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+		Name:        doc.Name,
+	}
+}
+
+// WorkspaceMember converts the document to the model used in API responses
+func (doc MongoWorkspaceMember) WorkspaceMember() WorkspaceMember {
+	return WorkspaceMember{
+		IDWorkspace: doc.IDWorkspace,
+		IDUser:      doc.IDUser,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+		Role:        doc.Role,
+	}
+}
+
+// WorkspaceInvitation converts the document to the model used in API responses
+func (doc MongoWorkspaceInvitation) WorkspaceInvitation() WorkspaceInvitation {
+	return WorkspaceInvitation{
+		InvitationID: doc.InvitationID,
+		CreatedAt:    doc.CreatedAt,
+		ExpiresAt:    doc.ExpiresAt,
+		IDWorkspace:  doc.IDWorkspace,
+		Role:         doc.Role,
+		IDUser:       doc.IDUser,
+		NickName:     doc.NickName,
+		Email:        doc.Email,
+		IDInvitedBy:  doc.IDInvitedBy,
+	}
+}
@@ -7,12 +7,55 @@ import (
 )
 
 // Note model - `notes` table
+//
+// a note belongs to its author (IDUser) or, if IDWorkspace is set,
+// to a workspace, IDUser is then the author
+//
+// ChangeSeq: taken from the SyncCounter of the author on every change,
+// the delta sync pages on it
 type Note struct {
-	NoteID    uint64         `gorm:"primaryKey" json:"noteID,omitempty"`
-	CreatedAt time.Time      `json:"createdAt,omitempty"`
-	UpdatedAt time.Time      `json:"updatedAt,omitempty"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Title     string         `json:"title,omitempty"`
-	Body      string         `json:"body,omitempty"`
-	IDUser    uint64         `json:"-"`
+	NoteID      uint64         `gorm:"primaryKey" json:"noteID,omitempty"`
+	CreatedAt   time.Time      `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time      `json:"updatedAt,omitempty"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	Title       string         `json:"title,omitempty"`
+	Body        string         `json:"body,omitempty"`
+	ContentType string         `json:"contentType,omitempty"`
+	E2EE        bool           `gorm:"column:e2ee" json:"e2ee"`
+	Ciphertext  string         `json:"ciphertext,omitempty"`
+	Algorithm   string         `json:"algorithm,omitempty"`
+	KeyID       string         `json:"keyID,omitempty"`
+	Nonce       string         `json:"nonce,omitempty"`
+	Latitude    *float64       `gorm:"index:idx_notes_geo,priority:2" json:"latitude,omitempty"`
+	Longitude   *float64       `gorm:"index:idx_notes_geo,priority:3" json:"longitude,omitempty"`
+	Accuracy    *float64       `json:"accuracy,omitempty"`
+	PlaceName   string         `json:"placeName,omitempty"`
+	Distance    *float64       `gorm:"-" json:"distance,omitempty"`
+	Position    string         `gorm:"size:255;index:idx_notes_position,priority:2" json:"position,omitempty"`
+	Version     uint64         `json:"version,omitempty"`
+	ChangeSeq   uint64         `gorm:"index:idx_notes_changes,priority:2" json:"-"`
+	IDUser      uint64         `gorm:"index:idx_notes_changes,priority:1;index:idx_notes_geo,priority:1;index:idx_notes_position,priority:1" json:"-"`
+	IDWorkspace *uint64        `gorm:"index" json:"workspaceID,omitempty"`
+	NoteKeys    []NoteKey      `gorm:"foreignkey:IDNote;references:NoteID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+// NoteMove - new place of a note in the manual order,
+// at least one neighbour is required
+type NoteMove struct {
+	Before uint64 `json:"before,omitempty"`
+	After  uint64 `json:"after,omitempty"`
+}
+
+// ConvertedNote - note with its body converted to another format
+type ConvertedNote struct {
+	Note
+	Conversion NoteConversion `json:"conversion"`
+}
+
+// NoteConversion - outcome of converting the body of a note
+type NoteConversion struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Lossy    bool     `json:"lossy"`
+	Warnings []string `json:"warnings,omitempty"`
 }
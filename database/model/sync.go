@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// SyncCounter model - `sync_counters` table
+//
+// last change sequence number given to the notes of a user
+type SyncCounter struct {
+	IDUser uint64 `gorm:"primaryKey;autoIncrement:false"`
+	Seq    uint64
+}
+
+// SyncChange - one change recorded by an offline client
+//
+// Op: create, update or delete
+//
+// BaseVersion: version of the note the client last saw,
+// ignored for create
+type SyncChange struct {
+	Op          string `json:"op"`
+	ClientRef   string `json:"clientRef,omitempty"`
+	NoteID      uint64 `json:"noteID,omitempty"`
+	BaseVersion uint64 `json:"baseVersion"`
+	Note        Note   `json:"note"`
+}
+
+// SyncPush - batch of client changes
+type SyncPush struct {
+	Changes []SyncChange `json:"changes" binding:"required"`
+}
+
+// SyncApplied - change accepted by the server
+type SyncApplied struct {
+	Op        string `json:"op"`
+	ClientRef string `json:"clientRef,omitempty"`
+	NoteID    uint64 `json:"noteID"`
+	Version   uint64 `json:"version"`
+}
+
+// SyncConflict - change rejected because the server state
+// diverged from the base version of the client
+type SyncConflict struct {
+	Op        string `json:"op"`
+	ClientRef string `json:"clientRef,omitempty"`
+	NoteID    uint64 `json:"noteID"`
+	Reason    string `json:"reason"`
+	Server    *Note  `json:"server,omitempty"`
+}
+
+// SyncRejected - change rejected because of invalid input
+type SyncRejected struct {
+	Op        string `json:"op"`
+	ClientRef string `json:"clientRef,omitempty"`
+	NoteID    uint64 `json:"noteID,omitempty"`
+	Message   string `json:"message"`
+}
+
+// SyncPushResult - outcome of a batch of client changes
+type SyncPushResult struct {
+	Applied   []SyncApplied  `json:"applied"`
+	Conflicts []SyncConflict `json:"conflicts"`
+	Rejected  []SyncRejected `json:"rejected"`
+}
+
+// SyncTombstone - deleted note
+type SyncTombstone struct {
+	NoteID    uint64    `json:"noteID"`
+	Version   uint64    `json:"version"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// SyncPull - all changes since a sync token
+type SyncPull struct {
+	Notes     []Note          `json:"notes"`
+	Deleted   []SyncTombstone `json:"deleted"`
+	SyncToken string          `json:"syncToken"`
+	HasMore   bool            `json:"hasMore"`
+}
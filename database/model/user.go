@@ -9,11 +9,117 @@ import (
 
 // User model - `users` table
 type User struct {
-	UserID    uint64         `gorm:"primaryKey" json:"userID,omitempty"`
-	CreatedAt time.Time      `json:"createdAt,omitempty"`
-	UpdatedAt time.Time      `json:"updatedAt,omitempty"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	NickName  string         `json:"nickName,omitempty"`
-	IDAuth    uint64         `json:"-"`
-	Notes     []Note         `gorm:"foreignkey:IDUser;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"notes,omitempty"`
+	UserID      uint64          `gorm:"primaryKey" json:"userID,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time       `json:"updatedAt,omitempty"`
+	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"-"`
+	NickName    string          `json:"nickName,omitempty"`
+	NickKey     *string         `gorm:"size:128;uniqueIndex" json:"-"`
+	NickChanged *time.Time      `json:"-"`
+	Bio         string          `gorm:"size:500" json:"bio,omitempty"`
+	Timezone    string          `gorm:"size:64" json:"timezone,omitempty"`
+	Locale      string          `gorm:"size:35" json:"locale,omitempty"`
+	Preferences UserPreferences `gorm:"embedded;embeddedPrefix:pref_" json:"preferences"`
+	Avatar      string          `gorm:"size:32" json:"avatar,omitempty"`
+	AvatarURL   string          `gorm:"-" json:"avatarURL,omitempty"`
+	DeleteAfter *time.Time      `gorm:"index" json:"deleteAfter,omitempty"`
+	IDAuth      uint64          `json:"-"`
+	Notes       []Note          `gorm:"foreignkey:IDUser;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"notes,omitempty"`
+	Keys        []UserKey       `gorm:"foreignkey:IDUser;references:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+// UserPreferences - display settings shared by all clients of a user
+//
+// - Theme: system (default), light or dark
+// - TimeFormat: 24h (default) or 12h
+// - LocalTime: timestamps in responses are rendered in the timezone of the user
+type UserPreferences struct {
+	Theme      string `gorm:"size:16" json:"theme,omitempty"`
+	TimeFormat string `gorm:"size:8" json:"timeFormat,omitempty"`
+	LocalTime  bool   `json:"localTime,omitempty"`
+}
+
+// UserUpdate - input of an update of a profile,
+// omitted fields keep their stored value
+type UserUpdate struct {
+	NickName    *string                `json:"nickName"`
+	Bio         *string                `json:"bio"`
+	Timezone    *string                `json:"timezone"`
+	Locale      *string                `json:"locale"`
+	Preferences *UserPreferencesUpdate `json:"preferences"`
+}
+
+// UserPreferencesUpdate - input of an update of the display settings,
+// omitted fields keep their stored value
+type UserPreferencesUpdate struct {
+	Theme      *string `json:"theme"`
+	TimeFormat *string `json:"timeFormat"`
+	LocalTime  *bool   `json:"localTime"`
+}
+
+// UserSettings model - `user_settings` table
+//
+// settings shared by the clients of a user, the keys
+// are declared by the server
+type UserSettings struct {
+	IDUser    uint64                 `gorm:"primaryKey;autoIncrement:false" json:"-"`
+	UpdatedAt time.Time              `json:"updatedAt,omitempty"`
+	Values    map[string]interface{} `gorm:"serializer:json" json:"settings"`
+}
+
+// NicknameReservation model - `nickname_reservations` table
+//
+// a nickname given up by a user stays reserved for them until
+// ExpiresAt, so nobody else can impersonate them right away
+type NicknameReservation struct {
+	NickKey   string    `gorm:"primaryKey;size:128"`
+	IDUser    uint64    `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// UserFilter - criteria of a profile search
+//
+// zero values do not filter, profiles are returned ordered by ID
+type UserFilter struct {
+	NickName string
+	AfterID  uint64
+	Limit    int
+}
+
+// UserPage - one page of profiles found by administrators
+//
+// NextAfterID is the cursor of the next page, 0 if there is none
+type UserPage struct {
+	Users       []AdminUser `json:"users"`
+	NextAfterID uint64      `json:"nextAfterID,omitempty"`
+}
+
+// AdminUser - a profile with the auth ID of its account
+type AdminUser struct {
+	User
+	IDAuth uint64 `json:"authID"`
+}
+
+// PublicProfile - part of a profile visible without authentication
+type PublicProfile struct {
+	NickName  string    `json:"nickName"`
+	Bio       string    `json:"bio,omitempty"`
+	AvatarURL string    `json:"avatarURL,omitempty"`
+	CreatedAt time.Time `json:"memberSince"`
+}
+
+// NicknameAvailability - answer of a nickname check
+type NicknameAvailability struct {
+	NickName  string `json:"nickName"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// AvatarImage - avatar of a user in one size, served as a file
+type AvatarImage struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+	Immutable   bool
 }
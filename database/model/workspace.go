@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// roles of workspace members, each role includes
+// the permissions of the ones below it
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleAdmin  = "admin"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+// Workspace model - `workspaces` table
+//
+// the notes of a workspace are shared with its members
+// according to their role
+type Workspace struct {
+	WorkspaceID uint64    `gorm:"primaryKey" json:"workspaceID,omitempty"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Role        string    `gorm:"-" json:"role,omitempty"`
+}
+
+// WorkspaceMember model - `workspace_members` table
+//
+// every workspace has exactly one member with the owner role
+type WorkspaceMember struct {
+	IDWorkspace uint64    `gorm:"primaryKey;autoIncrement:false" json:"workspaceID"`
+	IDUser      uint64    `gorm:"primaryKey;autoIncrement:false;index" json:"userID"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time `json:"updatedAt,omitempty"`
+	Role        string    `gorm:"size:16" json:"role"`
+	NickName    string    `gorm:"-" json:"nickName,omitempty"`
+}
+
+// WorkspaceInvitation model - `workspace_invitations` table
+//
+// addressed to an existing user, invited by nickname, or to an
+// email address, accepted by the user logged in with that address
+type WorkspaceInvitation struct {
+	InvitationID  uint64    `gorm:"primaryKey" json:"invitationID,omitempty"`
+	CreatedAt     time.Time `json:"createdAt,omitempty"`
+	ExpiresAt     time.Time `gorm:"index" json:"expiresAt"`
+	IDWorkspace   uint64    `gorm:"index" json:"workspaceID"`
+	WorkspaceName string    `gorm:"-" json:"workspaceName,omitempty"`
+	Role          string    `gorm:"size:16" json:"role"`
+	IDUser        *uint64   `gorm:"index" json:"-"`
+	NickName      string    `json:"nickName,omitempty"`
+	Email         string    `gorm:"index" json:"email,omitempty"`
+	IDInvitedBy   uint64    `json:"invitedBy,omitempty"`
+}
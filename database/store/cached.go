@@ -0,0 +1,210 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/cache"
+	"apidev/database/model"
+)
+
+// CachedUserStore - read-through cache of profiles by auth ID
+// in front of a UserStore
+type CachedUserStore struct {
+	UserStore
+	cache cache.Cache
+}
+
+// NewCachedUserStore wraps a UserStore with a cache
+func NewCachedUserStore(users UserStore, c cache.Cache) *CachedUserStore {
+	return &CachedUserStore{UserStore: users, cache: c}
+}
+
+// userCacheKey - key of a profile by auth ID
+func userCacheKey(authID uint64) string {
+	return "user:auth:" + strconv.FormatUint(authID, 10)
+}
+
+// FindByAuthID returns the cached profile or reads it from the store
+func (s *CachedUserStore) FindByAuthID(authID uint64) (model.User, error) {
+	key := userCacheKey(authID)
+
+	user := model.User{}
+	if value, ok := s.cache.Get(key); ok && decode(value, &user) {
+		return user, nil
+	}
+
+	user, err := s.UserStore.FindByAuthID(authID)
+	if err != nil {
+		return user, err
+	}
+	if value, ok := encode(user); ok {
+		s.cache.Set(key, value)
+	}
+	return user, nil
+}
+
+// Create saves a new profile and drops the cached entry
+func (s *CachedUserStore) Create(user *model.User, event *model.AuditEvent) error {
+	err := s.UserStore.Create(user, event)
+	s.cache.Delete(userCacheKey(user.IDAuth))
+	return err
+}
+
+// Update saves a profile and drops the cached entry
+func (s *CachedUserStore) Update(user *model.User, event *model.AuditEvent) error {
+	err := s.UserStore.Update(user, event)
+	s.cache.Delete(userCacheKey(user.IDAuth))
+	return err
+}
+
+// Purge deletes a profile and drops the cached entry
+func (s *CachedUserStore) Purge(user model.User) error {
+	err := s.UserStore.Purge(user)
+	s.cache.Delete(userCacheKey(user.IDAuth))
+	return err
+}
+
+// CachedNoteStore - read-through cache of individual notes
+// in front of a NoteStore
+type CachedNoteStore struct {
+	NoteStore
+	cache cache.Cache
+}
+
+// NewCachedNoteStore wraps a NoteStore with a cache
+func NewCachedNoteStore(notes NoteStore, c cache.Cache) *CachedNoteStore {
+	return &CachedNoteStore{NoteStore: notes, cache: c}
+}
+
+// noteCacheKey - key of a note by ID
+func noteCacheKey(noteID uint64) string {
+	return "note:" + strconv.FormatUint(noteID, 10)
+}
+
+// FindOne returns the cached note or reads it from the store
+//
+// the cache is keyed by note only, ownership is checked here
+func (s *CachedNoteStore) FindOne(owner Owner, noteID uint64) (model.Note, error) {
+	note, err := s.FindByID(noteID)
+	if err != nil || !owner.Owns(note) {
+		return model.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+// FindByID returns the cached note or reads it from the store
+func (s *CachedNoteStore) FindByID(noteID uint64) (model.Note, error) {
+	key := noteCacheKey(noteID)
+
+	note := model.Note{}
+	if value, ok := s.cache.Get(key); ok && decode(value, &note) {
+		return note, nil
+	}
+
+	note, err := s.NoteStore.FindByID(noteID)
+	if err != nil {
+		return note, err
+	}
+	if value, ok := encode(note); ok {
+		s.cache.Set(key, value)
+	}
+	return note, nil
+}
+
+// Update saves a note and drops the cached entry
+func (s *CachedNoteStore) Update(note *model.Note, event *model.AuditEvent) error {
+	err := s.NoteStore.Update(note, event)
+	s.Invalidate(note.NoteID)
+	return err
+}
+
+// Delete soft deletes a note and drops the cached entry
+func (s *CachedNoteStore) Delete(note *model.Note, event *model.AuditEvent) error {
+	err := s.NoteStore.Delete(note, event)
+	s.Invalidate(note.NoteID)
+	return err
+}
+
+// Reorder sets the positions of several notes and drops their cached entries
+func (s *CachedNoteStore) Reorder(owner Owner, positions map[uint64]string) error {
+	err := s.NoteStore.Reorder(owner, positions)
+	for noteID := range positions {
+		s.Invalidate(noteID)
+	}
+	return err
+}
+
+// Purge deletes all notes written by a user and drops their cached entries
+func (s *CachedNoteStore) Purge(userID uint64) error {
+	notes, err := s.NoteStore.FindAllByUser(userID)
+	if err != nil {
+		return err
+	}
+	err = s.NoteStore.Purge(userID)
+	for _, note := range notes {
+		s.Invalidate(note.NoteID)
+	}
+	return err
+}
+
+// Sync runs the writes of a sync push and drops the cached entries
+// of the notes it changed
+func (s *CachedNoteStore) Sync(fn func(batch SyncBatch) error) error {
+	batch := &cachedSyncBatch{}
+	err := s.NoteStore.Sync(func(b SyncBatch) error {
+		batch.SyncBatch = b
+		return fn(batch)
+	})
+	for _, noteID := range batch.changed {
+		s.Invalidate(noteID)
+	}
+	return err
+}
+
+// cachedSyncBatch - SyncBatch keeping the IDs of the notes it changed
+type cachedSyncBatch struct {
+	SyncBatch
+	changed []uint64
+}
+
+// Update saves a note and keeps its ID
+func (b *cachedSyncBatch) Update(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	b.changed = append(b.changed, note.NoteID)
+	return b.SyncBatch.Update(note, baseVersion, event)
+}
+
+// Delete soft deletes a note and keeps its ID
+func (b *cachedSyncBatch) Delete(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	b.changed = append(b.changed, note.NoteID)
+	return b.SyncBatch.Delete(note, baseVersion, event)
+}
+
+// Invalidate drops the cached note
+func (s *CachedNoteStore) Invalidate(noteID uint64) {
+	s.cache.Delete(noteCacheKey(noteID))
+}
+
+// encode serializes a record for the cache
+//
+// gob keeps the fields hidden from JSON responses (e.g. IDAuth)
+func encode(v interface{}) ([]byte, bool) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		log.WithError(err).Error("error code: 1611")
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decode deserializes a record from the cache
+func decode(value []byte, v interface{}) bool {
+	if err := gob.NewDecoder(bytes.NewReader(value)).Decode(v); err != nil {
+		log.WithError(err).Error("error code: 1612")
+		return false
+	}
+	return true
+}
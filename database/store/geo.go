@@ -0,0 +1,55 @@
+package store
+
+import (
+	"math"
+	"sort"
+
+	"apidev/database/model"
+	"apidev/lib/geo"
+)
+
+// filterByLocation keeps the notes matching a location query
+// and sets their distance to the center of the query
+//
+// stores without spatial support narrow down the candidates with
+// a bounding box and compute the exact distance here (haversine)
+func filterByLocation(notes []model.Note, query geo.Query) []model.Note {
+	found := []model.Note{}
+	for _, note := range notes {
+		if note.Latitude == nil || note.Longitude == nil {
+			continue
+		}
+		point := geo.Point{Lat: *note.Latitude, Lng: *note.Longitude}
+
+		if query.BBox != nil && !query.BBox.Contains(point) {
+			continue
+		}
+		if query.Near != nil {
+			distance := geo.Distance(*query.Near, point)
+			if distance > query.Radius {
+				continue
+			}
+			note.Distance = roundDistance(distance)
+		}
+		found = append(found, note)
+	}
+
+	sortByDistance(found)
+	return found
+}
+
+// sortByDistance orders notes by distance, then by ID
+func sortByDistance(notes []model.Note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Distance != nil && notes[j].Distance != nil && *notes[i].Distance != *notes[j].Distance {
+			return *notes[i].Distance < *notes[j].Distance
+		}
+		return notes[i].NoteID < notes[j].NoteID
+	})
+}
+
+// roundDistance rounds a distance in km to meters
+func roundDistance(km float64) *float64 {
+	rounded := math.Round(km*1000) / 1000
+	return &rounded
+}
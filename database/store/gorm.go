@@ -0,0 +1,1664 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"apidev/database/model"
+	"apidev/lib/geo"
+)
+
+// GormUserStore - UserStore backed by RDBMS
+type GormUserStore struct {
+	db *gorm.DB
+}
+
+// NewGormUserStore returns a UserStore using the given connection
+func NewGormUserStore(db *gorm.DB) *GormUserStore {
+	return &GormUserStore{db: db}
+}
+
+// FindByAuthID returns the profile linked to an auth ID
+func (s *GormUserStore) FindByAuthID(authID uint64) (user model.User, err error) {
+	err = gormError(s.db.Where("id_auth = ?", authID).First(&user).Error)
+	return
+}
+
+// FindByID returns a profile by its ID
+func (s *GormUserStore) FindByID(userID uint64) (user model.User, err error) {
+	err = gormError(s.db.Where("user_id = ?", userID).First(&user).Error)
+	return
+}
+
+// FindByNickname returns the profile using a nickname key
+func (s *GormUserStore) FindByNickname(key string) (user model.User, err error) {
+	err = gormError(s.db.Where("nick_key = ?", key).First(&user).Error)
+	return
+}
+
+// Search returns the profiles whose nickname contains the given one
+func (s *GormUserStore) Search(filter model.UserFilter) (users []model.User, err error) {
+	tx := s.db.Model(&model.User{})
+	if filter.NickName != "" {
+		tx = tx.Where("LOWER(nick_name) LIKE ? ESCAPE '!'", "%"+likeEscaper.Replace(strings.ToLower(filter.NickName))+"%")
+	}
+	if filter.AfterID != 0 {
+		tx = tx.Where("user_id > ?", filter.AfterID)
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+
+	users = []model.User{}
+	err = tx.Order("user_id").Find(&users).Error
+	return
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern with ESCAPE '!'
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// FindReservation returns the reservation of a nickname key
+func (s *GormUserStore) FindReservation(key string) (reservation model.NicknameReservation, err error) {
+	err = gormError(s.db.Where("nick_key = ?", key).First(&reservation).Error)
+	return
+}
+
+// Reserve creates or replaces the reservation of a nickname key
+func (s *GormUserStore) Reserve(reservation model.NicknameReservation) error {
+	return s.db.Save(&reservation).Error
+}
+
+// FindSettings returns the stored settings of a user
+func (s *GormUserStore) FindSettings(userID uint64) (settings model.UserSettings, err error) {
+	err = gormError(s.db.Where("id_user = ?", userID).First(&settings).Error)
+	return
+}
+
+// SaveSettings creates or replaces the settings of a user
+func (s *GormUserStore) SaveSettings(settings *model.UserSettings) error {
+	return s.db.Save(settings).Error
+}
+
+// Create saves a new profile
+func (s *GormUserStore) Create(user *model.User, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Create(user).Error; err != nil {
+		tx.Rollback()
+		return uniqueError(err)
+	}
+	if err := createEvent(tx, event, user.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Update saves all fields of an existing profile
+func (s *GormUserStore) Update(user *model.User, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Save(user).Error; err != nil {
+		tx.Rollback()
+		return uniqueError(err)
+	}
+	if err := createEvent(tx, event, user.UserID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// FindDeletionDue returns the profiles scheduled for deletion until the given time
+func (s *GormUserStore) FindDeletionDue(until time.Time) (users []model.User, err error) {
+	users = []model.User{}
+	err = s.db.Where("delete_after <= ?", until).Find(&users).Error
+	return
+}
+
+// Purge hard deletes a profile
+//
+// notes, their keys and the public keys of the user are deleted by
+// ON DELETE CASCADE (see migrate.SetPkFk), keys of notes shared
+// with the user, settings and nickname reservations are deleted here
+func (s *GormUserStore) Purge(user model.User) error {
+	tx := s.db.Begin()
+	if err := tx.Unscoped().Where("id_user = ?", user.UserID).Delete(&model.NoteKey{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_user = ?", user.UserID).Delete(&model.UserSettings{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_user = ?", user.UserID).Delete(&model.SyncCounter{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_user = ?", user.UserID).Delete(&model.NicknameReservation{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Unscoped().Delete(&model.User{}, user.UserID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// GormNoteStore - NoteStore backed by RDBMS
+type GormNoteStore struct {
+	db      *gorm.DB
+	postgis bool
+}
+
+// NewGormNoteStore returns a NoteStore using the given connection
+//
+// on PostgreSQL with the PostGIS extension, nearby queries are
+// answered by the database, otherwise with the haversine formula
+func NewGormNoteStore(db *gorm.DB) *GormNoteStore {
+	s := &GormNoteStore{db: db}
+	if db.Dialector.Name() == "postgres" {
+		var count int64
+		if err := db.Raw("SELECT COUNT(*) FROM pg_extension WHERE extname = ?", "postgis").Scan(&count).Error; err == nil {
+			s.postgis = count > 0
+		}
+	}
+	return s
+}
+
+// whereOwner restricts a query to the notes of an owner
+func whereOwner(tx *gorm.DB, owner Owner) *gorm.DB {
+	if owner.WorkspaceID != 0 {
+		return tx.Where("id_workspace = ?", owner.WorkspaceID)
+	}
+	return tx.Where("id_user = ?", owner.UserID).Where("id_workspace IS NULL")
+}
+
+// FindByOwner returns all notes of an owner
+func (s *GormNoteStore) FindByOwner(owner Owner) (notes []model.Note, err error) {
+	notes = []model.Note{}
+	err = whereOwner(s.db, owner).Find(&notes).Error
+	return
+}
+
+// FindOne returns a note if it belongs to the owner
+func (s *GormNoteStore) FindOne(owner Owner, noteID uint64) (note model.Note, err error) {
+	err = gormError(whereOwner(s.db.Where("note_id = ?", noteID), owner).First(&note).Error)
+	return
+}
+
+// FindByID returns a note of any owner
+func (s *GormNoteStore) FindByID(noteID uint64) (note model.Note, err error) {
+	err = gormError(s.db.Where("note_id = ?", noteID).First(&note).Error)
+	return
+}
+
+// FindAllByUser returns all notes written by a user, soft deleted ones included
+func (s *GormNoteStore) FindAllByUser(userID uint64) (notes []model.Note, err error) {
+	notes = []model.Note{}
+	err = s.db.Unscoped().Where("id_user = ?", userID).Order("note_id").Find(&notes).Error
+	return
+}
+
+// FindByLocation returns the notes of an owner matching a location query
+func (s *GormNoteStore) FindByLocation(owner Owner, query geo.Query) ([]model.Note, error) {
+	if s.postgis && query.Near != nil {
+		return s.findNearPostGIS(owner, query)
+	}
+
+	// narrow down the candidates, the exact distance is computed afterwards
+	tx := whereOwner(s.db, owner).Where("latitude IS NOT NULL")
+	if query.Near != nil {
+		tx = whereBBox(tx, geo.Around(*query.Near, query.Radius))
+	}
+	if query.BBox != nil {
+		tx = whereBBox(tx, *query.BBox)
+	}
+
+	notes := []model.Note{}
+	if err := tx.Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return filterByLocation(notes, query), nil
+}
+
+// postgisPoint - location of a note as geography,
+// matches the expression of the index idx_notes_geog
+const postgisPoint = "geography(ST_MakePoint(longitude, latitude))"
+
+// findNearPostGIS lets PostGIS find the notes within the radius
+// and compute their distance
+func (s *GormNoteStore) findNearPostGIS(owner Owner, query geo.Query) ([]model.Note, error) {
+	center := "geography(ST_MakePoint(?, ?))"
+	rows := []struct {
+		NoteID   uint64
+		Distance float64
+	}{}
+
+	tx := whereOwner(s.db.Model(&model.Note{}), owner).
+		Select("note_id, ST_Distance("+postgisPoint+", "+center+") / 1000 AS distance", query.Near.Lng, query.Near.Lat).
+		Where("latitude IS NOT NULL").
+		Where("ST_DWithin("+postgisPoint+", "+center+", ?)", query.Near.Lng, query.Near.Lat, query.Radius*1000)
+	if query.BBox != nil {
+		tx = whereBBox(tx, *query.BBox)
+	}
+	if err := tx.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	notes := []model.Note{}
+	if len(rows) == 0 {
+		return notes, nil
+	}
+
+	noteIDs := make([]uint64, 0, len(rows))
+	distances := map[uint64]float64{}
+	for _, row := range rows {
+		noteIDs = append(noteIDs, row.NoteID)
+		distances[row.NoteID] = row.Distance
+	}
+	if err := s.db.Where("note_id IN ?", noteIDs).Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		notes[i].Distance = roundDistance(distances[notes[i].NoteID])
+	}
+
+	sortByDistance(notes)
+	return notes, nil
+}
+
+// whereBBox restricts a query to notes inside a bounding box
+func whereBBox(tx *gorm.DB, box geo.BBox) *gorm.DB {
+	tx = tx.Where("latitude BETWEEN ? AND ?", box.MinLat, box.MaxLat)
+	if box.MinLng <= box.MaxLng {
+		return tx.Where("longitude BETWEEN ? AND ?", box.MinLng, box.MaxLng)
+	}
+	// crossing the antimeridian
+	return tx.Where("(longitude >= ? OR longitude <= ?)", box.MinLng, box.MaxLng)
+}
+
+// FindByPosition returns all notes of an owner in manual order
+func (s *GormNoteStore) FindByPosition(owner Owner) (notes []model.Note, err error) {
+	notes = []model.Note{}
+	err = whereOwner(s.db, owner).
+		Order("CASE WHEN position = '' THEN 1 ELSE 0 END").
+		Order("position").
+		Order("note_id").
+		Find(&notes).Error
+	return
+}
+
+// LastPosition returns the greatest position of the notes of an owner
+func (s *GormNoteStore) LastPosition(owner Owner) (string, error) {
+	return lastPosition(s.db, owner)
+}
+
+// lastPosition returns the greatest position of the notes of an owner
+// seen by a connection or transaction
+func lastPosition(tx *gorm.DB, owner Owner) (string, error) {
+	positions := []string{}
+	err := whereOwner(tx.Model(&model.Note{}), owner).
+		Where("position <> ''").
+		Order("position DESC").
+		Limit(1).
+		Pluck("position", &positions).Error
+	if err != nil || len(positions) == 0 {
+		return "", err
+	}
+	return positions[0], nil
+}
+
+// AdjacentPosition returns the closest position after (or before) the given one
+func (s *GormNoteStore) AdjacentPosition(owner Owner, position string, after bool) (string, error) {
+	tx := whereOwner(s.db.Model(&model.Note{}), owner).Where("position <> ''")
+	if after {
+		tx = tx.Where("position > ?", position).Order("position ASC")
+	} else {
+		tx = tx.Where("position < ?", position).Order("position DESC")
+	}
+
+	positions := []string{}
+	if err := tx.Limit(1).Pluck("position", &positions).Error; err != nil || len(positions) == 0 {
+		return "", err
+	}
+	return positions[0], nil
+}
+
+// Reorder sets the positions of several notes of an owner in one transaction
+func (s *GormNoteStore) Reorder(owner Owner, positions map[uint64]string) error {
+	noteIDs := make([]uint64, 0, len(positions))
+	for noteID := range positions {
+		noteIDs = append(noteIDs, noteID)
+	}
+
+	now := time.Now()
+	tx := s.db.Begin()
+
+	// the counters of the authors are locked in the same order
+	// by concurrent moves
+	notes := []model.Note{}
+	if err := whereOwner(tx.Where("note_id IN ?", noteIDs), owner).
+		Order("id_user").Order("note_id").Find(&notes).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, note := range notes {
+		seq, err := NextChangeSeq(tx, note.IDUser)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Model(&model.Note{}).Where("note_id = ?", note.NoteID).
+			Updates(map[string]interface{}{
+				"position":   positions[note.NoteID],
+				"updated_at": now,
+				"version":    gorm.Expr("version + 1"),
+				"change_seq": seq,
+			}).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// Create saves a new note
+func (s *GormNoteStore) Create(note *model.Note, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	seq, err := NextChangeSeq(tx, note.IDUser)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	note.ChangeSeq = seq
+	if err := tx.Create(note).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, note.NoteID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Update saves all fields of an existing note
+func (s *GormNoteStore) Update(note *model.Note, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	seq, err := NextChangeSeq(tx, note.IDUser)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	note.ChangeSeq = seq
+	if err := tx.Save(note).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, note.NoteID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Delete soft deletes a note and bumps its version
+func (s *GormNoteStore) Delete(note *model.Note, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	seq, err := NextChangeSeq(tx, note.IDUser)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(note).Updates(map[string]interface{}{"updated_at": time.Now(), "version": note.Version + 1, "change_seq": seq}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(note).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, note.NoteID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// NextChangeSeq returns the next change sequence number of the notes
+// of a user, to be saved with a change in the same transaction
+//
+// the counter of the user stays locked until the transaction ends, so
+// the changes of a user are committed in the order of their numbers
+// and a delta sync never skips one
+func NextChangeSeq(tx *gorm.DB, userID uint64) (uint64, error) {
+	counter := model.SyncCounter{IDUser: userID}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&counter).Error; err != nil {
+		return 0, err
+	}
+	err := tx.Model(&model.SyncCounter{}).
+		Where("id_user = ?", userID).
+		Update("seq", gorm.Expr("seq + 1")).Error
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Where("id_user = ?", userID).First(&counter).Error; err != nil {
+		return 0, err
+	}
+	return counter.Seq, nil
+}
+
+// Purge does nothing, notes are deleted with the profile
+// by ON DELETE CASCADE in GormUserStore.Purge, notes of workspaces
+// are handed over by WorkspaceStore.Purge beforehand
+func (s *GormNoteStore) Purge(userID uint64) error {
+	return nil
+}
+
+// FindChanges returns the personal notes of a user changed after the cursor
+//
+// notes saved before the change sequence was introduced share the
+// number 0, the note ID breaks the tie
+func (s *GormNoteStore) FindChanges(userID uint64, after *ChangeCursor, limit int) (notes []model.Note, err error) {
+	tx := whereOwner(s.db.Unscoped(), Personal(userID))
+	if after == nil {
+		tx = tx.Where("deleted_at IS NULL")
+	} else {
+		tx = tx.Where("(change_seq > ? OR (change_seq = ? AND note_id > ?))", after.ChangeSeq, after.ChangeSeq, after.NoteID)
+	}
+
+	notes = []model.Note{}
+	err = tx.Order("change_seq ASC").Order("note_id ASC").Limit(limit).Find(&notes).Error
+	return
+}
+
+// Sync runs the writes of a sync push in one transaction
+func (s *GormNoteStore) Sync(fn func(batch SyncBatch) error) error {
+	tx := s.db.Begin()
+	if err := fn(&gormSyncBatch{tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// gormSyncBatch - SyncBatch writing in the transaction of a sync push
+type gormSyncBatch struct {
+	tx *gorm.DB
+}
+
+// FindOne returns a note if it belongs to the owner, soft deleted ones included
+func (b *gormSyncBatch) FindOne(owner Owner, noteID uint64) (note model.Note, err error) {
+	err = gormError(whereOwner(b.tx.Unscoped().Where("note_id = ?", noteID), owner).First(&note).Error)
+	return
+}
+
+// LastPosition returns the greatest position of the notes of an owner
+func (b *gormSyncBatch) LastPosition(owner Owner) (string, error) {
+	return lastPosition(b.tx, owner)
+}
+
+// Create saves a new note
+func (b *gormSyncBatch) Create(note *model.Note, event *model.AuditEvent) error {
+	seq, err := NextChangeSeq(b.tx, note.IDUser)
+	if err != nil {
+		return err
+	}
+	note.ChangeSeq = seq
+	if err := b.tx.Create(note).Error; err != nil {
+		return err
+	}
+	return createEvent(b.tx, event, note.NoteID)
+}
+
+// Update saves the content and location of a note still at the base version
+func (b *gormSyncBatch) Update(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	return b.write(note, baseVersion, false, event)
+}
+
+// Delete soft deletes a note still at the base version
+func (b *gormSyncBatch) Delete(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	return b.write(note, baseVersion, true, event)
+}
+
+// write saves a change of a note with its new version, timestamp
+// and change sequence number
+//
+// the version check in the WHERE clause protects against concurrent
+// writers between the read of the note and this update
+func (b *gormSyncBatch) write(note *model.Note, baseVersion uint64, deleted bool, event *model.AuditEvent) error {
+	seq, err := NextChangeSeq(b.tx, note.IDUser)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"updated_at": now,
+		"version":    baseVersion + 1,
+		"change_seq": seq,
+	}
+	if deleted {
+		updates["deleted_at"] = now
+	} else {
+		updates["title"] = note.Title
+		updates["body"] = note.Body
+		updates["content_type"] = note.ContentType
+		updates["ciphertext"] = note.Ciphertext
+		updates["algorithm"] = note.Algorithm
+		updates["key_id"] = note.KeyID
+		updates["nonce"] = note.Nonce
+		updates["latitude"] = note.Latitude
+		updates["longitude"] = note.Longitude
+		updates["accuracy"] = note.Accuracy
+		updates["place_name"] = note.PlaceName
+	}
+
+	res := b.tx.Unscoped().Model(&model.Note{}).
+		Where("note_id = ?", note.NoteID).
+		Where("version = ?", baseVersion).
+		Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrConflict
+	}
+
+	note.UpdatedAt = now
+	note.Version = baseVersion + 1
+	note.ChangeSeq = seq
+	if deleted {
+		note.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	}
+	return createEvent(b.tx, event, note.NoteID)
+}
+
+// GormAuditStore - AuditStore backed by RDBMS
+type GormAuditStore struct {
+	db *gorm.DB
+}
+
+// NewGormAuditStore returns an AuditStore using the given connection
+func NewGormAuditStore(db *gorm.DB) *GormAuditStore {
+	return &GormAuditStore{db: db}
+}
+
+// Append saves an event
+func (s *GormAuditStore) Append(event *model.AuditEvent) error {
+	return s.db.Create(event).Error
+}
+
+// Find returns the events matching the filter, newest first
+func (s *GormAuditStore) Find(filter model.AuditFilter) (events []model.AuditEvent, err error) {
+	tx := s.db.Model(&model.AuditEvent{})
+	if filter.IDAuth != 0 {
+		tx = tx.Where("id_auth = ?", filter.IDAuth)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		tx = tx.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != 0 {
+		tx = tx.Where("resource_id = ?", filter.ResourceID)
+	}
+	if !filter.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		tx = tx.Where("created_at < ?", filter.Until)
+	}
+	if filter.BeforeID != 0 {
+		tx = tx.Where("event_id < ?", filter.BeforeID)
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+
+	events = []model.AuditEvent{}
+	err = tx.Order("event_id DESC").Find(&events).Error
+	return
+}
+
+// Purge removes all events of an actor
+func (s *GormAuditStore) Purge(authID uint64) error {
+	return s.db.Where("id_auth = ?", authID).Delete(&model.AuditEvent{}).Error
+}
+
+// GormAuthStore - AuthStore backed by RDBMS, the database of gorest
+type GormAuthStore struct {
+	db *gorm.DB
+}
+
+// NewGormAuthStore returns an AuthStore using the given connection
+func NewGormAuthStore(db *gorm.DB) *GormAuthStore {
+	return &GormAuthStore{db: db}
+}
+
+// Delete hard deletes the credentials of an auth ID and saves the revocation
+func (s *GormAuthStore) Delete(revocation model.AuthRevocation) error {
+	tx := s.db.Begin()
+	if err := tx.Unscoped().Where("id_auth = ?", revocation.IDAuth).Delete(&gmodel.TwoFA{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Unscoped().Where("auth_id = ?", revocation.IDAuth).Delete(&gmodel.Auth{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.AuthRole{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.AuthSuspension{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.AccessToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.AuthIdentity{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.OAuthState{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	// the clients of the user with the grants of all users
+	clients := tx.Model(&model.OAuthClient{}).Select("client_id").Where("id_auth = ?", revocation.IDAuth)
+	if err := tx.Where("id_auth = ? OR client_id IN (?)", revocation.IDAuth, clients).Delete(&model.OAuthToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ? OR client_id IN (?)", revocation.IDAuth, clients).Delete(&model.OAuthCode{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.OAuthClient{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	sessions := tx.Model(&model.Session{}).Select("session_id").Where("id_auth = ?", revocation.IDAuth)
+	if err := tx.Where("id_session IN (?)", sessions).Delete(&model.SessionToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.Session{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.EmailToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.Passkey{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_auth = ?", revocation.IDAuth).Delete(&model.PasskeyChallenge{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Save(&revocation).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Revoke creates or replaces the revocation of the JWTs of an auth ID
+func (s *GormAuthStore) Revoke(revocation model.AuthRevocation) error {
+	return s.db.Save(&revocation).Error
+}
+
+// FindRevocation returns the revocation of the JWTs of an auth ID
+func (s *GormAuthStore) FindRevocation(authID uint64) (revocation model.AuthRevocation, err error) {
+	err = gormError(s.db.Where("id_auth = ?", authID).First(&revocation).Error)
+	return
+}
+
+// PruneRevocations removes the revocations expired until the given time
+func (s *GormAuthStore) PruneRevocations(until time.Time) error {
+	return s.db.Where("expires_at <= ?", until).Delete(&model.AuthRevocation{}).Error
+}
+
+// FindAuth returns the credentials of an auth ID
+func (s *GormAuthStore) FindAuth(authID uint64) (auth gmodel.Auth, err error) {
+	err = gormError(s.db.Where("auth_id = ?", authID).First(&auth).Error)
+	return
+}
+
+// FindAuthByEmail returns the credentials with an unencrypted email
+func (s *GormAuthStore) FindAuthByEmail(email string) (auth gmodel.Auth, err error) {
+	err = gormError(s.db.Where("email = ?", email).First(&auth).Error)
+	return
+}
+
+// CreateAuth saves new credentials and links the identity
+// in one transaction, ErrConflict if the identity is linked already
+func (s *GormAuthStore) CreateAuth(auth *gmodel.Auth, identity *model.AuthIdentity) error {
+	tx := s.db.Begin()
+	if err := tx.Create(auth).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	identity.IDAuth = auth.AuthID
+	if err := tx.Create(identity).Error; err != nil {
+		tx.Rollback()
+		return uniqueError(err)
+	}
+	return tx.Commit().Error
+}
+
+// SetEmailVerification saves the state of the verification of the email of an auth ID
+func (s *GormAuthStore) SetEmailVerification(authID uint64, state int8) error {
+	return s.db.Model(&gmodel.Auth{}).Where("auth_id = ?", authID).Update("verify_email", state).Error
+}
+
+// SetPassword replaces the password hash of an auth ID
+func (s *GormAuthStore) SetPassword(authID uint64, hash string) error {
+	return s.db.Model(&gmodel.Auth{}).Where("auth_id = ?", authID).Update("password", hash).Error
+}
+
+// FindTwoFA returns the two-factor authentication of an auth ID
+func (s *GormAuthStore) FindTwoFA(authID uint64) (twoFA gmodel.TwoFA, err error) {
+	err = gormError(s.db.Where("id_auth = ?", authID).First(&twoFA).Error)
+	return
+}
+
+// FindRoles returns the roles granted to an auth ID
+func (s *GormAuthStore) FindRoles(authID uint64) (roles []model.AuthRole, err error) {
+	roles = []model.AuthRole{}
+	err = s.db.Where("id_auth = ?", authID).Order("role").Find(&roles).Error
+	return
+}
+
+// FindGrants returns the grants of a role, or of all roles
+func (s *GormAuthStore) FindGrants(role string) (roles []model.AuthRole, err error) {
+	tx := s.db.Model(&model.AuthRole{})
+	if role != "" {
+		tx = tx.Where("role = ?", role)
+	}
+	roles = []model.AuthRole{}
+	err = tx.Order("id_auth").Order("role").Find(&roles).Error
+	return
+}
+
+// Grant creates or replaces the grant of a role
+func (s *GormAuthStore) Grant(role model.AuthRole) error {
+	return s.db.Save(&role).Error
+}
+
+// Ungrant removes a role from an auth ID
+func (s *GormAuthStore) Ungrant(authID uint64, role string) error {
+	return s.db.Where("id_auth = ?", authID).Where("role = ?", role).Delete(&model.AuthRole{}).Error
+}
+
+// FindSuspension returns the suspension of an auth ID
+func (s *GormAuthStore) FindSuspension(authID uint64) (suspension model.AuthSuspension, err error) {
+	err = gormError(s.db.Where("id_auth = ?", authID).First(&suspension).Error)
+	return
+}
+
+// Suspend creates or replaces the suspension of an auth ID
+func (s *GormAuthStore) Suspend(suspension model.AuthSuspension) error {
+	return s.db.Save(&suspension).Error
+}
+
+// Unsuspend removes the suspension of an auth ID
+func (s *GormAuthStore) Unsuspend(authID uint64) error {
+	return s.db.Where("id_auth = ?", authID).Delete(&model.AuthSuspension{}).Error
+}
+
+// FindTokens returns the access tokens of an auth ID, newest first
+func (s *GormAuthStore) FindTokens(authID uint64) (tokens []model.AccessToken, err error) {
+	tokens = []model.AccessToken{}
+	err = s.db.Where("id_auth = ?", authID).Order("token_id DESC").Find(&tokens).Error
+	return
+}
+
+// FindToken returns an access token by its ID
+func (s *GormAuthStore) FindToken(tokenID uint64) (token model.AccessToken, err error) {
+	err = gormError(s.db.Where("token_id = ?", tokenID).First(&token).Error)
+	return
+}
+
+// CreateToken saves a new access token
+func (s *GormAuthStore) CreateToken(token *model.AccessToken) error {
+	return s.db.Create(token).Error
+}
+
+// TouchToken sets the time an access token was last used
+func (s *GormAuthStore) TouchToken(tokenID uint64, usedAt time.Time) error {
+	return s.db.Model(&model.AccessToken{}).Where("token_id = ?", tokenID).Update("last_used_at", usedAt).Error
+}
+
+// DeleteToken removes an access token
+func (s *GormAuthStore) DeleteToken(tokenID uint64) error {
+	return s.db.Where("token_id = ?", tokenID).Delete(&model.AccessToken{}).Error
+}
+
+// DeleteTokens removes all access tokens of an auth ID
+func (s *GormAuthStore) DeleteTokens(authID uint64) error {
+	return s.db.Where("id_auth = ?", authID).Delete(&model.AccessToken{}).Error
+}
+
+// FindIdentity returns the identity of a user at a provider
+func (s *GormAuthStore) FindIdentity(provider, subject string) (identity model.AuthIdentity, err error) {
+	err = gormError(s.db.Where("provider = ?", provider).Where("subject = ?", subject).First(&identity).Error)
+	return
+}
+
+// FindIdentities returns the identities linked to an auth ID
+func (s *GormAuthStore) FindIdentities(authID uint64) (identities []model.AuthIdentity, err error) {
+	identities = []model.AuthIdentity{}
+	err = s.db.Where("id_auth = ?", authID).Order("provider").Find(&identities).Error
+	return
+}
+
+// CreateIdentity links an identity to an existing auth ID,
+// ErrConflict if it is linked already
+func (s *GormAuthStore) CreateIdentity(identity *model.AuthIdentity) error {
+	if err := s.db.Create(identity).Error; err != nil {
+		return uniqueError(err)
+	}
+	return nil
+}
+
+// DeleteIdentity unlinks the identity at a provider from an auth ID
+func (s *GormAuthStore) DeleteIdentity(authID uint64, provider string) error {
+	return s.db.Where("id_auth = ?", authID).Where("provider = ?", provider).Delete(&model.AuthIdentity{}).Error
+}
+
+// SaveOAuthState saves a login waiting for its callback
+func (s *GormAuthStore) SaveOAuthState(state model.OAuthState) error {
+	return s.db.Create(&state).Error
+}
+
+// TakeOAuthState returns and removes a login, of concurrent
+// callbacks with the same state only one gets it
+func (s *GormAuthStore) TakeOAuthState(state string) (oauthState model.OAuthState, err error) {
+	if err = gormError(s.db.Where("state = ?", state).First(&oauthState).Error); err != nil {
+		return
+	}
+	result := s.db.Where("state = ?", state).Delete(&model.OAuthState{})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// PruneOAuthStates removes the logins expired until the given time
+func (s *GormAuthStore) PruneOAuthStates(until time.Time) error {
+	return s.db.Where("expires_at <= ?", until).Delete(&model.OAuthState{}).Error
+}
+
+// FindClients returns the OAuth2 clients registered by an auth ID, newest first
+func (s *GormAuthStore) FindClients(authID uint64) (clients []model.OAuthClient, err error) {
+	clients = []model.OAuthClient{}
+	err = s.db.Where("id_auth = ?", authID).Order("created_at DESC").Find(&clients).Error
+	return
+}
+
+// FindClient returns an OAuth2 client by its ID
+func (s *GormAuthStore) FindClient(clientID string) (client model.OAuthClient, err error) {
+	err = gormError(s.db.Where("client_id = ?", clientID).First(&client).Error)
+	return
+}
+
+// CreateClient saves a new OAuth2 client, ErrConflict if the ID is taken
+func (s *GormAuthStore) CreateClient(client *model.OAuthClient) error {
+	if err := s.db.Create(client).Error; err != nil {
+		return uniqueError(err)
+	}
+	return nil
+}
+
+// DeleteClient removes an OAuth2 client with its codes and tokens
+func (s *GormAuthStore) DeleteClient(clientID string) error {
+	tx := s.db.Begin()
+	if err := tx.Where("client_id = ?", clientID).Delete(&model.OAuthToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("client_id = ?", clientID).Delete(&model.OAuthCode{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("client_id = ?", clientID).Delete(&model.OAuthClient{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// CreateOAuthCode saves a new authorization request
+func (s *GormAuthStore) CreateOAuthCode(code *model.OAuthCode) error {
+	return s.db.Create(code).Error
+}
+
+// FindOAuthCode returns an authorization request by its ID
+func (s *GormAuthStore) FindOAuthCode(codeID uint64) (code model.OAuthCode, err error) {
+	err = gormError(s.db.Where("code_id = ?", codeID).First(&code).Error)
+	return
+}
+
+// TakeOAuthCode returns and removes an authorization request
+func (s *GormAuthStore) TakeOAuthCode(codeID uint64) (code model.OAuthCode, err error) {
+	if err = gormError(s.db.Where("code_id = ?", codeID).First(&code).Error); err != nil {
+		return
+	}
+	result := s.db.Where("code_id = ?", codeID).Delete(&model.OAuthCode{})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// FindOAuthTokens returns the OAuth2 tokens of an auth ID, oldest first
+func (s *GormAuthStore) FindOAuthTokens(authID uint64) (tokens []model.OAuthToken, err error) {
+	tokens = []model.OAuthToken{}
+	err = s.db.Where("id_auth = ?", authID).Order("token_id").Find(&tokens).Error
+	return
+}
+
+// FindOAuthToken returns an OAuth2 token by its ID
+func (s *GormAuthStore) FindOAuthToken(tokenID uint64) (token model.OAuthToken, err error) {
+	err = gormError(s.db.Where("token_id = ?", tokenID).First(&token).Error)
+	return
+}
+
+// CreateOAuthToken saves a new OAuth2 token
+func (s *GormAuthStore) CreateOAuthToken(token *model.OAuthToken) error {
+	return s.db.Create(token).Error
+}
+
+// DeleteOAuthToken removes an OAuth2 token and the access tokens issued with it
+func (s *GormAuthStore) DeleteOAuthToken(tokenID uint64) error {
+	return s.db.Where("token_id = ? OR id_refresh = ?", tokenID, tokenID).Delete(&model.OAuthToken{}).Error
+}
+
+// DeleteOAuthTokens removes the OAuth2 tokens of an auth ID issued to
+// a client, or to all clients if it is empty
+func (s *GormAuthStore) DeleteOAuthTokens(authID uint64, clientID string) error {
+	query := s.db.Where("id_auth = ?", authID)
+	if clientID != "" {
+		query = query.Where("client_id = ?", clientID)
+	}
+	return query.Delete(&model.OAuthToken{}).Error
+}
+
+// PruneOAuthGrants removes the authorization requests and OAuth2 tokens
+// expired until the given time
+func (s *GormAuthStore) PruneOAuthGrants(until time.Time) error {
+	if err := s.db.Where("expires_at <= ?", until).Delete(&model.OAuthCode{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at <= ?", until).Delete(&model.OAuthToken{}).Error
+}
+
+// FindSessions returns the sessions of an auth ID which are not revoked, newest first
+func (s *GormAuthStore) FindSessions(authID uint64) (sessions []model.Session, err error) {
+	sessions = []model.Session{}
+	err = s.db.Where("id_auth = ? AND revoked_at IS NULL", authID).Order("session_id DESC").Find(&sessions).Error
+	return
+}
+
+// FindSession returns a session by its ID
+func (s *GormAuthStore) FindSession(sessionID uint64) (session model.Session, err error) {
+	err = gormError(s.db.Where("session_id = ?", sessionID).First(&session).Error)
+	return
+}
+
+// FindSessionToken returns a JWT issued to a session by its jti
+func (s *GormAuthStore) FindSessionToken(jti string) (token model.SessionToken, err error) {
+	err = gormError(s.db.Where("jti = ?", jti).First(&token).Error)
+	return
+}
+
+// CreateSession saves a new session with its first tokens
+func (s *GormAuthStore) CreateSession(session *model.Session, tokens []model.SessionToken) error {
+	tx := s.db.Begin()
+	if err := tx.Create(session).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i := range tokens {
+		tokens[i].IDSession = session.SessionID
+	}
+	if len(tokens) > 0 {
+		if err := tx.Create(&tokens).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// RefreshSession saves the refresh of a session with its new tokens
+// and marks the refresh token they replace
+func (s *GormAuthStore) RefreshSession(session model.Session, replaced string, tokens []model.SessionToken) error {
+	tx := s.db.Begin()
+	if err := tx.Model(&model.Session{}).Where("session_id = ?", session.SessionID).Updates(map[string]interface{}{
+		"refreshed_at": session.RefreshedAt,
+		"expires_at":   session.ExpiresAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if replaced != "" {
+		if err := tx.Model(&model.SessionToken{}).Where("jti = ?", replaced).Update("replaced", true).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for i := range tokens {
+		tokens[i].IDSession = session.SessionID
+	}
+	if len(tokens) > 0 {
+		if err := tx.Create(&tokens).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// RevokeSession marks a session as revoked
+func (s *GormAuthStore) RevokeSession(sessionID uint64, revokedAt time.Time) error {
+	return s.db.Model(&model.Session{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", revokedAt).Error
+}
+
+// RevokeSessions marks all sessions of an auth ID as revoked except one,
+// or all of them if it is 0
+func (s *GormAuthStore) RevokeSessions(authID, exceptID uint64, revokedAt time.Time) error {
+	return s.db.Model(&model.Session{}).Where("id_auth = ? AND session_id <> ? AND revoked_at IS NULL", authID, exceptID).Update("revoked_at", revokedAt).Error
+}
+
+// PruneSessions removes the sessions and their tokens expired until the given time
+func (s *GormAuthStore) PruneSessions(until time.Time) error {
+	if err := s.db.Where("expires_at <= ?", until).Delete(&model.SessionToken{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at <= ?", until).Delete(&model.Session{}).Error
+}
+
+// FindEmailTokens returns the email tokens of a kind of an auth ID, newest first
+func (s *GormAuthStore) FindEmailTokens(authID uint64, kind string) (tokens []model.EmailToken, err error) {
+	tokens = []model.EmailToken{}
+	err = s.db.Where("id_auth = ? AND kind = ?", authID, kind).Order("token_id DESC").Find(&tokens).Error
+	return
+}
+
+// FindEmailToken returns an email token by its ID
+func (s *GormAuthStore) FindEmailToken(tokenID uint64) (token model.EmailToken, err error) {
+	err = gormError(s.db.Where("token_id = ?", tokenID).First(&token).Error)
+	return
+}
+
+// CreateEmailToken saves a new email token
+func (s *GormAuthStore) CreateEmailToken(token *model.EmailToken) error {
+	return s.db.Create(token).Error
+}
+
+// TakeEmailToken returns and removes an email token, of concurrent
+// calls with the same ID only one gets it
+func (s *GormAuthStore) TakeEmailToken(tokenID uint64) (token model.EmailToken, err error) {
+	if err = gormError(s.db.Where("token_id = ?", tokenID).First(&token).Error); err != nil {
+		return
+	}
+	result := s.db.Where("token_id = ?", tokenID).Delete(&model.EmailToken{})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// DeleteEmailTokens removes the email tokens of a kind of an auth ID
+func (s *GormAuthStore) DeleteEmailTokens(authID uint64, kind string) error {
+	return s.db.Where("id_auth = ? AND kind = ?", authID, kind).Delete(&model.EmailToken{}).Error
+}
+
+// PruneEmailTokens removes the email tokens expired until the given time
+func (s *GormAuthStore) PruneEmailTokens(until time.Time) error {
+	return s.db.Where("expires_at <= ?", until).Delete(&model.EmailToken{}).Error
+}
+
+// FindPasskeys returns the passkeys of an auth ID, oldest first
+func (s *GormAuthStore) FindPasskeys(authID uint64) (passkeys []model.Passkey, err error) {
+	passkeys = []model.Passkey{}
+	err = s.db.Where("id_auth = ?", authID).Order("passkey_id").Find(&passkeys).Error
+	return
+}
+
+// FindPasskey returns a passkey by its credential ID
+func (s *GormAuthStore) FindPasskey(credentialID string) (passkey model.Passkey, err error) {
+	err = gormError(s.db.Where("credential_id = ?", credentialID).First(&passkey).Error)
+	return
+}
+
+// CreatePasskey saves a new passkey,
+// ErrConflict if the credential is registered already
+func (s *GormAuthStore) CreatePasskey(passkey *model.Passkey) error {
+	if err := s.db.Create(passkey).Error; err != nil {
+		return uniqueError(err)
+	}
+	return nil
+}
+
+// UsePasskey saves the signature counter of an authentication, the
+// counter is only raised, authenticators without counter send 0
+func (s *GormAuthStore) UsePasskey(passkeyID uint64, signCount uint32, usedAt time.Time) error {
+	result := s.db.Model(&model.Passkey{}).
+		Where("passkey_id = ? AND (sign_count < ? OR ? = 0)", passkeyID, signCount, signCount).
+		Updates(map[string]interface{}{"sign_count": signCount, "last_used_at": usedAt})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// DeletePasskey removes a passkey
+func (s *GormAuthStore) DeletePasskey(passkeyID uint64) error {
+	return s.db.Where("passkey_id = ?", passkeyID).Delete(&model.Passkey{}).Error
+}
+
+// CreatePasskeyChallenge saves a started ceremony
+func (s *GormAuthStore) CreatePasskeyChallenge(challenge model.PasskeyChallenge) error {
+	return s.db.Create(&challenge).Error
+}
+
+// TakePasskeyChallenge returns and removes a started ceremony, of
+// concurrent calls with the same challenge only one gets it
+func (s *GormAuthStore) TakePasskeyChallenge(challenge string) (passkeyChallenge model.PasskeyChallenge, err error) {
+	if err = gormError(s.db.Where("challenge = ?", challenge).First(&passkeyChallenge).Error); err != nil {
+		return
+	}
+	result := s.db.Where("challenge = ?", challenge).Delete(&model.PasskeyChallenge{})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = ErrNotFound
+	}
+	return
+}
+
+// PrunePasskeyChallenges removes the ceremonies expired until the given time
+func (s *GormAuthStore) PrunePasskeyChallenges(until time.Time) error {
+	return s.db.Where("expires_at <= ?", until).Delete(&model.PasskeyChallenge{}).Error
+}
+
+// GormExportStore - ExportStore backed by RDBMS
+type GormExportStore struct {
+	db *gorm.DB
+}
+
+// NewGormExportStore returns an ExportStore using the given connection
+func NewGormExportStore(db *gorm.DB) *GormExportStore {
+	return &GormExportStore{db: db}
+}
+
+// FindByAuth returns the exports of a user, newest first
+func (s *GormExportStore) FindByAuth(authID uint64) (exports []model.DataExport, err error) {
+	exports = []model.DataExport{}
+	err = s.db.Where("id_auth = ?", authID).Order("export_id DESC").Find(&exports).Error
+	return
+}
+
+// FindOne returns an export if it was requested by the user
+func (s *GormExportStore) FindOne(authID, exportID uint64) (export model.DataExport, err error) {
+	err = gormError(s.db.Where("export_id = ?", exportID).Where("id_auth = ?", authID).First(&export).Error)
+	return
+}
+
+// FindExpired returns the exports expired until the given time
+func (s *GormExportStore) FindExpired(until time.Time) (exports []model.DataExport, err error) {
+	exports = []model.DataExport{}
+	err = s.db.Where("expires_at <= ?", until).Find(&exports).Error
+	return
+}
+
+// Create saves a new export
+func (s *GormExportStore) Create(export *model.DataExport) error {
+	return s.db.Create(export).Error
+}
+
+// Update saves all fields of an existing export
+func (s *GormExportStore) Update(export *model.DataExport) error {
+	return s.db.Save(export).Error
+}
+
+// Delete removes an export
+func (s *GormExportStore) Delete(exportID uint64) error {
+	return s.db.Delete(&model.DataExport{}, exportID).Error
+}
+
+// GormKeyStore - KeyStore backed by RDBMS
+type GormKeyStore struct {
+	db *gorm.DB
+}
+
+// NewGormKeyStore returns a KeyStore using the given connection
+func NewGormKeyStore(db *gorm.DB) *GormKeyStore {
+	return &GormKeyStore{db: db}
+}
+
+// FindUserKeys returns the public keys of a user
+func (s *GormKeyStore) FindUserKeys(userID uint64) (keys []model.UserKey, err error) {
+	keys = []model.UserKey{}
+	err = s.db.Where("id_user = ?", userID).Order("key_id").Find(&keys).Error
+	return
+}
+
+// FindUserKey returns a public key if it belongs to the user
+func (s *GormKeyStore) FindUserKey(userID, keyID uint64) (key model.UserKey, err error) {
+	err = gormError(s.db.Where("key_id = ?", keyID).Where("id_user = ?", userID).First(&key).Error)
+	return
+}
+
+// CreateUserKey saves a new public key
+func (s *GormKeyStore) CreateUserKey(key *model.UserKey) error {
+	return s.db.Create(key).Error
+}
+
+// DeleteUserKey removes a public key with the note keys wrapped with it
+func (s *GormKeyStore) DeleteUserKey(key model.UserKey) error {
+	tx := s.db.Begin()
+	if err := tx.Where("id_user_key = ?", key.KeyID).Delete(&model.NoteKey{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&key).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// FindNoteKeys returns the wrapped keys of a note for one or all recipients
+func (s *GormKeyStore) FindNoteKeys(noteID, userID uint64) (noteKeys []model.NoteKey, err error) {
+	tx := s.db.Where("id_note = ?", noteID)
+	if userID != 0 {
+		tx = tx.Where("id_user = ?", userID)
+	}
+	noteKeys = []model.NoteKey{}
+	err = tx.Order("note_key_id").Find(&noteKeys).Error
+	return
+}
+
+// FindNoteKey returns a wrapped key of a note
+func (s *GormKeyStore) FindNoteKey(noteID, noteKeyID uint64) (noteKey model.NoteKey, err error) {
+	err = gormError(s.db.Where("note_key_id = ?", noteKeyID).Where("id_note = ?", noteID).First(&noteKey).Error)
+	return
+}
+
+// CreateNoteKey saves a new wrapped key, one per note and public key
+func (s *GormKeyStore) CreateNoteKey(noteKey *model.NoteKey) error {
+	var count int64
+	err := s.db.Model(&model.NoteKey{}).
+		Where("id_note = ?", noteKey.IDNote).
+		Where("id_user_key = ?", noteKey.IDUserKey).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrConflict
+	}
+	return s.db.Create(noteKey).Error
+}
+
+// DeleteNoteKey removes a wrapped key
+func (s *GormKeyStore) DeleteNoteKey(noteKey model.NoteKey) error {
+	return s.db.Delete(&noteKey).Error
+}
+
+// FindSharedNotes returns the end-to-end encrypted notes of other users
+// with a key wrapped for a user
+func (s *GormKeyStore) FindSharedNotes(userID uint64) (notes []model.Note, err error) {
+	sharedNoteIDs := s.db.Model(&model.NoteKey{}).Select("id_note").Where("id_user = ?", userID)
+	notes = []model.Note{}
+	err = s.db.Where("note_id IN (?)", sharedNoteIDs).
+		Where("id_user <> ?", userID).
+		Where("e2ee = ?", true).
+		Order("note_id").
+		Find(&notes).Error
+	return
+}
+
+// GormWorkspaceStore - WorkspaceStore backed by RDBMS
+type GormWorkspaceStore struct {
+	db *gorm.DB
+}
+
+// NewGormWorkspaceStore returns a WorkspaceStore using the given connection
+func NewGormWorkspaceStore(db *gorm.DB) *GormWorkspaceStore {
+	return &GormWorkspaceStore{db: db}
+}
+
+// FindByMember returns the workspaces of a user with their role
+func (s *GormWorkspaceStore) FindByMember(userID uint64) ([]model.Workspace, error) {
+	members := []model.WorkspaceMember{}
+	if err := s.db.Where("id_user = ?", userID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	workspaces := []model.Workspace{}
+	if len(members) == 0 {
+		return workspaces, nil
+	}
+	workspaceIDs := make([]uint64, 0, len(members))
+	roles := map[uint64]string{}
+	for _, member := range members {
+		workspaceIDs = append(workspaceIDs, member.IDWorkspace)
+		roles[member.IDWorkspace] = member.Role
+	}
+
+	if err := s.db.Where("workspace_id IN ?", workspaceIDs).Order("workspace_id").Find(&workspaces).Error; err != nil {
+		return nil, err
+	}
+	for i := range workspaces {
+		workspaces[i].Role = roles[workspaces[i].WorkspaceID]
+	}
+	return workspaces, nil
+}
+
+// FindOne returns a workspace by its ID
+func (s *GormWorkspaceStore) FindOne(workspaceID uint64) (workspace model.Workspace, err error) {
+	err = gormError(s.db.Where("workspace_id = ?", workspaceID).First(&workspace).Error)
+	return
+}
+
+// Create saves a new workspace with its owner
+func (s *GormWorkspaceStore) Create(workspace *model.Workspace, owner *model.WorkspaceMember, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Create(workspace).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	owner.IDWorkspace = workspace.WorkspaceID
+	if err := tx.Create(owner).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, workspace.WorkspaceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Update saves all fields of an existing workspace
+func (s *GormWorkspaceStore) Update(workspace *model.Workspace, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Save(workspace).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, workspace.WorkspaceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Delete hard deletes a workspace with its members, invitations and notes
+func (s *GormWorkspaceStore) Delete(workspace model.Workspace, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := deleteWorkspace(tx, workspace.WorkspaceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, workspace.WorkspaceID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// deleteWorkspace hard deletes a workspace with everything attached to it
+func deleteWorkspace(tx *gorm.DB, workspaceID uint64) error {
+	noteIDs := tx.Unscoped().Model(&model.Note{}).Select("note_id").Where("id_workspace = ?", workspaceID)
+	if err := tx.Unscoped().Where("id_note IN (?)", noteIDs).Delete(&model.NoteKey{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("id_workspace = ?", workspaceID).Delete(&model.Note{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("id_workspace = ?", workspaceID).Delete(&model.WorkspaceInvitation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("id_workspace = ?", workspaceID).Delete(&model.WorkspaceMember{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&model.Workspace{}, workspaceID).Error
+}
+
+// FindMember returns the membership of a user in a workspace
+func (s *GormWorkspaceStore) FindMember(workspaceID, userID uint64) (member model.WorkspaceMember, err error) {
+	err = gormError(s.db.Where("id_workspace = ?", workspaceID).Where("id_user = ?", userID).First(&member).Error)
+	return
+}
+
+// FindMembers returns the members of a workspace
+func (s *GormWorkspaceStore) FindMembers(workspaceID uint64) (members []model.WorkspaceMember, err error) {
+	members = []model.WorkspaceMember{}
+	err = s.db.Where("id_workspace = ?", workspaceID).Order("id_user").Find(&members).Error
+	return
+}
+
+// SaveMember creates or replaces a membership
+func (s *GormWorkspaceStore) SaveMember(member *model.WorkspaceMember, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Save(member).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, member.IDUser); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// DeleteMember removes a user from a workspace
+func (s *GormWorkspaceStore) DeleteMember(member model.WorkspaceMember, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	err := tx.Where("id_workspace = ?", member.IDWorkspace).
+		Where("id_user = ?", member.IDUser).
+		Delete(&model.WorkspaceMember{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, member.IDUser); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// FindInvitations returns the invitations of a workspace, newest first
+func (s *GormWorkspaceStore) FindInvitations(workspaceID uint64) (invitations []model.WorkspaceInvitation, err error) {
+	invitations = []model.WorkspaceInvitation{}
+	err = s.db.Where("id_workspace = ?", workspaceID).Order("invitation_id DESC").Find(&invitations).Error
+	return
+}
+
+// FindInvitationsFor returns the invitations addressed to a user
+// or to their email address, newest first
+func (s *GormWorkspaceStore) FindInvitationsFor(userID uint64, email string) (invitations []model.WorkspaceInvitation, err error) {
+	invitations = []model.WorkspaceInvitation{}
+	tx := s.db.Where("id_user = ?", userID)
+	if email != "" {
+		tx = tx.Or("email = ?", email)
+	}
+	err = tx.Order("invitation_id DESC").Find(&invitations).Error
+	return
+}
+
+// FindInvitation returns an invitation by its ID
+func (s *GormWorkspaceStore) FindInvitation(invitationID uint64) (invitation model.WorkspaceInvitation, err error) {
+	err = gormError(s.db.Where("invitation_id = ?", invitationID).First(&invitation).Error)
+	return
+}
+
+// CreateInvitation saves a new invitation
+func (s *GormWorkspaceStore) CreateInvitation(invitation *model.WorkspaceInvitation, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Create(invitation).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, invitation.InvitationID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// DeleteInvitation removes an invitation
+func (s *GormWorkspaceStore) DeleteInvitation(invitation model.WorkspaceInvitation, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Delete(&model.WorkspaceInvitation{}, invitation.InvitationID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, invitation.InvitationID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Accept saves the membership of an invited user and removes the invitation
+func (s *GormWorkspaceStore) Accept(invitation model.WorkspaceInvitation, member *model.WorkspaceMember, event *model.AuditEvent) error {
+	tx := s.db.Begin()
+	if err := tx.Save(member).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(&model.WorkspaceInvitation{}, invitation.InvitationID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := createEvent(tx, event, member.IDUser); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// PruneInvitations removes the invitations expired until the given time
+func (s *GormWorkspaceStore) PruneInvitations(until time.Time) error {
+	return s.db.Where("expires_at <= ?", until).Delete(&model.WorkspaceInvitation{}).Error
+}
+
+// Purge removes a user from all workspaces in one transaction
+func (s *GormWorkspaceStore) Purge(userID uint64) error {
+	tx := s.db.Begin()
+
+	owned := []uint64{}
+	err := tx.Model(&model.WorkspaceMember{}).
+		Where("id_user = ?", userID).
+		Where("role = ?", model.WorkspaceRoleOwner).
+		Pluck("id_workspace", &owned).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, workspaceID := range owned {
+		if err := deleteWorkspace(tx, workspaceID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// notes left in other workspaces would go with the profile
+	// by ON DELETE CASCADE
+	err = tx.Unscoped().Model(&model.Note{}).
+		Where("id_user = ?", userID).
+		Where("id_workspace IS NOT NULL").
+		Update("id_user", gorm.Expr(
+			"(SELECT m.id_user FROM workspace_members m WHERE m.id_workspace = notes.id_workspace AND m.role = ?)",
+			model.WorkspaceRoleOwner,
+		)).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("id_user = ?", userID).Delete(&model.WorkspaceInvitation{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("id_user = ?", userID).Delete(&model.WorkspaceMember{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// createEvent saves an audit event in the transaction of the change it
+// records, the resource ID of a new record is known only after its insert
+func createEvent(tx *gorm.DB, event *model.AuditEvent, resourceID uint64) error {
+	if event == nil {
+		return nil
+	}
+	if event.ResourceID == 0 {
+		event.ResourceID = resourceID
+	}
+	return tx.Create(event).Error
+}
+
+// gormError maps gorm.ErrRecordNotFound to ErrNotFound
+func gormError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// uniqueError maps unique constraint violations to ErrConflict
+//
+// gorm translates them only with TranslateError, otherwise the
+// messages of MySQL, PostgreSQL and SQLite are recognized
+func uniqueError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrConflict
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "duplicate entry") || // MySQL
+		strings.Contains(msg, "duplicate key value") || // PostgreSQL
+		strings.Contains(msg, "unique constraint failed") { // SQLite
+		return ErrConflict
+	}
+	return err
+}
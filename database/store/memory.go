@@ -0,0 +1,2097 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	"gorm.io/gorm"
+
+	"apidev/database/model"
+	"apidev/lib/geo"
+)
+
+// MemoryUserStore - thread-safe UserStore kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type MemoryUserStore struct {
+	mu           sync.RWMutex
+	lastID       uint64
+	users        map[uint64]model.User
+	reservations map[string]model.NicknameReservation
+	settings     map[uint64]model.UserSettings
+	audit        *MemoryAuditStore
+}
+
+// NewMemoryUserStore returns an empty in-memory UserStore
+// recording its audit events in the given store
+func NewMemoryUserStore(audit *MemoryAuditStore) *MemoryUserStore {
+	return &MemoryUserStore{
+		users:        map[uint64]model.User{},
+		reservations: map[string]model.NicknameReservation{},
+		settings:     map[uint64]model.UserSettings{},
+		audit:        audit,
+	}
+}
+
+// FindByAuthID returns the profile linked to an auth ID
+func (s *MemoryUserStore) FindByAuthID(authID uint64) (model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.IDAuth == authID && !user.DeletedAt.Valid {
+			return user, nil
+		}
+	}
+	return model.User{}, ErrNotFound
+}
+
+// FindByID returns a profile by its ID
+func (s *MemoryUserStore) FindByID(userID uint64) (model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userID]
+	if !ok || user.DeletedAt.Valid {
+		return model.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+// FindByNickname returns the profile using a nickname key
+func (s *MemoryUserStore) FindByNickname(key string) (model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.NickKey != nil && *user.NickKey == key && !user.DeletedAt.Valid {
+			return user, nil
+		}
+	}
+	return model.User{}, ErrNotFound
+}
+
+// Search returns the profiles whose nickname contains the given one
+func (s *MemoryUserStore) Search(filter model.UserFilter) ([]model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	nickName := strings.ToLower(filter.NickName)
+	users := []model.User{}
+	for _, user := range s.users {
+		if user.DeletedAt.Valid || user.UserID <= filter.AfterID ||
+			!strings.Contains(strings.ToLower(user.NickName), nickName) {
+			continue
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+// FindReservation returns the reservation of a nickname key
+func (s *MemoryUserStore) FindReservation(key string) (model.NicknameReservation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reservation, ok := s.reservations[key]
+	if !ok {
+		return model.NicknameReservation{}, ErrNotFound
+	}
+	return reservation, nil
+}
+
+// Reserve creates or replaces the reservation of a nickname key
+func (s *MemoryUserStore) Reserve(reservation model.NicknameReservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reservations[reservation.NickKey] = reservation
+	return nil
+}
+
+// FindSettings returns the stored settings of a user
+func (s *MemoryUserStore) FindSettings(userID uint64) (model.UserSettings, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.settings[userID]
+	if !ok {
+		return model.UserSettings{}, ErrNotFound
+	}
+	return settings, nil
+}
+
+// SaveSettings creates or replaces the settings of a user
+func (s *MemoryUserStore) SaveSettings(settings *model.UserSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	settings.UpdatedAt = time.Now()
+	s.settings[settings.IDUser] = *settings
+	return nil
+}
+
+// nickTaken reports whether another profile uses the nickname key of user,
+// like the unique index of the RDBMS backend
+func (s *MemoryUserStore) nickTaken(user *model.User) bool {
+	if user.NickKey == nil {
+		return false
+	}
+	for _, other := range s.users {
+		if other.UserID != user.UserID && other.NickKey != nil && *other.NickKey == *user.NickKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Create saves a new profile
+func (s *MemoryUserStore) Create(user *model.User, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nickTaken(user) {
+		return ErrConflict
+	}
+
+	now := time.Now()
+	s.lastID++
+	user.UserID = s.lastID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	s.users[user.UserID] = *user
+	s.audit.record(event, user.UserID)
+	return nil
+}
+
+// Update saves all fields of an existing profile
+func (s *MemoryUserStore) Update(user *model.User, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.UserID]; !ok {
+		return ErrNotFound
+	}
+	if s.nickTaken(user) {
+		return ErrConflict
+	}
+	s.users[user.UserID] = *user
+	s.audit.record(event, user.UserID)
+	return nil
+}
+
+// FindDeletionDue returns the profiles scheduled for deletion until the given time
+func (s *MemoryUserStore) FindDeletionDue(until time.Time) ([]model.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []model.User{}
+	for _, user := range s.users {
+		if user.DeleteAfter != nil && !user.DeleteAfter.After(until) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+// Purge hard deletes a profile, its settings and nickname reservations
+//
+// the notes are deleted by MemoryNoteStore.Purge
+func (s *MemoryUserStore) Purge(user model.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.settings, user.UserID)
+	for key, reservation := range s.reservations {
+		if reservation.IDUser == user.UserID {
+			delete(s.reservations, key)
+		}
+	}
+	delete(s.users, user.UserID)
+	return nil
+}
+
+// MemoryNoteStore - thread-safe NoteStore kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type MemoryNoteStore struct {
+	mu         sync.RWMutex
+	lastID     uint64
+	lastChange uint64
+	notes      map[uint64]model.Note
+	audit      *MemoryAuditStore
+}
+
+// NewMemoryNoteStore returns an empty in-memory NoteStore
+// recording its audit events in the given store
+func NewMemoryNoteStore(audit *MemoryAuditStore) *MemoryNoteStore {
+	return &MemoryNoteStore{notes: map[uint64]model.Note{}, audit: audit}
+}
+
+// FindByOwner returns all notes of an owner ordered by ID
+func (s *MemoryNoteStore) FindByOwner(owner Owner) ([]model.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []model.Note{}
+	for _, note := range s.notes {
+		if owner.Owns(note) && !note.DeletedAt.Valid {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].NoteID < notes[j].NoteID })
+	return notes, nil
+}
+
+// FindOne returns a note if it belongs to the owner
+func (s *MemoryNoteStore) FindOne(owner Owner, noteID uint64) (model.Note, error) {
+	note, err := s.FindByID(noteID)
+	if err != nil || !owner.Owns(note) {
+		return model.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+// FindByID returns a note of any owner
+func (s *MemoryNoteStore) FindByID(noteID uint64) (model.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	note, ok := s.notes[noteID]
+	if !ok || note.DeletedAt.Valid {
+		return model.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+// FindAllByUser returns all notes written by a user, soft deleted ones included
+func (s *MemoryNoteStore) FindAllByUser(userID uint64) ([]model.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	notes := []model.Note{}
+	for _, note := range s.notes {
+		if note.IDUser == userID {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].NoteID < notes[j].NoteID })
+	return notes, nil
+}
+
+// FindByLocation returns the notes of an owner matching a location query
+func (s *MemoryNoteStore) FindByLocation(owner Owner, query geo.Query) ([]model.Note, error) {
+	notes, err := s.FindByOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	return filterByLocation(notes, query), nil
+}
+
+// FindByPosition returns all notes of an owner in manual order
+func (s *MemoryNoteStore) FindByPosition(owner Owner) ([]model.Note, error) {
+	notes, err := s.FindByOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	SortByPosition(notes)
+	return notes, nil
+}
+
+// LastPosition returns the greatest position of the notes of an owner
+func (s *MemoryNoteStore) LastPosition(owner Owner) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last := ""
+	for _, note := range s.notes {
+		if owner.Owns(note) && !note.DeletedAt.Valid && note.Position > last {
+			last = note.Position
+		}
+	}
+	return last, nil
+}
+
+// AdjacentPosition returns the closest position after (or before) the given one
+func (s *MemoryNoteStore) AdjacentPosition(owner Owner, position string, after bool) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	closest := ""
+	for _, note := range s.notes {
+		if !owner.Owns(note) || note.DeletedAt.Valid || note.Position == "" {
+			continue
+		}
+		if after && note.Position > position && (closest == "" || note.Position < closest) {
+			closest = note.Position
+		}
+		if !after && note.Position < position && note.Position > closest {
+			closest = note.Position
+		}
+	}
+	return closest, nil
+}
+
+// Reorder sets the positions of several notes of an owner
+func (s *MemoryNoteStore) Reorder(owner Owner, positions map[uint64]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for noteID, position := range positions {
+		note, ok := s.notes[noteID]
+		if !ok || !owner.Owns(note) || note.DeletedAt.Valid {
+			continue
+		}
+		s.lastChange++
+		note.Position = position
+		note.UpdatedAt = now
+		note.Version++
+		note.ChangeSeq = s.lastChange
+		s.notes[noteID] = note
+	}
+	return nil
+}
+
+// Create saves a new note
+func (s *MemoryNoteStore) Create(note *model.Note, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastID++
+	note.NoteID = s.lastID
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	s.lastChange++
+	note.ChangeSeq = s.lastChange
+	s.notes[note.NoteID] = *note
+	s.audit.record(event, note.NoteID)
+	return nil
+}
+
+// Update saves all fields of an existing note
+func (s *MemoryNoteStore) Update(note *model.Note, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.notes[note.NoteID]; !ok {
+		return ErrNotFound
+	}
+	s.lastChange++
+	note.ChangeSeq = s.lastChange
+	s.notes[note.NoteID] = *note
+	s.audit.record(event, note.NoteID)
+	return nil
+}
+
+// Delete soft deletes a note and bumps its version
+func (s *MemoryNoteStore) Delete(note *model.Note, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.notes[note.NoteID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	stored.UpdatedAt = now
+	stored.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	stored.Version++
+	s.lastChange++
+	stored.ChangeSeq = s.lastChange
+	s.notes[note.NoteID] = stored
+	*note = stored
+	s.audit.record(event, note.NoteID)
+	return nil
+}
+
+// Purge hard deletes all notes written by a user
+func (s *MemoryNoteStore) Purge(userID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for noteID, note := range s.notes {
+		if note.IDUser == userID {
+			delete(s.notes, noteID)
+		}
+	}
+	return nil
+}
+
+// FindChanges returns the personal notes of a user changed after the cursor
+func (s *MemoryNoteStore) FindChanges(userID uint64, after *ChangeCursor, limit int) ([]model.Note, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	owner := Personal(userID)
+	notes := []model.Note{}
+	for _, note := range s.notes {
+		if !owner.Owns(note) {
+			continue
+		}
+		if after == nil && !note.DeletedAt.Valid ||
+			after != nil && (note.ChangeSeq > after.ChangeSeq || note.ChangeSeq == after.ChangeSeq && note.NoteID > after.NoteID) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if notes[i].ChangeSeq != notes[j].ChangeSeq {
+			return notes[i].ChangeSeq < notes[j].ChangeSeq
+		}
+		return notes[i].NoteID < notes[j].NoteID
+	})
+	if len(notes) > limit {
+		notes = notes[:limit]
+	}
+	return notes, nil
+}
+
+// Sync runs the writes of a sync push, they are kept aside
+// until fn returns nil
+func (s *MemoryNoteStore) Sync(fn func(batch SyncBatch) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := &memorySyncBatch{s: s, notes: map[uint64]model.Note{}}
+	if err := fn(batch); err != nil {
+		return err
+	}
+	for noteID, note := range batch.notes {
+		s.notes[noteID] = note
+	}
+	for _, e := range batch.events {
+		s.audit.record(e.event, e.noteID)
+	}
+	return nil
+}
+
+// memorySyncBatch - SyncBatch of a MemoryNoteStore, locked by Sync
+type memorySyncBatch struct {
+	s      *MemoryNoteStore
+	notes  map[uint64]model.Note
+	events []memorySyncEvent
+}
+
+// memorySyncEvent - audit event of a note written by a memorySyncBatch
+type memorySyncEvent struct {
+	event  *model.AuditEvent
+	noteID uint64
+}
+
+// FindOne returns a note if it belongs to the owner, soft deleted ones included
+func (b *memorySyncBatch) FindOne(owner Owner, noteID uint64) (model.Note, error) {
+	note, ok := b.notes[noteID]
+	if !ok {
+		note, ok = b.s.notes[noteID]
+	}
+	if !ok || !owner.Owns(note) {
+		return model.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+// LastPosition returns the greatest position of the notes of an owner
+func (b *memorySyncBatch) LastPosition(owner Owner) (string, error) {
+	last := ""
+	for _, notes := range []map[uint64]model.Note{b.s.notes, b.notes} {
+		for _, note := range notes {
+			if owner.Owns(note) && !note.DeletedAt.Valid && note.Position > last {
+				last = note.Position
+			}
+		}
+	}
+	return last, nil
+}
+
+// Create saves a new note
+func (b *memorySyncBatch) Create(note *model.Note, event *model.AuditEvent) error {
+	now := time.Now()
+	b.s.lastID++
+	note.NoteID = b.s.lastID
+	note.CreatedAt = now
+	note.UpdatedAt = now
+	b.s.lastChange++
+	note.ChangeSeq = b.s.lastChange
+	b.save(*note, event)
+	return nil
+}
+
+// Update saves the content and location of a note still at the base version
+func (b *memorySyncBatch) Update(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	stored, err := b.FindOne(OwnerOf(*note), note.NoteID)
+	if err != nil || stored.Version != baseVersion || stored.DeletedAt.Valid {
+		return ErrConflict
+	}
+
+	stored.Title = note.Title
+	stored.Body = note.Body
+	stored.ContentType = note.ContentType
+	stored.Ciphertext = note.Ciphertext
+	stored.Algorithm = note.Algorithm
+	stored.KeyID = note.KeyID
+	stored.Nonce = note.Nonce
+	stored.Latitude = note.Latitude
+	stored.Longitude = note.Longitude
+	stored.Accuracy = note.Accuracy
+	stored.PlaceName = note.PlaceName
+	b.bump(&stored)
+	*note = stored
+	b.save(stored, event)
+	return nil
+}
+
+// Delete soft deletes a note still at the base version
+func (b *memorySyncBatch) Delete(note *model.Note, baseVersion uint64, event *model.AuditEvent) error {
+	stored, err := b.FindOne(OwnerOf(*note), note.NoteID)
+	if err != nil || stored.Version != baseVersion || stored.DeletedAt.Valid {
+		return ErrConflict
+	}
+
+	b.bump(&stored)
+	stored.DeletedAt = gorm.DeletedAt{Time: stored.UpdatedAt, Valid: true}
+	*note = stored
+	b.save(stored, event)
+	return nil
+}
+
+// bump sets the new version, timestamp and change sequence number of a note
+func (b *memorySyncBatch) bump(note *model.Note) {
+	b.s.lastChange++
+	note.UpdatedAt = time.Now()
+	note.Version++
+	note.ChangeSeq = b.s.lastChange
+}
+
+// save keeps a written note and its audit event until the batch is committed
+func (b *memorySyncBatch) save(note model.Note, event *model.AuditEvent) {
+	b.notes[note.NoteID] = note
+	b.events = append(b.events, memorySyncEvent{event: event, noteID: note.NoteID})
+}
+
+// deleteWorkspace hard deletes the notes of a workspace
+func (s *MemoryNoteStore) deleteWorkspace(workspaceID uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for noteID, note := range s.notes {
+		if note.IDWorkspace != nil && *note.IDWorkspace == workspaceID {
+			delete(s.notes, noteID)
+		}
+	}
+}
+
+// handOver makes the owners of workspaces the authors of the notes
+// a user wrote in them, owners are keyed by workspace ID
+func (s *MemoryNoteStore) handOver(userID uint64, owners map[uint64]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for noteID, note := range s.notes {
+		if note.IDUser == userID && note.IDWorkspace != nil {
+			note.IDUser = owners[*note.IDWorkspace]
+			s.notes[noteID] = note
+		}
+	}
+}
+
+// MemoryAuditStore - thread-safe AuditStore kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type MemoryAuditStore struct {
+	mu     sync.RWMutex
+	lastID uint64
+	events []model.AuditEvent
+}
+
+// NewMemoryAuditStore returns an empty in-memory AuditStore
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{events: []model.AuditEvent{}}
+}
+
+// Append saves an event
+func (s *MemoryAuditStore) Append(event *model.AuditEvent) error {
+	s.record(event, event.ResourceID)
+	return nil
+}
+
+// record saves the event of a change, if any, with the ID of the
+// changed resource, the resource ID of a new record is known only
+// after its insert
+func (s *MemoryAuditStore) record(event *model.AuditEvent, resourceID uint64) {
+	if event == nil || s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ResourceID == 0 {
+		event.ResourceID = resourceID
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	s.lastID++
+	event.EventID = s.lastID
+	s.events = append(s.events, *event)
+}
+
+// Find returns the events matching the filter, newest first
+func (s *MemoryAuditStore) Find(filter model.AuditFilter) ([]model.AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	events := []model.AuditEvent{}
+	for i := len(s.events) - 1; i >= 0; i-- {
+		event := s.events[i]
+		if filter.IDAuth != 0 && event.IDAuth != filter.IDAuth ||
+			filter.Action != "" && event.Action != filter.Action ||
+			filter.ResourceType != "" && event.ResourceType != filter.ResourceType ||
+			filter.ResourceID != 0 && event.ResourceID != filter.ResourceID ||
+			!filter.Since.IsZero() && event.CreatedAt.Before(filter.Since) ||
+			!filter.Until.IsZero() && !event.CreatedAt.Before(filter.Until) ||
+			filter.BeforeID != 0 && event.EventID >= filter.BeforeID {
+			continue
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// Purge removes all events of an actor
+func (s *MemoryAuditStore) Purge(authID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := []model.AuditEvent{}
+	for _, event := range s.events {
+		if event.IDAuth != authID {
+			events = append(events, event)
+		}
+	}
+	s.events = events
+	return nil
+}
+
+// MemoryAuthStore - thread-safe AuthStore kept in memory
+//
+// for tests, demo mode and setups without RDBMS where gorest keeps
+// no credentials, only the credentials created with a social login,
+// the revocations, roles, suspensions, access tokens, identities and
+// OAuth2 clients and grants are saved
+type MemoryAuthStore struct {
+	mu          sync.RWMutex
+	lastAuthID  uint64
+	auths       map[uint64]gmodel.Auth
+	revocations map[uint64]model.AuthRevocation
+	roles       map[uint64]map[string]model.AuthRole
+	suspensions map[uint64]model.AuthSuspension
+	lastTokenID uint64
+	tokens      map[uint64]model.AccessToken
+	identities  map[string]model.AuthIdentity
+	states      map[string]model.OAuthState
+	clients     map[string]model.OAuthClient
+	lastCodeID  uint64
+	codes       map[uint64]model.OAuthCode
+	lastOAuthID uint64
+	oauthTokens map[uint64]model.OAuthToken
+	lastSession uint64
+	sessions    map[uint64]model.Session
+	sessionJWTs map[string]model.SessionToken
+	lastEmailID uint64
+	emailTokens map[uint64]model.EmailToken
+	lastPasskey uint64
+	passkeys    map[uint64]model.Passkey
+	challenges  map[string]model.PasskeyChallenge
+}
+
+// NewMemoryAuthStore returns an empty in-memory AuthStore
+func NewMemoryAuthStore() *MemoryAuthStore {
+	return &MemoryAuthStore{
+		auths:       map[uint64]gmodel.Auth{},
+		revocations: map[uint64]model.AuthRevocation{},
+		roles:       map[uint64]map[string]model.AuthRole{},
+		suspensions: map[uint64]model.AuthSuspension{},
+		tokens:      map[uint64]model.AccessToken{},
+		identities:  map[string]model.AuthIdentity{},
+		states:      map[string]model.OAuthState{},
+		clients:     map[string]model.OAuthClient{},
+		codes:       map[uint64]model.OAuthCode{},
+		oauthTokens: map[uint64]model.OAuthToken{},
+		sessions:    map[uint64]model.Session{},
+		sessionJWTs: map[string]model.SessionToken{},
+		emailTokens: map[uint64]model.EmailToken{},
+		passkeys:    map[uint64]model.Passkey{},
+		challenges:  map[string]model.PasskeyChallenge{},
+	}
+}
+
+// identityKey - key of an identity in the map
+func identityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
+
+// Delete removes the credentials, roles, suspension, access tokens,
+// identities, OAuth2 clients and grants, sessions, email tokens and
+// passkeys and saves the revocation
+func (s *MemoryAuthStore) Delete(revocation model.AuthRevocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.auths, revocation.IDAuth)
+	delete(s.roles, revocation.IDAuth)
+	delete(s.suspensions, revocation.IDAuth)
+	s.deleteTokens(revocation.IDAuth)
+	for key, identity := range s.identities {
+		if identity.IDAuth == revocation.IDAuth {
+			delete(s.identities, key)
+		}
+	}
+	for key, state := range s.states {
+		if state.IDAuth == revocation.IDAuth {
+			delete(s.states, key)
+		}
+	}
+	for clientID, client := range s.clients {
+		if client.IDAuth == revocation.IDAuth {
+			s.deleteClient(clientID)
+		}
+	}
+	for codeID, code := range s.codes {
+		if code.IDAuth == revocation.IDAuth {
+			delete(s.codes, codeID)
+		}
+	}
+	s.deleteOAuthTokens(revocation.IDAuth, "")
+	for sessionID, session := range s.sessions {
+		if session.IDAuth == revocation.IDAuth {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for jti, token := range s.sessionJWTs {
+		if _, ok := s.sessions[token.IDSession]; !ok {
+			delete(s.sessionJWTs, jti)
+		}
+	}
+	for tokenID, token := range s.emailTokens {
+		if token.IDAuth == revocation.IDAuth {
+			delete(s.emailTokens, tokenID)
+		}
+	}
+	for passkeyID, passkey := range s.passkeys {
+		if passkey.IDAuth == revocation.IDAuth {
+			delete(s.passkeys, passkeyID)
+		}
+	}
+	for key, challenge := range s.challenges {
+		if challenge.IDAuth == revocation.IDAuth {
+			delete(s.challenges, key)
+		}
+	}
+	s.revocations[revocation.IDAuth] = revocation
+	return nil
+}
+
+// Revoke creates or replaces the revocation of the JWTs of an auth ID
+func (s *MemoryAuthStore) Revoke(revocation model.AuthRevocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revocations[revocation.IDAuth] = revocation
+	return nil
+}
+
+// FindRevocation returns the revocation of the JWTs of an auth ID
+func (s *MemoryAuthStore) FindRevocation(authID uint64) (model.AuthRevocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revocation, ok := s.revocations[authID]
+	if !ok {
+		return model.AuthRevocation{}, ErrNotFound
+	}
+	return revocation, nil
+}
+
+// PruneRevocations removes the revocations expired until the given time
+func (s *MemoryAuthStore) PruneRevocations(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for authID, revocation := range s.revocations {
+		if !revocation.ExpiresAt.After(until) {
+			delete(s.revocations, authID)
+		}
+	}
+	return nil
+}
+
+// FindAuth returns the credentials created with a social login
+func (s *MemoryAuthStore) FindAuth(authID uint64) (gmodel.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	auth, ok := s.auths[authID]
+	if !ok {
+		return gmodel.Auth{}, ErrNotFound
+	}
+	return auth, nil
+}
+
+// FindAuthByEmail returns the credentials created with a social login
+// with an unencrypted email
+func (s *MemoryAuthStore) FindAuthByEmail(email string) (gmodel.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, auth := range s.auths {
+		if auth.Email == email {
+			return auth, nil
+		}
+	}
+	return gmodel.Auth{}, ErrNotFound
+}
+
+// CreateAuth saves new credentials and links the identity
+func (s *MemoryAuthStore) CreateAuth(auth *gmodel.Auth, identity *model.AuthIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(identity.Provider, identity.Subject)
+	if _, ok := s.identities[key]; ok {
+		return ErrConflict
+	}
+
+	s.lastAuthID++
+	auth.AuthID = s.lastAuthID
+	s.auths[auth.AuthID] = *auth
+	identity.IDAuth = auth.AuthID
+	s.identities[key] = *identity
+	return nil
+}
+
+// SetEmailVerification saves the state of the verification of the email of an auth ID
+func (s *MemoryAuthStore) SetEmailVerification(authID uint64, state int8) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.auths[authID]
+	if !ok {
+		return ErrNotFound
+	}
+	auth.VerifyEmail = state
+	auth.UpdatedAt = time.Now()
+	s.auths[authID] = auth
+	return nil
+}
+
+// SetPassword replaces the password hash of an auth ID
+func (s *MemoryAuthStore) SetPassword(authID uint64, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.auths[authID]
+	if !ok {
+		return ErrNotFound
+	}
+	auth.Password = hash
+	auth.UpdatedAt = time.Now()
+	s.auths[authID] = auth
+	return nil
+}
+
+// FindTwoFA returns ErrNotFound, credentials are not kept in memory
+func (s *MemoryAuthStore) FindTwoFA(authID uint64) (gmodel.TwoFA, error) {
+	return gmodel.TwoFA{}, ErrNotFound
+}
+
+// FindRoles returns the roles granted to an auth ID
+func (s *MemoryAuthStore) FindRoles(authID uint64) ([]model.AuthRole, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := []model.AuthRole{}
+	for _, role := range s.roles[authID] {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Role < roles[j].Role })
+	return roles, nil
+}
+
+// FindGrants returns the grants of a role, or of all roles
+func (s *MemoryAuthStore) FindGrants(role string) ([]model.AuthRole, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	roles := []model.AuthRole{}
+	for _, granted := range s.roles {
+		for _, grant := range granted {
+			if role == "" || grant.Role == role {
+				roles = append(roles, grant)
+			}
+		}
+	}
+	sort.Slice(roles, func(i, j int) bool {
+		if roles[i].IDAuth != roles[j].IDAuth {
+			return roles[i].IDAuth < roles[j].IDAuth
+		}
+		return roles[i].Role < roles[j].Role
+	})
+	return roles, nil
+}
+
+// Grant creates or replaces the grant of a role
+func (s *MemoryAuthStore) Grant(role model.AuthRole) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if role.CreatedAt.IsZero() {
+		role.CreatedAt = time.Now()
+	}
+	if s.roles[role.IDAuth] == nil {
+		s.roles[role.IDAuth] = map[string]model.AuthRole{}
+	}
+	s.roles[role.IDAuth][role.Role] = role
+	return nil
+}
+
+// Ungrant removes a role from an auth ID
+func (s *MemoryAuthStore) Ungrant(authID uint64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.roles[authID], role)
+	if len(s.roles[authID]) == 0 {
+		delete(s.roles, authID)
+	}
+	return nil
+}
+
+// FindSuspension returns the suspension of an auth ID
+func (s *MemoryAuthStore) FindSuspension(authID uint64) (model.AuthSuspension, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	suspension, ok := s.suspensions[authID]
+	if !ok {
+		return model.AuthSuspension{}, ErrNotFound
+	}
+	return suspension, nil
+}
+
+// Suspend creates or replaces the suspension of an auth ID
+func (s *MemoryAuthStore) Suspend(suspension model.AuthSuspension) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if suspension.CreatedAt.IsZero() {
+		suspension.CreatedAt = time.Now()
+	}
+	s.suspensions[suspension.IDAuth] = suspension
+	return nil
+}
+
+// Unsuspend removes the suspension of an auth ID
+func (s *MemoryAuthStore) Unsuspend(authID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.suspensions, authID)
+	return nil
+}
+
+// FindTokens returns the access tokens of an auth ID, newest first
+func (s *MemoryAuthStore) FindTokens(authID uint64) ([]model.AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []model.AccessToken{}
+	for _, token := range s.tokens {
+		if token.IDAuth == authID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].TokenID > tokens[j].TokenID })
+	return tokens, nil
+}
+
+// FindToken returns an access token by its ID
+func (s *MemoryAuthStore) FindToken(tokenID uint64) (model.AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.tokens[tokenID]
+	if !ok {
+		return model.AccessToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// CreateToken saves a new access token and sets its ID and CreatedAt
+func (s *MemoryAuthStore) CreateToken(token *model.AccessToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastTokenID++
+	token.TokenID = s.lastTokenID
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.tokens[token.TokenID] = *token
+	return nil
+}
+
+// TouchToken sets the time an access token was last used
+func (s *MemoryAuthStore) TouchToken(tokenID uint64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[tokenID]
+	if !ok {
+		return nil
+	}
+	token.LastUsedAt = &usedAt
+	s.tokens[tokenID] = token
+	return nil
+}
+
+// DeleteToken removes an access token
+func (s *MemoryAuthStore) DeleteToken(tokenID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, tokenID)
+	return nil
+}
+
+// DeleteTokens removes all access tokens of an auth ID
+func (s *MemoryAuthStore) DeleteTokens(authID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteTokens(authID)
+	return nil
+}
+
+// FindIdentity returns the identity of a user at a provider
+func (s *MemoryAuthStore) FindIdentity(provider, subject string) (model.AuthIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identity, ok := s.identities[identityKey(provider, subject)]
+	if !ok {
+		return model.AuthIdentity{}, ErrNotFound
+	}
+	return identity, nil
+}
+
+// FindIdentities returns the identities linked to an auth ID
+func (s *MemoryAuthStore) FindIdentities(authID uint64) ([]model.AuthIdentity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	identities := []model.AuthIdentity{}
+	for _, identity := range s.identities {
+		if identity.IDAuth == authID {
+			identities = append(identities, identity)
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].Provider < identities[j].Provider })
+	return identities, nil
+}
+
+// CreateIdentity links an identity to an existing auth ID
+func (s *MemoryAuthStore) CreateIdentity(identity *model.AuthIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := identityKey(identity.Provider, identity.Subject)
+	if _, ok := s.identities[key]; ok {
+		return ErrConflict
+	}
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	s.identities[key] = *identity
+	return nil
+}
+
+// DeleteIdentity unlinks the identity at a provider from an auth ID
+func (s *MemoryAuthStore) DeleteIdentity(authID uint64, provider string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, identity := range s.identities {
+		if identity.IDAuth == authID && identity.Provider == provider {
+			delete(s.identities, key)
+		}
+	}
+	return nil
+}
+
+// SaveOAuthState saves a login waiting for its callback
+func (s *MemoryAuthStore) SaveOAuthState(state model.OAuthState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[state.State] = state
+	return nil
+}
+
+// TakeOAuthState returns and removes a login
+func (s *MemoryAuthStore) TakeOAuthState(state string) (model.OAuthState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oauthState, ok := s.states[state]
+	if !ok {
+		return model.OAuthState{}, ErrNotFound
+	}
+	delete(s.states, state)
+	return oauthState, nil
+}
+
+// PruneOAuthStates removes the logins expired until the given time
+func (s *MemoryAuthStore) PruneOAuthStates(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, state := range s.states {
+		if !state.ExpiresAt.After(until) {
+			delete(s.states, key)
+		}
+	}
+	return nil
+}
+
+// FindClients returns the OAuth2 clients registered by an auth ID, newest first
+func (s *MemoryAuthStore) FindClients(authID uint64) ([]model.OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := []model.OAuthClient{}
+	for _, client := range s.clients {
+		if client.IDAuth == authID {
+			clients = append(clients, client)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].CreatedAt.After(clients[j].CreatedAt) })
+	return clients, nil
+}
+
+// FindClient returns an OAuth2 client by its ID
+func (s *MemoryAuthStore) FindClient(clientID string) (model.OAuthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return model.OAuthClient{}, ErrNotFound
+	}
+	return client, nil
+}
+
+// CreateClient saves a new OAuth2 client, ErrConflict if the ID is taken
+func (s *MemoryAuthStore) CreateClient(client *model.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client.ClientID]; ok {
+		return ErrConflict
+	}
+	if client.CreatedAt.IsZero() {
+		client.CreatedAt = time.Now()
+	}
+	s.clients[client.ClientID] = *client
+	return nil
+}
+
+// DeleteClient removes an OAuth2 client with its codes and tokens
+func (s *MemoryAuthStore) DeleteClient(clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteClient(clientID)
+	return nil
+}
+
+// CreateOAuthCode saves a new authorization request and sets its ID
+func (s *MemoryAuthStore) CreateOAuthCode(code *model.OAuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCodeID++
+	code.CodeID = s.lastCodeID
+	s.codes[code.CodeID] = *code
+	return nil
+}
+
+// FindOAuthCode returns an authorization request by its ID
+func (s *MemoryAuthStore) FindOAuthCode(codeID uint64) (model.OAuthCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.codes[codeID]
+	if !ok {
+		return model.OAuthCode{}, ErrNotFound
+	}
+	return code, nil
+}
+
+// TakeOAuthCode returns and removes an authorization request
+func (s *MemoryAuthStore) TakeOAuthCode(codeID uint64) (model.OAuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[codeID]
+	if !ok {
+		return model.OAuthCode{}, ErrNotFound
+	}
+	delete(s.codes, codeID)
+	return code, nil
+}
+
+// FindOAuthTokens returns the OAuth2 tokens of an auth ID, oldest first
+func (s *MemoryAuthStore) FindOAuthTokens(authID uint64) ([]model.OAuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []model.OAuthToken{}
+	for _, token := range s.oauthTokens {
+		if token.IDAuth == authID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].TokenID < tokens[j].TokenID })
+	return tokens, nil
+}
+
+// FindOAuthToken returns an OAuth2 token by its ID
+func (s *MemoryAuthStore) FindOAuthToken(tokenID uint64) (model.OAuthToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.oauthTokens[tokenID]
+	if !ok {
+		return model.OAuthToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// CreateOAuthToken saves a new OAuth2 token and sets its ID and CreatedAt
+func (s *MemoryAuthStore) CreateOAuthToken(token *model.OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastOAuthID++
+	token.TokenID = s.lastOAuthID
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.oauthTokens[token.TokenID] = *token
+	return nil
+}
+
+// DeleteOAuthToken removes an OAuth2 token and the access tokens issued with it
+func (s *MemoryAuthStore) DeleteOAuthToken(tokenID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, token := range s.oauthTokens {
+		if id == tokenID || token.IDRefresh == tokenID {
+			delete(s.oauthTokens, id)
+		}
+	}
+	return nil
+}
+
+// DeleteOAuthTokens removes the OAuth2 tokens of an auth ID issued to
+// a client, or to all clients if it is empty
+func (s *MemoryAuthStore) DeleteOAuthTokens(authID uint64, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteOAuthTokens(authID, clientID)
+	return nil
+}
+
+// PruneOAuthGrants removes the authorization requests and OAuth2 tokens
+// expired until the given time
+func (s *MemoryAuthStore) PruneOAuthGrants(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for codeID, code := range s.codes {
+		if !code.ExpiresAt.After(until) {
+			delete(s.codes, codeID)
+		}
+	}
+	for tokenID, token := range s.oauthTokens {
+		if !token.ExpiresAt.After(until) {
+			delete(s.oauthTokens, tokenID)
+		}
+	}
+	return nil
+}
+
+// FindSessions returns the sessions of an auth ID which are not revoked, newest first
+func (s *MemoryAuthStore) FindSessions(authID uint64) ([]model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []model.Session{}
+	for _, session := range s.sessions {
+		if session.IDAuth == authID && session.RevokedAt == nil {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].SessionID > sessions[j].SessionID })
+	return sessions, nil
+}
+
+// FindSession returns a session by its ID
+func (s *MemoryAuthStore) FindSession(sessionID uint64) (model.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return model.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+// FindSessionToken returns a JWT issued to a session by its jti
+func (s *MemoryAuthStore) FindSessionToken(jti string) (model.SessionToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.sessionJWTs[jti]
+	if !ok {
+		return model.SessionToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// CreateSession saves a new session with its first tokens and sets
+// its ID and CreatedAt
+func (s *MemoryAuthStore) CreateSession(session *model.Session, tokens []model.SessionToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSession++
+	session.SessionID = s.lastSession
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	s.sessions[session.SessionID] = *session
+	for i := range tokens {
+		tokens[i].IDSession = session.SessionID
+		s.sessionJWTs[tokens[i].JTI] = tokens[i]
+	}
+	return nil
+}
+
+// RefreshSession saves the refresh of a session with its new tokens
+// and marks the refresh token they replace
+func (s *MemoryAuthStore) RefreshSession(session model.Session, replaced string, tokens []model.SessionToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, ok := s.sessions[session.SessionID]
+	if !ok {
+		return nil
+	}
+	saved.RefreshedAt = session.RefreshedAt
+	saved.ExpiresAt = session.ExpiresAt
+	s.sessions[session.SessionID] = saved
+	if token, ok := s.sessionJWTs[replaced]; ok {
+		token.Replaced = true
+		s.sessionJWTs[replaced] = token
+	}
+	for i := range tokens {
+		tokens[i].IDSession = session.SessionID
+		s.sessionJWTs[tokens[i].JTI] = tokens[i]
+	}
+	return nil
+}
+
+// RevokeSession marks a session as revoked
+func (s *MemoryAuthStore) RevokeSession(sessionID uint64, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, ok := s.sessions[sessionID]; ok && session.RevokedAt == nil {
+		session.RevokedAt = &revokedAt
+		s.sessions[sessionID] = session
+	}
+	return nil
+}
+
+// RevokeSessions marks all sessions of an auth ID as revoked except one,
+// or all of them if it is 0
+func (s *MemoryAuthStore) RevokeSessions(authID, exceptID uint64, revokedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID, session := range s.sessions {
+		if session.IDAuth == authID && sessionID != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &revokedAt
+			s.sessions[sessionID] = session
+		}
+	}
+	return nil
+}
+
+// PruneSessions removes the sessions and their tokens expired until the given time
+func (s *MemoryAuthStore) PruneSessions(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for jti, token := range s.sessionJWTs {
+		if !token.ExpiresAt.After(until) {
+			delete(s.sessionJWTs, jti)
+		}
+	}
+	for sessionID, session := range s.sessions {
+		if !session.ExpiresAt.After(until) {
+			delete(s.sessions, sessionID)
+		}
+	}
+	return nil
+}
+
+// FindEmailTokens returns the email tokens of a kind of an auth ID, newest first
+func (s *MemoryAuthStore) FindEmailTokens(authID uint64, kind string) ([]model.EmailToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []model.EmailToken{}
+	for _, token := range s.emailTokens {
+		if token.IDAuth == authID && token.Kind == kind {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].TokenID > tokens[j].TokenID })
+	return tokens, nil
+}
+
+// FindEmailToken returns an email token by its ID
+func (s *MemoryAuthStore) FindEmailToken(tokenID uint64) (model.EmailToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	token, ok := s.emailTokens[tokenID]
+	if !ok {
+		return model.EmailToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+// CreateEmailToken saves a new email token and sets its ID and CreatedAt
+func (s *MemoryAuthStore) CreateEmailToken(token *model.EmailToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastEmailID++
+	token.TokenID = s.lastEmailID
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	s.emailTokens[token.TokenID] = *token
+	return nil
+}
+
+// TakeEmailToken returns and removes an email token
+func (s *MemoryAuthStore) TakeEmailToken(tokenID uint64) (model.EmailToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.emailTokens[tokenID]
+	if !ok {
+		return model.EmailToken{}, ErrNotFound
+	}
+	delete(s.emailTokens, tokenID)
+	return token, nil
+}
+
+// DeleteEmailTokens removes the email tokens of a kind of an auth ID
+func (s *MemoryAuthStore) DeleteEmailTokens(authID uint64, kind string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.emailTokens {
+		if token.IDAuth == authID && token.Kind == kind {
+			delete(s.emailTokens, tokenID)
+		}
+	}
+	return nil
+}
+
+// PruneEmailTokens removes the email tokens expired until the given time
+func (s *MemoryAuthStore) PruneEmailTokens(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenID, token := range s.emailTokens {
+		if !token.ExpiresAt.After(until) {
+			delete(s.emailTokens, tokenID)
+		}
+	}
+	return nil
+}
+
+// FindPasskeys returns the passkeys of an auth ID, oldest first
+func (s *MemoryAuthStore) FindPasskeys(authID uint64) ([]model.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	passkeys := []model.Passkey{}
+	for _, passkey := range s.passkeys {
+		if passkey.IDAuth == authID {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool { return passkeys[i].PasskeyID < passkeys[j].PasskeyID })
+	return passkeys, nil
+}
+
+// FindPasskey returns a passkey by its credential ID
+func (s *MemoryAuthStore) FindPasskey(credentialID string) (model.Passkey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, passkey := range s.passkeys {
+		if passkey.CredentialID == credentialID {
+			return passkey, nil
+		}
+	}
+	return model.Passkey{}, ErrNotFound
+}
+
+// CreatePasskey saves a new passkey and sets its ID and CreatedAt,
+// ErrConflict if the credential is registered already
+func (s *MemoryAuthStore) CreatePasskey(passkey *model.Passkey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.passkeys {
+		if existing.CredentialID == passkey.CredentialID {
+			return ErrConflict
+		}
+	}
+	s.lastPasskey++
+	passkey.PasskeyID = s.lastPasskey
+	if passkey.CreatedAt.IsZero() {
+		passkey.CreatedAt = time.Now()
+	}
+	s.passkeys[passkey.PasskeyID] = *passkey
+	return nil
+}
+
+// UsePasskey saves the signature counter of an authentication, the
+// counter is only raised, authenticators without counter send 0
+func (s *MemoryAuthStore) UsePasskey(passkeyID uint64, signCount uint32, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkey, ok := s.passkeys[passkeyID]
+	if !ok || (signCount != 0 && passkey.SignCount >= signCount) {
+		return ErrConflict
+	}
+	passkey.SignCount = signCount
+	passkey.LastUsedAt = &usedAt
+	s.passkeys[passkeyID] = passkey
+	return nil
+}
+
+// DeletePasskey removes a passkey
+func (s *MemoryAuthStore) DeletePasskey(passkeyID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.passkeys, passkeyID)
+	return nil
+}
+
+// CreatePasskeyChallenge saves a started ceremony
+func (s *MemoryAuthStore) CreatePasskeyChallenge(challenge model.PasskeyChallenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[challenge.Challenge]; ok {
+		return ErrConflict
+	}
+	s.challenges[challenge.Challenge] = challenge
+	return nil
+}
+
+// TakePasskeyChallenge returns and removes a started ceremony
+func (s *MemoryAuthStore) TakePasskeyChallenge(challenge string) (model.PasskeyChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	passkeyChallenge, ok := s.challenges[challenge]
+	if !ok {
+		return model.PasskeyChallenge{}, ErrNotFound
+	}
+	delete(s.challenges, challenge)
+	return passkeyChallenge, nil
+}
+
+// PrunePasskeyChallenges removes the ceremonies expired until the given time
+func (s *MemoryAuthStore) PrunePasskeyChallenges(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, challenge := range s.challenges {
+		if !challenge.ExpiresAt.After(until) {
+			delete(s.challenges, key)
+		}
+	}
+	return nil
+}
+
+// deleteClient removes an OAuth2 client with its codes and tokens,
+// the caller holds the lock
+func (s *MemoryAuthStore) deleteClient(clientID string) {
+	delete(s.clients, clientID)
+	for codeID, code := range s.codes {
+		if code.ClientID == clientID {
+			delete(s.codes, codeID)
+		}
+	}
+	for tokenID, token := range s.oauthTokens {
+		if token.ClientID == clientID {
+			delete(s.oauthTokens, tokenID)
+		}
+	}
+}
+
+// deleteOAuthTokens removes the OAuth2 tokens of an auth ID issued to
+// a client, or to all clients if it is empty, the caller holds the lock
+func (s *MemoryAuthStore) deleteOAuthTokens(authID uint64, clientID string) {
+	for tokenID, token := range s.oauthTokens {
+		if token.IDAuth == authID && (clientID == "" || token.ClientID == clientID) {
+			delete(s.oauthTokens, tokenID)
+		}
+	}
+}
+
+// deleteTokens removes all access tokens of an auth ID,
+// the caller holds the lock
+func (s *MemoryAuthStore) deleteTokens(authID uint64) {
+	for tokenID, token := range s.tokens {
+		if token.IDAuth == authID {
+			delete(s.tokens, tokenID)
+		}
+	}
+}
+
+// MemoryExportStore - thread-safe ExportStore kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type MemoryExportStore struct {
+	mu      sync.RWMutex
+	lastID  uint64
+	exports map[uint64]model.DataExport
+}
+
+// NewMemoryExportStore returns an empty in-memory ExportStore
+func NewMemoryExportStore() *MemoryExportStore {
+	return &MemoryExportStore{exports: map[uint64]model.DataExport{}}
+}
+
+// FindByAuth returns the exports of a user, newest first
+func (s *MemoryExportStore) FindByAuth(authID uint64) ([]model.DataExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exports := []model.DataExport{}
+	for _, export := range s.exports {
+		if export.IDAuth == authID {
+			exports = append(exports, export)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i].ExportID > exports[j].ExportID })
+	return exports, nil
+}
+
+// FindOne returns an export if it was requested by the user
+func (s *MemoryExportStore) FindOne(authID, exportID uint64) (model.DataExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	export, ok := s.exports[exportID]
+	if !ok || export.IDAuth != authID {
+		return model.DataExport{}, ErrNotFound
+	}
+	return export, nil
+}
+
+// FindExpired returns the exports expired until the given time
+func (s *MemoryExportStore) FindExpired(until time.Time) ([]model.DataExport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	exports := []model.DataExport{}
+	for _, export := range s.exports {
+		if export.ExpiresAt != nil && !export.ExpiresAt.After(until) {
+			exports = append(exports, export)
+		}
+	}
+	return exports, nil
+}
+
+// Create saves a new export
+func (s *MemoryExportStore) Create(export *model.DataExport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastID++
+	export.ExportID = s.lastID
+	export.CreatedAt = now
+	export.UpdatedAt = now
+	s.exports[export.ExportID] = *export
+	return nil
+}
+
+// Update saves all fields of an existing export
+func (s *MemoryExportStore) Update(export *model.DataExport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.exports[export.ExportID]; !ok {
+		return ErrNotFound
+	}
+	s.exports[export.ExportID] = *export
+	return nil
+}
+
+// Delete removes an export
+func (s *MemoryExportStore) Delete(exportID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.exports, exportID)
+	return nil
+}
+
+// memberKey - key of a membership in MemoryWorkspaceStore
+type memberKey struct {
+	workspaceID uint64
+	userID      uint64
+}
+
+// MemoryWorkspaceStore - thread-safe WorkspaceStore kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type MemoryWorkspaceStore struct {
+	mu               sync.RWMutex
+	lastID           uint64
+	lastInvitationID uint64
+	workspaces       map[uint64]model.Workspace
+	members          map[memberKey]model.WorkspaceMember
+	invitations      map[uint64]model.WorkspaceInvitation
+	notes            *MemoryNoteStore
+	audit            *MemoryAuditStore
+}
+
+// NewMemoryWorkspaceStore returns an empty in-memory WorkspaceStore
+// deleting the notes of workspaces from the given note store and
+// recording its audit events in the given audit store
+func NewMemoryWorkspaceStore(notes *MemoryNoteStore, audit *MemoryAuditStore) *MemoryWorkspaceStore {
+	return &MemoryWorkspaceStore{
+		workspaces:  map[uint64]model.Workspace{},
+		members:     map[memberKey]model.WorkspaceMember{},
+		invitations: map[uint64]model.WorkspaceInvitation{},
+		notes:       notes,
+		audit:       audit,
+	}
+}
+
+// FindByMember returns the workspaces of a user with their role
+func (s *MemoryWorkspaceStore) FindByMember(userID uint64) ([]model.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspaces := []model.Workspace{}
+	for key, member := range s.members {
+		if key.userID == userID {
+			workspace := s.workspaces[key.workspaceID]
+			workspace.Role = member.Role
+			workspaces = append(workspaces, workspace)
+		}
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].WorkspaceID < workspaces[j].WorkspaceID })
+	return workspaces, nil
+}
+
+// FindOne returns a workspace by its ID
+func (s *MemoryWorkspaceStore) FindOne(workspaceID uint64) (model.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[workspaceID]
+	if !ok {
+		return model.Workspace{}, ErrNotFound
+	}
+	return workspace, nil
+}
+
+// Create saves a new workspace with its owner
+func (s *MemoryWorkspaceStore) Create(workspace *model.Workspace, owner *model.WorkspaceMember, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.lastID++
+	workspace.WorkspaceID = s.lastID
+	workspace.CreatedAt = now
+	workspace.UpdatedAt = now
+	s.workspaces[workspace.WorkspaceID] = *workspace
+
+	owner.IDWorkspace = workspace.WorkspaceID
+	owner.CreatedAt = now
+	owner.UpdatedAt = now
+	s.members[memberKey{owner.IDWorkspace, owner.IDUser}] = *owner
+	s.audit.record(event, workspace.WorkspaceID)
+	return nil
+}
+
+// Update saves all fields of an existing workspace
+func (s *MemoryWorkspaceStore) Update(workspace *model.Workspace, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workspaces[workspace.WorkspaceID]; !ok {
+		return ErrNotFound
+	}
+	s.workspaces[workspace.WorkspaceID] = *workspace
+	s.audit.record(event, workspace.WorkspaceID)
+	return nil
+}
+
+// Delete hard deletes a workspace with its members, invitations and notes
+func (s *MemoryWorkspaceStore) Delete(workspace model.Workspace, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delete(workspace.WorkspaceID)
+	s.audit.record(event, workspace.WorkspaceID)
+	return nil
+}
+
+// delete removes a workspace with everything attached to it,
+// the caller holds the lock
+func (s *MemoryWorkspaceStore) delete(workspaceID uint64) {
+	s.notes.deleteWorkspace(workspaceID)
+	for invitationID, invitation := range s.invitations {
+		if invitation.IDWorkspace == workspaceID {
+			delete(s.invitations, invitationID)
+		}
+	}
+	for key := range s.members {
+		if key.workspaceID == workspaceID {
+			delete(s.members, key)
+		}
+	}
+	delete(s.workspaces, workspaceID)
+}
+
+// FindMember returns the membership of a user in a workspace
+func (s *MemoryWorkspaceStore) FindMember(workspaceID, userID uint64) (model.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.members[memberKey{workspaceID, userID}]
+	if !ok {
+		return model.WorkspaceMember{}, ErrNotFound
+	}
+	return member, nil
+}
+
+// FindMembers returns the members of a workspace ordered by user ID
+func (s *MemoryWorkspaceStore) FindMembers(workspaceID uint64) ([]model.WorkspaceMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []model.WorkspaceMember{}
+	for key, member := range s.members {
+		if key.workspaceID == workspaceID {
+			members = append(members, member)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].IDUser < members[j].IDUser })
+	return members, nil
+}
+
+// SaveMember creates or replaces a membership
+func (s *MemoryWorkspaceStore) SaveMember(member *model.WorkspaceMember, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveMember(member)
+	s.audit.record(event, member.IDUser)
+	return nil
+}
+
+// saveMember sets the timestamps of a membership and stores it,
+// the caller holds the lock
+func (s *MemoryWorkspaceStore) saveMember(member *model.WorkspaceMember) {
+	now := time.Now()
+	if member.CreatedAt.IsZero() {
+		member.CreatedAt = now
+	}
+	member.UpdatedAt = now
+	s.members[memberKey{member.IDWorkspace, member.IDUser}] = *member
+}
+
+// DeleteMember removes a user from a workspace
+func (s *MemoryWorkspaceStore) DeleteMember(member model.WorkspaceMember, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.members, memberKey{member.IDWorkspace, member.IDUser})
+	s.audit.record(event, member.IDUser)
+	return nil
+}
+
+// FindInvitations returns the invitations of a workspace, newest first
+func (s *MemoryWorkspaceStore) FindInvitations(workspaceID uint64) ([]model.WorkspaceInvitation, error) {
+	return s.findInvitations(func(invitation model.WorkspaceInvitation) bool {
+		return invitation.IDWorkspace == workspaceID
+	}), nil
+}
+
+// FindInvitationsFor returns the invitations addressed to a user
+// or to their email address, newest first
+func (s *MemoryWorkspaceStore) FindInvitationsFor(userID uint64, email string) ([]model.WorkspaceInvitation, error) {
+	return s.findInvitations(func(invitation model.WorkspaceInvitation) bool {
+		return invitation.IDUser != nil && *invitation.IDUser == userID ||
+			email != "" && invitation.Email == email
+	}), nil
+}
+
+// findInvitations returns the invitations matching a condition, newest first
+func (s *MemoryWorkspaceStore) findInvitations(match func(model.WorkspaceInvitation) bool) []model.WorkspaceInvitation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitations := []model.WorkspaceInvitation{}
+	for _, invitation := range s.invitations {
+		if match(invitation) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].InvitationID > invitations[j].InvitationID })
+	return invitations
+}
+
+// FindInvitation returns an invitation by its ID
+func (s *MemoryWorkspaceStore) FindInvitation(invitationID uint64) (model.WorkspaceInvitation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invitation, ok := s.invitations[invitationID]
+	if !ok {
+		return model.WorkspaceInvitation{}, ErrNotFound
+	}
+	return invitation, nil
+}
+
+// CreateInvitation saves a new invitation
+func (s *MemoryWorkspaceStore) CreateInvitation(invitation *model.WorkspaceInvitation, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastInvitationID++
+	invitation.InvitationID = s.lastInvitationID
+	invitation.CreatedAt = time.Now()
+	s.invitations[invitation.InvitationID] = *invitation
+	s.audit.record(event, invitation.InvitationID)
+	return nil
+}
+
+// DeleteInvitation removes an invitation
+func (s *MemoryWorkspaceStore) DeleteInvitation(invitation model.WorkspaceInvitation, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.invitations, invitation.InvitationID)
+	s.audit.record(event, invitation.InvitationID)
+	return nil
+}
+
+// Accept saves the membership of an invited user and removes the invitation
+func (s *MemoryWorkspaceStore) Accept(invitation model.WorkspaceInvitation, member *model.WorkspaceMember, event *model.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invitations[invitation.InvitationID]; !ok {
+		return ErrNotFound
+	}
+	s.saveMember(member)
+	delete(s.invitations, invitation.InvitationID)
+	s.audit.record(event, member.IDUser)
+	return nil
+}
+
+// PruneInvitations removes the invitations expired until the given time
+func (s *MemoryWorkspaceStore) PruneInvitations(until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for invitationID, invitation := range s.invitations {
+		if !invitation.ExpiresAt.After(until) {
+			delete(s.invitations, invitationID)
+		}
+	}
+	return nil
+}
+
+// Purge removes a user from all workspaces
+func (s *MemoryWorkspaceStore) Purge(userID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, member := range s.members {
+		if key.userID == userID && member.Role == model.WorkspaceRoleOwner {
+			s.delete(key.workspaceID)
+		}
+	}
+
+	owners := map[uint64]uint64{}
+	for key, member := range s.members {
+		if member.Role == model.WorkspaceRoleOwner {
+			owners[key.workspaceID] = key.userID
+		}
+	}
+	s.notes.handOver(userID, owners)
+
+	for invitationID, invitation := range s.invitations {
+		if invitation.IDUser != nil && *invitation.IDUser == userID {
+			delete(s.invitations, invitationID)
+		}
+	}
+	for key := range s.members {
+		if key.userID == userID {
+			delete(s.members, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1220 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"apidev/database/model"
+	"apidev/lib/geo"
+)
+
+// mongoStore - common parts of the MongoDB stores
+type mongoStore struct {
+	db  *qmgo.Database
+	ttl time.Duration
+}
+
+// context returns a context bound to the configured connection TTL
+func (s mongoStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), s.ttl)
+}
+
+// nextID allocates the next numeric ID of a collection
+//
+// MongoDB has no auto-increment, numeric IDs keep the API
+// identical to the RDBMS backend
+func (s mongoStore) nextID(ctx context.Context, collection string) (uint64, error) {
+	counter := model.MongoCounter{}
+	err := s.db.Collection(model.MongoCollectionCounters).
+		Find(ctx, bson.M{"_id": collection}).
+		Apply(qmgo.Change{
+			Update:    bson.M{"$inc": bson.M{"seq": 1}},
+			Upsert:    true,
+			ReturnNew: true,
+		}, &counter)
+	return counter.Seq, err
+}
+
+// insertEvent saves the event of a change, if any, after the change
+//
+// MongoDB is used without multi-document transactions, an event
+// failing to save is reported but the change is kept
+func (s mongoStore) insertEvent(ctx context.Context, event *model.AuditEvent, resourceID uint64) error {
+	if event == nil {
+		return nil
+	}
+	if event.ResourceID == 0 {
+		event.ResourceID = resourceID
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	eventID, err := s.nextID(ctx, model.MongoCollectionAudit)
+	if err != nil {
+		return err
+	}
+	event.EventID = eventID
+
+	_, err = s.db.Collection(model.MongoCollectionAudit).InsertOne(ctx, model.MongoAuditEvent{
+		EventID:      event.EventID,
+		CreatedAt:    event.CreatedAt,
+		IDAuth:       event.IDAuth,
+		Action:       event.Action,
+		ResourceType: event.ResourceType,
+		ResourceID:   event.ResourceID,
+		Changes:      event.Changes,
+		ClientIP:     event.ClientIP,
+		UserAgent:    event.UserAgent,
+	})
+	return err
+}
+
+// mongoError maps qmgo.ErrNoSuchDocuments to ErrNotFound
+// and duplicate keys to ErrConflict
+func mongoError(err error) error {
+	if qmgo.IsErrNoDocuments(err) {
+		return ErrNotFound
+	}
+	if qmgo.IsDup(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+// MongoUserStore - UserStore backed by MongoDB
+type MongoUserStore struct {
+	mongoStore
+}
+
+// NewMongoUserStore returns a UserStore using the given database,
+// every operation is bound to the TTL
+func NewMongoUserStore(db *qmgo.Database, ttl time.Duration) *MongoUserStore {
+	return &MongoUserStore{mongoStore{db: db, ttl: ttl}}
+}
+
+// FindByAuthID returns the profile linked to an auth ID
+func (s *MongoUserStore) FindByAuthID(authID uint64) (model.User, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoUser{}
+	err := s.db.Collection(model.MongoCollectionUsers).
+		Find(ctx, bson.M{"idAuth": authID, "deletedAt": nil}).
+		One(&doc)
+	if err != nil {
+		return model.User{}, mongoError(err)
+	}
+	return doc.User(), nil
+}
+
+// FindByID returns a profile by its ID
+func (s *MongoUserStore) FindByID(userID uint64) (model.User, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoUser{}
+	err := s.db.Collection(model.MongoCollectionUsers).
+		Find(ctx, bson.M{"_id": userID, "deletedAt": nil}).
+		One(&doc)
+	if err != nil {
+		return model.User{}, mongoError(err)
+	}
+	return doc.User(), nil
+}
+
+// FindByNickname returns the profile using a nickname key
+func (s *MongoUserStore) FindByNickname(key string) (model.User, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoUser{}
+	err := s.db.Collection(model.MongoCollectionUsers).
+		Find(ctx, bson.M{"nickKey": key, "deletedAt": nil}).
+		One(&doc)
+	if err != nil {
+		return model.User{}, mongoError(err)
+	}
+	return doc.User(), nil
+}
+
+// Search returns the profiles whose nickname contains the given one
+func (s *MongoUserStore) Search(filter model.UserFilter) ([]model.User, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	query := bson.M{"deletedAt": nil}
+	if filter.NickName != "" {
+		query["nickName"] = bson.M{"$regex": regexp.QuoteMeta(filter.NickName), "$options": "i"}
+	}
+	if filter.AfterID != 0 {
+		query["_id"] = bson.M{"$gt": filter.AfterID}
+	}
+
+	find := s.db.Collection(model.MongoCollectionUsers).Find(ctx, query).Sort("_id")
+	if filter.Limit > 0 {
+		find = find.Limit(int64(filter.Limit))
+	}
+
+	docs := []model.MongoUser{}
+	if err := find.All(&docs); err != nil {
+		return nil, err
+	}
+	users := make([]model.User, 0, len(docs))
+	for _, doc := range docs {
+		users = append(users, doc.User())
+	}
+	return users, nil
+}
+
+// FindReservation returns the reservation of a nickname key
+func (s *MongoUserStore) FindReservation(key string) (model.NicknameReservation, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoNicknameReservation{}
+	err := s.db.Collection(model.MongoCollectionNickname).
+		Find(ctx, bson.M{"_id": key}).
+		One(&doc)
+	if err != nil {
+		return model.NicknameReservation{}, mongoError(err)
+	}
+	return model.NicknameReservation{NickKey: doc.NickKey, IDUser: doc.IDUser, ExpiresAt: doc.ExpiresAt}, nil
+}
+
+// Reserve creates or replaces the reservation of a nickname key
+func (s *MongoUserStore) Reserve(reservation model.NicknameReservation) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	_, err := s.db.Collection(model.MongoCollectionNickname).Upsert(ctx, bson.M{"_id": reservation.NickKey}, model.MongoNicknameReservation{
+		NickKey:   reservation.NickKey,
+		IDUser:    reservation.IDUser,
+		ExpiresAt: reservation.ExpiresAt,
+	})
+	return err
+}
+
+// FindSettings returns the stored settings of a user
+func (s *MongoUserStore) FindSettings(userID uint64) (model.UserSettings, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoUserSettings{}
+	err := s.db.Collection(model.MongoCollectionSettings).
+		Find(ctx, bson.M{"_id": userID}).
+		One(&doc)
+	if err != nil {
+		return model.UserSettings{}, mongoError(err)
+	}
+	return model.UserSettings{IDUser: doc.IDUser, UpdatedAt: doc.UpdatedAt, Values: doc.Values}, nil
+}
+
+// SaveSettings creates or replaces the settings of a user
+func (s *MongoUserStore) SaveSettings(settings *model.UserSettings) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	settings.UpdatedAt = time.Now()
+	_, err := s.db.Collection(model.MongoCollectionSettings).Upsert(ctx, bson.M{"_id": settings.IDUser}, model.MongoUserSettings{
+		IDUser:    settings.IDUser,
+		UpdatedAt: settings.UpdatedAt,
+		Values:    settings.Values,
+	})
+	return err
+}
+
+// Create saves a new profile
+func (s *MongoUserStore) Create(user *model.User, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	userID, err := s.nextID(ctx, model.MongoCollectionUsers)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.UserID = userID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	_, err = s.db.Collection(model.MongoCollectionUsers).InsertOne(ctx, model.MongoUser{
+		UserID:      user.UserID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		NickName:    user.NickName,
+		NickKey:     user.NickKey,
+		NickChanged: user.NickChanged,
+		Bio:         user.Bio,
+		Timezone:    user.Timezone,
+		Locale:      user.Locale,
+		Preferences: user.Preferences,
+		Avatar:      user.Avatar,
+		DeleteAfter: user.DeleteAfter,
+		IDAuth:      user.IDAuth,
+	})
+	if err != nil {
+		return mongoError(err)
+	}
+	return s.insertEvent(ctx, event, user.UserID)
+}
+
+// Update saves all fields of an existing profile
+func (s *MongoUserStore) Update(user *model.User, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionUsers).UpdateOne(ctx, bson.M{"_id": user.UserID}, bson.M{"$set": bson.M{
+		"updatedAt":   user.UpdatedAt,
+		"nickName":    user.NickName,
+		"nickKey":     user.NickKey,
+		"nickChanged": user.NickChanged,
+		"bio":         user.Bio,
+		"timezone":    user.Timezone,
+		"locale":      user.Locale,
+		"preferences": user.Preferences,
+		"avatar":      user.Avatar,
+		"deleteAfter": user.DeleteAfter,
+	}})
+	if err != nil {
+		return mongoError(err)
+	}
+	return s.insertEvent(ctx, event, user.UserID)
+}
+
+// FindDeletionDue returns the profiles scheduled for deletion until the given time
+func (s *MongoUserStore) FindDeletionDue(until time.Time) ([]model.User, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoUser{}
+	err := s.db.Collection(model.MongoCollectionUsers).
+		Find(ctx, bson.M{"deleteAfter": bson.M{"$ne": nil, "$lte": until}}).
+		All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]model.User, 0, len(docs))
+	for _, doc := range docs {
+		users = append(users, doc.User())
+	}
+	return users, nil
+}
+
+// Purge hard deletes a profile, its settings and nickname reservations
+//
+// the notes are deleted by MongoNoteStore.Purge
+func (s *MongoUserStore) Purge(user model.User) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	_, err := s.db.Collection(model.MongoCollectionNickname).RemoveAll(ctx, bson.M{"idUser": user.UserID})
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Collection(model.MongoCollectionSettings).RemoveAll(ctx, bson.M{"_id": user.UserID})
+	if err != nil {
+		return err
+	}
+	err = s.db.Collection(model.MongoCollectionUsers).Remove(ctx, bson.M{"_id": user.UserID})
+	if err != nil && !qmgo.IsErrNoDocuments(err) {
+		return err
+	}
+	return nil
+}
+
+// MongoNoteStore - NoteStore backed by MongoDB
+type MongoNoteStore struct {
+	mongoStore
+}
+
+// NewMongoNoteStore returns a NoteStore using the given database,
+// every operation is bound to the TTL
+func NewMongoNoteStore(db *qmgo.Database, ttl time.Duration) *MongoNoteStore {
+	return &MongoNoteStore{mongoStore{db: db, ttl: ttl}}
+}
+
+// mongoOwner builds a filter for the notes of an owner,
+// personal notes have no idWorkspace
+func mongoOwner(owner Owner) bson.M {
+	if owner.WorkspaceID != 0 {
+		return bson.M{"idWorkspace": owner.WorkspaceID, "deletedAt": nil}
+	}
+	return bson.M{"idUser": owner.UserID, "idWorkspace": nil, "deletedAt": nil}
+}
+
+// FindByOwner returns all notes of an owner ordered by ID
+func (s *MongoNoteStore) FindByOwner(owner Owner) ([]model.Note, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoNote{}
+	err := s.db.Collection(model.MongoCollectionNotes).
+		Find(ctx, mongoOwner(owner)).
+		Sort("_id").
+		All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]model.Note, 0, len(docs))
+	for _, doc := range docs {
+		notes = append(notes, doc.Note())
+	}
+	return notes, nil
+}
+
+// FindOne returns a note if it belongs to the owner
+func (s *MongoNoteStore) FindOne(owner Owner, noteID uint64) (model.Note, error) {
+	filter := mongoOwner(owner)
+	filter["_id"] = noteID
+	return s.findOne(filter)
+}
+
+// FindByID returns a note of any owner
+func (s *MongoNoteStore) FindByID(noteID uint64) (model.Note, error) {
+	return s.findOne(bson.M{"_id": noteID, "deletedAt": nil})
+}
+
+// findOne returns the note matching the filter
+func (s *MongoNoteStore) findOne(filter bson.M) (model.Note, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoNote{}
+	err := s.db.Collection(model.MongoCollectionNotes).
+		Find(ctx, filter).
+		One(&doc)
+	if err != nil {
+		return model.Note{}, mongoError(err)
+	}
+	return doc.Note(), nil
+}
+
+// FindAllByUser returns all notes written by a user, soft deleted ones included
+func (s *MongoNoteStore) FindAllByUser(userID uint64) ([]model.Note, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoNote{}
+	err := s.db.Collection(model.MongoCollectionNotes).
+		Find(ctx, bson.M{"idUser": userID}).
+		Sort("_id").
+		All(&docs)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]model.Note, 0, len(docs))
+	for _, doc := range docs {
+		notes = append(notes, doc.Note())
+	}
+	return notes, nil
+}
+
+// FindByLocation returns the notes of an owner matching a location query
+func (s *MongoNoteStore) FindByLocation(owner Owner, query geo.Query) ([]model.Note, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	// narrow down the candidates, the exact distance is computed afterwards
+	filter := []bson.M{mongoOwner(owner), {"latitude": bson.M{"$ne": nil}}}
+	if query.Near != nil {
+		filter = append(filter, mongoBBox(geo.Around(*query.Near, query.Radius)))
+	}
+	if query.BBox != nil {
+		filter = append(filter, mongoBBox(*query.BBox))
+	}
+
+	docs := []model.MongoNote{}
+	if err := s.db.Collection(model.MongoCollectionNotes).Find(ctx, bson.M{"$and": filter}).All(&docs); err != nil {
+		return nil, err
+	}
+
+	notes := make([]model.Note, 0, len(docs))
+	for _, doc := range docs {
+		notes = append(notes, doc.Note())
+	}
+	return filterByLocation(notes, query), nil
+}
+
+// mongoBBox builds a filter for notes inside a bounding box
+func mongoBBox(box geo.BBox) bson.M {
+	filter := bson.M{"latitude": bson.M{"$gte": box.MinLat, "$lte": box.MaxLat}}
+	if box.MinLng <= box.MaxLng {
+		filter["longitude"] = bson.M{"$gte": box.MinLng, "$lte": box.MaxLng}
+		return filter
+	}
+	// crossing the antimeridian
+	filter["$or"] = []bson.M{
+		{"longitude": bson.M{"$gte": box.MinLng}},
+		{"longitude": bson.M{"$lte": box.MaxLng}},
+	}
+	return filter
+}
+
+// FindByPosition returns all notes of an owner in manual order
+func (s *MongoNoteStore) FindByPosition(owner Owner) ([]model.Note, error) {
+	notes, err := s.FindByOwner(owner)
+	if err != nil {
+		return nil, err
+	}
+	SortByPosition(notes)
+	return notes, nil
+}
+
+// LastPosition returns the greatest position of the notes of an owner
+func (s *MongoNoteStore) LastPosition(owner Owner) (string, error) {
+	return s.findPosition(owner, bson.M{"$ne": ""}, "-position")
+}
+
+// AdjacentPosition returns the closest position after (or before) the given one
+func (s *MongoNoteStore) AdjacentPosition(owner Owner, position string, after bool) (string, error) {
+	if after {
+		return s.findPosition(owner, bson.M{"$gt": position}, "position")
+	}
+	return s.findPosition(owner, bson.M{"$lt": position, "$ne": ""}, "-position")
+}
+
+// findPosition returns the position of the first note matching
+// the condition in the given order, empty if there is none
+func (s *MongoNoteStore) findPosition(owner Owner, condition bson.M, sort string) (string, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	filter := mongoOwner(owner)
+	filter["position"] = condition
+
+	doc := model.MongoNote{}
+	err := s.db.Collection(model.MongoCollectionNotes).
+		Find(ctx, filter).
+		Sort(sort).
+		Limit(1).
+		One(&doc)
+	if err != nil {
+		if qmgo.IsErrNoDocuments(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return doc.Position, nil
+}
+
+// Reorder sets the positions of several notes of an owner
+//
+// MongoDB updates the documents one by one, an interrupted
+// rebalancing leaves a valid but partially spread order
+func (s *MongoNoteStore) Reorder(owner Owner, positions map[uint64]string) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	now := time.Now()
+	for noteID, position := range positions {
+		filter := mongoOwner(owner)
+		filter["_id"] = noteID
+		err := s.db.Collection(model.MongoCollectionNotes).UpdateOne(ctx,
+			filter,
+			bson.M{
+				"$set": bson.M{"position": position, "updatedAt": now},
+				"$inc": bson.M{"version": 1},
+			})
+		if err != nil && !qmgo.IsErrNoDocuments(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create saves a new note
+func (s *MongoNoteStore) Create(note *model.Note, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	noteID, err := s.nextID(ctx, model.MongoCollectionNotes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	note.NoteID = noteID
+	note.CreatedAt = now
+	note.UpdatedAt = now
+
+	_, err = s.db.Collection(model.MongoCollectionNotes).InsertOne(ctx, model.MongoNote{
+		NoteID:      note.NoteID,
+		CreatedAt:   note.CreatedAt,
+		UpdatedAt:   note.UpdatedAt,
+		Title:       note.Title,
+		Body:        note.Body,
+		ContentType: note.ContentType,
+		E2EE:        note.E2EE,
+		Ciphertext:  note.Ciphertext,
+		Algorithm:   note.Algorithm,
+		KeyID:       note.KeyID,
+		Nonce:       note.Nonce,
+		Latitude:    note.Latitude,
+		Longitude:   note.Longitude,
+		Accuracy:    note.Accuracy,
+		PlaceName:   note.PlaceName,
+		Position:    note.Position,
+		Version:     note.Version,
+		IDUser:      note.IDUser,
+		IDWorkspace: note.IDWorkspace,
+	})
+	if err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, note.NoteID)
+}
+
+// Update saves all fields of an existing note
+func (s *MongoNoteStore) Update(note *model.Note, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionNotes).UpdateOne(ctx, bson.M{"_id": note.NoteID}, bson.M{"$set": bson.M{
+		"updatedAt":   note.UpdatedAt,
+		"title":       note.Title,
+		"body":        note.Body,
+		"contentType": note.ContentType,
+		"ciphertext":  note.Ciphertext,
+		"algorithm":   note.Algorithm,
+		"keyID":       note.KeyID,
+		"nonce":       note.Nonce,
+		"latitude":    note.Latitude,
+		"longitude":   note.Longitude,
+		"accuracy":    note.Accuracy,
+		"placeName":   note.PlaceName,
+		"position":    note.Position,
+		"version":     note.Version,
+	}})
+	if err != nil {
+		return mongoError(err)
+	}
+	return s.insertEvent(ctx, event, note.NoteID)
+}
+
+// Delete soft deletes a note and bumps its version
+func (s *MongoNoteStore) Delete(note *model.Note, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	now := time.Now()
+	err := s.db.Collection(model.MongoCollectionNotes).UpdateOne(ctx, bson.M{"_id": note.NoteID}, bson.M{"$set": bson.M{
+		"updatedAt": now,
+		"deletedAt": now,
+		"version":   note.Version + 1,
+	}})
+	if err != nil {
+		return mongoError(err)
+	}
+	return s.insertEvent(ctx, event, note.NoteID)
+}
+
+// Purge hard deletes all notes written by a user
+func (s *MongoNoteStore) Purge(userID uint64) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	_, err := s.db.Collection(model.MongoCollectionNotes).RemoveAll(ctx, bson.M{"idUser": userID})
+	return err
+}
+
+// errNoChangeSeq - MongoDB keeps no change sequence of the notes,
+// delta sync is refused with this backend
+var errNoChangeSeq = errors.New("delta sync is not supported by MongoDB")
+
+// FindChanges is not supported, see errNoChangeSeq
+func (s *MongoNoteStore) FindChanges(userID uint64, after *ChangeCursor, limit int) ([]model.Note, error) {
+	return nil, errNoChangeSeq
+}
+
+// Sync is not supported, see errNoChangeSeq
+func (s *MongoNoteStore) Sync(fn func(batch SyncBatch) error) error {
+	return errNoChangeSeq
+}
+
+// MongoAuditStore - AuditStore backed by MongoDB
+type MongoAuditStore struct {
+	mongoStore
+}
+
+// NewMongoAuditStore returns an AuditStore using the given database,
+// every operation is bound to the TTL
+func NewMongoAuditStore(db *qmgo.Database, ttl time.Duration) *MongoAuditStore {
+	return &MongoAuditStore{mongoStore{db: db, ttl: ttl}}
+}
+
+// Append saves an event
+func (s *MongoAuditStore) Append(event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	return s.insertEvent(ctx, event, event.ResourceID)
+}
+
+// Find returns the events matching the filter, newest first
+func (s *MongoAuditStore) Find(filter model.AuditFilter) ([]model.AuditEvent, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	query := bson.M{}
+	if filter.IDAuth != 0 {
+		query["idAuth"] = filter.IDAuth
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.ResourceType != "" {
+		query["resourceType"] = filter.ResourceType
+	}
+	if filter.ResourceID != 0 {
+		query["resourceID"] = filter.ResourceID
+	}
+	createdAt := bson.M{}
+	if !filter.Since.IsZero() {
+		createdAt["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		createdAt["$lt"] = filter.Until
+	}
+	if len(createdAt) > 0 {
+		query["createdAt"] = createdAt
+	}
+	if filter.BeforeID != 0 {
+		query["_id"] = bson.M{"$lt": filter.BeforeID}
+	}
+
+	find := s.db.Collection(model.MongoCollectionAudit).Find(ctx, query).Sort("-_id")
+	if filter.Limit > 0 {
+		find = find.Limit(int64(filter.Limit))
+	}
+
+	docs := []model.MongoAuditEvent{}
+	if err := find.All(&docs); err != nil {
+		return nil, err
+	}
+
+	events := make([]model.AuditEvent, 0, len(docs))
+	for _, doc := range docs {
+		events = append(events, doc.AuditEvent())
+	}
+	return events, nil
+}
+
+// Purge removes all events of an actor
+func (s *MongoAuditStore) Purge(authID uint64) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	_, err := s.db.Collection(model.MongoCollectionAudit).RemoveAll(ctx, bson.M{"idAuth": authID})
+	return err
+}
+
+// MongoExportStore - ExportStore backed by MongoDB
+type MongoExportStore struct {
+	mongoStore
+}
+
+// NewMongoExportStore returns an ExportStore using the given database,
+// every operation is bound to the TTL
+func NewMongoExportStore(db *qmgo.Database, ttl time.Duration) *MongoExportStore {
+	return &MongoExportStore{mongoStore{db: db, ttl: ttl}}
+}
+
+// FindByAuth returns the exports of a user, newest first
+func (s *MongoExportStore) FindByAuth(authID uint64) ([]model.DataExport, error) {
+	return s.find(bson.M{"idAuth": authID})
+}
+
+// FindOne returns an export if it was requested by the user
+func (s *MongoExportStore) FindOne(authID, exportID uint64) (model.DataExport, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoDataExport{}
+	err := s.db.Collection(model.MongoCollectionExports).
+		Find(ctx, bson.M{"_id": exportID, "idAuth": authID}).
+		One(&doc)
+	if err != nil {
+		return model.DataExport{}, mongoError(err)
+	}
+	return doc.DataExport(), nil
+}
+
+// FindExpired returns the exports expired until the given time
+func (s *MongoExportStore) FindExpired(until time.Time) ([]model.DataExport, error) {
+	return s.find(bson.M{"expiresAt": bson.M{"$ne": nil, "$lte": until}})
+}
+
+// find returns the exports matching the filter, newest first
+func (s *MongoExportStore) find(filter bson.M) ([]model.DataExport, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoDataExport{}
+	if err := s.db.Collection(model.MongoCollectionExports).Find(ctx, filter).Sort("-_id").All(&docs); err != nil {
+		return nil, err
+	}
+
+	exports := make([]model.DataExport, 0, len(docs))
+	for _, doc := range docs {
+		exports = append(exports, doc.DataExport())
+	}
+	return exports, nil
+}
+
+// Create saves a new export
+func (s *MongoExportStore) Create(export *model.DataExport) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	exportID, err := s.nextID(ctx, model.MongoCollectionExports)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	export.ExportID = exportID
+	export.CreatedAt = now
+	export.UpdatedAt = now
+
+	_, err = s.db.Collection(model.MongoCollectionExports).InsertOne(ctx, model.MongoDataExport{
+		ExportID:  export.ExportID,
+		CreatedAt: export.CreatedAt,
+		UpdatedAt: export.UpdatedAt,
+		IDAuth:    export.IDAuth,
+		Status:    export.Status,
+		Size:      export.Size,
+		ExpiresAt: export.ExpiresAt,
+	})
+	return err
+}
+
+// Update saves all fields of an existing export
+func (s *MongoExportStore) Update(export *model.DataExport) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionExports).UpdateOne(ctx, bson.M{"_id": export.ExportID}, bson.M{"$set": bson.M{
+		"updatedAt": export.UpdatedAt,
+		"status":    export.Status,
+		"size":      export.Size,
+		"expiresAt": export.ExpiresAt,
+	}})
+	return mongoError(err)
+}
+
+// Delete removes an export
+func (s *MongoExportStore) Delete(exportID uint64) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionExports).Remove(ctx, bson.M{"_id": exportID})
+	if err != nil && !qmgo.IsErrNoDocuments(err) {
+		return err
+	}
+	return nil
+}
+
+// MongoWorkspaceStore - WorkspaceStore backed by MongoDB
+type MongoWorkspaceStore struct {
+	mongoStore
+}
+
+// NewMongoWorkspaceStore returns a WorkspaceStore using the given database,
+// every operation is bound to the TTL
+func NewMongoWorkspaceStore(db *qmgo.Database, ttl time.Duration) *MongoWorkspaceStore {
+	return &MongoWorkspaceStore{mongoStore{db: db, ttl: ttl}}
+}
+
+// FindByMember returns the workspaces of a user with their role
+func (s *MongoWorkspaceStore) FindByMember(userID uint64) ([]model.Workspace, error) {
+	members, err := s.findMembers(bson.M{"idUser": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	workspaces := []model.Workspace{}
+	if len(members) == 0 {
+		return workspaces, nil
+	}
+	workspaceIDs := make([]uint64, 0, len(members))
+	roles := map[uint64]string{}
+	for _, member := range members {
+		workspaceIDs = append(workspaceIDs, member.IDWorkspace)
+		roles[member.IDWorkspace] = member.Role
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoWorkspace{}
+	err = s.db.Collection(model.MongoCollectionWorkspaces).
+		Find(ctx, bson.M{"_id": bson.M{"$in": workspaceIDs}}).
+		Sort("_id").
+		All(&docs)
+	if err != nil {
+		return nil, err
+	}
+	for _, doc := range docs {
+		workspace := doc.Workspace()
+		workspace.Role = roles[workspace.WorkspaceID]
+		workspaces = append(workspaces, workspace)
+	}
+	return workspaces, nil
+}
+
+// FindOne returns a workspace by its ID
+func (s *MongoWorkspaceStore) FindOne(workspaceID uint64) (model.Workspace, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoWorkspace{}
+	err := s.db.Collection(model.MongoCollectionWorkspaces).
+		Find(ctx, bson.M{"_id": workspaceID}).
+		One(&doc)
+	if err != nil {
+		return model.Workspace{}, mongoError(err)
+	}
+	return doc.Workspace(), nil
+}
+
+// Create saves a new workspace with its owner
+func (s *MongoWorkspaceStore) Create(workspace *model.Workspace, owner *model.WorkspaceMember, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	workspaceID, err := s.nextID(ctx, model.MongoCollectionWorkspaces)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	workspace.WorkspaceID = workspaceID
+	workspace.CreatedAt = now
+	workspace.UpdatedAt = now
+
+	_, err = s.db.Collection(model.MongoCollectionWorkspaces).InsertOne(ctx, model.MongoWorkspace{
+		WorkspaceID: workspace.WorkspaceID,
+		CreatedAt:   workspace.CreatedAt,
+		UpdatedAt:   workspace.UpdatedAt,
+		Name:        workspace.Name,
+	})
+	if err != nil {
+		return err
+	}
+
+	owner.IDWorkspace = workspace.WorkspaceID
+	if err := s.upsertMember(ctx, owner); err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, workspace.WorkspaceID)
+}
+
+// Update saves all fields of an existing workspace
+func (s *MongoWorkspaceStore) Update(workspace *model.Workspace, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionWorkspaces).UpdateOne(ctx, bson.M{"_id": workspace.WorkspaceID}, bson.M{"$set": bson.M{
+		"updatedAt": workspace.UpdatedAt,
+		"name":      workspace.Name,
+	}})
+	if err != nil {
+		return mongoError(err)
+	}
+	return s.insertEvent(ctx, event, workspace.WorkspaceID)
+}
+
+// Delete hard deletes a workspace with its members, invitations and notes
+//
+// the notes go first, an interrupted deletion leaves an empty workspace
+func (s *MongoWorkspaceStore) Delete(workspace model.Workspace, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	if err := s.delete(ctx, workspace.WorkspaceID); err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, workspace.WorkspaceID)
+}
+
+// delete removes a workspace with everything attached to it
+func (s *MongoWorkspaceStore) delete(ctx context.Context, workspaceID uint64) error {
+	if _, err := s.db.Collection(model.MongoCollectionNotes).RemoveAll(ctx, bson.M{"idWorkspace": workspaceID}); err != nil {
+		return err
+	}
+	if _, err := s.db.Collection(model.MongoCollectionInvitations).RemoveAll(ctx, bson.M{"idWorkspace": workspaceID}); err != nil {
+		return err
+	}
+	if _, err := s.db.Collection(model.MongoCollectionMembers).RemoveAll(ctx, bson.M{"idWorkspace": workspaceID}); err != nil {
+		return err
+	}
+	err := s.db.Collection(model.MongoCollectionWorkspaces).Remove(ctx, bson.M{"_id": workspaceID})
+	if err != nil && !qmgo.IsErrNoDocuments(err) {
+		return err
+	}
+	return nil
+}
+
+// FindMember returns the membership of a user in a workspace
+func (s *MongoWorkspaceStore) FindMember(workspaceID, userID uint64) (model.WorkspaceMember, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoWorkspaceMember{}
+	err := s.db.Collection(model.MongoCollectionMembers).
+		Find(ctx, bson.M{"idWorkspace": workspaceID, "idUser": userID}).
+		One(&doc)
+	if err != nil {
+		return model.WorkspaceMember{}, mongoError(err)
+	}
+	return doc.WorkspaceMember(), nil
+}
+
+// FindMembers returns the members of a workspace ordered by user ID
+func (s *MongoWorkspaceStore) FindMembers(workspaceID uint64) ([]model.WorkspaceMember, error) {
+	return s.findMembers(bson.M{"idWorkspace": workspaceID})
+}
+
+// findMembers returns the memberships matching the filter ordered by user ID
+func (s *MongoWorkspaceStore) findMembers(filter bson.M) ([]model.WorkspaceMember, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoWorkspaceMember{}
+	if err := s.db.Collection(model.MongoCollectionMembers).Find(ctx, filter).Sort("idUser").All(&docs); err != nil {
+		return nil, err
+	}
+
+	members := make([]model.WorkspaceMember, 0, len(docs))
+	for _, doc := range docs {
+		members = append(members, doc.WorkspaceMember())
+	}
+	return members, nil
+}
+
+// SaveMember creates or replaces a membership
+func (s *MongoWorkspaceStore) SaveMember(member *model.WorkspaceMember, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	if err := s.upsertMember(ctx, member); err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, member.IDUser)
+}
+
+// upsertMember sets the timestamps of a membership and stores it
+func (s *MongoWorkspaceStore) upsertMember(ctx context.Context, member *model.WorkspaceMember) error {
+	now := time.Now()
+	if member.CreatedAt.IsZero() {
+		member.CreatedAt = now
+	}
+	member.UpdatedAt = now
+
+	_, err := s.db.Collection(model.MongoCollectionMembers).Upsert(ctx,
+		bson.M{"idWorkspace": member.IDWorkspace, "idUser": member.IDUser},
+		model.MongoWorkspaceMember{
+			IDWorkspace: member.IDWorkspace,
+			IDUser:      member.IDUser,
+			CreatedAt:   member.CreatedAt,
+			UpdatedAt:   member.UpdatedAt,
+			Role:        member.Role,
+		})
+	return err
+}
+
+// DeleteMember removes a user from a workspace
+func (s *MongoWorkspaceStore) DeleteMember(member model.WorkspaceMember, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionMembers).Remove(ctx, bson.M{"idWorkspace": member.IDWorkspace, "idUser": member.IDUser})
+	if err != nil && !qmgo.IsErrNoDocuments(err) {
+		return err
+	}
+	return s.insertEvent(ctx, event, member.IDUser)
+}
+
+// FindInvitations returns the invitations of a workspace, newest first
+func (s *MongoWorkspaceStore) FindInvitations(workspaceID uint64) ([]model.WorkspaceInvitation, error) {
+	return s.findInvitations(bson.M{"idWorkspace": workspaceID})
+}
+
+// FindInvitationsFor returns the invitations addressed to a user
+// or to their email address, newest first
+func (s *MongoWorkspaceStore) FindInvitationsFor(userID uint64, email string) ([]model.WorkspaceInvitation, error) {
+	filter := []bson.M{{"idUser": userID}}
+	if email != "" {
+		filter = append(filter, bson.M{"email": email})
+	}
+	return s.findInvitations(bson.M{"$or": filter})
+}
+
+// findInvitations returns the invitations matching the filter, newest first
+func (s *MongoWorkspaceStore) findInvitations(filter bson.M) ([]model.WorkspaceInvitation, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	docs := []model.MongoWorkspaceInvitation{}
+	if err := s.db.Collection(model.MongoCollectionInvitations).Find(ctx, filter).Sort("-_id").All(&docs); err != nil {
+		return nil, err
+	}
+
+	invitations := make([]model.WorkspaceInvitation, 0, len(docs))
+	for _, doc := range docs {
+		invitations = append(invitations, doc.WorkspaceInvitation())
+	}
+	return invitations, nil
+}
+
+// FindInvitation returns an invitation by its ID
+func (s *MongoWorkspaceStore) FindInvitation(invitationID uint64) (model.WorkspaceInvitation, error) {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	doc := model.MongoWorkspaceInvitation{}
+	err := s.db.Collection(model.MongoCollectionInvitations).
+		Find(ctx, bson.M{"_id": invitationID}).
+		One(&doc)
+	if err != nil {
+		return model.WorkspaceInvitation{}, mongoError(err)
+	}
+	return doc.WorkspaceInvitation(), nil
+}
+
+// CreateInvitation saves a new invitation
+func (s *MongoWorkspaceStore) CreateInvitation(invitation *model.WorkspaceInvitation, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	invitationID, err := s.nextID(ctx, model.MongoCollectionInvitations)
+	if err != nil {
+		return err
+	}
+	invitation.InvitationID = invitationID
+	invitation.CreatedAt = time.Now()
+
+	_, err = s.db.Collection(model.MongoCollectionInvitations).InsertOne(ctx, model.MongoWorkspaceInvitation{
+		InvitationID: invitation.InvitationID,
+		CreatedAt:    invitation.CreatedAt,
+		ExpiresAt:    invitation.ExpiresAt,
+		IDWorkspace:  invitation.IDWorkspace,
+		Role:         invitation.Role,
+		IDUser:       invitation.IDUser,
+		NickName:     invitation.NickName,
+		Email:        invitation.Email,
+		IDInvitedBy:  invitation.IDInvitedBy,
+	})
+	if err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, invitation.InvitationID)
+}
+
+// DeleteInvitation removes an invitation
+func (s *MongoWorkspaceStore) DeleteInvitation(invitation model.WorkspaceInvitation, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionInvitations).Remove(ctx, bson.M{"_id": invitation.InvitationID})
+	if err != nil && !qmgo.IsErrNoDocuments(err) {
+		return err
+	}
+	return s.insertEvent(ctx, event, invitation.InvitationID)
+}
+
+// Accept saves the membership of an invited user and removes the invitation
+//
+// the invitation is removed first, so it cannot be accepted twice
+func (s *MongoWorkspaceStore) Accept(invitation model.WorkspaceInvitation, member *model.WorkspaceMember, event *model.AuditEvent) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	err := s.db.Collection(model.MongoCollectionInvitations).Remove(ctx, bson.M{"_id": invitation.InvitationID})
+	if err != nil {
+		return mongoError(err)
+	}
+	if err := s.upsertMember(ctx, member); err != nil {
+		return err
+	}
+	return s.insertEvent(ctx, event, member.IDUser)
+}
+
+// PruneInvitations removes the invitations expired until the given time
+func (s *MongoWorkspaceStore) PruneInvitations(until time.Time) error {
+	ctx, cancel := s.context()
+	defer cancel()
+
+	_, err := s.db.Collection(model.MongoCollectionInvitations).RemoveAll(ctx, bson.M{"expiresAt": bson.M{"$lte": until}})
+	return err
+}
+
+// Purge removes a user from all workspaces
+//
+// MongoDB is used without multi-document transactions,
+// an interrupted purge is completed by the next run
+func (s *MongoWorkspaceStore) Purge(userID uint64) error {
+	members, err := s.findMembers(bson.M{"idUser": userID})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := s.context()
+	defer cancel()
+
+	for _, member := range members {
+		if member.Role != model.WorkspaceRoleOwner {
+			continue
+		}
+		if err := s.delete(ctx, member.IDWorkspace); err != nil {
+			return err
+		}
+	}
+
+	// hand over the notes written in other workspaces,
+	// including the ones the user has left
+	notes := []model.MongoNote{}
+	err = s.db.Collection(model.MongoCollectionNotes).
+		Find(ctx, bson.M{"idUser": userID, "idWorkspace": bson.M{"$ne": nil}}).
+		All(&notes)
+	if err != nil {
+		return err
+	}
+	handedOver := map[uint64]bool{}
+	for _, note := range notes {
+		workspaceID := *note.IDWorkspace
+		if handedOver[workspaceID] {
+			continue
+		}
+		owner := model.MongoWorkspaceMember{}
+		err := s.db.Collection(model.MongoCollectionMembers).
+			Find(ctx, bson.M{"idWorkspace": workspaceID, "role": model.WorkspaceRoleOwner}).
+			One(&owner)
+		if err != nil {
+			return mongoError(err)
+		}
+		_, err = s.db.Collection(model.MongoCollectionNotes).UpdateAll(ctx,
+			bson.M{"idUser": userID, "idWorkspace": workspaceID},
+			bson.M{"$set": bson.M{"idUser": owner.IDUser}})
+		if err != nil {
+			return err
+		}
+		handedOver[workspaceID] = true
+	}
+
+	if _, err := s.db.Collection(model.MongoCollectionInvitations).RemoveAll(ctx, bson.M{"idUser": userID}); err != nil {
+		return err
+	}
+	_, err = s.db.Collection(model.MongoCollectionMembers).RemoveAll(ctx, bson.M{"idUser": userID})
+	return err
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"sort"
+
+	"apidev/database/model"
+)
+
+// SortByPosition orders notes by position, notes without
+// a position come last, ties are ordered by ID
+func SortByPosition(notes []model.Note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		a, b := notes[i].Position, notes[j].Position
+		if a != b {
+			if a == "" || b == "" {
+				return b == ""
+			}
+			return a < b
+		}
+		return notes[i].NoteID < notes[j].NoteID
+	})
+}
@@ -0,0 +1,488 @@
+// Package store abstracts the persistence of user profiles and notes
+// so that handlers do not depend on a specific database
+package store
+
+import (
+	"errors"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+
+	"apidev/database/model"
+	"apidev/lib/geo"
+)
+
+// Backend - storage backend of user profiles and notes
+type Backend string
+
+// supported backends
+const (
+	BackendRDBMS  Backend = "rdbms"
+	BackendMongo  Backend = "mongo"
+	BackendMemory Backend = "memory"
+)
+
+// ErrNotFound is returned when a record does not exist
+// or is soft deleted
+var ErrNotFound = errors.New("record not found")
+
+// ErrConflict is returned when a write violates a unique constraint,
+// e.g. a nickname taken concurrently by another user
+var ErrConflict = errors.New("record already exists")
+
+// Owner - owner of notes, a user for their personal notes
+// or a workspace for the notes shared with its members
+type Owner struct {
+	UserID      uint64
+	WorkspaceID uint64
+}
+
+// Personal returns the owner of the personal notes of a user
+func Personal(userID uint64) Owner {
+	return Owner{UserID: userID}
+}
+
+// InWorkspace returns the owner of the notes of a workspace
+func InWorkspace(workspaceID uint64) Owner {
+	return Owner{WorkspaceID: workspaceID}
+}
+
+// OwnerOf returns the owner of a note
+func OwnerOf(note model.Note) Owner {
+	if note.IDWorkspace != nil {
+		return InWorkspace(*note.IDWorkspace)
+	}
+	return Personal(note.IDUser)
+}
+
+// Owns reports whether a note belongs to the owner
+//
+// the notes of a workspace keep their author in IDUser,
+// they are not personal notes of the author
+func (o Owner) Owns(note model.Note) bool {
+	if o.WorkspaceID != 0 {
+		return note.IDWorkspace != nil && *note.IDWorkspace == o.WorkspaceID
+	}
+	return note.IDWorkspace == nil && note.IDUser == o.UserID
+}
+
+// UserStore - persistence of user profiles
+//
+// mutations record the optional audit event together with the change,
+// in the same transaction where the backend supports it
+type UserStore interface {
+	// FindByAuthID returns the profile linked to an auth ID
+	FindByAuthID(authID uint64) (model.User, error)
+	// FindByID returns a profile by its ID
+	FindByID(userID uint64) (model.User, error)
+	// FindByNickname returns the profile using a nickname key
+	FindByNickname(key string) (model.User, error)
+	// Search returns the profiles whose nickname contains the given one,
+	// ignoring case, ordered by ID
+	Search(filter model.UserFilter) ([]model.User, error)
+	// FindReservation returns the reservation of a nickname key,
+	// expired reservations are returned as well
+	FindReservation(key string) (model.NicknameReservation, error)
+	// Reserve creates or replaces the reservation of a nickname key
+	Reserve(reservation model.NicknameReservation) error
+	// FindSettings returns the stored settings of a user
+	FindSettings(userID uint64) (model.UserSettings, error)
+	// SaveSettings creates or replaces the settings of a user
+	SaveSettings(settings *model.UserSettings) error
+	// Create saves a new profile and sets its ID and timestamps
+	Create(user *model.User, event *model.AuditEvent) error
+	// Update saves all fields of an existing profile
+	Update(user *model.User, event *model.AuditEvent) error
+	// FindDeletionDue returns the profiles scheduled for deletion
+	// until the given time
+	FindDeletionDue(until time.Time) ([]model.User, error)
+	// Purge hard deletes a profile with its keys, settings and nickname reservations,
+	// the RDBMS backend also deletes its notes by ON DELETE CASCADE
+	Purge(user model.User) error
+}
+
+// NoteStore - persistence of notes
+//
+// queries are scoped to an Owner, the personal notes of a user
+// or the notes of a workspace
+type NoteStore interface {
+	// FindByOwner returns all notes of an owner
+	FindByOwner(owner Owner) ([]model.Note, error)
+	// FindOne returns a note if it belongs to the owner
+	FindOne(owner Owner, noteID uint64) (model.Note, error)
+	// FindByID returns a note of any owner, access is checked by the caller
+	FindByID(noteID uint64) (model.Note, error)
+	// FindAllByUser returns all notes written by a user ordered by ID,
+	// soft deleted notes and notes of workspaces included
+	FindAllByUser(userID uint64) ([]model.Note, error)
+	// FindByLocation returns the notes of an owner matching a location query,
+	// ordered by distance if the query has a center
+	FindByLocation(owner Owner, query geo.Query) ([]model.Note, error)
+	// FindByPosition returns all notes of an owner in manual order,
+	// notes without a position come last
+	FindByPosition(owner Owner) ([]model.Note, error)
+	// LastPosition returns the greatest position of the notes of an owner,
+	// empty if no note has a position
+	LastPosition(owner Owner) (string, error)
+	// AdjacentPosition returns the closest position after (or before)
+	// the given one, empty if there is none
+	AdjacentPosition(owner Owner, position string, after bool) (string, error)
+	// Reorder sets the positions of several notes of an owner at once
+	// and bumps their versions
+	Reorder(owner Owner, positions map[uint64]string) error
+	// Create saves a new note and sets its ID and timestamps
+	Create(note *model.Note, event *model.AuditEvent) error
+	// Update saves all fields of an existing note
+	Update(note *model.Note, event *model.AuditEvent) error
+	// Delete soft deletes a note and bumps its version
+	// so that sync clients receive the tombstone
+	Delete(note *model.Note, event *model.AuditEvent) error
+	// Purge hard deletes all notes written by a user, soft deleted ones included,
+	// for the RDBMS backend it is done by UserStore.Purge
+	Purge(userID uint64) error
+	// FindChanges returns up to limit personal notes of a user changed after
+	// the cursor in the order of their changes, soft deleted ones included;
+	// without a cursor only the existing notes are returned
+	FindChanges(userID uint64, after *ChangeCursor, limit int) ([]model.Note, error)
+	// Sync runs the writes of a sync push in a single transaction,
+	// which is committed if fn returns nil
+	Sync(fn func(batch SyncBatch) error) error
+}
+
+// ChangeCursor - position in the changes of the personal notes of a user,
+// ordered by change sequence number and note ID
+type ChangeCursor struct {
+	ChangeSeq uint64
+	NoteID    uint64
+}
+
+// SyncBatch - writes of a sync push, see NoteStore.Sync
+//
+// every write takes the next change sequence number of the author
+type SyncBatch interface {
+	// FindOne returns a note if it belongs to the owner, soft deleted ones included
+	FindOne(owner Owner, noteID uint64) (model.Note, error)
+	// LastPosition returns the greatest position of the notes of an owner,
+	// the notes created by the batch included
+	LastPosition(owner Owner) (string, error)
+	// Create saves a new note and sets its ID and timestamps
+	Create(note *model.Note, event *model.AuditEvent) error
+	// Update saves the content and location of a note if it is still
+	// at the base version and bumps its version, ErrConflict otherwise
+	Update(note *model.Note, baseVersion uint64, event *model.AuditEvent) error
+	// Delete soft deletes a note if it is still at the base version
+	// and bumps its version, ErrConflict otherwise
+	Delete(note *model.Note, baseVersion uint64, event *model.AuditEvent) error
+}
+
+// WorkspaceStore - workspaces, their members and invitations
+type WorkspaceStore interface {
+	// FindByMember returns the workspaces of a user ordered by ID,
+	// with the role of the user
+	FindByMember(userID uint64) ([]model.Workspace, error)
+	// FindOne returns a workspace by its ID
+	FindOne(workspaceID uint64) (model.Workspace, error)
+	// Create saves a new workspace with its owner and sets its ID and timestamps
+	Create(workspace *model.Workspace, owner *model.WorkspaceMember, event *model.AuditEvent) error
+	// Update saves all fields of an existing workspace
+	Update(workspace *model.Workspace, event *model.AuditEvent) error
+	// Delete hard deletes a workspace with its members, invitations and notes
+	Delete(workspace model.Workspace, event *model.AuditEvent) error
+	// FindMember returns the membership of a user in a workspace
+	FindMember(workspaceID, userID uint64) (model.WorkspaceMember, error)
+	// FindMembers returns the members of a workspace ordered by user ID
+	FindMembers(workspaceID uint64) ([]model.WorkspaceMember, error)
+	// SaveMember creates or replaces a membership
+	SaveMember(member *model.WorkspaceMember, event *model.AuditEvent) error
+	// DeleteMember removes a user from a workspace
+	DeleteMember(member model.WorkspaceMember, event *model.AuditEvent) error
+	// FindInvitations returns the invitations of a workspace, newest first,
+	// expired ones included
+	FindInvitations(workspaceID uint64) ([]model.WorkspaceInvitation, error)
+	// FindInvitationsFor returns the invitations addressed to a user
+	// or to their email address, newest first, expired ones included
+	FindInvitationsFor(userID uint64, email string) ([]model.WorkspaceInvitation, error)
+	// FindInvitation returns an invitation by its ID
+	FindInvitation(invitationID uint64) (model.WorkspaceInvitation, error)
+	// CreateInvitation saves a new invitation and sets its ID and timestamp
+	CreateInvitation(invitation *model.WorkspaceInvitation, event *model.AuditEvent) error
+	// DeleteInvitation removes an invitation
+	DeleteInvitation(invitation model.WorkspaceInvitation, event *model.AuditEvent) error
+	// Accept saves the membership of an invited user and removes the invitation
+	Accept(invitation model.WorkspaceInvitation, member *model.WorkspaceMember, event *model.AuditEvent) error
+	// PruneInvitations removes the invitations expired until the given time
+	PruneInvitations(until time.Time) error
+	// Purge removes a user from all workspaces before their account is purged:
+	// the workspaces they own are deleted, their notes in other workspaces
+	// are handed over to the owners of those workspaces
+	Purge(userID uint64) error
+}
+
+// AuditStore - append-only log of changes
+type AuditStore interface {
+	// Append saves an event which is not recorded by a mutation of another store
+	Append(event *model.AuditEvent) error
+	// Find returns the events matching the filter, newest first
+	Find(filter model.AuditFilter) ([]model.AuditEvent, error)
+	// Purge removes all events of an actor, only done when
+	// their account is purged
+	Purge(authID uint64) error
+}
+
+// CredentialStore - credentials managed by gorest and the deletion of accounts
+type CredentialStore interface {
+	// Delete hard deletes the credentials (auth and 2FA), roles, suspension,
+	// access tokens, identities, OAuth2 clients and grants, sessions and
+	// email tokens of the auth ID of the revocation and saves the revocation
+	Delete(revocation model.AuthRevocation) error
+	// FindAuth returns the credentials of an auth ID
+	FindAuth(authID uint64) (gmodel.Auth, error)
+	// FindAuthByEmail returns the credentials with an unencrypted email
+	FindAuthByEmail(email string) (gmodel.Auth, error)
+	// CreateAuth saves new credentials, sets their ID and links the identity,
+	// ErrConflict if the identity is linked already
+	CreateAuth(auth *gmodel.Auth, identity *model.AuthIdentity) error
+	// SetEmailVerification saves the state of the verification of the
+	// email of an auth ID, one of the gmodel.Email* constants
+	SetEmailVerification(authID uint64, state int8) error
+	// SetPassword replaces the password hash of an auth ID
+	SetPassword(authID uint64, hash string) error
+	// FindTwoFA returns the two-factor authentication of an auth ID
+	FindTwoFA(authID uint64) (gmodel.TwoFA, error)
+}
+
+// RevocationStore - revocation of the JWTs of accounts
+type RevocationStore interface {
+	// Revoke creates or replaces the revocation of the JWTs of an auth ID,
+	// the credentials are kept
+	Revoke(revocation model.AuthRevocation) error
+	// FindRevocation returns the revocation of the JWTs of an auth ID
+	FindRevocation(authID uint64) (model.AuthRevocation, error)
+	// PruneRevocations removes the revocations expired until the given time
+	PruneRevocations(until time.Time) error
+}
+
+// RoleStore - roles granted to accounts
+type RoleStore interface {
+	// FindRoles returns the roles granted to an auth ID ordered by name
+	FindRoles(authID uint64) ([]model.AuthRole, error)
+	// FindGrants returns the grants of a role, or of all roles if it is empty,
+	// ordered by auth ID
+	FindGrants(role string) ([]model.AuthRole, error)
+	// Grant creates or replaces the grant of a role
+	Grant(role model.AuthRole) error
+	// Ungrant removes a role from an auth ID
+	Ungrant(authID uint64, role string) error
+}
+
+// SuspensionStore - suspensions of accounts
+type SuspensionStore interface {
+	// FindSuspension returns the suspension of an auth ID
+	FindSuspension(authID uint64) (model.AuthSuspension, error)
+	// Suspend creates or replaces the suspension of an auth ID
+	Suspend(suspension model.AuthSuspension) error
+	// Unsuspend removes the suspension of an auth ID
+	Unsuspend(authID uint64) error
+}
+
+// TokenStore - personal access tokens
+type TokenStore interface {
+	// FindTokens returns the access tokens of an auth ID, newest first
+	FindTokens(authID uint64) ([]model.AccessToken, error)
+	// FindToken returns an access token by its ID
+	FindToken(tokenID uint64) (model.AccessToken, error)
+	// CreateToken saves a new access token and sets its ID and CreatedAt
+	CreateToken(token *model.AccessToken) error
+	// TouchToken sets the time an access token was last used
+	TouchToken(tokenID uint64, usedAt time.Time) error
+	// DeleteToken removes an access token
+	DeleteToken(tokenID uint64) error
+	// DeleteTokens removes all access tokens of an auth ID
+	DeleteTokens(authID uint64) error
+}
+
+// IdentityStore - identities at OAuth2/OIDC providers and the social
+// logins waiting for their callback
+type IdentityStore interface {
+	// FindIdentity returns the identity of a user at a provider
+	FindIdentity(provider, subject string) (model.AuthIdentity, error)
+	// FindIdentities returns the identities linked to an auth ID ordered by provider
+	FindIdentities(authID uint64) ([]model.AuthIdentity, error)
+	// CreateIdentity links an identity to an existing auth ID,
+	// ErrConflict if it is linked already
+	CreateIdentity(identity *model.AuthIdentity) error
+	// DeleteIdentity unlinks the identity at a provider from an auth ID
+	DeleteIdentity(authID uint64, provider string) error
+	// SaveOAuthState saves a login waiting for its callback
+	SaveOAuthState(state model.OAuthState) error
+	// TakeOAuthState returns and removes a login, each login can be taken once
+	TakeOAuthState(state string) (model.OAuthState, error)
+	// PruneOAuthStates removes the logins expired until the given time
+	PruneOAuthStates(until time.Time) error
+}
+
+// OAuthServerStore - clients and grants of the OAuth2 authorization server
+type OAuthServerStore interface {
+	// FindClients returns the OAuth2 clients registered by an auth ID, newest first
+	FindClients(authID uint64) ([]model.OAuthClient, error)
+	// FindClient returns an OAuth2 client by its ID
+	FindClient(clientID string) (model.OAuthClient, error)
+	// CreateClient saves a new OAuth2 client, ErrConflict if the ID is taken
+	CreateClient(client *model.OAuthClient) error
+	// DeleteClient removes an OAuth2 client with its codes and tokens
+	DeleteClient(clientID string) error
+	// CreateOAuthCode saves a new authorization request and sets its ID
+	CreateOAuthCode(code *model.OAuthCode) error
+	// FindOAuthCode returns an authorization request by its ID
+	FindOAuthCode(codeID uint64) (model.OAuthCode, error)
+	// TakeOAuthCode returns and removes an authorization request,
+	// each request can be taken once
+	TakeOAuthCode(codeID uint64) (model.OAuthCode, error)
+	// FindOAuthTokens returns the OAuth2 tokens of an auth ID, oldest first
+	FindOAuthTokens(authID uint64) ([]model.OAuthToken, error)
+	// FindOAuthToken returns an OAuth2 token by its ID
+	FindOAuthToken(tokenID uint64) (model.OAuthToken, error)
+	// CreateOAuthToken saves a new OAuth2 token and sets its ID and CreatedAt
+	CreateOAuthToken(token *model.OAuthToken) error
+	// DeleteOAuthToken removes an OAuth2 token and the access tokens
+	// issued with it
+	DeleteOAuthToken(tokenID uint64) error
+	// DeleteOAuthTokens removes the OAuth2 tokens of an auth ID issued to
+	// a client, or to all clients if it is empty
+	DeleteOAuthTokens(authID uint64, clientID string) error
+	// PruneOAuthGrants removes the authorization requests and OAuth2 tokens
+	// expired until the given time
+	PruneOAuthGrants(until time.Time) error
+}
+
+// SessionStore - logins with JWTs and the tokens issued to them
+type SessionStore interface {
+	// FindSessions returns the sessions of an auth ID which are not revoked,
+	// newest first
+	FindSessions(authID uint64) ([]model.Session, error)
+	// FindSession returns a session by its ID
+	FindSession(sessionID uint64) (model.Session, error)
+	// FindSessionToken returns a JWT issued to a session by its jti
+	FindSessionToken(jti string) (model.SessionToken, error)
+	// CreateSession saves a new session with its first tokens and sets
+	// its ID and CreatedAt
+	CreateSession(session *model.Session, tokens []model.SessionToken) error
+	// RefreshSession saves the RefreshedAt and ExpiresAt of a session with
+	// its new tokens and marks the refresh token they replace, if any
+	RefreshSession(session model.Session, replaced string, tokens []model.SessionToken) error
+	// RevokeSession marks a session as revoked
+	RevokeSession(sessionID uint64, revokedAt time.Time) error
+	// RevokeSessions marks all sessions of an auth ID as revoked except
+	// one, or all of them if it is 0
+	RevokeSessions(authID, exceptID uint64, revokedAt time.Time) error
+	// PruneSessions removes the sessions and their tokens expired until
+	// the given time
+	PruneSessions(until time.Time) error
+}
+
+// EmailTokenStore - tokens sent by email to verify an address,
+// recover a password or log in
+type EmailTokenStore interface {
+	// FindEmailTokens returns the email tokens of a kind of an auth ID,
+	// newest first
+	FindEmailTokens(authID uint64, kind string) ([]model.EmailToken, error)
+	// FindEmailToken returns an email token by its ID
+	FindEmailToken(tokenID uint64) (model.EmailToken, error)
+	// CreateEmailToken saves a new email token and sets its ID and CreatedAt
+	CreateEmailToken(token *model.EmailToken) error
+	// TakeEmailToken returns and removes an email token, of concurrent
+	// calls with the same ID only one gets it
+	TakeEmailToken(tokenID uint64) (model.EmailToken, error)
+	// DeleteEmailTokens removes the email tokens of a kind of an auth ID
+	DeleteEmailTokens(authID uint64, kind string) error
+	// PruneEmailTokens removes the email tokens expired until the given time
+	PruneEmailTokens(until time.Time) error
+}
+
+// PasskeyStore - passkeys and their started ceremonies
+type PasskeyStore interface {
+	// FindPasskeys returns the passkeys of an auth ID, oldest first
+	FindPasskeys(authID uint64) ([]model.Passkey, error)
+	// FindPasskey returns a passkey by its credential ID
+	FindPasskey(credentialID string) (model.Passkey, error)
+	// CreatePasskey saves a new passkey and sets its ID,
+	// ErrConflict if the credential is registered already
+	CreatePasskey(passkey *model.Passkey) error
+	// UsePasskey saves the signature counter of an authentication,
+	// ErrConflict if a concurrent one saved a higher counter
+	UsePasskey(passkeyID uint64, signCount uint32, usedAt time.Time) error
+	// DeletePasskey removes a passkey
+	DeletePasskey(passkeyID uint64) error
+	// CreatePasskeyChallenge saves a started ceremony
+	CreatePasskeyChallenge(challenge model.PasskeyChallenge) error
+	// TakePasskeyChallenge returns and removes a started ceremony,
+	// of concurrent calls with the same challenge only one gets it
+	TakePasskeyChallenge(challenge string) (model.PasskeyChallenge, error)
+	// PrunePasskeyChallenges removes the ceremonies expired until the given time
+	PrunePasskeyChallenges(until time.Time) error
+}
+
+// AuthStore - all stores of the accounts, implemented by the RDBMS and
+// memory backends; the handlers take each of them apart, so that a
+// backend may support some features only
+type AuthStore interface {
+	CredentialStore
+	RevocationStore
+	RoleStore
+	SuspensionStore
+	TokenStore
+	IdentityStore
+	OAuthServerStore
+	SessionStore
+	EmailTokenStore
+	PasskeyStore
+}
+
+// ExportStore - data exports requested by users
+type ExportStore interface {
+	// FindByAuth returns the exports of a user, newest first
+	FindByAuth(authID uint64) ([]model.DataExport, error)
+	// FindOne returns an export if it was requested by the user
+	FindOne(authID, exportID uint64) (model.DataExport, error)
+	// FindExpired returns the exports expired until the given time
+	FindExpired(until time.Time) ([]model.DataExport, error)
+	// Create saves a new export and sets its ID and timestamps
+	Create(export *model.DataExport) error
+	// Update saves all fields of an existing export
+	Update(export *model.DataExport) error
+	// Delete removes an export
+	Delete(exportID uint64) error
+}
+
+// KeyStore - public keys of users and the content keys of end-to-end
+// encrypted notes wrapped with them, only stored in RDBMS
+type KeyStore interface {
+	// FindUserKeys returns the public keys of a user ordered by ID
+	FindUserKeys(userID uint64) ([]model.UserKey, error)
+	// FindUserKey returns a public key if it belongs to the user
+	FindUserKey(userID, keyID uint64) (model.UserKey, error)
+	// CreateUserKey saves a new public key and sets its ID and timestamps
+	CreateUserKey(key *model.UserKey) error
+	// DeleteUserKey removes a public key with the note keys wrapped with it
+	DeleteUserKey(key model.UserKey) error
+	// FindNoteKeys returns the wrapped keys of a note for a recipient,
+	// or for all recipients if userID is 0, ordered by ID
+	FindNoteKeys(noteID, userID uint64) ([]model.NoteKey, error)
+	// FindNoteKey returns a wrapped key of a note by its ID
+	FindNoteKey(noteID, noteKeyID uint64) (model.NoteKey, error)
+	// CreateNoteKey saves a new wrapped key and sets its ID and timestamps,
+	// ErrConflict if the note has a key wrapped with the same public key
+	CreateNoteKey(noteKey *model.NoteKey) error
+	// DeleteNoteKey removes a wrapped key
+	DeleteNoteKey(noteKey model.NoteKey) error
+	// FindSharedNotes returns the end-to-end encrypted notes of other
+	// users with a key wrapped for a user, ordered by ID
+	FindSharedNotes(userID uint64) ([]model.Note, error)
+}
+
+// Invalidator is implemented by stores keeping a cache of records,
+// code writing records around the store must invalidate them
+type Invalidator interface {
+	// Invalidate drops the cached record with the given ID
+	Invalidate(id uint64)
+}
@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	gmiddleware "github.com/pilinux/gorest/lib/middleware"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// DeleteAccount handles jobs for controller.DeleteAccount
+//
+// the account is purged by PurgeAccounts after the grace period,
+// until then it can be restored
+func DeleteAccount(userIDAuth uint64, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	userFinal, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if userFinal.DeleteAfter != nil {
+		httpResponse.Message = "account deletion is already scheduled"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	userBefore := userFinal
+	now := time.Now()
+	deleteAfter := now.Add(config.GetConfig().Deletion.GracePeriod)
+	userFinal.DeleteAfter = &deleteAfter
+	userFinal.UpdatedAt = now
+
+	// update in DB
+	event := newAuditEvent(userIDAuth, AuditUserDelete, AuditResourceUser, userFinal.UserID, userBefore, userFinal, client)
+	if err := userStore.Update(&userFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1151")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	presentUser(&userFinal)
+	httpResponse.Message = userFinal
+	httpStatusCode = http.StatusAccepted
+	return
+}
+
+// RestoreAccount handles jobs for controller.RestoreAccount
+func RestoreAccount(userIDAuth uint64, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	userFinal, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if userFinal.DeleteAfter == nil {
+		httpResponse.Message = "no account deletion is scheduled"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	userBefore := userFinal
+	userFinal.DeleteAfter = nil
+	userFinal.UpdatedAt = time.Now()
+
+	// update in DB
+	event := newAuditEvent(userIDAuth, AuditUserRestore, AuditResourceUser, userFinal.UserID, userBefore, userFinal, client)
+	if err := userStore.Update(&userFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1152")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	presentUser(&userFinal)
+	httpResponse.Message = userFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// StartPurge runs PurgeAccounts and PurgeDataExports in the background,
+// right away and then every interval
+func StartPurge(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			PurgeAccounts()
+			PurgeDataExports()
+			<-ticker.C
+		}
+	}()
+}
+
+// PurgeAccounts hard deletes the accounts whose grace period is over
+// and returns how many were purged
+//
+// an account failing to purge is retried by the next run
+func PurgeAccounts() (purged int) {
+	now := time.Now()
+
+	users, err := userStore.FindDeletionDue(now)
+	if err != nil {
+		log.WithError(err).Error("error code: 1161")
+		return
+	}
+	for _, user := range users {
+		if err := purgeAccount(user, now); err != nil {
+			continue
+		}
+		purged++
+	}
+
+	if revocationStore != nil {
+		if err := revocationStore.PruneRevocations(now); err != nil {
+			log.WithError(err).Error("error code: 1162")
+		}
+	}
+	if identityStore != nil {
+		if err := identityStore.PruneOAuthStates(now); err != nil {
+			log.WithError(err).Error("error code: 2051")
+		}
+	}
+	if oauthServerStore != nil {
+		if err := oauthServerStore.PruneOAuthGrants(now); err != nil {
+			log.WithError(err).Error("error code: 2195")
+		}
+	}
+	if sessionStore != nil {
+		if err := sessionStore.PruneSessions(now); err != nil {
+			log.WithError(err).Error("error code: 2295")
+		}
+	}
+	if emailTokenStore != nil {
+		if err := emailTokenStore.PruneEmailTokens(now); err != nil {
+			log.WithError(err).Error("error code: 2395")
+		}
+	}
+	if passkeyStore != nil {
+		if err := passkeyStore.PrunePasskeyChallenges(now); err != nil {
+			log.WithError(err).Error("error code: 2695")
+		}
+	}
+	if err := workspaceStore.PruneInvitations(now); err != nil {
+		log.WithError(err).Error("error code: 1592")
+	}
+	return
+}
+
+// purgeAccount hard deletes the credentials, notes and profile of a user
+// with everything attached to them
+//
+// the workspaces owned by the user are deleted, their notes in other
+// workspaces stay with the owners of those workspaces
+//
+// the credentials go first, a profile left behind is still due
+// for deletion and the next run completes the purge
+func purgeAccount(user model.User, now time.Time) error {
+	if credentialStore != nil {
+		// refresh tokens live the longest
+		ttl := time.Duration(gmiddleware.JWTParams.RefreshKeyTTL) * time.Minute
+		err := credentialStore.Delete(model.AuthRevocation{
+			IDAuth:    user.IDAuth,
+			RevokedAt: now,
+			ExpiresAt: now.Add(ttl),
+			Reason:    model.RevocationDeleted,
+		})
+		if err != nil {
+			log.WithError(err).Error("error code: 1163")
+			return err
+		}
+	}
+
+	// notes of the workspaces are deleted or handed over around
+	// the note store, their cached copies are dropped afterwards
+	noteIDs, err := purgedWorkspaceNotes(user.UserID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1593")
+		return err
+	}
+	if err := workspaceStore.Purge(user.UserID); err != nil {
+		log.WithError(err).Error("error code: 1591")
+		return err
+	}
+	if invalidator, ok := noteStore.(store.Invalidator); ok {
+		for _, noteID := range noteIDs {
+			invalidator.Invalidate(noteID)
+		}
+	}
+	if err := noteStore.Purge(user.UserID); err != nil {
+		log.WithError(err).Error("error code: 1164")
+		return err
+	}
+	if err := userStore.Purge(user); err != nil {
+		log.WithError(err).Error("error code: 1165")
+		return err
+	}
+
+	// files and log entries left behind are not reachable anymore
+	if err := avatarStorage.Delete(user.UserID); err != nil {
+		log.WithError(err).Error("error code: 1166")
+	}
+	if exports, err := exportStore.FindByAuth(user.IDAuth); err != nil {
+		log.WithError(err).Error("error code: 1169")
+	} else {
+		deleteDataExports(exports)
+	}
+	if err := auditStore.Purge(user.IDAuth); err != nil {
+		log.WithError(err).Error("error code: 1167")
+	}
+
+	// keep a trace without personal data
+	event := newAuditEvent(user.IDAuth, AuditUserPurge, AuditResourceUser, user.UserID, nil, nil, model.ClientInfo{})
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 1168")
+	}
+	return nil
+}
+
+// purgedWorkspaceNotes returns the IDs of the notes changed by
+// WorkspaceStore.Purge: the notes of the workspaces owned by the user
+// and the notes written by the user in any workspace
+func purgedWorkspaceNotes(userID uint64) ([]uint64, error) {
+	noteIDs := []uint64{}
+
+	workspaces, err := workspaceStore.FindByMember(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, workspace := range workspaces {
+		if workspace.Role != model.WorkspaceRoleOwner {
+			continue
+		}
+		notes, err := noteStore.FindByOwner(store.InWorkspace(workspace.WorkspaceID))
+		if err != nil {
+			return nil, err
+		}
+		for _, note := range notes {
+			noteIDs = append(noteIDs, note.NoteID)
+		}
+	}
+
+	notes, err := noteStore.FindAllByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if note.IDWorkspace != nil {
+			noteIDs = append(noteIDs, note.NoteID)
+		}
+	}
+	return noteIDs, nil
+}
+
+// CheckRevokedJWT handles jobs for controller.RevokedJWTChecker
+//
+// - issuedAt: issue time of the token
+// - tokens of suspended accounts are rejected regardless of their age
+func CheckRevokedJWT(userIDAuth uint64, issuedAt time.Time) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if suspensionStore != nil {
+		_, err := suspensionStore.FindSuspension(userIDAuth)
+		if err == nil {
+			httpResponse.Message = "account is suspended"
+			httpStatusCode = http.StatusForbidden
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 1172")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+	}
+
+	if revocationStore == nil {
+		httpStatusCode = http.StatusOK
+		return
+	}
+	revocation, err := revocationStore.FindRevocation(userIDAuth)
+	if errors.Is(err, store.ErrNotFound) {
+		httpStatusCode = http.StatusOK
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1171")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// tokens issued afterwards belong to a new login,
+	// or to a new account reusing the auth ID
+	if issuedAt.After(revocation.RevokedAt) {
+		httpStatusCode = http.StatusOK
+		return
+	}
+
+	if revocation.Reason == model.RevocationLogout {
+		httpResponse.Message = "token is revoked, please log in again"
+	} else {
+		httpResponse.Message = "account is deleted"
+	}
+	httpStatusCode = http.StatusUnauthorized
+	return
+}
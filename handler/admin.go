@@ -0,0 +1,497 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	gmiddleware "github.com/pilinux/gorest/lib/middleware"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/rbac"
+)
+
+// limits of a page of profiles found by administrators
+const (
+	AdminPageSizeDefault = 50
+	AdminPageSizeMax     = 200
+)
+
+// SuspensionReasonMaxLength - maximum length of the reason of a suspension in characters
+const SuspensionReasonMaxLength = 500
+
+// ErrAdminExists is returned by BootstrapAdmin when an admin is already granted
+var ErrAdminExists = errors.New("an admin already exists, grant further roles with the admin API")
+
+// CheckPermission handles jobs for controller.RequirePermission
+func CheckPermission(userIDAuth uint64, permission rbac.Permission) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	roles, err := grantedRoles(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 1801")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if !rbac.Allowed(roles, permission) {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// grantedRoles returns the names of the roles granted to an auth ID,
+// none without storage of the roles
+func grantedRoles(authID uint64) ([]string, error) {
+	if roleStore == nil {
+		return nil, nil
+	}
+	grants, err := roleStore.FindRoles(authID)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		roles = append(roles, grant.Role)
+	}
+	return roles, nil
+}
+
+// BootstrapAdmin grants the admin role to the first administrator,
+// it fails once an admin exists
+func BootstrapAdmin(authID uint64) error {
+	admins, err := roleStore.FindGrants(rbac.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if len(admins) > 0 {
+		return ErrAdminExists
+	}
+	if _, err := credentialStore.FindAuth(authID); err != nil {
+		return fmt.Errorf("auth ID %d: %w", authID, err)
+	}
+
+	grant := model.AuthRole{IDAuth: authID, Role: rbac.RoleAdmin, CreatedAt: time.Now()}
+	if err := roleStore.Grant(grant); err != nil {
+		return err
+	}
+
+	// granted by nobody, from the command line
+	appendAccountEvent(0, AuditRoleGrant, authID, nil, grant, model.ClientInfo{})
+	return nil
+}
+
+// SearchUsers handles jobs for controller.SearchUsers
+//
+// - nickName: optional part of the nickname, case is ignored
+// - after: cursor from nextAfterID of the previous page
+// - limit: page size
+func SearchUsers(params url.Values) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	filter := model.UserFilter{NickName: strings.TrimSpace(params.Get("nickName"))}
+
+	if after := params.Get("after"); after != "" {
+		id, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			httpResponse.Message = "after must be a user ID"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		filter.AfterID = id
+	}
+
+	limit := AdminPageSizeDefault
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > AdminPageSizeMax {
+			httpResponse.Message = fmt.Sprintf("limit must be between 1 and %d", AdminPageSizeMax)
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		limit = n
+	}
+
+	// fetch one extra profile to find out whether there is another page
+	filter.Limit = limit + 1
+	users, err := userStore.Search(filter)
+	if err != nil {
+		log.WithError(err).Error("error code: 1811")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	page := model.UserPage{Users: []model.AdminUser{}}
+	if len(users) > limit {
+		users = users[:limit]
+		page.NextAfterID = users[limit-1].UserID
+	}
+	for _, user := range users {
+		// timestamps of other users are always in UTC
+		user.Preferences.LocalTime = false
+		presentUser(&user)
+		page.Users = append(page.Users, model.AdminUser{User: user, IDAuth: user.IDAuth})
+	}
+
+	httpResponse.Message = page
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetAccount handles jobs for controller.GetAccount
+//
+// the profile, roles and suspension of an account
+func GetAccount(id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	httpResponse.Message = account
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// findAccount returns an account by its raw auth ID, httpStatusCode
+// is set if it cannot be returned
+//
+// an account exists if it has credentials or a profile, the memory
+// auth store keeps no credentials
+func findAccount(id string) (account model.AdminAccount, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	authID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		httpResponse.Message = "account not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	account.IDAuth = authID
+
+	user, err := userStore.FindByAuthID(authID)
+	if err == nil {
+		user.Preferences.LocalTime = false
+		presentUser(&user)
+		account.Profile = &user
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 1812")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	} else if _, err := credentialStore.FindAuth(authID); errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "account not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	} else if err != nil {
+		log.WithError(err).Error("error code: 1813")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	account.Roles, err = grantedRoles(authID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1801")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	suspension, err := suspensionStore.FindSuspension(authID)
+	if err == nil {
+		account.Suspension = &suspension
+	} else if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 1814")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+	}
+	return
+}
+
+// SuspendAccount handles jobs for controller.SuspendAccount
+//
+// - all tokens of the account are rejected until it is unsuspended
+// - accounts with a role can only be suspended with rbac.RolesManage
+func SuspendAccount(userIDAuth uint64, id string, suspension model.AuthSuspension, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	suspension.Reason = strings.TrimSpace(suspension.Reason)
+	if utf8.RuneCountInString(suspension.Reason) > SuspensionReasonMaxLength {
+		httpResponse.Message = fmt.Sprintf("reason must not be longer than %d characters", SuspensionReasonMaxLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+	if account.IDAuth == userIDAuth {
+		httpResponse.Message = "own account cannot be suspended"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if account.Suspension != nil {
+		httpResponse.Message = "account is already suspended"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if len(account.Roles) > 0 {
+		if httpResponse, httpStatusCode = CheckPermission(userIDAuth, rbac.RolesManage); httpStatusCode != http.StatusOK {
+			return
+		}
+	}
+
+	suspensionFinal := model.AuthSuspension{
+		IDAuth:        account.IDAuth,
+		CreatedAt:     time.Now(),
+		Reason:        suspension.Reason,
+		IDSuspendedBy: userIDAuth,
+	}
+	if err := suspensionStore.Suspend(suspensionFinal); err != nil {
+		log.WithError(err).Error("error code: 1821")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountSuspend, account.IDAuth, nil, suspensionFinal, client)
+
+	httpResponse.Message = suspensionFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// UnsuspendAccount handles jobs for controller.UnsuspendAccount
+func UnsuspendAccount(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+	if account.Suspension == nil {
+		httpResponse.Message = "account is not suspended"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	if err := suspensionStore.Unsuspend(account.IDAuth); err != nil {
+		log.WithError(err).Error("error code: 1822")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountUnsuspend, account.IDAuth, *account.Suspension, nil, client)
+
+	httpResponse.Message = "account ID# " + id + " unsuspended!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// LogoutAccount handles jobs for controller.LogoutAccount
+//
+// all JWTs issued until now are rejected, the sessions are revoked, the
+// access tokens and the tokens of OAuth2 clients are deleted, the user
+// can log in again
+func LogoutAccount(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	// refresh tokens live the longest
+	now := time.Now()
+	revocation := model.AuthRevocation{
+		IDAuth:    account.IDAuth,
+		RevokedAt: now,
+		ExpiresAt: now.Add(time.Duration(gmiddleware.JWTParams.RefreshKeyTTL) * time.Minute),
+		Reason:    model.RevocationLogout,
+	}
+	if err := revocationStore.Revoke(revocation); err != nil {
+		log.WithError(err).Error("error code: 1831")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := tokenStore.DeleteTokens(account.IDAuth); err != nil {
+		log.WithError(err).Error("error code: 1832")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := oauthServerStore.DeleteOAuthTokens(account.IDAuth, ""); err != nil {
+		log.WithError(err).Error("error code: 1833")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := sessionStore.RevokeSessions(account.IDAuth, 0, time.Now()); err != nil {
+		log.WithError(err).Error("error code: 1834")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountLogout, account.IDAuth, nil, nil, client)
+
+	httpResponse.Message = "account ID# " + id + " logged out!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetRoleGrants handles jobs for controller.GetRoleGrants
+//
+// - role: optional, all grants if empty
+func GetRoleGrants(role string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if role != "" && !rbac.Valid(role) {
+		httpResponse.Message = "role must be one of " + strings.Join(rbac.Roles(), ", ")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	grants, err := roleStore.FindGrants(role)
+	if err != nil {
+		log.WithError(err).Error("error code: 1841")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = grants
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GrantRole handles jobs for controller.GrantRole
+//
+// granting a role twice keeps the first grant
+func GrantRole(userIDAuth uint64, id, role string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if !rbac.Valid(role) {
+		httpResponse.Message = "role must be one of " + strings.Join(rbac.Roles(), ", ")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	grant := model.AuthRole{IDAuth: account.IDAuth, Role: role, CreatedAt: time.Now(), IDGrantedBy: userIDAuth}
+	if !hasRole(account, role) {
+		if err := roleStore.Grant(grant); err != nil {
+			log.WithError(err).Error("error code: 1842")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		appendAccountEvent(userIDAuth, AuditRoleGrant, account.IDAuth, nil, grant, client)
+		account.Roles = append(account.Roles, role)
+	}
+
+	httpResponse.Message = account
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// RevokeRole handles jobs for controller.RevokeRole
+//
+// the admin role of the last admin cannot be revoked
+func RevokeRole(userIDAuth uint64, id, role string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+	if !hasRole(account, role) {
+		httpResponse.Message = "role not granted"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if role == rbac.RoleAdmin {
+		admins, err := roleStore.FindGrants(rbac.RoleAdmin)
+		if err != nil {
+			log.WithError(err).Error("error code: 1841")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if len(admins) <= 1 {
+			httpResponse.Message = "the last admin cannot be removed"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+	}
+
+	if err := roleStore.Ungrant(account.IDAuth, role); err != nil {
+		log.WithError(err).Error("error code: 1843")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditRoleRevoke, account.IDAuth, model.AuthRole{IDAuth: account.IDAuth, Role: role}, nil, client)
+
+	httpResponse.Message = "role " + role + " revoked from account ID# " + id + "!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// hasRole reports whether a role is granted to an account
+func hasRole(account model.AdminAccount, role string) bool {
+	for _, granted := range account.Roles {
+		if granted == role {
+			return true
+		}
+	}
+	return false
+}
+
+// ModerateNote handles jobs for controller.ModerateNote
+//
+// soft deletes a note of any user, sync clients of the owner
+// receive the tombstone
+func ModerateNote(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	noteID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		httpResponse.Message = "note not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	note, err := noteStore.FindByID(noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "note not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1851")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// the audit event is recorded for the administrator
+	event := newAuditEvent(userIDAuth, AuditNoteDelete, AuditResourceNote, note.NoteID, note, nil, client)
+	if err := noteStore.Delete(&note, event); err != nil {
+		log.WithError(err).Error("error code: 1852")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = "note ID# " + id + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// appendAccountEvent records a change of an account made around the
+// audited stores, a failure is logged only
+func appendAccountEvent(userIDAuth uint64, action string, authID uint64, before, after interface{}, client model.ClientInfo) {
+	event := newAuditEvent(userIDAuth, action, AuditResourceAccount, authID, before, after, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 1802")
+	}
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+)
+
+// limits of an audit log page
+const (
+	AuditPageSizeDefault = 50
+	AuditPageSizeMax     = 500
+)
+
+// audited actions
+const (
+	AuditUserCreate  = "user.create"
+	AuditUserUpdate  = "user.update"
+	AuditUserDelete  = "user.delete"
+	AuditUserRestore = "user.restore"
+	AuditUserPurge   = "user.purge"
+	AuditNoteCreate  = "note.create"
+	AuditNoteUpdate  = "note.update"
+	AuditNoteDelete  = "note.delete"
+	AuditNoteMove    = "note.move"
+
+	AuditExportCreate   = "dataExport.create"
+	AuditExportDownload = "dataExport.download"
+
+	AuditWorkspaceCreate  = "workspace.create"
+	AuditWorkspaceUpdate  = "workspace.update"
+	AuditWorkspaceDelete  = "workspace.delete"
+	AuditMemberCreate     = "workspaceMember.create"
+	AuditMemberUpdate     = "workspaceMember.update"
+	AuditMemberDelete     = "workspaceMember.delete"
+	AuditInvitationCreate = "workspaceInvitation.create"
+	AuditInvitationDelete = "workspaceInvitation.delete"
+
+	AuditAccountSuspend          = "account.suspend"
+	AuditAccountUnsuspend        = "account.unsuspend"
+	AuditAccountLogout           = "account.logout"
+	AuditAccountCreate           = "account.create"
+	AuditAccountLink             = "account.link"
+	AuditAccountUnlink           = "account.unlink"
+	AuditAccountRegisterClient   = "account.registerClient"
+	AuditAccountUnregisterClient = "account.unregisterClient"
+	AuditAccountAuthorize        = "account.authorize"
+	AuditAccountDeauthorize      = "account.deauthorize"
+	AuditAccountVerifyEmail      = "account.verifyEmail"
+	AuditAccountResetPassword    = "account.resetPassword"
+	AuditAccountLock             = "account.lock"
+	AuditAccountUnlock           = "account.unlock"
+	AuditRoleGrant               = "role.grant"
+	AuditRoleRevoke              = "role.revoke"
+
+	AuditTokenCreate = "accessToken.create"
+	AuditTokenDelete = "accessToken.delete"
+
+	AuditSessionRevoke = "session.revoke"
+
+	AuditPasskeyCreate = "passkey.create"
+	AuditPasskeyDelete = "passkey.delete"
+)
+
+// audited resource types
+const (
+	AuditResourceUser       = "user"
+	AuditResourceNote       = "note"
+	AuditResourceExport     = "dataExport"
+	AuditResourceWorkspace  = "workspace"
+	AuditResourceMember     = "workspaceMember"
+	AuditResourceInvitation = "workspaceInvitation"
+	AuditResourceAccount    = "account"
+	AuditResourceToken      = "accessToken"
+	AuditResourceSession    = "session"
+	AuditResourcePasskey    = "passkey"
+)
+
+// auditSkipped - IDs recorded as the resource of the event and fields
+// which change with every write or are computed per request
+var auditSkipped = map[string]bool{
+	"userID":    true,
+	"noteID":    true,
+	"tokenID":   true,
+	"sessionID": true,
+	"createdAt": true,
+	"updatedAt": true,
+	"version":   true,
+	"distance":  true,
+	"avatarURL": true,
+}
+
+// auditRedacted - fields whose values are not copied into the log,
+// only the fact that they changed
+var auditRedacted = map[string]bool{
+	"ciphertext": true,
+	"nonce":      true,
+}
+
+// auditRedactedValue replaces the value of a redacted field
+const auditRedactedValue = "[redacted]"
+
+// newAuditEvent builds the event of a change
+//
+// - before is nil for a created resource, after is nil for a deleted one
+// - the resource ID of a created resource is set by the store
+func newAuditEvent(userIDAuth uint64, action, resourceType string, resourceID uint64, before, after interface{}, client model.ClientInfo) *model.AuditEvent {
+	return &model.AuditEvent{
+		CreatedAt:    time.Now(),
+		IDAuth:       userIDAuth,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      auditDiff(before, after),
+		ClientIP:     client.IP,
+		UserAgent:    client.UserAgent,
+	}
+}
+
+// auditDiff returns the fields of a record which differ between
+// before and after, keyed by their JSON name
+//
+// - before and after are structs of the same type, either may be nil
+// - fields hidden from JSON, slices of related records and the fields
+// in auditSkipped are ignored
+func auditDiff(before, after interface{}) map[string]model.AuditChange {
+	changes := map[string]model.AuditChange{}
+
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	switch {
+	case !b.IsValid() && !a.IsValid():
+		return changes
+	case !b.IsValid():
+		b = reflect.Zero(a.Type())
+	case !a.IsValid():
+		a = reflect.Zero(b.Type())
+	}
+	if b.Type() != a.Type() || b.Kind() != reflect.Struct {
+		return changes
+	}
+
+	t := b.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || auditSkipped[name] || field.Type.Kind() == reflect.Slice {
+			continue
+		}
+
+		valueBefore, valueAfter := auditValue(b.Field(i)), auditValue(a.Field(i))
+		if reflect.DeepEqual(valueBefore, valueAfter) {
+			continue
+		}
+		if auditRedacted[name] {
+			valueBefore, valueAfter = redact(valueBefore), redact(valueAfter)
+		}
+		changes[name] = model.AuditChange{Before: valueBefore, After: valueAfter}
+	}
+	return changes
+}
+
+// auditValue returns the value of a field, nil for nil pointers
+// and zero values
+func auditValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// redact hides a non-empty value
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return auditRedactedValue
+}
+
+// GetAuditEvents handles jobs for controller.GetAuditEvents
+//
+// only the events of the user are returned
+func GetAuditEvents(userIDAuth uint64, params url.Values) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	filter, msg := parseAuditFilter(params)
+	if msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	filter.IDAuth = userIDAuth
+
+	return findAuditEvents(filter)
+}
+
+// GetAllAuditEvents handles jobs for controller.GetAllAuditEvents
+//
+// - requires rbac.AuditRead, checked by controller.RequirePermission
+// - actor: optional auth ID of the user who made the changes
+func GetAllAuditEvents(params url.Values) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	filter, msg := parseAuditFilter(params)
+	if msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if actor := params.Get("actor"); actor != "" {
+		id, err := strconv.ParseUint(actor, 10, 64)
+		if err != nil {
+			httpResponse.Message = "actor must be an auth ID"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		filter.IDAuth = id
+	}
+
+	return findAuditEvents(filter)
+}
+
+// findAuditEvents returns one page of events matching the filter
+func findAuditEvents(filter model.AuditFilter) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	limit := filter.Limit
+
+	// fetch one extra event to find out whether there is another page
+	filter.Limit = limit + 1
+	events, err := auditStore.Find(filter)
+	if err != nil {
+		log.WithError(err).Error("error code: 1701")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	page := model.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextBeforeID = page.Events[limit-1].EventID
+	}
+
+	httpResponse.Message = page
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// parseAuditFilter reads the query parameters of an audit log request
+//
+// - action, resourceType, resourceID: exact match
+// - since, until: RFC 3339 timestamps, until is exclusive
+// - before: cursor from nextBeforeID of the previous page
+// - limit: page size
+func parseAuditFilter(params url.Values) (filter model.AuditFilter, msg string) {
+	filter.Action = strings.TrimSpace(params.Get("action"))
+	filter.ResourceType = strings.TrimSpace(params.Get("resourceType"))
+
+	var err error
+	if value := params.Get("resourceID"); value != "" {
+		if filter.ResourceID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			msg = "resourceID must be a number"
+			return
+		}
+	}
+	if value := params.Get("since"); value != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, value); err != nil {
+			msg = "since must be an RFC 3339 timestamp"
+			return
+		}
+	}
+	if value := params.Get("until"); value != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, value); err != nil {
+			msg = "until must be an RFC 3339 timestamp"
+			return
+		}
+	}
+	if value := params.Get("before"); value != "" {
+		if filter.BeforeID, err = strconv.ParseUint(value, 10, 64); err != nil {
+			msg = "before must be an event ID"
+			return
+		}
+	}
+
+	filter.Limit = AuditPageSizeDefault
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > AuditPageSizeMax {
+			msg = "limit must be between 1 and " + strconv.Itoa(AuditPageSizeMax)
+			return
+		}
+		filter.Limit = limit
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/lib/avatar"
+)
+
+// UpdateAvatar handles jobs for controller.UpdateAvatar
+//
+// the upload is resized to avatar.Sizes, a new upload
+// replaces the previous avatar
+func UpdateAvatar(userIDAuth uint64, upload io.Reader, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	userFinal, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	images, version, err := avatar.Process(upload)
+	if errors.Is(err, avatar.ErrTooLarge) {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusRequestEntityTooLarge
+		return
+	}
+	if errors.Is(err, avatar.ErrFormat) || errors.Is(err, avatar.ErrDimensions) {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1131")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if err := avatarStorage.Save(userFinal.UserID, images); err != nil {
+		log.WithError(err).Error("error code: 1132")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	userBefore := userFinal
+	userFinal.Avatar = version
+	userFinal.UpdatedAt = time.Now()
+
+	// update in DB
+	event := newAuditEvent(userIDAuth, AuditUserUpdate, AuditResourceUser, userFinal.UserID, userBefore, userFinal, client)
+	if err := userStore.Update(&userFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1133")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	presentUser(&userFinal)
+	httpResponse.Message = userFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteAvatar handles jobs for controller.DeleteAvatar
+func DeleteAvatar(userIDAuth uint64, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	userFinal, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if userFinal.Avatar == "" {
+		httpResponse.Message = "avatar not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	userBefore := userFinal
+	userFinal.Avatar = ""
+	userFinal.UpdatedAt = time.Now()
+
+	// update in DB first, the files of a removed avatar are never served
+	event := newAuditEvent(userIDAuth, AuditUserUpdate, AuditResourceUser, userFinal.UserID, userBefore, userFinal, client)
+	if err := userStore.Update(&userFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1134")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := avatarStorage.Delete(userFinal.UserID); err != nil {
+		log.WithError(err).Error("error code: 1135")
+	}
+
+	presentUser(&userFinal)
+	httpResponse.Message = userFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetAvatar handles jobs for controller.GetAvatar
+//
+// - id: user ID, raw path parameter
+// - size: one of avatar.Sizes, avatar.SizeDefault if empty
+// - version: optional version from the avatar URL, a matching
+// version marks the response as immutable
+func GetAvatar(id, size, version string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	userID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		httpResponse.Message = "avatar not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	px := avatar.SizeDefault
+	if size != "" {
+		px, err = strconv.Atoi(size)
+		if err != nil || !avatar.ValidSize(px) {
+			httpResponse.Message = "size must be one of 64, 128, 256, 512"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+	}
+
+	user, err := userStore.FindByID(userID)
+	if err != nil || user.Avatar == "" {
+		httpResponse.Message = "avatar not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	img, err := avatarStorage.Load(userID, px)
+	if errors.Is(err, avatar.ErrNotFound) {
+		httpResponse.Message = "avatar not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1136")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = model.AvatarImage{
+		Data:        img.Data,
+		ContentType: avatar.ContentType,
+		ETag:        `"` + user.Avatar + "-" + strconv.Itoa(px) + `"`,
+		ModTime:     img.ModTime,
+		Immutable:   version == user.Avatar,
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
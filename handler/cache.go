@@ -0,0 +1,16 @@
+package handler
+
+import (
+	"net/http"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+
+	"apidev/database/cache"
+)
+
+// GetCacheStats handles jobs for controller.GetCacheStats
+func GetCacheStats() (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	httpResponse.Message = cache.AllStats()
+	httpStatusCode = http.StatusOK
+	return
+}
@@ -0,0 +1,445 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// symmetric algorithms accepted for the content of end-to-end encrypted notes
+var e2eeContentAlgorithms = map[string]bool{
+	"AES-256-GCM":        true,
+	"XChaCha20-Poly1305": true,
+}
+
+// asymmetric algorithms accepted for public keys and wrapped note keys
+var e2eeKeyAlgorithms = map[string]bool{
+	"X25519":       true,
+	"ECDH-P256":    true,
+	"RSA-OAEP-256": true,
+}
+
+// validateE2EE checks the metadata of an end-to-end encrypted note
+// and returns a message describing the first problem found
+//
+// the content itself is opaque to the server, so only the shape
+// of the ciphertext and its metadata can be validated
+func validateE2EE(note model.Note) string {
+	if note.Title != "" || note.Body != "" {
+		return "plaintext title and body are not allowed in e2ee mode"
+	}
+	if !e2eeContentAlgorithms[note.Algorithm] {
+		return "unsupported e2ee algorithm"
+	}
+	if strings.TrimSpace(note.KeyID) == "" {
+		return "keyID is required in e2ee mode"
+	}
+	if !isBase64(note.Ciphertext) {
+		return "ciphertext must be a non-empty base64 string"
+	}
+	if !isBase64(note.Nonce) {
+		return "nonce must be a non-empty base64 string"
+	}
+	return ""
+}
+
+// isBase64 reports whether s is a non-empty standard base64 string
+func isBase64(s string) bool {
+	if s == "" {
+		return false
+	}
+	_, err := base64.StdEncoding.DecodeString(s)
+	return err == nil
+}
+
+// findKeyedNote returns a note with the recipient whose wrapped keys
+// the user may access: all of them (0) if the user may share the note,
+// see findNote, otherwise only the keys wrapped for the user
+// - id is the raw path parameter
+func findKeyedNote(user model.User, id string) (note model.Note, recipient uint64, err error) {
+	if note, err = findNote(user, id, model.WorkspaceRoleEditor); err == nil {
+		return note, 0, nil
+	}
+	noteID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return model.Note{}, 0, store.ErrNotFound
+	}
+	note, err = noteStore.FindByID(noteID)
+	return note, user.UserID, err
+}
+
+// GetUserKeys handles jobs for controller.GetUserKeys
+func GetUserKeys(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	keys, err := keyStore.FindUserKeys(user.UserID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1301")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if len(keys) == 0 {
+		httpResponse.Message = "no key found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	httpResponse.Message = keys
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetPublicKeys handles jobs for controller.GetPublicKeys
+func GetPublicKeys(userIDAuth uint64, userID string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	if _, err := userStore.FindByAuthID(userIDAuth); err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	ownerID, err := strconv.ParseUint(userID, 10, 64)
+	if err != nil {
+		httpResponse.Message = "no key found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	keys, err := keyStore.FindUserKeys(ownerID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1302")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if len(keys) == 0 {
+		httpResponse.Message = "no key found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	httpResponse.Message = keys
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// AddUserKey handles jobs for controller.AddUserKey
+func AddUserKey(userIDAuth uint64, key model.UserKey) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	keyFinal := model.UserKey{}
+
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	if !e2eeKeyAlgorithms[key.Algorithm] {
+		httpResponse.Message = "unsupported key algorithm"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if !isBase64(key.PublicKey) {
+		httpResponse.Message = "publicKey must be a non-empty base64 string"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// security: user must not be able to manipulate all fields
+	keyFinal.Algorithm = key.Algorithm
+	keyFinal.PublicKey = key.PublicKey
+	keyFinal.IDUser = user.UserID
+
+	// save in DB
+	if err := keyStore.CreateUserKey(&keyFinal); err != nil {
+		log.WithError(err).Error("error code: 1311")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = keyFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// DeleteUserKey handles jobs for controller.DeleteUserKey
+//
+// note keys wrapped with this public key can no longer be
+// unwrapped by anyone, so they are deleted as well
+func DeleteUserKey(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// does the key exist + does the user own this key
+	key := model.UserKey{}
+	keyID, err := strconv.ParseUint(id, 10, 64)
+	if err == nil {
+		key, err = keyStore.FindUserKey(user.UserID, keyID)
+	}
+	if err != nil {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// delete from DB
+	if err := keyStore.DeleteUserKey(key); err != nil {
+		log.WithError(err).Error("error code: 1321")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = "key ID# " + id + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetNoteKeys handles jobs for controller.GetNoteKeys
+//
+// the users who may share the note receive all wrapped keys,
+// a recipient only receives the keys wrapped for them
+func GetNoteKeys(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	note, recipient, err := findKeyedNote(user, id)
+	if err != nil || !note.E2EE {
+		httpResponse.Message = "note not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	noteKeys, err := keyStore.FindNoteKeys(note.NoteID, recipient)
+	if err != nil {
+		log.WithError(err).Error("error code: 1331")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if len(noteKeys) == 0 {
+		httpResponse.Message = "no key found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	httpResponse.Message = noteKeys
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// AddNoteKey handles jobs for controller.AddNoteKey
+//
+// the users who may edit an end-to-end encrypted note can share it
+// by uploading its content key wrapped for a recipient's public key
+func AddNoteKey(userIDAuth uint64, id string, noteKey model.NoteKey) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	noteKeyFinal := model.NoteKey{}
+
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// does the note exist + does the user have right to share this note
+	note, err := findNote(user, id, model.WorkspaceRoleEditor)
+	if err != nil {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !note.E2EE {
+		httpResponse.Message = "only e2ee notes can be shared with wrapped keys"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	if !e2eeKeyAlgorithms[noteKey.Algorithm] {
+		httpResponse.Message = "unsupported key algorithm"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if !isBase64(noteKey.WrappedKey) {
+		httpResponse.Message = "wrappedKey must be a non-empty base64 string"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// the wrapping key must be a public key of the recipient
+	recipientKey, err := keyStore.FindUserKey(noteKey.IDUser, noteKey.IDUserKey)
+	if err != nil {
+		httpResponse.Message = "public key of the recipient not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	// the recipient can only unwrap with the algorithm of their key
+	if noteKey.Algorithm != recipientKey.Algorithm {
+		httpResponse.Message = "algorithm must match the public key of the recipient"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// security: user must not be able to manipulate all fields
+	noteKeyFinal.Algorithm = noteKey.Algorithm
+	noteKeyFinal.WrappedKey = noteKey.WrappedKey
+	noteKeyFinal.IDUserKey = recipientKey.KeyID
+	noteKeyFinal.IDNote = note.NoteID
+	noteKeyFinal.IDUser = recipientKey.IDUser
+	noteKeyFinal.IDSharedBy = user.UserID
+
+	// save in DB, one wrapped key per note and public key
+	err = keyStore.CreateNoteKey(&noteKeyFinal)
+	if errors.Is(err, store.ErrConflict) {
+		httpResponse.Message = "note key already exists for this public key"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1341")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = noteKeyFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// DeleteNoteKey handles jobs for controller.DeleteNoteKey
+//
+// the users who may share the note can revoke any share,
+// a recipient can only remove the key wrapped for them
+func DeleteNoteKey(userIDAuth uint64, id, noteKeyID string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	note, recipient, err := findKeyedNote(user, id)
+	if err != nil {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	noteKey := model.NoteKey{}
+	keyID, err := strconv.ParseUint(noteKeyID, 10, 64)
+	if err == nil {
+		noteKey, err = keyStore.FindNoteKey(note.NoteID, keyID)
+	}
+	if err != nil || recipient != 0 && noteKey.IDUser != recipient {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// delete from DB
+	if err := keyStore.DeleteNoteKey(noteKey); err != nil {
+		log.WithError(err).Error("error code: 1351")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = "note key ID# " + noteKeyID + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetSharedNotes handles jobs for controller.GetSharedNotes
+func GetSharedNotes(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// find all e2ee notes of other users with a key wrapped for this user
+	notes, err := keyStore.FindSharedNotes(user.UserID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1361")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if len(notes) == 0 {
+		httpResponse.Message = "no note found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	httpResponse.Message = notes
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetSharedNote handles jobs for controller.GetSharedNote
+func GetSharedNote(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// show the note if a key is wrapped for the user
+	note := model.Note{}
+	noteID, err := strconv.ParseUint(id, 10, 64)
+	if err == nil {
+		var noteKeys []model.NoteKey
+		if noteKeys, err = keyStore.FindNoteKeys(noteID, user.UserID); err == nil && len(noteKeys) == 0 {
+			err = store.ErrNotFound
+		}
+	}
+	if err == nil {
+		note, err = noteStore.FindByID(noteID)
+	}
+	if err != nil || !note.E2EE {
+		httpResponse.Message = "note not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	httpResponse.Message = note
+	httpStatusCode = http.StatusOK
+	return
+}
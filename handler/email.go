@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	gmiddleware "github.com/pilinux/gorest/lib/middleware"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/mailer"
+)
+
+// EmailResendInterval - a new code of the same kind is sent to an
+// account at most once per interval
+const EmailResendInterval = time.Minute
+
+// PasswordMinLength - minimum length of a password set by a reset
+const PasswordMinLength = 6
+
+// validity of the codes when EMAIL_VERIFY_VALIDITY_PERIOD and
+// EMAIL_PASS_RECOVER_VALIDITY_PERIOD are not set
+const (
+	emailVerifyValidityDefault = 24 * time.Hour
+	passRecoverValidityDefault = 30 * time.Minute
+)
+
+// errEmailToken - a code which is malformed, unknown, expired or wrong
+var errEmailToken = errors.New("invalid email token")
+
+// StartEmailVerification marks the email of a new account as not
+// verified and sends it a verification code
+//
+// - email: address given at the registration, the credentials may
+// only hold its encrypted form
+//
+// errors are logged only, the user can ask for a new code
+func StartEmailVerification(authID uint64, email string) {
+	if err := credentialStore.SetEmailVerification(authID, gmodel.EmailNotVerified); err != nil {
+		log.WithError(err).Error("error code: 2301")
+		return
+	}
+	if err := sendEmailToken(authID, strings.TrimSpace(email), model.EmailTokenVerify, ""); err != nil {
+		log.WithError(err).Error("error code: 2302")
+	}
+}
+
+// VerifyEmail handles jobs for controller.VerifyEmail
+func VerifyEmail(payload model.EmailCode, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	token, err := checkEmailToken(payload.Code, model.EmailTokenVerify)
+	if errors.Is(err, errEmailToken) {
+		httpResponse.Message = "invalid or expired code"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2311")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if err := credentialStore.SetEmailVerification(token.IDAuth, gmodel.EmailVerified); err != nil {
+		log.WithError(err).Error("error code: 2312")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := emailTokenStore.DeleteEmailTokens(token.IDAuth, model.EmailTokenVerify); err != nil {
+		log.WithError(err).Error("error code: 2313")
+	}
+	appendAccountEvent(token.IDAuth, AuditAccountVerifyEmail, token.IDAuth, nil, nil, client)
+
+	httpResponse.Message = "email verified!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// ResendVerificationEmail handles jobs for controller.ResendVerificationEmail
+//
+// the response does not reveal whether an account uses the email
+func ResendVerificationEmail(payload model.EmailRequest) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	email := strings.TrimSpace(payload.Email)
+	if email == "" {
+		httpResponse.Message = "email is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	auth, err := credentialStore.FindAuthByEmail(email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2321")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err == nil && auth.VerifyEmail == gmodel.EmailNotVerified {
+		if err := sendEmailToken(auth.AuthID, email, model.EmailTokenVerify, ""); err != nil {
+			log.WithError(err).Error("error code: 2322")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+	}
+
+	httpResponse.Message = "if the email belongs to an unverified account, a new code has been sent"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// ForgotPassword handles jobs for controller.ForgotPassword
+//
+// the response does not reveal whether an account uses the email
+func ForgotPassword(payload model.EmailRequest) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	email := strings.TrimSpace(payload.Email)
+	if email == "" {
+		httpResponse.Message = "email is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	auth, err := credentialStore.FindAuthByEmail(email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2331")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err == nil {
+		if err := sendEmailToken(auth.AuthID, email, model.EmailTokenRecover, ""); err != nil {
+			log.WithError(err).Error("error code: 2332")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+	}
+
+	httpResponse.Message = "if an account uses the email, a recovery code has been sent"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// ResetPassword handles jobs for controller.ResetPassword
+//
+// - all JWTs issued until now are rejected and the sessions are revoked
+// - the email is verified, the code proves access to it
+func ResetPassword(payload model.PasswordReset, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if len(payload.Password) < PasswordMinLength {
+		httpResponse.Message = fmt.Sprintf("password must be at least %d characters", PasswordMinLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	token, err := checkEmailToken(payload.Code, model.EmailTokenRecover)
+	if errors.Is(err, errEmailToken) {
+		httpResponse.Message = "invalid or expired code"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2341")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	auth, err := credentialStore.FindAuth(token.IDAuth)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid or expired code"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2342")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	hash, err := hashSecret(payload.Password)
+	if err != nil {
+		log.WithError(err).Error("error code: 2343")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := credentialStore.SetPassword(auth.AuthID, hash); err != nil {
+		log.WithError(err).Error("error code: 2344")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := emailTokenStore.DeleteEmailTokens(auth.AuthID, model.EmailTokenRecover); err != nil {
+		log.WithError(err).Error("error code: 2345")
+	}
+	if auth.VerifyEmail == gmodel.EmailNotVerified {
+		if err := credentialStore.SetEmailVerification(auth.AuthID, gmodel.EmailVerified); err != nil {
+			log.WithError(err).Error("error code: 2346")
+		}
+	}
+
+	// logins with the old password end, refresh tokens live the longest
+	now := time.Now()
+	revocation := model.AuthRevocation{
+		IDAuth:    auth.AuthID,
+		RevokedAt: now,
+		ExpiresAt: now.Add(time.Duration(gmiddleware.JWTParams.RefreshKeyTTL) * time.Minute),
+		Reason:    model.RevocationLogout,
+	}
+	if err := revocationStore.Revoke(revocation); err != nil {
+		log.WithError(err).Error("error code: 2347")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := sessionStore.RevokeSessions(auth.AuthID, 0, now); err != nil {
+		log.WithError(err).Error("error code: 2348")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(auth.AuthID, AuditAccountResetPassword, auth.AuthID, nil, nil, client)
+
+	httpResponse.Message = "password updated, please log in again"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CheckVerifiedLogin handles jobs for controller.RequireVerifiedEmail
+//
+// rejects the JWTs issued by a login to an account whose email is not
+// verified yet
+func CheckVerifiedLogin(payload gmodel.JWTPayload) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	claims, ok := parseJWTClaims(payload.AccessJWT)
+	if !ok {
+		claims, ok = parseJWTClaims(payload.RefreshJWT)
+	}
+	if !ok || credentialStore == nil {
+		httpStatusCode = http.StatusOK
+		return
+	}
+
+	auth, err := credentialStore.FindAuth(claims.AuthID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2351")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err == nil && auth.VerifyEmail == gmodel.EmailNotVerified {
+		httpResponse.Message = "email verification required"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// sendEmailToken saves a new code of a kind and emails it, unless a code
+// of this kind was sent within EmailResendInterval
+//
+// - device: hash of the device key the code is bound to, see deviceHash
+//
+// the template gets the variables of EMAIL_HTML_MODEL and
+// - code: `<tokenID>_<secret>`
+// - email: address of the recipient
+// - validity: minutes until the code expires
+// - link: URL of a magic link, with MAGIC_LINK_URL only
+func sendEmailToken(authID uint64, email, kind, device string) error {
+	if emailSender == nil {
+		return errors.New("no email provider")
+	}
+
+	now := time.Now()
+	tokens, err := emailTokenStore.FindEmailTokens(authID, kind)
+	if err != nil {
+		return err
+	}
+	if len(tokens) > 0 && tokens[0].CreatedAt.After(now.Add(-EmailResendInterval)) {
+		return nil
+	}
+
+	configureEmail := gconfig.GetConfig().EmailConf
+	var validity time.Duration
+	var messageKind string
+	switch kind {
+	case model.EmailTokenVerify:
+		validity = time.Duration(configureEmail.EmailVerifyValidityPeriod) * time.Second
+		if validity <= 0 {
+			validity = emailVerifyValidityDefault
+		}
+		messageKind = mailer.KindVerifyEmail
+	case model.EmailTokenRecover:
+		validity = time.Duration(configureEmail.PassRecoverValidityPeriod) * time.Second
+		if validity <= 0 {
+			validity = passRecoverValidityDefault
+		}
+		messageKind = mailer.KindRecoverPassword
+	case model.EmailTokenMagicLink:
+		validity = config.GetConfig().Email.MagicLink.TTL
+		if validity <= 0 {
+			validity = magicLinkValidityDefault
+		}
+		messageKind = mailer.KindMagicLink
+	default:
+		return fmt.Errorf("unknown email token kind %s", kind)
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		return err
+	}
+	token := model.EmailToken{
+		CreatedAt: now,
+		Kind:      kind,
+		IDAuth:    authID,
+		Hash:      hash,
+		Device:    device,
+		ExpiresAt: now.Add(validity),
+	}
+	if err := emailTokenStore.CreateEmailToken(&token); err != nil {
+		return err
+	}
+
+	code := strconv.FormatUint(token.TokenID, 10) + "_" + secret
+	variables := mailer.ParseModel(configureEmail.HTMLModel)
+	variables["code"] = code
+	variables["email"] = email
+	variables["validity"] = strconv.Itoa(int(validity.Minutes()))
+	if kind == model.EmailTokenMagicLink {
+		if link := magicLinkURL(code); link != "" {
+			variables["link"] = link
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailer.RequestTimeout)
+	defer cancel()
+	return emailSender.Send(ctx, mailer.Message{
+		To:    email,
+		Kind:  messageKind,
+		Model: variables,
+	})
+}
+
+// checkEmailToken returns the token of a code of a kind,
+// errEmailToken if it is malformed, unknown, expired or wrong
+func checkEmailToken(raw, kind string) (model.EmailToken, error) {
+	tokenID, secret, ok := splitSecret(strings.TrimSpace(raw))
+	if !ok {
+		return model.EmailToken{}, errEmailToken
+	}
+
+	token, err := emailTokenStore.FindEmailToken(tokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		return model.EmailToken{}, errEmailToken
+	}
+	if err != nil {
+		return model.EmailToken{}, err
+	}
+	if token.Kind != kind || !token.ExpiresAt.After(time.Now()) {
+		return model.EmailToken{}, errEmailToken
+	}
+
+	match, err := matchSecret(secret, token.Hash)
+	if err != nil {
+		return model.EmailToken{}, err
+	}
+	if !match {
+		return model.EmailToken{}, errEmailToken
+	}
+	return token, nil
+}
@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+
+	"apidev/database/model"
+	"apidev/lib/mailer"
+)
+
+// useMemoryMailer injects a mailer keeping the emails
+func useMemoryMailer(t *testing.T) *mailer.Memory {
+	t.Helper()
+
+	sender := mailer.NewMemory()
+	SetMailer(sender)
+	t.Cleanup(func() { SetMailer(nil) })
+	return sender
+}
+
+// emailCode matches a code `<tokenID>_<secret>` in the body of an email
+var emailCode = regexp.MustCompile(`\b[0-9]+_[A-Za-z0-9_-]{20,}`)
+
+// emailedCode returns the code in the text body of the latest email of
+// a kind to an address, rendered with the templates of this application
+func emailedCode(t *testing.T, sender *mailer.Memory, email, kind string) string {
+	t.Helper()
+
+	msg, ok := sender.Last(email)
+	if !ok {
+		t.Fatalf("no email to %s", email)
+	}
+	if msg.Kind != kind {
+		t.Fatalf("email to %s of kind %s, want %s", email, msg.Kind, kind)
+	}
+
+	templates, err := mailer.NewTemplates("../templates/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, text, _, err := templates.Render(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := emailCode.FindString(text)
+	if code == "" {
+		t.Fatalf("no code in the email to %s:\n%s", email, text)
+	}
+	return code
+}
+
+// createEmailToken saves a token of a kind created and expiring at the
+// given times and returns its code
+func createEmailToken(t *testing.T, authID uint64, kind string, createdAt, expiresAt time.Time) string {
+	t.Helper()
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := model.EmailToken{
+		CreatedAt: createdAt,
+		Kind:      kind,
+		IDAuth:    authID,
+		Hash:      hash,
+		ExpiresAt: expiresAt,
+	}
+	if err := emailTokenStore.CreateEmailToken(&token); err != nil {
+		t.Fatal(err)
+	}
+	return strconv.FormatUint(token.TokenID, 10) + "_" + secret
+}
+
+func TestVerifyEmail(t *testing.T) {
+	authStore := useMemoryStores(t)
+	sender := useMemoryMailer(t)
+	email := "alice@example.com"
+	authID := createPasswordAccount(t, authStore, email)
+
+	StartEmailVerification(authID, email)
+	auth, err := credentialStore.FindAuth(authID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.VerifyEmail != gmodel.EmailNotVerified {
+		t.Errorf("VerifyEmail = %d, want %d", auth.VerifyEmail, gmodel.EmailNotVerified)
+	}
+	code := emailedCode(t, sender, email, mailer.KindVerifyEmail)
+	expired := createEmailToken(t, authID, model.EmailTokenVerify, time.Now().Add(-time.Hour), time.Now().Add(-time.Second))
+
+	tests := []struct {
+		name string
+		code string
+		want int
+	}{
+		{"expired code", expired, http.StatusBadRequest},
+		{"wrong secret", code + "x", http.StatusBadRequest},
+		{"malformed code", "abc", http.StatusBadRequest},
+		{"emailed code", code, http.StatusOK},
+		{"used code", code, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := VerifyEmail(model.EmailCode{Code: tt.code}, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("VerifyEmail() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	auth, err = credentialStore.FindAuth(authID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.VerifyEmail != gmodel.EmailVerified {
+		t.Errorf("VerifyEmail = %d, want %d", auth.VerifyEmail, gmodel.EmailVerified)
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	authStore := useMemoryStores(t)
+	sender := useMemoryMailer(t)
+	email := "alice@example.com"
+	authID := createPasswordAccount(t, authStore, email)
+	createPasswordAccount(t, authStore, "bob@example.com")
+	if err := credentialStore.SetEmailVerification(authID, gmodel.EmailNotVerified); err != nil {
+		t.Fatal(err)
+	}
+	// the code of the registration was sent before the resend interval
+	first := createEmailToken(t, authID, model.EmailTokenVerify, time.Now().Add(-2*EmailResendInterval), time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name  string
+		email string
+		want  int
+		sent  int
+	}{
+		{"unverified account", email, http.StatusOK, 1},
+		{"within the resend interval", email, http.StatusOK, 1},
+		{"verified account", "bob@example.com", http.StatusOK, 1},
+		{"unknown email", "carol@example.com", http.StatusOK, 1},
+		{"no email", " ", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := ResendVerificationEmail(model.EmailRequest{Email: tt.email})
+			if statusCode != tt.want {
+				t.Errorf("ResendVerificationEmail() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+			if sent := len(sender.Sent()); sent != tt.sent {
+				t.Errorf("emails sent = %d, want %d", sent, tt.sent)
+			}
+		})
+	}
+
+	// the new code verifies the email and the first code ends with it
+	code := emailedCode(t, sender, email, mailer.KindVerifyEmail)
+	if resp, statusCode := VerifyEmail(model.EmailCode{Code: code}, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("VerifyEmail() = %d %v", statusCode, resp.Message)
+	}
+	if _, statusCode := VerifyEmail(model.EmailCode{Code: first}, model.ClientInfo{}); statusCode != http.StatusBadRequest {
+		t.Errorf("VerifyEmail() with the first code = %d, want %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestForgotPassword(t *testing.T) {
+	authStore := useMemoryStores(t)
+	sender := useMemoryMailer(t)
+	createPasswordAccount(t, authStore, "alice@example.com")
+
+	tests := []struct {
+		name  string
+		email string
+		want  int
+		sent  int
+	}{
+		{"known email", "alice@example.com", http.StatusOK, 1},
+		{"within the resend interval", "alice@example.com", http.StatusOK, 1},
+		{"unknown email", "carol@example.com", http.StatusOK, 1},
+		{"no email", "", http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := ForgotPassword(model.EmailRequest{Email: tt.email})
+			if statusCode != tt.want {
+				t.Errorf("ForgotPassword() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+			if sent := len(sender.Sent()); sent != tt.sent {
+				t.Errorf("emails sent = %d, want %d", sent, tt.sent)
+			}
+		})
+	}
+	emailedCode(t, sender, "alice@example.com", mailer.KindRecoverPassword)
+}
+
+func TestResetPassword(t *testing.T) {
+	authStore := useMemoryStores(t)
+	sender := useMemoryMailer(t)
+	email := "alice@example.com"
+	authID := createPasswordAccount(t, authStore, email)
+
+	session := model.Session{IDAuth: authID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := sessionStore.CreateSession(&session, []model.SessionToken{{JTI: "refresh", ExpiresAt: session.ExpiresAt}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, statusCode := ForgotPassword(model.EmailRequest{Email: email}); statusCode != http.StatusOK {
+		t.Fatalf("ForgotPassword() = %d %v", statusCode, resp.Message)
+	}
+	code := emailedCode(t, sender, email, mailer.KindRecoverPassword)
+	expired := createEmailToken(t, authID, model.EmailTokenRecover, time.Now().Add(-time.Hour), time.Now().Add(-time.Second))
+	verify := createEmailToken(t, authID, model.EmailTokenVerify, time.Now(), time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		payload model.PasswordReset
+		want    int
+	}{
+		{"short password", model.PasswordReset{Code: code, Password: "12345"}, http.StatusBadRequest},
+		{"expired code", model.PasswordReset{Code: expired, Password: "new password"}, http.StatusBadRequest},
+		{"code of a verification", model.PasswordReset{Code: verify, Password: "new password"}, http.StatusBadRequest},
+		{"emailed code", model.PasswordReset{Code: code, Password: "new password"}, http.StatusOK},
+		{"used code", model.PasswordReset{Code: code, Password: "other password"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := ResetPassword(tt.payload, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("ResetPassword() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	auth, err := credentialStore.FindAuth(authID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, err := matchSecret("new password", auth.Password); err != nil || !match {
+		t.Errorf("password of the account is not the new password: %v", err)
+	}
+
+	// the sessions and JWTs of the old password end
+	sessions, err := sessionStore.FindSessions(authID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("sessions after the reset = %+v, want none", sessions)
+	}
+	revocation, err := revocationStore.FindRevocation(authID)
+	if err != nil {
+		t.Fatalf("no revocation of the JWTs: %v", err)
+	}
+	if revocation.RevokedAt.Before(session.CreatedAt) {
+		t.Errorf("JWTs revoked at %v, before the session was created", revocation.RevokedAt)
+	}
+}
@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/dataexport"
+)
+
+// states of a data export
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// ExportPath - path of the data exports, the download URL
+// of an export is <ExportPath><exportID>/download
+const ExportPath = "/api/v1/users/data-export/"
+
+// GetDataExports handles jobs for controller.GetDataExports
+func GetDataExports(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	exports, err := exportStore.FindByAuth(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 1181")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	for i := range exports {
+		presentExport(&exports[i])
+	}
+	httpResponse.Message = exports
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CreateDataExport handles jobs for controller.CreateDataExport
+//
+// the archive is built in the background, its status is
+// polled with GetDataExport
+//
+// - email: address of the access token, exported if gorest
+// keeps the address encrypted
+func CreateDataExport(userIDAuth uint64, email string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// one export at a time
+	exports, err := exportStore.FindByAuth(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 1181")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	for _, export := range exports {
+		if export.Status == ExportPending {
+			httpResponse.Message = "a data export is already in progress"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+	}
+
+	export := model.DataExport{IDAuth: userIDAuth, Status: ExportPending}
+	if err := exportStore.Create(&export); err != nil {
+		log.WithError(err).Error("error code: 1182")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// every subject access request is logged
+	event := newAuditEvent(userIDAuth, AuditExportCreate, AuditResourceExport, export.ExportID, nil, nil, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 1183")
+	}
+
+	go buildDataExport(export, email)
+
+	presentExport(&export)
+	httpResponse.Message = export
+	httpStatusCode = http.StatusAccepted
+	return
+}
+
+// GetDataExport handles jobs for controller.GetDataExport
+//
+// - id: export ID, raw path parameter
+func GetDataExport(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	export, err := findDataExport(userIDAuth, id)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "data export not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1184")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	presentExport(&export)
+	httpResponse.Message = export
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DownloadDataExport handles jobs for controller.DownloadDataExport
+//
+// - id: export ID, raw path parameter
+// - the archive can be downloaded until the export expires
+func DownloadDataExport(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	export, err := findDataExport(userIDAuth, id)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "data export not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1184")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if export.Status != ExportReady {
+		httpResponse.Message = "data export is " + export.Status
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if export.ExpiresAt != nil && !time.Now().Before(*export.ExpiresAt) {
+		httpResponse.Message = "data export has expired"
+		httpStatusCode = http.StatusGone
+		return
+	}
+
+	data, err := exportArchives.Load(export.ExportID)
+	if errors.Is(err, dataexport.ErrNotFound) {
+		httpResponse.Message = "data export has expired"
+		httpStatusCode = http.StatusGone
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1185")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	event := newAuditEvent(userIDAuth, AuditExportDownload, AuditResourceExport, export.ExportID, nil, nil, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 1183")
+	}
+
+	httpResponse.Message = model.DataExportArchive{
+		Data:        data,
+		ContentType: dataexport.ContentType,
+		FileName:    "data-export-" + strconv.FormatUint(export.ExportID, 10) + ".zip",
+		ModTime:     export.UpdatedAt,
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// findDataExport returns an export if it was requested by the user
+// - id is the raw path parameter
+func findDataExport(userIDAuth uint64, id string) (model.DataExport, error) {
+	exportID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return model.DataExport{}, store.ErrNotFound
+	}
+	return exportStore.FindOne(userIDAuth, exportID)
+}
+
+// presentExport sets the download URL of a ready export
+func presentExport(export *model.DataExport) {
+	if export.Status == ExportReady {
+		export.DownloadURL = ExportPath + strconv.FormatUint(export.ExportID, 10) + "/download"
+	}
+}
+
+// buildDataExport collects the data of the user, stores the archive
+// and marks the export as ready, or failed
+//
+// failed exports expire like ready ones, their records are removed
+// by PurgeDataExports
+func buildDataExport(export model.DataExport, email string) {
+	now := time.Now()
+	expiresAt := now.Add(config.GetConfig().DataExport.TTL)
+	export.ExpiresAt = &expiresAt
+	export.UpdatedAt = now
+	export.Status = ExportFailed
+
+	files, err := collectDataExport(export.IDAuth, email)
+	if err != nil {
+		log.WithError(err).Error("error code: 1186")
+	}
+	if err == nil {
+		var data []byte
+		data, err = dataexport.Build(files, now)
+		if err == nil {
+			err = exportArchives.Save(export.ExportID, data)
+		}
+		if err != nil {
+			log.WithError(err).Error("error code: 1187")
+		} else {
+			export.Status = ExportReady
+			export.Size = int64(len(data))
+		}
+	}
+
+	if err := exportStore.Update(&export); err != nil {
+		log.WithError(err).Error("error code: 1188")
+	}
+}
+
+// collectDataExport returns everything held about a user,
+// keyed by the file name in the archive
+//
+// - auth: credentials without password and encrypted fields
+// - twoFA: state of two-factor authentication, without keys
+// - accessTokens: personal access tokens, without their hashes
+// - oauthClients, oauthAuthorizations: OAuth2 clients registered by the
+// user and the clients the user has granted access to
+// - sessions: active logins with their user agent and IP
+// - profile, notes (soft deleted included), auditEvents
+// - workspaces: the workspaces the user is a member of, with their role
+func collectDataExport(userIDAuth uint64, email string) (map[string]interface{}, error) {
+	files := map[string]interface{}{}
+
+	if credentialStore != nil {
+		auth, err := credentialStore.FindAuth(userIDAuth)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			if auth.Email == "" && auth.EmailCipher != "" {
+				// stored encrypted
+				auth.Email = email
+			}
+			files["auth"] = model.ExportAuth{
+				AuthID:        auth.AuthID,
+				CreatedAt:     auth.CreatedAt,
+				UpdatedAt:     auth.UpdatedAt,
+				Email:         auth.Email,
+				EmailVerified: auth.VerifyEmail == gmodel.EmailVerified,
+			}
+		}
+
+		twoFA, err := credentialStore.FindTwoFA(userIDAuth)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			files["twoFA"] = model.ExportTwoFA{
+				Status:    twoFA.Status,
+				CreatedAt: twoFA.CreatedAt,
+				UpdatedAt: twoFA.UpdatedAt,
+			}
+		}
+	}
+
+	if tokenStore != nil {
+		tokens, err := tokenStore.FindTokens(userIDAuth)
+		if err != nil {
+			return nil, err
+		}
+		files["accessTokens"] = tokens
+	}
+
+	if oauthServerStore != nil {
+		clients, err := oauthServerStore.FindClients(userIDAuth)
+		if err != nil {
+			return nil, err
+		}
+		files["oauthClients"] = clients
+
+		authorizations, err := findOAuthAuthorizations(userIDAuth)
+		if err != nil {
+			return nil, err
+		}
+		files["oauthAuthorizations"] = authorizations
+	}
+
+	if sessionStore != nil {
+		sessions, err := sessionStore.FindSessions(userIDAuth)
+		if err != nil {
+			return nil, err
+		}
+		files["sessions"] = sessions
+	}
+
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil {
+		files["profile"] = user
+
+		notes, err := noteStore.FindAllByUser(user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		exported := make([]model.ExportNote, 0, len(notes))
+		for _, note := range notes {
+			exportedNote := model.ExportNote{Note: note}
+			if note.DeletedAt.Valid {
+				deletedAt := note.DeletedAt.Time
+				exportedNote.DeletedAt = &deletedAt
+			}
+			exported = append(exported, exportedNote)
+		}
+		files["notes"] = exported
+
+		userSettings, err := userStore.FindSettings(user.UserID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			files["settings"] = userSettings
+		}
+
+		workspaces, err := workspaceStore.FindByMember(user.UserID)
+		if err != nil {
+			return nil, err
+		}
+		files["workspaces"] = workspaces
+	}
+
+	events, err := auditStore.Find(model.AuditFilter{IDAuth: userIDAuth})
+	if err != nil {
+		return nil, err
+	}
+	files["auditEvents"] = events
+
+	return files, nil
+}
+
+// PurgeDataExports removes the expired exports with their archives
+func PurgeDataExports() {
+	exports, err := exportStore.FindExpired(time.Now())
+	if err != nil {
+		log.WithError(err).Error("error code: 1189")
+		return
+	}
+	deleteDataExports(exports)
+}
+
+// deleteDataExports removes exports with their archives,
+// the records of exports whose archive failed to delete are kept
+func deleteDataExports(exports []model.DataExport) {
+	for _, export := range exports {
+		if err := exportArchives.Delete(export.ExportID); err != nil {
+			log.WithError(err).Error("error code: 1190")
+			continue
+		}
+		if err := exportStore.Delete(export.ExportID); err != nil {
+			log.WithError(err).Error("error code: 1190")
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/lockout"
+	"apidev/lib/mailer"
+)
+
+// LoginAttempt - the keys a login or a 2FA validation is throttled by,
+// reserved by CheckLoginAttempt or CheckTwoFAAttempt until
+// FinishLoginAttempt
+type LoginAttempt struct {
+	authID  uint64
+	email   string
+	account string
+	ip      string
+
+	accountReservation *lockout.Reservation
+	ipReservation      *lockout.Reservation
+}
+
+// CheckLoginAttempt handles jobs for controller.ThrottleLogin
+// before the login
+//
+// - email: of the login payload, the failures of an unknown email are
+// counted too, so that the responses do not reveal the accounts
+//
+// the attempt is counted as failed until FinishLoginAttempt, so that
+// concurrent attempts are throttled one after the other; retryAfter is
+// the wait of a rejected attempt, the throttling is skipped if its
+// store fails
+func CheckLoginAttempt(email string, client model.ClientInfo) (attempt LoginAttempt, retryAfter time.Duration, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	email = strings.TrimSpace(email)
+	attempt.ip = ipLockoutKey(client.IP)
+	attempt.account = "email:" + emailHash(email)
+
+	if email != "" {
+		auth, err := credentialStore.FindAuthByEmail(email)
+		if err == nil {
+			attempt.authID = auth.AuthID
+			attempt.email = auth.Email
+			attempt.account = "login:" + strconv.FormatUint(auth.AuthID, 10)
+		} else if !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 2701")
+		}
+	}
+
+	retryAfter, httpResponse, httpStatusCode = reserveLoginAttempt(&attempt)
+	return
+}
+
+// CheckTwoFAAttempt handles jobs for controller.ThrottleTwoFA
+// before the validation of the second factor
+//
+// the failures are counted apart from those of the password, so that
+// a correct password does not reset them
+func CheckTwoFAAttempt(userIDAuth uint64, client model.ClientInfo) (attempt LoginAttempt, retryAfter time.Duration, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	attempt = LoginAttempt{
+		authID:  userIDAuth,
+		account: "2fa:" + strconv.FormatUint(userIDAuth, 10),
+		ip:      ipLockoutKey(client.IP),
+	}
+
+	retryAfter, httpResponse, httpStatusCode = reserveLoginAttempt(&attempt)
+	return
+}
+
+// FinishLoginAttempt handles jobs for controller.ThrottleLogin and
+// controller.ThrottleTwoFA after the login or the validation
+//
+// - statusCode: of the response, 401 keeps the failure, 200 is a
+// success which resets the failures of the account but not those of
+// the IP, other responses release the attempt
+//
+// the user is notified when the account gets locked
+func FinishLoginAttempt(attempt LoginAttempt, statusCode int, client model.ClientInfo) {
+	if accountLockout == nil {
+		return
+	}
+	ctx := context.Background()
+
+	switch statusCode {
+	case http.StatusOK:
+		if err := accountLockout.Reset(ctx, attempt.account); err != nil {
+			log.WithError(err).Error("error code: 2702")
+		}
+		releaseLoginAttempt(ipLockout, attempt.ipReservation, attempt.ip)
+
+	case http.StatusUnauthorized:
+		if reservation := attempt.accountReservation; reservation != nil && reservation.Locked {
+			lockedAccount(attempt, reservation.Failures, reservation.Wait, client)
+		}
+		if reservation := attempt.ipReservation; reservation != nil && reservation.Locked {
+			log.WithField("ip", client.IP).Warn("logins from the IP are locked after too many failed attempts")
+		}
+
+	default:
+		releaseLoginAttempt(accountLockout, attempt.accountReservation, attempt.account)
+		releaseLoginAttempt(ipLockout, attempt.ipReservation, attempt.ip)
+	}
+}
+
+// UnlockAccount handles jobs for controller.UnlockAccount
+//
+// lifts the lockout of the logins and the 2FA validations of an account
+// and forgets its failures, those of its IPs are kept
+func UnlockAccount(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	account, httpResponse, httpStatusCode := findAccount(id)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	authID := strconv.FormatUint(account.IDAuth, 10)
+	keys := []string{"login:" + authID, "2fa:" + authID}
+	auth, err := credentialStore.FindAuth(account.IDAuth)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2711")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err == nil && auth.Email != "" {
+		keys = append(keys, "email:"+emailHash(auth.Email))
+	}
+
+	if err := accountLockout.Reset(context.Background(), keys...); err != nil {
+		log.WithError(err).Error("error code: 2712")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountUnlock, account.IDAuth, nil, nil, client)
+
+	httpResponse.Message = "account ID# " + id + " unlocked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// UnlockIP handles jobs for controller.UnlockIP
+//
+// lifts the lockout of the logins from an IP and forgets its failures
+func UnlockIP(userIDAuth uint64, ip string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if net.ParseIP(ip) == nil {
+		httpResponse.Message = "invalid IP"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	if err := ipLockout.Reset(context.Background(), ipLockoutKey(ip)); err != nil {
+		log.WithError(err).Error("error code: 2721")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	log.WithFields(log.Fields{"ip": ip, "authID": userIDAuth}).Info("logins from the IP unlocked")
+
+	httpResponse.Message = "IP " + ip + " unlocked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// reserveLoginAttempt counts an attempt as failed for its account and
+// its IP, it is rejected while one of them is delayed or locked
+func reserveLoginAttempt(attempt *LoginAttempt) (retryAfter time.Duration, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	httpStatusCode = http.StatusOK
+	if accountLockout == nil {
+		return
+	}
+	ctx := context.Background()
+
+	reservation, err := accountLockout.Reserve(ctx, attempt.account)
+	if err != nil {
+		log.WithError(err).Error("error code: 2705")
+	} else if reservation.RetryAfter > 0 {
+		retryAfter = reservation.RetryAfter
+	} else {
+		attempt.accountReservation = &reservation
+	}
+
+	if retryAfter == 0 {
+		reservation, err := ipLockout.Reserve(ctx, attempt.ip)
+		if err != nil {
+			log.WithError(err).Error("error code: 2706")
+		} else if reservation.RetryAfter > 0 {
+			retryAfter = reservation.RetryAfter
+			releaseLoginAttempt(accountLockout, attempt.accountReservation, attempt.account)
+		} else {
+			attempt.ipReservation = &reservation
+		}
+	}
+
+	if retryAfter > 0 {
+		httpResponse.Message = "too many failed attempts, try again later"
+		httpStatusCode = http.StatusTooManyRequests
+	}
+	return
+}
+
+// releaseLoginAttempt uncounts a reserved attempt of a key
+func releaseLoginAttempt(limiter *lockout.Limiter, reservation *lockout.Reservation, key string) {
+	if reservation == nil {
+		return
+	}
+	if err := limiter.Release(context.Background(), key); err != nil {
+		log.WithError(err).Error("error code: 2704")
+	}
+}
+
+// lockedAccount records the lockout of an account in the audit log and
+// notifies the user by email if an email provider is injected
+func lockedAccount(attempt LoginAttempt, failures int64, wait time.Duration, client model.ClientInfo) {
+	if attempt.authID == 0 {
+		return
+	}
+	lock := model.AccountLockout{
+		Failures:    failures,
+		LockedUntil: time.Now().Add(wait),
+	}
+	appendAccountEvent(attempt.authID, AuditAccountLock, attempt.authID, nil, lock, client)
+
+	if emailSender == nil {
+		return
+	}
+	email := attempt.email
+	if email == "" {
+		auth, err := credentialStore.FindAuth(attempt.authID)
+		if err != nil {
+			log.WithError(err).Error("error code: 2707")
+			return
+		}
+		email = auth.Email
+	}
+	// encrypted by gorest or not saved with the credentials
+	if email == "" {
+		return
+	}
+
+	variables := mailer.ParseModel(gconfig.GetConfig().EmailConf.HTMLModel)
+	variables["email"] = email
+	variables["ip"] = client.IP
+	variables["minutes"] = strconv.Itoa(int(math.Ceil(wait.Minutes())))
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailer.RequestTimeout)
+	defer cancel()
+	err := emailSender.Send(ctx, mailer.Message{
+		To:    email,
+		Kind:  mailer.KindAccountLocked,
+		Model: variables,
+	})
+	if err != nil {
+		log.WithError(err).Error("error code: 2708")
+	}
+}
+
+// ipLockoutKey returns the key of an IP, in its canonical form
+func ipLockoutKey(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		ip = parsed.String()
+	}
+	return "ip:" + ip
+}
+
+// emailHash returns the SHA-256 of a lowercase email in hex,
+// so that the keys hold no personal data
+func emailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
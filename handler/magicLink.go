@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// validity of a magic link when MAGIC_LINK_VALIDITY_PERIOD is not set
+const magicLinkValidityDefault = 10 * time.Minute
+
+// RequestMagicLink handles jobs for controller.RequestMagicLink
+//
+// - at most MAGIC_LINK_LIMIT links of an account are valid at the same
+// time and one is sent per EmailResendInterval, more requests are ignored
+// - the response does not reveal whether an account uses the email
+func RequestMagicLink(payload model.MagicLinkRequest) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	email := strings.TrimSpace(payload.Email)
+	if email == "" {
+		httpResponse.Message = "email is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	auth, err := credentialStore.FindAuthByEmail(email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2501")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err == nil {
+		tokens, err := emailTokenStore.FindEmailTokens(auth.AuthID, model.EmailTokenMagicLink)
+		if err != nil {
+			log.WithError(err).Error("error code: 2502")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		valid := 0
+		now := time.Now()
+		for _, token := range tokens {
+			if token.ExpiresAt.After(now) {
+				valid++
+			}
+		}
+
+		if valid < config.GetConfig().Email.MagicLink.Limit {
+			err := sendEmailToken(auth.AuthID, email, model.EmailTokenMagicLink, deviceHash(payload.Device))
+			if err != nil {
+				log.WithError(err).Error("error code: 2503")
+				httpResponse.Message = "internal server error"
+				httpStatusCode = http.StatusInternalServerError
+				return
+			}
+		}
+	}
+
+	httpResponse.Message = "if an account uses the email, a login link has been sent"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// MagicLinkLogin handles jobs for controller.MagicLinkLogin
+//
+// - the link can be used once, with the device key of its request
+// - the JWTs are the same as those of a login with the password, the
+// second factor is still required if 2FA is enabled for the account
+// - the email is verified, the link proves access to it
+func MagicLinkLogin(payload model.MagicLinkLogin, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	token, err := checkEmailToken(payload.Code, model.EmailTokenMagicLink)
+	if errors.Is(err, errEmailToken) {
+		httpResponse.Message = "invalid or expired link"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2511")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if token.Device != "" && subtle.ConstantTimeCompare([]byte(token.Device), []byte(deviceHash(payload.Device))) != 1 {
+		httpResponse.Message = "the link must be opened on the device which requested it"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+
+	// of concurrent logins with the same link only one succeeds
+	_, err = emailTokenStore.TakeEmailToken(token.TokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid or expired link"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2512")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	auth, err := credentialStore.FindAuth(token.IDAuth)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid or expired link"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2513")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	_, err = suspensionStore.FindSuspension(auth.AuthID)
+	if err == nil {
+		httpResponse.Message = "account is suspended"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2514")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if auth.VerifyEmail == gmodel.EmailNotVerified {
+		if err := credentialStore.SetEmailVerification(auth.AuthID, gmodel.EmailVerified); err != nil {
+			log.WithError(err).Error("error code: 2515")
+		} else {
+			appendAccountEvent(auth.AuthID, AuditAccountVerifyEmail, auth.AuthID, nil, nil, client)
+		}
+	}
+
+	jwtPayload, err := issueJWT(auth.AuthID, auth.Email, false)
+	if err != nil {
+		log.WithError(err).Error("error code: 2516")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := TrackSession("", "", jwtPayload, client); err != nil {
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = jwtPayload
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// deviceHash returns the SHA-256 of a device key in hex,
+// empty if there is no key
+func deviceHash(device string) string {
+	device = strings.TrimSpace(device)
+	if device == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(device))
+	return hex.EncodeToString(sum[:])
+}
+
+// magicLinkURL returns MAGIC_LINK_URL with the code as query parameter,
+// empty if it is not set or invalid
+func magicLinkURL(code string) string {
+	base := config.GetConfig().Email.MagicLink.URL
+	if base == "" {
+		return ""
+	}
+	link, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	query := link.Query()
+	query.Set("code", code)
+	link.RawQuery = query.Encode()
+	return link.String()
+}
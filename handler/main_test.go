@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gmiddleware "github.com/pilinux/gorest/lib/middleware"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// TestMain reads the settings from the environment, as main does
+// before the handlers are used, and signs the JWTs with a test key
+func TestMain(m *testing.M) {
+	if err := gconfig.Config(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	config.Config()
+
+	gmiddleware.JWTParams.Algorithm = "HS256"
+	gmiddleware.JWTParams.AccessKey = []byte("test access key")
+	gmiddleware.JWTParams.AccessKeyTTL = 5
+	gmiddleware.JWTParams.RefreshKey = []byte("test refresh key")
+	gmiddleware.JWTParams.RefreshKeyTTL = 60
+
+	os.Exit(m.Run())
+}
+
+// useMemoryStores injects empty in-memory stores into the handlers,
+// the stores of the accounts included
+func useMemoryStores(t *testing.T) *store.MemoryAuthStore {
+	t.Helper()
+
+	audit := store.NewMemoryAuditStore()
+	notes := store.NewMemoryNoteStore(audit)
+	SetStores(store.BackendMemory, store.NewMemoryUserStore(audit), notes, audit)
+	SetWorkspaceStore(store.NewMemoryWorkspaceStore(notes, audit))
+
+	authStore := store.NewMemoryAuthStore()
+	SetAuthStore(authStore)
+	return authStore
+}
+
+// createProfile creates the profile of an auth ID
+func createProfile(t *testing.T, authID uint64, nickName string) model.User {
+	t.Helper()
+
+	resp, statusCode := CreateUserProfile(authID, model.User{NickName: nickName}, model.ClientInfo{})
+	if statusCode != http.StatusCreated {
+		t.Fatalf("create profile %s: %d %v", nickName, statusCode, resp.Message)
+	}
+	return resp.Message.(model.User)
+}
+
+// createNote creates a personal note of an auth ID
+func createNote(t *testing.T, authID uint64, title string) model.Note {
+	t.Helper()
+
+	resp, statusCode := CreateNote(authID, model.Note{Title: title}, model.ClientInfo{})
+	if statusCode != http.StatusCreated {
+		t.Fatalf("create note %s: %d %v", title, statusCode, resp.Message)
+	}
+	return resp.Message.(model.Note)
+}
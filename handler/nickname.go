@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/nickname"
+)
+
+// messages of unavailable nicknames
+const (
+	nicknameTaken    = "nickname is already taken"
+	nicknameReserved = "nickname is not available"
+)
+
+// nickKey returns the nickname key of a profile, profiles created
+// before the nickname policy have none stored
+func nickKey(user model.User) string {
+	if user.NickKey != nil {
+		return *user.NickKey
+	}
+	return nickname.Key(user.NickName)
+}
+
+// nicknameAvailable checks whether the user may take a nickname key
+// - msg is empty if the nickname is available
+// - err is set if the stores failed
+func nicknameAvailable(userID uint64, key string) (msg string, err error) {
+	owner, err := userStore.FindByNickname(key)
+	if err == nil && owner.UserID != userID {
+		return nicknameTaken, nil
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 1141")
+		return "", err
+	}
+
+	// given up by another user recently
+	reservation, err := userStore.FindReservation(key)
+	if err == nil && reservation.IDUser != userID && reservation.ExpiresAt.After(time.Now()) {
+		return nicknameReserved, nil
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 1142")
+		return "", err
+	}
+	return "", nil
+}
+
+// claimNickname checks whether the nickname of userFinal can be saved,
+// a changed nickname key is rate-limited and marked as changed
+//
+// - userBefore is the stored profile, zero for a new one
+// - msg and httpStatusCode describe why it cannot be saved
+func claimNickname(userBefore model.User, userFinal *model.User) (msg string, httpStatusCode int) {
+	if userFinal.NickKey == nil || userBefore.UserID != 0 && nickKey(userBefore) == *userFinal.NickKey {
+		// unchanged or only a different case
+		return
+	}
+
+	now := time.Now()
+	if userBefore.NickChanged != nil {
+		next := userBefore.NickChanged.Add(config.GetConfig().Nickname.ChangeInterval)
+		if now.Before(next) {
+			msg = "nickname can be changed again after " + next.UTC().Format(time.RFC3339)
+			httpStatusCode = http.StatusTooManyRequests
+			return
+		}
+	}
+
+	msg, err := nicknameAvailable(userFinal.UserID, *userFinal.NickKey)
+	if err != nil {
+		msg = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if msg != "" {
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	if userBefore.UserID != 0 {
+		userFinal.NickChanged = &now
+	}
+	return
+}
+
+// reserveNickname keeps the previous nickname of a user reserved for them
+// after a change of the nickname key
+func reserveNickname(userBefore, userFinal model.User) {
+	if userBefore.NickName == "" || nickKey(userBefore) == nickKey(userFinal) {
+		return
+	}
+
+	err := userStore.Reserve(model.NicknameReservation{
+		NickKey:   nickKey(userBefore),
+		IDUser:    userBefore.UserID,
+		ExpiresAt: time.Now().Add(config.GetConfig().Nickname.Cooldown),
+	})
+	if err != nil {
+		log.WithError(err).Error("error code: 1143")
+	}
+}
+
+// CheckNickname handles jobs for controller.CheckNickname
+//
+// an invalid nickname is reported as unavailable with the reason
+func CheckNickname(nickName string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	nickName = strings.TrimSpace(nickName)
+	if nickName == "" {
+		httpResponse.Message = "n is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	result := model.NicknameAvailability{NickName: nickName}
+	display, key, err := nickname.Normalize(nickName)
+	if err != nil {
+		result.Reason = err.Error()
+		httpResponse.Message = result
+		httpStatusCode = http.StatusOK
+		return
+	}
+	result.NickName = display
+
+	// nobody is logged in, reservations of all users apply
+	msg, err := nicknameAvailable(0, key)
+	if err != nil {
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	result.Available = msg == ""
+	result.Reason = msg
+
+	httpResponse.Message = result
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetPublicProfile handles jobs for controller.GetPublicProfile
+//
+// only profiles with a nickname following the nickname policy
+// can be found
+func GetPublicProfile(nickName string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	key := nickname.Key(norm.NFKC.String(strings.TrimSpace(nickName)))
+
+	user, err := userStore.FindByNickname(key)
+	if errors.Is(err, store.ErrNotFound) || err == nil && user.DeleteAfter != nil {
+		// accounts scheduled for deletion are hidden
+		httpResponse.Message = "profile not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1144")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// timestamps of public profiles are always in UTC
+	user.Preferences.LocalTime = false
+	presentUser(&user)
+
+	httpResponse.Message = model.PublicProfile{
+		NickName:  user.NickName,
+		Bio:       user.Bio,
+		AvatarURL: user.AvatarURL,
+		CreatedAt: user.CreatedAt,
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
@@ -1,32 +1,75 @@
 package handler
 
 import (
+	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
 
-	gdatabase "github.com/pilinux/gorest/database"
 	gmodel "github.com/pilinux/gorest/database/model"
 	log "github.com/sirupsen/logrus"
 
 	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/geo"
+	"apidev/lib/richtext"
 )
 
-// GetNotes handles jobs for controller.GetNotes
-func GetNotes(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
-	notes := []model.Note{}
+// PlaceNameMaxLength - maximum length of the place name of a note
+const PlaceNameMaxLength = 255
 
+// GetNotes handles jobs for controller.GetNotes
+//
+// - workspace: optional workspace ID, the personal notes of the user if empty
+// - near, radius, bbox: optional location filter, see geo.ParseQuery
+// - sort: optional order, position for the manual order
+func GetNotes(userIDAuth uint64, workspace, near, radius, bbox, sort string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
-	// find all notes written by this user
-	if err := db.Where("id_user = ?", user.UserID).Find(&notes).Error; err != nil {
+	owner := store.Personal(user.UserID)
+	if workspace != "" {
+		member, err := findWorkspaceMember(user, workspace, model.WorkspaceRoleViewer)
+		if err != nil {
+			httpResponse.Message = "workspace not found"
+			httpStatusCode = http.StatusNotFound
+			return
+		}
+		owner = store.InWorkspace(member.IDWorkspace)
+	}
+
+	query, err := geo.ParseQuery(near, radius, bbox)
+	if err != nil {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if sort != "" && sort != "position" {
+		httpResponse.Message = "sort must be position"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// find all notes of this user or workspace
+	var notes []model.Note
+	switch {
+	case query != nil:
+		notes, err = noteStore.FindByLocation(owner, *query)
+		if err == nil && sort == "position" {
+			store.SortByPosition(notes)
+		}
+	case sort == "position":
+		notes, err = noteStore.FindByPosition(owner)
+	default:
+		notes, err = noteStore.FindByOwner(owner)
+	}
+	if err != nil {
 		log.WithError(err).Error("error code: 1201")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
@@ -39,166 +82,340 @@ func GetNotes(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCo
 		return
 	}
 
+	localize(&notes, userLocation(user))
 	httpResponse.Message = notes
 	httpStatusCode = http.StatusOK
 	return
 }
 
 // GetNote handles jobs for controller.GetNote
-func GetNote(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
-	note := model.Note{}
-
+//
+// - as: optional format the body is converted to
+func GetNote(userIDAuth uint64, id, as string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
-	// show the note if it is written by the user
-	if err := db.Where("note_id = ?", id).Where("id_user = ?", user.UserID).First(&note).Error; err != nil {
+	// show the note if it is written by the user or shared in a workspace
+	note, err := findNote(user, id, model.WorkspaceRoleViewer)
+	if err != nil {
 		httpResponse.Message = "note not found"
 		httpStatusCode = http.StatusNotFound
 		return
 	}
 
-	httpResponse.Message = note
+	if as == "" {
+		localize(&note, userLocation(user))
+		httpResponse.Message = note
+		httpStatusCode = http.StatusOK
+		return
+	}
+
+	// the server cannot read the body of an end-to-end encrypted note
+	if note.E2EE {
+		httpResponse.Message = "end-to-end encrypted notes cannot be converted"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	from := note.ContentType
+	if from == "" {
+		from = richtext.FormatText
+	}
+	body, report, err := richtext.Convert(note.Body, from, as)
+	if err != nil {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	note.Body = body
+	note.ContentType = as
+	localize(&note, userLocation(user))
+
+	httpResponse.Message = model.ConvertedNote{
+		Note: note,
+		Conversion: model.NoteConversion{
+			From:     from,
+			To:       as,
+			Lossy:    report.Lossy,
+			Warnings: report.Warnings,
+		},
+	}
 	httpStatusCode = http.StatusOK
 	return
 }
 
 // CreateNote handles jobs for controller.CreateNote
-func CreateNote(userIDAuth uint64, note model.Note) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
+//
+// the note is created in the workspace given by workspaceID,
+// which requires the editor role, otherwise it is a personal note
+func CreateNote(userIDAuth uint64, note model.Note, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	noteFinal := model.Note{}
 
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
-	// remove all leading and trailing white spaces
-	note.Title = strings.TrimSpace(note.Title)
-	if note.Title == "" {
-		httpResponse.Message = "title is required"
+	// security: user must not be able to manipulate all fields
+	if msg, _ := applyNote(note, &noteFinal); msg != "" {
+		httpResponse.Message = msg
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
-
-	// security: user must not be able to manipulate all fields
-	noteFinal.Title = note.Title
-	noteFinal.Body = note.Body
+	noteFinal.Version = 1
 	noteFinal.IDUser = user.UserID
 
+	owner := store.Personal(user.UserID)
+	if note.IDWorkspace != nil {
+		member, err := findMember(*note.IDWorkspace, user.UserID, model.WorkspaceRoleEditor)
+		if err != nil {
+			httpResponse.Message = "user may not have access to perform this task"
+			httpStatusCode = http.StatusForbidden
+			return
+		}
+		noteFinal.IDWorkspace = &member.IDWorkspace
+		owner = store.InWorkspace(member.IDWorkspace)
+	}
+
+	// new notes are appended to the manual order
+	last, err := noteStore.LastPosition(owner)
+	if err != nil {
+		log.WithError(err).Error("error code: 1212")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	noteFinal.Position = appendPosition(last)
+
 	// save in DB
-	tx := db.Begin()
-	if err := tx.Create(&noteFinal).Error; err != nil {
-		tx.Rollback()
+	event := newAuditEvent(userIDAuth, AuditNoteCreate, AuditResourceNote, 0, nil, noteFinal, client)
+	if err := noteStore.Create(&noteFinal, event); err != nil {
 		log.WithError(err).Error("error code: 1211")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
 		return
 	}
-	tx.Commit()
 
+	localize(&noteFinal, userLocation(user))
 	httpResponse.Message = noteFinal
 	httpStatusCode = http.StatusCreated
 	return
 }
 
 // UpdateNote handles jobs for controller.UpdateNote
-func UpdateNote(userIDAuth uint64, id string, note model.Note) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
-	noteFinal := model.Note{}
-
+func UpdateNote(userIDAuth uint64, id string, note model.Note, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
 	// does the note exist + does the user have right to modify this note
-	if err := db.Where("note_id = ?", id).Where("id_user = ?", user.UserID).First(&noteFinal).Error; err != nil {
+	noteFinal, err := findNote(user, id, model.WorkspaceRoleEditor)
+	if err != nil {
 		httpResponse.Message = "user may not have access to perform this task"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
-	// remove all leading and trailing white spaces
-	note.Title = strings.TrimSpace(note.Title)
-	if note.Title == "" {
-		httpResponse.Message = "title is required"
+	// security: user must not be able to manipulate all fields
+	noteBefore := noteFinal
+	msg, changed := applyNote(note, &noteFinal)
+	if msg != "" {
+		httpResponse.Message = msg
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
 
 	// if no new info is received, abort
-	if note.Title == noteFinal.Title && note.Body == noteFinal.Body {
+	if !changed {
 		httpResponse.Message = "no new info to update"
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
 
-	// security: user must not be able to manipulate all fields
 	noteFinal.UpdatedAt = time.Now()
-	noteFinal.Title = note.Title
-	noteFinal.Body = note.Body
+	noteFinal.Version++
 
 	// update in DB
-	tx := db.Begin()
-	if err := tx.Save(&noteFinal).Error; err != nil {
-		tx.Rollback()
+	event := newAuditEvent(userIDAuth, AuditNoteUpdate, AuditResourceNote, noteFinal.NoteID, noteBefore, noteFinal, client)
+	if err := noteStore.Update(&noteFinal, event); err != nil {
 		log.WithError(err).Error("error code: 1221")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
 		return
 	}
-	tx.Commit()
 
+	localize(&noteFinal, userLocation(user))
 	httpResponse.Message = noteFinal
 	httpStatusCode = http.StatusOK
 	return
 }
 
 // DeleteNote handles jobs for controller.DeleteNote
-func DeleteNote(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
-	note := model.Note{}
-
+func DeleteNote(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
 	// does the note exist + does the user have right to delete this note
-	if err := db.Where("note_id = ?", id).Where("id_user = ?", user.UserID).First(&note).Error; err != nil {
+	note, err := findNote(user, id, model.WorkspaceRoleEditor)
+	if err != nil {
 		httpResponse.Message = "user may not have access to perform this task"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
 	// delete from DB
-	tx := db.Begin()
-	if err := tx.Delete(&note).Error; err != nil {
-		tx.Rollback()
+	event := newAuditEvent(userIDAuth, AuditNoteDelete, AuditResourceNote, note.NoteID, note, nil, client)
+	if err := noteStore.Delete(&note, event); err != nil {
 		log.WithError(err).Error("error code: 1231")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
 		return
 	}
-	tx.Commit()
 
 	httpResponse.Message = "note ID# " + id + " deleted!"
 	httpStatusCode = http.StatusOK
 	return
 }
+
+// applyNote validates the input of a note and copies the fields a user
+// is allowed to modify into noteFinal
+//
+// - a new note takes its mode (plaintext or e2ee) from the input,
+// an existing note cannot be switched to the other mode
+// - the workspace of a note is set by CreateNote and never changes
+// - msg describes why the input was rejected
+// - changed reports whether noteFinal was modified
+func applyNote(note model.Note, noteFinal *model.Note) (msg string, changed bool) {
+	if noteFinal.NoteID == 0 {
+		noteFinal.E2EE = note.E2EE
+	}
+
+	// a note cannot be switched between plaintext and end-to-end encrypted mode
+	if note.E2EE != noteFinal.E2EE {
+		msg = "e2ee mode of a note cannot be changed"
+		return
+	}
+
+	// the location is metadata, available in both modes
+	if msg, changed = applyLocation(note, noteFinal); msg != "" {
+		return
+	}
+
+	if noteFinal.E2EE {
+		// the server never sees the content of an end-to-end encrypted note,
+		// only the ciphertext and the metadata the clients need to decrypt it
+		if msg = validateE2EE(note); msg != "" {
+			return
+		}
+
+		changed = changed || note.Ciphertext != noteFinal.Ciphertext || note.Algorithm != noteFinal.Algorithm ||
+			note.KeyID != noteFinal.KeyID || note.Nonce != noteFinal.Nonce
+
+		noteFinal.Ciphertext = note.Ciphertext
+		noteFinal.Algorithm = note.Algorithm
+		noteFinal.KeyID = note.KeyID
+		noteFinal.Nonce = note.Nonce
+		return
+	}
+
+	// remove all leading and trailing white spaces
+	note.Title = strings.TrimSpace(note.Title)
+	if note.Title == "" {
+		msg = "title is required"
+		return
+	}
+
+	// keep the content type of an existing note if none is given,
+	// notes created before content types existed are plain text
+	if note.ContentType == "" {
+		note.ContentType = noteFinal.ContentType
+	}
+	if note.ContentType == "" {
+		note.ContentType = richtext.FormatText
+	}
+	if !richtext.ValidFormat(note.ContentType) {
+		msg = "contentType must be one of text, markdown, html, json"
+		return
+	}
+
+	body, err := richtext.Normalize(note.Body, note.ContentType)
+	if err != nil {
+		msg = err.Error()
+		return
+	}
+	note.Body = body
+
+	changed = changed || note.Title != noteFinal.Title || note.Body != noteFinal.Body ||
+		note.ContentType != noteFinal.ContentType
+
+	noteFinal.Title = note.Title
+	noteFinal.Body = note.Body
+	noteFinal.ContentType = note.ContentType
+	return
+}
+
+// applyLocation validates the optional location of a note and copies it
+// into noteFinal
+//
+// - latitude and longitude are WGS 84 degrees and given together
+// - accuracy is the radius of uncertainty in meters
+func applyLocation(note model.Note, noteFinal *model.Note) (msg string, changed bool) {
+	if (note.Latitude == nil) != (note.Longitude == nil) {
+		msg = "latitude and longitude must be given together"
+		return
+	}
+	if note.Latitude != nil && !geo.ValidLatLng(*note.Latitude, *note.Longitude) {
+		msg = "latitude must be between -90 and 90, longitude between -180 and 180"
+		return
+	}
+	if note.Accuracy != nil {
+		if note.Latitude == nil {
+			msg = "accuracy requires latitude and longitude"
+			return
+		}
+		if *note.Accuracy < 0 || math.IsNaN(*note.Accuracy) {
+			msg = "accuracy must not be negative"
+			return
+		}
+	}
+
+	note.PlaceName = strings.TrimSpace(note.PlaceName)
+	if len(note.PlaceName) > PlaceNameMaxLength {
+		msg = fmt.Sprintf("placeName must not be longer than %d characters", PlaceNameMaxLength)
+		return
+	}
+
+	changed = !sameFloat(note.Latitude, noteFinal.Latitude) || !sameFloat(note.Longitude, noteFinal.Longitude) ||
+		!sameFloat(note.Accuracy, noteFinal.Accuracy) || note.PlaceName != noteFinal.PlaceName
+
+	noteFinal.Latitude = note.Latitude
+	noteFinal.Longitude = note.Longitude
+	noteFinal.Accuracy = note.Accuracy
+	noteFinal.PlaceName = note.PlaceName
+	return
+}
+
+// sameFloat compares two optional numbers
+func sameFloat(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"apidev/database/model"
+)
+
+// auth IDs of the note tests: the author of the notes, another user
+// and a user without profile
+const (
+	noteAuthor   uint64 = 1
+	noteStranger uint64 = 2
+	noteNobody   uint64 = 3
+)
+
+func setupNotes(t *testing.T) model.Note {
+	t.Helper()
+
+	useMemoryStores(t)
+	createProfile(t, noteAuthor, "author")
+	createProfile(t, noteStranger, "stranger")
+	return createNote(t, noteAuthor, "groceries")
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+func TestGetNote(t *testing.T) {
+	note := setupNotes(t)
+	id := strconv.FormatUint(note.NoteID, 10)
+
+	tests := []struct {
+		name   string
+		authID uint64
+		id     string
+		as     string
+		want   int
+	}{
+		{"author", noteAuthor, id, "", http.StatusOK},
+		{"converted", noteAuthor, id, "html", http.StatusOK},
+		{"unknown format", noteAuthor, id, "pdf", http.StatusBadRequest},
+		{"note of another user", noteStranger, id, "", http.StatusNotFound},
+		{"missing note", noteAuthor, "999", "", http.StatusNotFound},
+		{"invalid ID", noteAuthor, "abc", "", http.StatusNotFound},
+		{"no profile", noteNobody, id, "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := GetNote(tt.authID, tt.id, tt.as)
+			if statusCode != tt.want {
+				t.Errorf("GetNote() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNote(t *testing.T) {
+	setupNotes(t)
+	workspaceID := uint64(999)
+
+	tests := []struct {
+		name   string
+		authID uint64
+		note   model.Note
+		want   int
+	}{
+		{"plaintext", noteAuthor, model.Note{Title: "todo", Body: "milk"}, http.StatusCreated},
+		{"markdown", noteAuthor, model.Note{Title: "todo", Body: "# milk", ContentType: "markdown"}, http.StatusCreated},
+		{"location", noteAuthor, model.Note{Title: "todo", Latitude: float(52.5), Longitude: float(13.4), Accuracy: float(10)}, http.StatusCreated},
+		{"e2ee", noteAuthor, model.Note{E2EE: true, Ciphertext: "c2VjcmV0", Algorithm: "AES-256-GCM", KeyID: "k1", Nonce: "bm9uY2U="}, http.StatusCreated},
+		{"no title", noteAuthor, model.Note{Title: "  ", Body: "milk"}, http.StatusBadRequest},
+		{"unknown content type", noteAuthor, model.Note{Title: "todo", ContentType: "pdf"}, http.StatusBadRequest},
+		{"latitude without longitude", noteAuthor, model.Note{Title: "todo", Latitude: float(52.5)}, http.StatusBadRequest},
+		{"latitude out of range", noteAuthor, model.Note{Title: "todo", Latitude: float(91), Longitude: float(0)}, http.StatusBadRequest},
+		{"negative accuracy", noteAuthor, model.Note{Title: "todo", Latitude: float(0), Longitude: float(0), Accuracy: float(-1)}, http.StatusBadRequest},
+		{"place name too long", noteAuthor, model.Note{Title: "todo", PlaceName: strings.Repeat("x", PlaceNameMaxLength+1)}, http.StatusBadRequest},
+		{"e2ee without ciphertext", noteAuthor, model.Note{E2EE: true, Algorithm: "AES-256-GCM", KeyID: "k1", Nonce: "bm9uY2U="}, http.StatusBadRequest},
+		{"workspace of others", noteAuthor, model.Note{Title: "todo", IDWorkspace: &workspaceID}, http.StatusForbidden},
+		{"no profile", noteNobody, model.Note{Title: "todo"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := CreateNote(tt.authID, tt.note, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Fatalf("CreateNote() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+			if statusCode != http.StatusCreated {
+				return
+			}
+			created := resp.Message.(model.Note)
+			if created.NoteID == 0 || created.Version != 1 || created.Position == "" {
+				t.Errorf("CreateNote() = %+v, want an ID, version 1 and a position", created)
+			}
+		})
+	}
+}
+
+func TestUpdateNote(t *testing.T) {
+	note := setupNotes(t)
+	id := strconv.FormatUint(note.NoteID, 10)
+
+	tests := []struct {
+		name   string
+		authID uint64
+		id     string
+		note   model.Note
+		want   int
+	}{
+		{"note of another user", noteStranger, id, model.Note{Title: "stolen"}, http.StatusForbidden},
+		{"missing note", noteAuthor, "999", model.Note{Title: "lost"}, http.StatusForbidden},
+		{"no profile", noteNobody, id, model.Note{Title: "lost"}, http.StatusForbidden},
+		{"no title", noteAuthor, id, model.Note{Title: ""}, http.StatusBadRequest},
+		{"switch to e2ee", noteAuthor, id, model.Note{E2EE: true, Ciphertext: "c2VjcmV0", Algorithm: "AES-256-GCM", KeyID: "k1", Nonce: "bm9uY2U="}, http.StatusBadRequest},
+		{"unchanged", noteAuthor, id, model.Note{Title: note.Title}, http.StatusBadRequest},
+		{"author", noteAuthor, id, model.Note{Title: "groceries", Body: "milk"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := UpdateNote(tt.authID, tt.id, tt.note, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("UpdateNote() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	stored, err := noteStore.FindByID(note.NoteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Body != "milk" || stored.Version != 2 {
+		t.Errorf("stored note = %q version %d, want %q version 2", stored.Body, stored.Version, "milk")
+	}
+}
+
+func TestDeleteNote(t *testing.T) {
+	note := setupNotes(t)
+	id := strconv.FormatUint(note.NoteID, 10)
+
+	tests := []struct {
+		name   string
+		authID uint64
+		id     string
+		want   int
+	}{
+		{"note of another user", noteStranger, id, http.StatusForbidden},
+		{"missing note", noteAuthor, "999", http.StatusForbidden},
+		{"no profile", noteNobody, id, http.StatusForbidden},
+		{"author", noteAuthor, id, http.StatusOK},
+		{"deleted already", noteAuthor, id, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := DeleteNote(tt.authID, tt.id, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("DeleteNote() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	if _, statusCode := GetNote(noteAuthor, id, ""); statusCode != http.StatusNotFound {
+		t.Errorf("GetNote() of a deleted note = %d, want %d", statusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,440 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	gmiddleware "github.com/pilinux/gorest/lib/middleware"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/oauthclient"
+)
+
+// OAuthProviders returns the names of the providers of the social login
+// in sorted order
+func OAuthProviders() []string {
+	names := make([]string, 0, len(oauthProviders))
+	for name := range oauthProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetOAuthProviders handles jobs for controller.GetOAuthProviders
+func GetOAuthProviders() (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	httpResponse.Message = OAuthProviders()
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// StartOAuthLogin handles jobs for controller.OAuthLogin and
+// controller.LinkOAuthProvider
+//
+// - userIDAuth: 0 to sign in, otherwise the logged-in user linking
+// the provider to their account
+// - returns the URL of the provider, the state and the PKCE verifier
+// are kept until the callback
+func StartOAuthLogin(userIDAuth uint64, name string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		httpResponse.Message = "unknown provider"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if userIDAuth != 0 {
+		identities, err := identityStore.FindIdentities(userIDAuth)
+		if err != nil {
+			log.WithError(err).Error("error code: 2001")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		for _, identity := range identities {
+			if identity.Provider == name {
+				httpResponse.Message = "provider is linked already"
+				httpStatusCode = http.StatusConflict
+				return
+			}
+		}
+	}
+
+	state, err := oauthclient.NewState()
+	if err != nil {
+		log.WithError(err).Error("error code: 2002")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	verifier, err := oauthclient.NewVerifier()
+	if err != nil {
+		log.WithError(err).Error("error code: 2002")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), oauthclient.RequestTimeout)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, state, verifier)
+	if err != nil {
+		log.WithError(err).Error("error code: 2003")
+		httpResponse.Message = "provider is not available"
+		httpStatusCode = http.StatusBadGateway
+		return
+	}
+
+	err = identityStore.SaveOAuthState(model.OAuthState{
+		State:     state,
+		Provider:  name,
+		Verifier:  verifier,
+		IDAuth:    userIDAuth,
+		ExpiresAt: time.Now().Add(oauthStateTTL),
+	})
+	if err != nil {
+		log.WithError(err).Error("error code: 2004")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = model.OAuthLogin{URL: authURL}
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// OAuthCallback handles jobs for controller.OAuthCallback
+//
+// - params: query of the callback, code and state or error
+// - signs the user in and returns JWTs like gcontroller.Login,
+// the account is created with the first login
+// - for a link started by a logged-in user, returns the linked identity
+func OAuthCallback(name string, params url.Values, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	provider, ok := oauthProviders[name]
+	if !ok {
+		httpResponse.Message = "unknown provider"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	// each login is completed once
+	state, err := identityStore.TakeOAuthState(params.Get("state"))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2011")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err != nil || state.Provider != name || !state.ExpiresAt.After(time.Now()) {
+		httpResponse.Message = "login is invalid or expired, please start again"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	if reason := params.Get("error"); reason != "" {
+		httpResponse.Message = "login was denied by the provider: " + reason
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	code := params.Get("code")
+	if code == "" {
+		httpResponse.Message = "code is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*oauthclient.RequestTimeout)
+	defer cancel()
+	accessToken, err := provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		log.WithError(err).Error("error code: 2012")
+		httpResponse.Message = "login could not be confirmed by the provider"
+		httpStatusCode = http.StatusBadGateway
+		return
+	}
+	identity, err := provider.Identity(ctx, accessToken)
+	if err != nil {
+		log.WithError(err).Error("error code: 2013")
+		httpResponse.Message = "login could not be confirmed by the provider"
+		httpStatusCode = http.StatusBadGateway
+		return
+	}
+
+	if state.IDAuth != 0 {
+		return linkIdentity(state.IDAuth, name, identity, client)
+	}
+	return signInWithIdentity(name, identity, client)
+}
+
+// signInWithIdentity issues JWTs to the account linked to an identity,
+// or to a new account if it is not linked yet
+func signInWithIdentity(name string, identity oauthclient.Identity, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	var auth gmodel.Auth
+
+	linked, err := identityStore.FindIdentity(name, identity.Subject)
+	switch {
+	case err == nil:
+		auth, err = credentialStore.FindAuth(linked.IDAuth)
+		if errors.Is(err, store.ErrNotFound) {
+			httpResponse.Message = "account not found"
+			httpStatusCode = http.StatusUnauthorized
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("error code: 2015")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+
+	case errors.Is(err, store.ErrNotFound):
+		auth, httpResponse, httpStatusCode = createOAuthAccount(name, identity, client)
+		if httpStatusCode != 0 {
+			return
+		}
+
+	default:
+		log.WithError(err).Error("error code: 2014")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	_, err = suspensionStore.FindSuspension(auth.AuthID)
+	if err == nil {
+		httpResponse.Message = "account is suspended"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2018")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// encrypted by gorest or not saved with the credentials
+	email := auth.Email
+	if email == "" && identity.EmailVerified {
+		email = identity.Email
+	}
+
+	payload, err := issueJWT(auth.AuthID, email, false)
+	if err != nil {
+		log.WithError(err).Error("error code: 2019")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := TrackSession("", "", payload, client); err != nil {
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = payload
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// createOAuthAccount creates the credentials of a user signing in
+// with an identity for the first time
+//
+// - the verified email of the identity is saved with the credentials
+// unless gorest encrypts them, an account with the same email must
+// be linked by its user instead
+// - nobody knows the password, the user can set one by recovering it
+func createOAuthAccount(name string, identity oauthclient.Identity, client model.ClientInfo) (auth gmodel.Auth, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	now := time.Now()
+	auth = gmodel.Auth{
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		VerifyEmail: gmodel.EmailVerifyNotRequired,
+	}
+
+	if identity.Email != "" && identity.EmailVerified && !gconfig.GetConfig().Security.MustCipher {
+		_, err := credentialStore.FindAuthByEmail(identity.Email)
+		if err == nil {
+			httpResponse.Message = "an account with this email exists, log in and link " + name + " to it"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 2016")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		auth.Email = identity.Email
+		auth.VerifyEmail = gmodel.EmailVerified
+	}
+
+	_, hash, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("error code: 2017")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	auth.Password = hash
+
+	linked := model.AuthIdentity{
+		Provider:  name,
+		Subject:   identity.Subject,
+		CreatedAt: now,
+		Email:     identity.Email,
+	}
+	err = credentialStore.CreateAuth(&auth, &linked)
+	if errors.Is(err, store.ErrConflict) {
+		// a concurrent first login with the same identity
+		httpResponse.Message = "login is in progress, please try again"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2017")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(auth.AuthID, AuditAccountCreate, auth.AuthID, nil, linked, client)
+	return
+}
+
+// linkIdentity links an identity to the account of a logged-in user
+func linkIdentity(userIDAuth uint64, name string, identity oauthclient.Identity, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	linked := model.AuthIdentity{
+		Provider:  name,
+		Subject:   identity.Subject,
+		IDAuth:    userIDAuth,
+		CreatedAt: time.Now(),
+		Email:     identity.Email,
+	}
+	err := identityStore.CreateIdentity(&linked)
+	if errors.Is(err, store.ErrConflict) {
+		httpResponse.Message = "this " + name + " account is linked already"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2021")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountLink, userIDAuth, nil, linked, client)
+
+	httpResponse.Message = linked
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// GetOAuthIdentities handles jobs for controller.GetOAuthIdentities
+func GetOAuthIdentities(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	identities, err := identityStore.FindIdentities(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2031")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = identities
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteOAuthIdentity handles jobs for controller.DeleteOAuthIdentity
+//
+// the last identity of an account without email is kept,
+// its user could not log in anymore
+func DeleteOAuthIdentity(userIDAuth uint64, name string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	identities, err := identityStore.FindIdentities(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2041")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	var linked *model.AuthIdentity
+	for i := range identities {
+		if identities[i].Provider == name {
+			linked = &identities[i]
+		}
+	}
+	if linked == nil {
+		httpResponse.Message = "provider is not linked"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if len(identities) == 1 {
+		auth, err := credentialStore.FindAuth(userIDAuth)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 2042")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if auth.Email == "" && auth.EmailCipher == "" {
+			httpResponse.Message = "the last provider of an account without email cannot be unlinked"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+	}
+
+	if err := identityStore.DeleteIdentity(userIDAuth, name); err != nil {
+		log.WithError(err).Error("error code: 2043")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountUnlink, userIDAuth, *linked, nil, client)
+
+	httpResponse.Message = "provider " + name + " unlinked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// issueJWT returns the access and refresh JWTs of an account
+// with the claims set by gcontroller.Login
+//
+// - secondFactor: the login proved a second factor, the claims are those
+// of gcontroller.Validate2FA if 2FA is enabled for the account
+func issueJWT(authID uint64, email string, secondFactor bool) (payload gmodel.JWTPayload, err error) {
+	claims := gmiddleware.MyCustomClaims{
+		AuthID: authID,
+		Email:  email,
+	}
+
+	// gmiddleware.TwoFA asks for the second factor
+	// if it is enabled for the account
+	configure := gconfig.GetConfig()
+	if configure.Security.Must2FA == gconfig.Activated {
+		twoFA, err := credentialStore.FindTwoFA(authID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return payload, err
+		}
+		claims.TwoFA = twoFA.Status
+		if secondFactor && twoFA.Status == configure.Security.TwoFA.Status.On {
+			claims.TwoFA = configure.Security.TwoFA.Status.Verified
+		}
+	}
+	payload.TwoAuth = claims.TwoFA
+
+	if payload.AccessJWT, _, err = gmiddleware.GetJWT(claims, "access"); err != nil {
+		return
+	}
+	payload.RefreshJWT, _, err = gmiddleware.GetJWT(claims, "refresh")
+	return
+}
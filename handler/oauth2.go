@@ -0,0 +1,855 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/oauthclient"
+	"apidev/lib/scope"
+)
+
+// prefixes of the tokens issued by the OAuth2 authorization server,
+// a token is the prefix, the token ID, "_" and the secret
+const (
+	OAuthAccessTokenPrefix  = "oat_"
+	OAuthRefreshTokenPrefix = "ort_"
+)
+
+// limits of OAuth2 clients
+const (
+	OAuthClientNameMaxLength  = 100
+	OAuthClientMaxCount       = 20
+	OAuthRedirectURIMaxCount  = 10
+	OAuthRedirectURIMaxLength = 500
+	OAuthStateMaxLength       = 500
+)
+
+// error codes of the OAuth2 endpoints, RFC 6749 section 4.1.2.1 and 5.2
+const (
+	oauthInvalidRequest       = "invalid_request"
+	oauthInvalidClient        = "invalid_client"
+	oauthInvalidGrant         = "invalid_grant"
+	oauthInvalidScope         = "invalid_scope"
+	oauthAccessDenied         = "access_denied"
+	oauthUnsupportedGrantType = "unsupported_grant_type"
+	oauthUnsupportedResponse  = "unsupported_response_type"
+	oauthServerError          = "server_error"
+)
+
+// GetOAuthClients handles jobs for controller.GetOAuthClients
+func GetOAuthClients(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	clients, err := oauthServerStore.FindClients(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2101")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = clients
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CreateOAuthClient handles jobs for controller.CreateOAuthClient
+//
+// - the secret of a confidential client is only returned in this response
+// - redirect URIs are https, http on localhost, or the custom scheme of a
+// native app named after a domain (RFC 8252), they are matched exactly
+func CreateOAuthClient(userIDAuth uint64, oauthClient model.OAuthClient, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	clientFinal := model.OAuthClient{
+		IDAuth:       userIDAuth,
+		Name:         strings.TrimSpace(oauthClient.Name),
+		RedirectURIs: []string{},
+		Confidential: oauthClient.Confidential,
+	}
+
+	if clientFinal.Name == "" {
+		httpResponse.Message = "name is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if utf8.RuneCountInString(clientFinal.Name) > OAuthClientNameMaxLength {
+		httpResponse.Message = fmt.Sprintf("name must not exceed %d characters", OAuthClientNameMaxLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, redirectURI := range oauthClient.RedirectURIs {
+		redirectURI = strings.TrimSpace(redirectURI)
+		if !validRedirectURI(redirectURI) {
+			httpResponse.Message = "redirect URI " + redirectURI + " must be https, http on localhost or a custom scheme like com.example.app, without fragment"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		if !seen[redirectURI] {
+			seen[redirectURI] = true
+			clientFinal.RedirectURIs = append(clientFinal.RedirectURIs, redirectURI)
+		}
+	}
+	if len(clientFinal.RedirectURIs) == 0 || len(clientFinal.RedirectURIs) > OAuthRedirectURIMaxCount {
+		httpResponse.Message = fmt.Sprintf("1 to %d redirect URIs are required", OAuthRedirectURIMaxCount)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	clients, err := oauthServerStore.FindClients(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2111")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if len(clients) >= OAuthClientMaxCount {
+		httpResponse.Message = fmt.Sprintf("no more than %d clients are allowed, delete an unused one", OAuthClientMaxCount)
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	clientFinal.ClientID, err = newClientID()
+	if err != nil {
+		log.WithError(err).Error("error code: 2112")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	secret := ""
+	if clientFinal.Confidential {
+		secret, clientFinal.Hash, err = newSecret()
+		if err != nil {
+			log.WithError(err).Error("error code: 2112")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+	}
+	clientFinal.CreatedAt = time.Now()
+
+	// save in DB
+	if err := oauthServerStore.CreateClient(&clientFinal); err != nil {
+		log.WithError(err).Error("error code: 2113")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountRegisterClient, userIDAuth, nil, clientFinal, client)
+
+	clientFinal.Secret = secret
+	httpResponse.Message = clientFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// DeleteOAuthClient handles jobs for controller.DeleteOAuthClient
+//
+// all tokens issued to the client are revoked
+func DeleteOAuthClient(userIDAuth uint64, clientID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	oauthClient, err := oauthServerStore.FindClient(clientID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2121")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err != nil || oauthClient.IDAuth != userIDAuth {
+		httpResponse.Message = "client not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if err := oauthServerStore.DeleteClient(clientID); err != nil {
+		log.WithError(err).Error("error code: 2122")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountUnregisterClient, userIDAuth, oauthClient, nil, client)
+
+	httpResponse.Message = "client " + clientID + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// StartAuthorization handles jobs for controller.Authorize
+//
+// - params: query of the authorization request, RFC 6749 section 4.1.1,
+// PKCE with S256 is required (RFC 7636)
+// - returns the request to show to the user for consent
+// - once the client and the redirect URI are verified, errors are
+// returned as the redirect to the client
+func StartAuthorization(userIDAuth uint64, params url.Values) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	oauthClient, err := oauthServerStore.FindClient(params.Get("client_id"))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2131")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err != nil {
+		httpResponse.Message = "unknown client_id"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// without a redirect URI, the only one registered
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(oauthClient.RedirectURIs) == 1 {
+		redirectURI = oauthClient.RedirectURIs[0]
+	}
+	registered := false
+	for _, uri := range oauthClient.RedirectURIs {
+		if uri == redirectURI {
+			registered = true
+		}
+	}
+	if !registered {
+		httpResponse.Message = "redirect_uri is not registered for this client"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	state := params.Get("state")
+	if len(state) > OAuthStateMaxLength {
+		httpResponse.Message = fmt.Sprintf("state must not exceed %d characters", OAuthStateMaxLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if params.Get("response_type") != "code" {
+		return oauthRedirect(redirectURI, url.Values{"error": {oauthUnsupportedResponse}, "state": {state}})
+	}
+	challenge := params.Get("code_challenge")
+	if params.Get("code_challenge_method") != "S256" || len(challenge) != 43 {
+		return oauthRedirect(redirectURI, url.Values{
+			"error":             {oauthInvalidRequest},
+			"error_description": {"code_challenge with code_challenge_method S256 is required"},
+			"state":             {state},
+		})
+	}
+	scopes, ok := normalizeScopes(strings.Fields(params.Get("scope")))
+	if !ok {
+		return oauthRedirect(redirectURI, url.Values{
+			"error":             {oauthInvalidScope},
+			"error_description": {"scope must be one or more of " + strings.Join(scope.Scopes(), " ")},
+			"state":             {state},
+		})
+	}
+
+	// the request waits for the consent, bound to the user
+	secret, hash, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("error code: 2132")
+		return oauthRedirect(redirectURI, url.Values{"error": {oauthServerError}, "state": {state}})
+	}
+	code := model.OAuthCode{
+		ClientID:    oauthClient.ClientID,
+		IDAuth:      userIDAuth,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+		State:       state,
+		Challenge:   challenge,
+		Hash:        hash,
+		ExpiresAt:   time.Now().Add(config.GetConfig().OAuth2.CodeTTL),
+	}
+	if err := oauthServerStore.CreateOAuthCode(&code); err != nil {
+		log.WithError(err).Error("error code: 2133")
+		return oauthRedirect(redirectURI, url.Values{"error": {oauthServerError}, "state": {state}})
+	}
+
+	httpResponse.Message = model.OAuthConsent{
+		Consent:     strconv.FormatUint(code.CodeID, 10) + "_" + secret,
+		ClientID:    oauthClient.ClientID,
+		ClientName:  oauthClient.Name,
+		RedirectURI: redirectURI,
+		Scopes:      scopes,
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CompleteAuthorization handles jobs for controller.Consent
+//
+// - returns the redirect to the client with the authorization code,
+// or access_denied if the user declined
+func CompleteAuthorization(userIDAuth uint64, decision model.OAuthDecision, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	request, err := findOAuthCode(decision.Consent)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2141")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err != nil || request.Approved || request.IDAuth != userIDAuth || !request.ExpiresAt.After(time.Now()) {
+		httpResponse.Message = "authorization request is invalid or expired, please start again"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// each request is decided once
+	if _, err := oauthServerStore.TakeOAuthCode(request.CodeID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpResponse.Message = "authorization request is invalid or expired, please start again"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		log.WithError(err).Error("error code: 2142")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if !decision.Approve {
+		return oauthRedirect(request.RedirectURI, url.Values{"error": {oauthAccessDenied}, "state": {request.State}})
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("error code: 2143")
+		return oauthRedirect(request.RedirectURI, url.Values{"error": {oauthServerError}, "state": {request.State}})
+	}
+	code := request
+	code.CodeID = 0
+	code.Approved = true
+	code.Hash = hash
+	code.ExpiresAt = time.Now().Add(config.GetConfig().OAuth2.CodeTTL)
+	if err := oauthServerStore.CreateOAuthCode(&code); err != nil {
+		log.WithError(err).Error("error code: 2144")
+		return oauthRedirect(request.RedirectURI, url.Values{"error": {oauthServerError}, "state": {request.State}})
+	}
+
+	clientName := ""
+	if oauthClient, err := oauthServerStore.FindClient(code.ClientID); err == nil {
+		clientName = oauthClient.Name
+	}
+	appendAccountEvent(userIDAuth, AuditAccountAuthorize, userIDAuth, nil, model.OAuthAuthorization{
+		ClientID:   code.ClientID,
+		ClientName: clientName,
+		Scopes:     code.Scopes,
+	}, client)
+
+	return oauthRedirect(code.RedirectURI, url.Values{
+		"code":  {strconv.FormatUint(code.CodeID, 10) + "_" + secret},
+		"state": {code.State},
+	})
+}
+
+// IssueOAuthTokens handles jobs for controller.OAuthToken
+//
+// - params: form of the token request, grant types authorization_code
+// (RFC 6749 section 4.1.3) and refresh_token (section 6)
+// - clientID, clientSecret: credentials of the client, from HTTP Basic
+// authentication or the form
+// - every refresh returns a new refresh token, the used one is revoked
+// with the access tokens issued with it
+func IssueOAuthTokens(params url.Values, clientID, clientSecret string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	oauthClient, ok, err := authenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.WithError(err).Error("error code: 2151")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+	if !ok {
+		return oauthError(http.StatusUnauthorized, oauthInvalidClient, "client authentication failed")
+	}
+
+	now := time.Now()
+	var authID uint64
+	var scopes []string
+
+	switch params.Get("grant_type") {
+	case "authorization_code":
+		code, err := findOAuthCode(params.Get("code"))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 2152")
+			return oauthError(http.StatusInternalServerError, oauthServerError, "")
+		}
+		if err != nil || !code.Approved || code.ClientID != oauthClient.ClientID || !code.ExpiresAt.After(now) {
+			return oauthError(http.StatusBadRequest, oauthInvalidGrant, "code is invalid or expired")
+		}
+		// PKCE binds the code to the client which started the request,
+		// a redirect URI sent along must still match
+		if redirectURI := params.Get("redirect_uri"); redirectURI != "" && redirectURI != code.RedirectURI {
+			return oauthError(http.StatusBadRequest, oauthInvalidGrant, "redirect_uri does not match the authorization request")
+		}
+		if oauthclient.Challenge(params.Get("code_verifier")) != code.Challenge {
+			return oauthError(http.StatusBadRequest, oauthInvalidGrant, "code_verifier does not match the code_challenge")
+		}
+
+		// each code is exchanged once
+		if _, err := oauthServerStore.TakeOAuthCode(code.CodeID); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return oauthError(http.StatusBadRequest, oauthInvalidGrant, "code is invalid or expired")
+			}
+			log.WithError(err).Error("error code: 2153")
+			return oauthError(http.StatusInternalServerError, oauthServerError, "")
+		}
+		authID, scopes = code.IDAuth, code.Scopes
+
+	case "refresh_token":
+		refresh, err := findOAuthToken(params.Get("refresh_token"), OAuthRefreshTokenPrefix)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.WithError(err).Error("error code: 2154")
+			return oauthError(http.StatusInternalServerError, oauthServerError, "")
+		}
+		if err != nil || refresh.ClientID != oauthClient.ClientID || !refresh.ExpiresAt.After(now) {
+			return oauthError(http.StatusBadRequest, oauthInvalidGrant, "refresh_token is invalid or expired")
+		}
+
+		// narrowed down, never widened
+		scopes = refresh.Scopes
+		if requested := strings.Fields(params.Get("scope")); len(requested) > 0 {
+			for _, s := range requested {
+				if !scope.Allowed(refresh.Scopes, scope.Scope(s)) {
+					return oauthError(http.StatusBadRequest, oauthInvalidScope, "scope exceeds the scope granted by the user")
+				}
+			}
+			scopes, _ = normalizeScopes(requested)
+		}
+
+		if err := oauthServerStore.DeleteOAuthToken(refresh.TokenID); err != nil {
+			log.WithError(err).Error("error code: 2155")
+			return oauthError(http.StatusInternalServerError, oauthServerError, "")
+		}
+		authID = refresh.IDAuth
+
+	default:
+		return oauthError(http.StatusBadRequest, oauthUnsupportedGrantType, "grant_type must be authorization_code or refresh_token")
+	}
+
+	_, err = suspensionStore.FindSuspension(authID)
+	if err == nil {
+		return oauthError(http.StatusBadRequest, oauthInvalidGrant, "account is suspended")
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2156")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+
+	configureOAuth2 := config.GetConfig().OAuth2
+	refresh := model.OAuthToken{
+		Kind:      model.OAuthTokenRefresh,
+		ClientID:  oauthClient.ClientID,
+		IDAuth:    authID,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(configureOAuth2.RefreshTokenTTL),
+	}
+	refreshToken, err := createOAuthToken(&refresh, OAuthRefreshTokenPrefix)
+	if err != nil {
+		log.WithError(err).Error("error code: 2157")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+	access := model.OAuthToken{
+		Kind:      model.OAuthTokenAccess,
+		ClientID:  oauthClient.ClientID,
+		IDAuth:    authID,
+		IDRefresh: refresh.TokenID,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(configureOAuth2.AccessTokenTTL),
+	}
+	accessToken, err := createOAuthToken(&access, OAuthAccessTokenPrefix)
+	if err != nil {
+		log.WithError(err).Error("error code: 2157")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+
+	httpResponse.Message = model.OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(configureOAuth2.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// RevokeOAuthToken handles jobs for controller.RevokeOAuthToken
+//
+// - params: form of the revocation request, RFC 7009 section 2.1
+// - revoking a refresh token revokes the access tokens issued with it
+// - unknown tokens and tokens of other clients are ignored
+func RevokeOAuthToken(params url.Values, clientID, clientSecret string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	oauthClient, ok, err := authenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.WithError(err).Error("error code: 2161")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+	if !ok {
+		return oauthError(http.StatusUnauthorized, oauthInvalidClient, "client authentication failed")
+	}
+	if params.Get("token") == "" {
+		return oauthError(http.StatusBadRequest, oauthInvalidRequest, "token is required")
+	}
+
+	token, err := findOAuthToken(params.Get("token"), "")
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2162")
+		return oauthError(http.StatusServiceUnavailable, oauthServerError, "")
+	}
+	if err == nil && token.ClientID == oauthClient.ClientID {
+		if err := oauthServerStore.DeleteOAuthToken(token.TokenID); err != nil {
+			log.WithError(err).Error("error code: 2163")
+			return oauthError(http.StatusServiceUnavailable, oauthServerError, "")
+		}
+	}
+
+	httpResponse.Message = "token revoked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// IntrospectOAuthToken handles jobs for controller.IntrospectOAuthToken
+//
+// - params: form of the introspection request, RFC 7662 section 2.1
+// - a client can introspect the tokens issued to it, all other tokens
+// are inactive
+func IntrospectOAuthToken(params url.Values, clientID, clientSecret string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	oauthClient, ok, err := authenticateClient(clientID, clientSecret)
+	if err != nil {
+		log.WithError(err).Error("error code: 2171")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+	if !ok {
+		return oauthError(http.StatusUnauthorized, oauthInvalidClient, "client authentication failed")
+	}
+	if params.Get("token") == "" {
+		return oauthError(http.StatusBadRequest, oauthInvalidRequest, "token is required")
+	}
+
+	httpStatusCode = http.StatusOK
+	httpResponse.Message = model.OAuthIntrospection{}
+
+	token, err := findOAuthToken(params.Get("token"), "")
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2172")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+	if err != nil || token.ClientID != oauthClient.ClientID || !token.ExpiresAt.After(time.Now()) {
+		return
+	}
+	_, err = suspensionStore.FindSuspension(token.IDAuth)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2173")
+		return oauthError(http.StatusInternalServerError, oauthServerError, "")
+	}
+
+	introspection := model.OAuthIntrospection{
+		Active:    true,
+		Scope:     strings.Join(token.Scopes, " "),
+		ClientID:  token.ClientID,
+		Subject:   strconv.FormatUint(token.IDAuth, 10),
+		ExpiresAt: token.ExpiresAt.Unix(),
+		IssuedAt:  token.CreatedAt.Unix(),
+	}
+	if token.Kind == model.OAuthTokenAccess {
+		introspection.TokenType = "Bearer"
+	}
+	httpResponse.Message = introspection
+	return
+}
+
+// GetOAuthAuthorizations handles jobs for controller.GetOAuthAuthorizations
+//
+// the clients holding unexpired tokens of the user, with the scopes
+// granted to them
+func GetOAuthAuthorizations(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	authorizations, err := findOAuthAuthorizations(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2181")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = authorizations
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteOAuthAuthorization handles jobs for controller.DeleteOAuthAuthorization
+//
+// revokes all tokens of the user issued to the client
+func DeleteOAuthAuthorization(userIDAuth uint64, clientID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	authorizations, err := findOAuthAuthorizations(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2182")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	var authorization *model.OAuthAuthorization
+	for i := range authorizations {
+		if authorizations[i].ClientID == clientID {
+			authorization = &authorizations[i]
+		}
+	}
+	if authorization == nil {
+		httpResponse.Message = "authorization not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if err := oauthServerStore.DeleteOAuthTokens(userIDAuth, clientID); err != nil {
+		log.WithError(err).Error("error code: 2183")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendAccountEvent(userIDAuth, AuditAccountDeauthorize, userIDAuth, *authorization, nil, client)
+
+	httpResponse.Message = "client " + clientID + " deauthorized!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CheckOAuthToken handles jobs for controller.AccessToken
+// for access tokens issued to OAuth2 clients
+//
+// - raw: the token sent by the client
+// - required: the scope the requested route is covered by
+func CheckOAuthToken(raw string, required scope.Scope) (token model.OAuthToken, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	token, err := findOAuthToken(raw, OAuthAccessTokenPrefix)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid access token"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2191")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if !token.ExpiresAt.After(time.Now()) {
+		httpResponse.Message = "access token is expired"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if !scope.Allowed(token.Scopes, required) {
+		httpResponse.Message = "access token lacks the scope " + string(required)
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	_, err = suspensionStore.FindSuspension(token.IDAuth)
+	if err == nil {
+		httpResponse.Message = "account is suspended"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2192")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// findOAuthAuthorizations groups the unexpired tokens of a user by client
+// in the order the clients were first authorized
+func findOAuthAuthorizations(userIDAuth uint64) ([]model.OAuthAuthorization, error) {
+	tokens, err := oauthServerStore.FindOAuthTokens(userIDAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	authorizations := []model.OAuthAuthorization{}
+	index := map[string]int{}
+	for _, token := range tokens {
+		if !token.ExpiresAt.After(now) {
+			continue
+		}
+		i, ok := index[token.ClientID]
+		if !ok {
+			oauthClient, err := oauthServerStore.FindClient(token.ClientID)
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			i = len(authorizations)
+			index[token.ClientID] = i
+			authorizations = append(authorizations, model.OAuthAuthorization{
+				ClientID:   oauthClient.ClientID,
+				ClientName: oauthClient.Name,
+				Scopes:     []string{},
+				CreatedAt:  token.CreatedAt,
+			})
+		}
+		authorizations[i].Scopes, _ = normalizeScopes(append(authorizations[i].Scopes, token.Scopes...))
+	}
+	return authorizations, nil
+}
+
+// authenticateClient returns the client of the credentials, false if they
+// are wrong, confidential clients must send their secret, public clients
+// must not send one
+func authenticateClient(clientID, clientSecret string) (model.OAuthClient, bool, error) {
+	oauthClient, err := oauthServerStore.FindClient(clientID)
+	if errors.Is(err, store.ErrNotFound) {
+		return model.OAuthClient{}, false, nil
+	}
+	if err != nil {
+		return model.OAuthClient{}, false, err
+	}
+
+	if !oauthClient.Confidential {
+		return oauthClient, clientSecret == "", nil
+	}
+	if clientSecret == "" {
+		return model.OAuthClient{}, false, nil
+	}
+	match, err := matchSecret(clientSecret, oauthClient.Hash)
+	if err != nil || !match {
+		return model.OAuthClient{}, false, err
+	}
+	return oauthClient, true, nil
+}
+
+// findOAuthCode returns the authorization request of a consent
+// or code, ErrNotFound if it is malformed, unknown or the secret is wrong
+func findOAuthCode(raw string) (model.OAuthCode, error) {
+	codeID, secret, ok := splitSecret(raw)
+	if !ok {
+		return model.OAuthCode{}, store.ErrNotFound
+	}
+	code, err := oauthServerStore.FindOAuthCode(codeID)
+	if err != nil {
+		return model.OAuthCode{}, err
+	}
+	match, err := matchSecret(secret, code.Hash)
+	if err != nil {
+		return model.OAuthCode{}, err
+	}
+	if !match {
+		return model.OAuthCode{}, store.ErrNotFound
+	}
+	return code, nil
+}
+
+// findOAuthToken returns the token matching a raw token with the prefix,
+// or with any prefix of the authorization server if it is empty,
+// ErrNotFound if it is malformed, unknown or the secret is wrong
+func findOAuthToken(raw, prefix string) (model.OAuthToken, error) {
+	kind := ""
+	switch {
+	case strings.HasPrefix(raw, OAuthAccessTokenPrefix) && prefix != OAuthRefreshTokenPrefix:
+		kind, raw = model.OAuthTokenAccess, strings.TrimPrefix(raw, OAuthAccessTokenPrefix)
+	case strings.HasPrefix(raw, OAuthRefreshTokenPrefix) && prefix != OAuthAccessTokenPrefix:
+		kind, raw = model.OAuthTokenRefresh, strings.TrimPrefix(raw, OAuthRefreshTokenPrefix)
+	default:
+		return model.OAuthToken{}, store.ErrNotFound
+	}
+
+	tokenID, secret, ok := splitSecret(raw)
+	if !ok {
+		return model.OAuthToken{}, store.ErrNotFound
+	}
+	token, err := oauthServerStore.FindOAuthToken(tokenID)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+	if token.Kind != kind {
+		return model.OAuthToken{}, store.ErrNotFound
+	}
+	match, err := matchSecret(secret, token.Hash)
+	if err != nil {
+		return model.OAuthToken{}, err
+	}
+	if !match {
+		return model.OAuthToken{}, store.ErrNotFound
+	}
+	return token, nil
+}
+
+// createOAuthToken saves a new token with a random secret
+// and returns the raw token
+func createOAuthToken(token *model.OAuthToken, prefix string) (string, error) {
+	secret, hash, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	token.Hash = hash
+	if err := oauthServerStore.CreateOAuthToken(token); err != nil {
+		return "", err
+	}
+	return prefix + strconv.FormatUint(token.TokenID, 10) + "_" + secret, nil
+}
+
+// newClientID returns a random client ID
+func newClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validRedirectURI reports whether a redirect URI may be registered,
+// see CreateOAuthClient
+func validRedirectURI(raw string) bool {
+	if raw == "" || len(raw) > OAuthRedirectURIMaxLength {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		hostname := u.Hostname()
+		return hostname == "localhost" || hostname == "127.0.0.1" || hostname == "::1"
+	default:
+		return strings.Contains(u.Scheme, ".")
+	}
+}
+
+// oauthRedirect returns the redirect to the client with the parameters,
+// empty ones are left out
+func oauthRedirect(redirectURI string, params url.Values) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	for key, values := range params {
+		if len(values) == 0 || values[0] == "" {
+			params.Del(key)
+		}
+	}
+
+	separator := "?"
+	if strings.Contains(redirectURI, "?") {
+		separator = "&"
+	}
+	httpResponse.Message = model.OAuthRedirect{URL: redirectURI + separator + params.Encode()}
+	httpStatusCode = http.StatusFound
+	return
+}
+
+// oauthError returns an error of the OAuth2 endpoints
+func oauthError(statusCode int, code, description string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	httpResponse.Message = model.OAuthError{Error: code, ErrorDescription: description}
+	httpStatusCode = statusCode
+	return
+}
@@ -0,0 +1,268 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/oauthclient"
+	"apidev/lib/oauthclient/oauthclienttest"
+)
+
+const oauthProvider = "test"
+
+// useOAuthProvider injects a mock OIDC provider into the social login
+func useOAuthProvider(t *testing.T, stateTTL time.Duration) *oauthclienttest.Server {
+	t.Helper()
+
+	server := oauthclienttest.NewServer()
+	t.Cleanup(server.Close)
+
+	provider := &oauthclient.Provider{
+		Name:         oauthProvider,
+		Type:         oauthclient.TypeOIDC,
+		ClientID:     oauthclienttest.ClientID,
+		ClientSecret: oauthclienttest.ClientSecret,
+		RedirectURL:  "https://app.example.com/oauth/test/callback",
+		Issuer:       server.URL,
+		Client:       server.Client(),
+	}
+	if err := provider.SetDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	SetOAuthProviders([]*oauthclient.Provider{provider}, stateTTL)
+	return server
+}
+
+// startOAuthLogin starts a login or, for a logged-in user, a link and
+// returns the query of the callback after the consent of the user
+func startOAuthLogin(t *testing.T, server *oauthclienttest.Server, userIDAuth uint64, user oauthclienttest.User) url.Values {
+	t.Helper()
+
+	resp, statusCode := StartOAuthLogin(userIDAuth, oauthProvider)
+	if statusCode != http.StatusOK {
+		t.Fatalf("StartOAuthLogin() = %d %v", statusCode, resp.Message)
+	}
+	params, err := server.Authorize(resp.Message.(model.OAuthLogin).URL, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+// createPasswordAccount creates the credentials of a user who signed up
+// with email and password, linked to another provider to satisfy the store
+func createPasswordAccount(t *testing.T, authStore *store.MemoryAuthStore, email string) uint64 {
+	t.Helper()
+
+	auth := gmodel.Auth{Email: email, VerifyEmail: gmodel.EmailVerified}
+	if err := authStore.CreateAuth(&auth, &model.AuthIdentity{Provider: "other", Subject: email}); err != nil {
+		t.Fatal(err)
+	}
+	return auth.AuthID
+}
+
+func TestStartOAuthLogin(t *testing.T) {
+	useMemoryStores(t)
+	useOAuthProvider(t, time.Minute)
+
+	resp, statusCode := StartOAuthLogin(0, oauthProvider)
+	if statusCode != http.StatusOK {
+		t.Fatalf("StartOAuthLogin() = %d %v", statusCode, resp.Message)
+	}
+	authURL, err := url.Parse(resp.Message.(model.OAuthLogin).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := identityStore.TakeOAuthState(authURL.Query().Get("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge := authURL.Query().Get("code_challenge"); challenge != oauthclient.Challenge(state.Verifier) {
+		t.Errorf("code_challenge = %q, want the challenge of the saved verifier", challenge)
+	}
+	if method := authURL.Query().Get("code_challenge_method"); method != "S256" {
+		t.Errorf("code_challenge_method = %q, want S256", method)
+	}
+
+	if _, statusCode := StartOAuthLogin(0, "unknown"); statusCode != http.StatusNotFound {
+		t.Errorf("StartOAuthLogin() of an unknown provider = %d, want %d", statusCode, http.StatusNotFound)
+	}
+}
+
+func TestOAuthCallbackState(t *testing.T) {
+	useMemoryStores(t)
+	server := useOAuthProvider(t, time.Minute)
+	user := oauthclienttest.User{Subject: "1234"}
+
+	params := startOAuthLogin(t, server, 0, user)
+	if resp, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("OAuthCallback() = %d %v", statusCode, resp.Message)
+	}
+
+	unknown := url.Values{}
+	unknown.Set("state", "unknown")
+	unknown.Set("code", params.Get("code"))
+
+	// the verifier of the first login is not used for the code of the second
+	first := startOAuthLogin(t, server, 0, user)
+	second := startOAuthLogin(t, server, 0, user)
+	swapped := url.Values{}
+	swapped.Set("state", first.Get("state"))
+	swapped.Set("code", second.Get("code"))
+
+	denied := startOAuthLogin(t, server, 0, user)
+	denied.Del("code")
+	denied.Set("error", "access_denied")
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   int
+	}{
+		{"replayed state", params, http.StatusBadRequest},
+		{"unknown state", unknown, http.StatusBadRequest},
+		{"code of another login", swapped, http.StatusBadGateway},
+		{"denied by the user", denied, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := OAuthCallback(oauthProvider, tt.params, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("OAuthCallback() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	expired := startOAuthLogin(t, useOAuthProvider(t, -time.Second), 0, user)
+	if _, statusCode := OAuthCallback(oauthProvider, expired, model.ClientInfo{}); statusCode != http.StatusBadRequest {
+		t.Errorf("OAuthCallback() of an expired login = %d, want %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestOAuthFirstLogin(t *testing.T) {
+	useMemoryStores(t)
+	server := useOAuthProvider(t, time.Minute)
+	user := oauthclienttest.User{Subject: "1234", Email: "alice@example.com", EmailVerified: true}
+
+	params := startOAuthLogin(t, server, 0, user)
+	if resp, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("OAuthCallback() = %d %v", statusCode, resp.Message)
+	}
+	linked, err := identityStore.FindIdentity(oauthProvider, user.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth, err := credentialStore.FindAuth(linked.IDAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.Email != user.Email || auth.VerifyEmail != gmodel.EmailVerified {
+		t.Errorf("created account = %q %d, want the verified email of the identity", auth.Email, auth.VerifyEmail)
+	}
+
+	// the next login signs in to the same account
+	params = startOAuthLogin(t, server, 0, user)
+	if resp, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("OAuthCallback() = %d %v", statusCode, resp.Message)
+	}
+	identities, err := identityStore.FindIdentities(linked.IDAuth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Errorf("identities = %+v, want the identity of the first login", identities)
+	}
+	if _, err := credentialStore.FindAuth(linked.IDAuth + 1); err == nil {
+		t.Error("the next login created another account")
+	}
+}
+
+func TestOAuthEmailOfUnlinkedAccount(t *testing.T) {
+	authStore := useMemoryStores(t)
+	server := useOAuthProvider(t, time.Minute)
+	createPasswordAccount(t, authStore, "alice@example.com")
+
+	tests := []struct {
+		name string
+		user oauthclienttest.User
+		want int
+	}{
+		{"verified email", oauthclienttest.User{Subject: "1", Email: "alice@example.com", EmailVerified: true}, http.StatusConflict},
+		{"unverified email", oauthclienttest.User{Subject: "2", Email: "alice@example.com"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := startOAuthLogin(t, server, 0, tt.user)
+			resp, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Fatalf("OAuthCallback() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+
+			linked, err := identityStore.FindIdentity(oauthProvider, tt.user.Subject)
+			if statusCode == http.StatusConflict {
+				if err == nil {
+					t.Errorf("identity linked to %d, want no identity", linked.IDAuth)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the unverified email is not saved with the new account
+			auth, err := credentialStore.FindAuth(linked.IDAuth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if auth.Email != "" {
+				t.Errorf("created account with email %q, want none", auth.Email)
+			}
+		})
+	}
+}
+
+func TestOAuthLink(t *testing.T) {
+	authStore := useMemoryStores(t)
+	server := useOAuthProvider(t, time.Minute)
+	alice := createPasswordAccount(t, authStore, "alice@example.com")
+	bob := createPasswordAccount(t, authStore, "bob@example.com")
+
+	// a different email at the provider does not matter for a link
+	user := oauthclienttest.User{Subject: "1234", Email: "alice@provider.example.com", EmailVerified: true}
+	params := startOAuthLogin(t, server, alice, user)
+	resp, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{})
+	if statusCode != http.StatusCreated {
+		t.Fatalf("OAuthCallback() = %d %v, want %d", statusCode, resp.Message, http.StatusCreated)
+	}
+	linked, err := identityStore.FindIdentity(oauthProvider, user.Subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if linked.IDAuth != alice {
+		t.Errorf("identity linked to %d, want %d", linked.IDAuth, alice)
+	}
+
+	if _, statusCode := StartOAuthLogin(alice, oauthProvider); statusCode != http.StatusConflict {
+		t.Errorf("StartOAuthLogin() of a linked provider = %d, want %d", statusCode, http.StatusConflict)
+	}
+
+	// the identity of alice cannot be linked to the account of bob
+	params = startOAuthLogin(t, server, bob, user)
+	if _, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{}); statusCode != http.StatusConflict {
+		t.Errorf("OAuthCallback() of an identity linked to another account = %d, want %d", statusCode, http.StatusConflict)
+	}
+
+	// the linked identity signs in to the account of alice
+	params = startOAuthLogin(t, server, 0, user)
+	if _, statusCode := OAuthCallback(oauthProvider, params, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Errorf("OAuthCallback() = %d, want %d", statusCode, http.StatusOK)
+	}
+	if _, err := credentialStore.FindAuth(bob + 1); err == nil {
+		t.Error("the login with the linked identity created another account")
+	}
+}
@@ -0,0 +1,512 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/webauthn"
+)
+
+// limits of passkeys
+const (
+	PasskeyNameMaxLength = 100
+	PasskeyMaxCount      = 20
+)
+
+// userHandleLength - random bytes of the user handle of an account
+const userHandleLength = 32
+
+// passkeyCredentialIDMaxLength - longest base64url credential ID which
+// fits the unique index, longer ones are very rare and rejected
+const passkeyCredentialIDMaxLength = 255
+
+// BeginPasskeyRegistration handles jobs for controller.BeginPasskeyRegistration
+//
+// returns the options of navigator.credentials.create, the passkeys of
+// the account are excluded
+func BeginPasskeyRegistration(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	auth, err := credentialStore.FindAuth(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2601")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	passkeys, err := passkeyStore.FindPasskeys(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2602")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if len(passkeys) >= PasskeyMaxCount {
+		httpResponse.Message = fmt.Sprintf("no more than %d passkeys are allowed, delete an unused one", PasskeyMaxCount)
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	// all passkeys of an account have the same user handle,
+	// so that an authenticator keeps one passkey per account
+	userHandle := make([]byte, userHandleLength)
+	if len(passkeys) > 0 {
+		userHandle = passkeys[0].UserHandle
+	} else if _, err := rand.Read(userHandle); err != nil {
+		log.WithError(err).Error("error code: 2603")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	challenge, err := newPasskeyChallenge(model.PasskeyRegister, userIDAuth, userHandle)
+	if err != nil {
+		log.WithError(err).Error("error code: 2604")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// encrypted by gorest or not saved with the credentials
+	name := auth.Email
+	if name == "" {
+		name = "account " + strconv.FormatUint(userIDAuth, 10)
+	}
+	user := webauthn.UserEntity{
+		ID:          userHandle,
+		Name:        name,
+		DisplayName: name,
+	}
+
+	httpResponse.Message = relyingParty.CreationOptions(challenge, user, passkeyDescriptors(passkeys))
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// FinishPasskeyRegistration handles jobs for controller.FinishPasskeyRegistration
+//
+// - the challenge of the response must have been issued to the user
+// by BeginPasskeyRegistration
+func FinishPasskeyRegistration(userIDAuth uint64, payload model.PasskeyRegistration, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	name := strings.TrimSpace(payload.Name)
+	if name == "" {
+		name = "passkey"
+	}
+	if utf8.RuneCountInString(name) > PasskeyNameMaxLength {
+		httpResponse.Message = fmt.Sprintf("name must not exceed %d characters", PasskeyNameMaxLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	challenge, err := takePasskeyChallenge(payload.Credential.Response.ClientDataJSON, model.PasskeyRegister, userIDAuth)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid or expired challenge"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2611")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	credential, err := relyingParty.VerifyRegistration(challenge.raw, payload.Credential)
+	if err != nil {
+		log.WithError(err).Info("passkey registration rejected")
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	passkey := model.Passkey{
+		CreatedAt:      time.Now(),
+		IDAuth:         userIDAuth,
+		Name:           name,
+		CredentialID:   base64.RawURLEncoding.EncodeToString(credential.ID),
+		UserHandle:     challenge.UserHandle,
+		PublicKey:      credential.PublicKey,
+		SignCount:      credential.SignCount,
+		AAGUID:         formatAAGUID(credential.AAGUID),
+		Transports:     credential.Transports,
+		BackupEligible: credential.BackupEligible,
+	}
+	if len(passkey.CredentialID) > passkeyCredentialIDMaxLength {
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	err = passkeyStore.CreatePasskey(&passkey)
+	if errors.Is(err, store.ErrConflict) {
+		httpResponse.Message = "passkey is registered already"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2612")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendPasskeyEvent(userIDAuth, AuditPasskeyCreate, passkey.PasskeyID, nil, passkey, client)
+
+	httpResponse.Message = passkey
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// GetPasskeys handles jobs for controller.GetPasskeys
+func GetPasskeys(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	passkeys, err := passkeyStore.FindPasskeys(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2621")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = passkeys
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeletePasskey handles jobs for controller.DeletePasskey
+//
+// - id: passkey ID, raw path parameter
+func DeletePasskey(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	passkeys, err := passkeyStore.FindPasskeys(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2631")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	var passkey *model.Passkey
+	for i := range passkeys {
+		if strconv.FormatUint(passkeys[i].PasskeyID, 10) == id {
+			passkey = &passkeys[i]
+		}
+	}
+	if passkey == nil {
+		httpResponse.Message = "passkey not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if err := passkeyStore.DeletePasskey(passkey.PasskeyID); err != nil {
+		log.WithError(err).Error("error code: 2632")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendPasskeyEvent(userIDAuth, AuditPasskeyDelete, passkey.PasskeyID, *passkey, nil, client)
+
+	httpResponse.Message = "passkey ID# " + id + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// BeginPasskeyLogin handles jobs for controller.BeginPasskeyLogin
+//
+// returns the options of navigator.credentials.get, the user
+// picks a passkey of any account
+func BeginPasskeyLogin() (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	challenge, err := newPasskeyChallenge(model.PasskeyLogin, 0, nil)
+	if err != nil {
+		log.WithError(err).Error("error code: 2641")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = relyingParty.RequestOptions(challenge, nil)
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// FinishPasskeyLogin handles jobs for controller.FinishPasskeyLogin
+//
+// - the JWTs are the same as those of a login with the password
+// - the second factor counts as verified if the authenticator verified
+// the user, the passkey is then both something the user has and knows
+// or is
+func FinishPasskeyLogin(payload model.PasskeyAssertion, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	passkey, result, httpResponse, httpStatusCode := checkPasskeyAssertion(payload.Credential, model.PasskeyLogin, 0)
+	if httpStatusCode != 0 {
+		return
+	}
+	// a discoverable passkey returns the handle of its account
+	if !bytes.Equal(result.UserHandle, passkey.UserHandle) {
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+
+	auth, err := credentialStore.FindAuth(passkey.IDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2651")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	_, err = suspensionStore.FindSuspension(auth.AuthID)
+	if err == nil {
+		httpResponse.Message = "account is suspended"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2652")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	jwtPayload, err := issueJWT(auth.AuthID, auth.Email, result.UserVerified)
+	if err != nil {
+		log.WithError(err).Error("error code: 2653")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := TrackSession("", "", jwtPayload, client); err != nil {
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = jwtPayload
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// BeginPasskeyTwoFA handles jobs for controller.BeginPasskeyTwoFA
+//
+// returns the options of navigator.credentials.get
+// with the passkeys of the account
+func BeginPasskeyTwoFA(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	passkeys, err := passkeyStore.FindPasskeys(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2661")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if len(passkeys) == 0 {
+		httpResponse.Message = "no passkey registered"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	challenge, err := newPasskeyChallenge(model.PasskeyTwoFA, userIDAuth, nil)
+	if err != nil {
+		log.WithError(err).Error("error code: 2662")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = relyingParty.RequestOptions(challenge, passkeyDescriptors(passkeys))
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// ValidatePasskeyTwoFA handles jobs for controller.ValidatePasskeyTwoFA
+//
+// the passkey replaces the TOTP of gcontroller.Validate2FA, the new
+// JWTs continue the session of the request
+// - accessJTI: JWT ID of the access token of the request
+func ValidatePasskeyTwoFA(userIDAuth uint64, accessJTI string, payload model.PasskeyAssertion, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	passkey, _, httpResponse, httpStatusCode := checkPasskeyAssertion(payload.Credential, model.PasskeyTwoFA, userIDAuth)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	auth, err := credentialStore.FindAuth(passkey.IDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2671")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	jwtPayload, err := issueJWT(auth.AuthID, auth.Email, true)
+	if err != nil {
+		log.WithError(err).Error("error code: 2672")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err := TrackSession(accessJTI, "", jwtPayload, client); err != nil {
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = jwtPayload
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// passkeyChallenge - a started ceremony with its raw challenge
+type passkeyChallenge struct {
+	model.PasskeyChallenge
+	raw []byte
+}
+
+// newPasskeyChallenge starts a ceremony, it expires with the timeout of
+// the relying party
+func newPasskeyChallenge(kind string, authID uint64, userHandle []byte) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	err = passkeyStore.CreatePasskeyChallenge(model.PasskeyChallenge{
+		Challenge:  base64.RawURLEncoding.EncodeToString(challenge),
+		Kind:       kind,
+		IDAuth:     authID,
+		UserHandle: userHandle,
+		ExpiresAt:  time.Now().Add(relyingParty.Timeout),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// takePasskeyChallenge returns and removes the ceremony a response was
+// made for, ErrNotFound if it is unknown, expired or of another kind
+// or account
+func takePasskeyChallenge(clientDataJSON []byte, kind string, authID uint64) (passkeyChallenge, error) {
+	encoded, err := webauthn.ClientChallenge(clientDataJSON)
+	if err != nil {
+		return passkeyChallenge{}, store.ErrNotFound
+	}
+	challenge, err := passkeyStore.TakePasskeyChallenge(encoded)
+	if err != nil {
+		return passkeyChallenge{}, err
+	}
+	if challenge.Kind != kind || challenge.IDAuth != authID || !challenge.ExpiresAt.After(time.Now()) {
+		return passkeyChallenge{}, store.ErrNotFound
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(challenge.Challenge)
+	if err != nil {
+		return passkeyChallenge{}, store.ErrNotFound
+	}
+	return passkeyChallenge{PasskeyChallenge: challenge, raw: raw}, nil
+}
+
+// checkPasskeyAssertion verifies the response to a ceremony of the kind
+// and saves the signature counter of the passkey
+//
+// - authID: the account the passkey must belong to, 0 for any
+//
+// httpStatusCode is 0 if the assertion is valid
+func checkPasskeyAssertion(assertion webauthn.Assertion, kind string, authID uint64) (passkey model.Passkey, result webauthn.AssertionResult, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	challenge, err := takePasskeyChallenge(assertion.Response.ClientDataJSON, kind, authID)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid or expired challenge"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2681")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	passkey, err = passkeyStore.FindPasskey(base64.RawURLEncoding.EncodeToString(assertion.RawID))
+	if err == nil && authID != 0 && passkey.IDAuth != authID {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2682")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	result, err = relyingParty.VerifyAssertion(challenge.raw, passkey.PublicKey, passkey.SignCount, assertion)
+	if err == nil {
+		// of concurrent logins with the same counter only one succeeds
+		err = passkeyStore.UsePasskey(passkey.PasskeyID, result.SignCount, time.Now())
+		if errors.Is(err, store.ErrConflict) {
+			err = webauthn.ErrSignCount
+		}
+	}
+	if errors.Is(err, webauthn.ErrSignCount) {
+		log.WithField("passkeyID", passkey.PasskeyID).Warn("passkey signature counter did not increase, it may be cloned")
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if errors.Is(err, webauthn.ErrInvalid) {
+		log.WithError(err).Info("passkey assertion rejected")
+		httpResponse.Message = "invalid passkey"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2683")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	return
+}
+
+// passkeyDescriptors returns the credential descriptors of passkeys
+func passkeyDescriptors(passkeys []model.Passkey) []webauthn.CredentialDescriptor {
+	descriptors := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		id, err := base64.RawURLEncoding.DecodeString(passkey.CredentialID)
+		if err != nil {
+			continue
+		}
+		descriptors = append(descriptors, webauthn.CredentialDescriptor{
+			Type:       "public-key",
+			ID:         id,
+			Transports: passkey.Transports,
+		})
+	}
+	return descriptors
+}
+
+// formatAAGUID returns the AAGUID of an authenticator as UUID,
+// empty if it is unknown
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 || bytes.Equal(aaguid, make([]byte, 16)) {
+		return ""
+	}
+	h := hex.EncodeToString(aaguid)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// appendPasskeyEvent records a change of a passkey, which is not
+// recorded by the store
+func appendPasskeyEvent(userIDAuth uint64, action string, passkeyID uint64, before, after interface{}, client model.ClientInfo) {
+	event := newAuditEvent(userIDAuth, action, AuditResourcePasskey, passkeyID, before, after, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 2691")
+	}
+}
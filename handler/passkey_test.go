@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"apidev/database/model"
+	"apidev/lib/webauthn"
+	"apidev/lib/webauthn/webauthntest"
+)
+
+const passkeyOrigin = "https://app.example.com"
+
+// useRelyingParty injects the relying party of the passkeys
+func useRelyingParty(t *testing.T) {
+	t.Helper()
+
+	rp := &webauthn.RelyingParty{
+		ID:      "example.com",
+		Name:    "Example",
+		Origins: []string{passkeyOrigin},
+		Timeout: time.Minute,
+	}
+	if err := rp.Check(); err != nil {
+		t.Fatal(err)
+	}
+	SetWebAuthn(rp)
+}
+
+// createPasskey registers a passkey of an authenticator to an account
+func createPasskey(t *testing.T, authenticator *webauthntest.Authenticator, authID uint64) model.Passkey {
+	t.Helper()
+
+	reg := passkeyRegistration(t, authenticator, authID)
+	resp, statusCode := FinishPasskeyRegistration(authID, model.PasskeyRegistration{Credential: reg}, model.ClientInfo{})
+	if statusCode != http.StatusCreated {
+		t.Fatalf("FinishPasskeyRegistration() = %d %v", statusCode, resp.Message)
+	}
+	return resp.Message.(model.Passkey)
+}
+
+// creationOptions returns the options of a new registration
+func creationOptions(t *testing.T, authID uint64) webauthn.CreationOptions {
+	t.Helper()
+
+	resp, statusCode := BeginPasskeyRegistration(authID)
+	if statusCode != http.StatusOK {
+		t.Fatalf("BeginPasskeyRegistration() = %d %v", statusCode, resp.Message)
+	}
+	return resp.Message.(webauthn.CreationOptions)
+}
+
+// passkeyRegistration returns the response of an authenticator
+// to a new registration of an account
+func passkeyRegistration(t *testing.T, authenticator *webauthntest.Authenticator, authID uint64) webauthn.Registration {
+	t.Helper()
+
+	reg, err := authenticator.Create(creationOptions(t, authID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+// passkeyAssertion returns the response of an authenticator to the
+// options of a started login or 2FA
+func passkeyAssertion(t *testing.T, authenticator *webauthntest.Authenticator, resp interface{}, statusCode int) model.PasskeyAssertion {
+	t.Helper()
+
+	if statusCode != http.StatusOK {
+		t.Fatalf("begin = %d %v", statusCode, resp)
+	}
+	assertion, err := authenticator.Get(resp.(webauthn.RequestOptions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.PasskeyAssertion{Credential: assertion}
+}
+
+func beginLogin(t *testing.T, authenticator *webauthntest.Authenticator) model.PasskeyAssertion {
+	t.Helper()
+
+	resp, statusCode := BeginPasskeyLogin()
+	return passkeyAssertion(t, authenticator, resp.Message, statusCode)
+}
+
+func beginTwoFA(t *testing.T, authenticator *webauthntest.Authenticator, authID uint64) model.PasskeyAssertion {
+	t.Helper()
+
+	resp, statusCode := BeginPasskeyTwoFA(authID)
+	return passkeyAssertion(t, authenticator, resp.Message, statusCode)
+}
+
+func TestFinishPasskeyRegistration(t *testing.T) {
+	authStore := useMemoryStores(t)
+	useRelyingParty(t)
+	alice := createPasswordAccount(t, authStore, "alice@example.com")
+	bob := createPasswordAccount(t, authStore, "bob@example.com")
+
+	authenticator := webauthntest.NewAuthenticator(passkeyOrigin)
+	reg := passkeyRegistration(t, authenticator, alice)
+	ofAlice := passkeyRegistration(t, authenticator, alice)
+	otherOrigin := passkeyRegistration(t, webauthntest.NewAuthenticator("https://evil.example.net"), alice)
+
+	tests := []struct {
+		name   string
+		authID uint64
+		reg    webauthn.Registration
+		want   int
+	}{
+		{"challenge of another account", bob, ofAlice, http.StatusBadRequest},
+		{"other origin", alice, otherOrigin, http.StatusBadRequest},
+		{"new passkey", alice, reg, http.StatusCreated},
+		{"reused challenge", alice, reg, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := FinishPasskeyRegistration(tt.authID, model.PasskeyRegistration{Credential: tt.reg}, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("FinishPasskeyRegistration() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	// the registered passkey is excluded from the next registration
+	if _, err := authenticator.Create(creationOptions(t, alice)); err == nil {
+		t.Error("the authenticator created a second passkey for the account")
+	}
+}
+
+func TestFinishPasskeyLogin(t *testing.T) {
+	authStore := useMemoryStores(t)
+	useRelyingParty(t)
+	alice := createPasswordAccount(t, authStore, "alice@example.com")
+	authenticator := webauthntest.NewAuthenticator(passkeyOrigin)
+	passkey := createPasskey(t, authenticator, alice)
+
+	login := beginLogin(t, authenticator)
+	if resp, statusCode := FinishPasskeyLogin(login, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("FinishPasskeyLogin() = %d %v", statusCode, resp.Message)
+	}
+
+	if resp, statusCode := FinishPasskeyLogin(beginLogin(t, authenticator), model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("FinishPasskeyLogin() = %d %v", statusCode, resp.Message)
+	}
+
+	// a clone of the passkey signs with the counter it was copied with
+	credentialID, err := base64.RawURLEncoding.DecodeString(passkey.CredentialID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.SetSignCount(credentialID, 0)
+	cloned := beginLogin(t, authenticator)
+
+	authenticator.Origin = "https://evil.example.net"
+	otherOrigin := beginLogin(t, authenticator)
+	authenticator.Origin = passkeyOrigin
+
+	twoFA := beginTwoFA(t, authenticator, alice)
+
+	tests := []struct {
+		name      string
+		assertion model.PasskeyAssertion
+		want      int
+	}{
+		{"reused challenge", login, http.StatusUnauthorized},
+		{"sign counter goes backwards", cloned, http.StatusUnauthorized},
+		{"other origin", otherOrigin, http.StatusUnauthorized},
+		{"challenge of a 2FA", twoFA, http.StatusUnauthorized},
+		{"next login", beginLogin(t, authenticator), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := FinishPasskeyLogin(tt.assertion, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("FinishPasskeyLogin() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePasskeyTwoFA(t *testing.T) {
+	authStore := useMemoryStores(t)
+	useRelyingParty(t)
+	alice := createPasswordAccount(t, authStore, "alice@example.com")
+	bob := createPasswordAccount(t, authStore, "bob@example.com")
+	authenticator := webauthntest.NewAuthenticator(passkeyOrigin)
+	createPasskey(t, authenticator, alice)
+
+	if _, statusCode := BeginPasskeyTwoFA(bob); statusCode != http.StatusNotFound {
+		t.Errorf("BeginPasskeyTwoFA() without passkey = %d, want %d", statusCode, http.StatusNotFound)
+	}
+	// bob registers a passkey on a second authenticator
+	ofBob := webauthntest.NewAuthenticator(passkeyOrigin)
+	createPasskey(t, ofBob, bob)
+
+	twoFA := beginTwoFA(t, authenticator, alice)
+	if resp, statusCode := ValidatePasskeyTwoFA(alice, "", twoFA, model.ClientInfo{}); statusCode != http.StatusOK {
+		t.Fatalf("ValidatePasskeyTwoFA() = %d %v", statusCode, resp.Message)
+	}
+
+	// the passkey of bob answers the options of alice
+	resp, _ := BeginPasskeyTwoFA(alice)
+	options := resp.Message.(webauthn.RequestOptions)
+	options.AllowCredentials = nil
+	passkeyOfBob, err := ofBob.Get(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		authID    uint64
+		assertion model.PasskeyAssertion
+		want      int
+	}{
+		{"reused challenge", alice, twoFA, http.StatusUnauthorized},
+		{"challenge of another account", bob, beginTwoFA(t, authenticator, alice), http.StatusUnauthorized},
+		{"passkey of another account", alice, model.PasskeyAssertion{Credential: passkeyOfBob}, http.StatusUnauthorized},
+		{"challenge of a login", alice, beginLogin(t, authenticator), http.StatusUnauthorized},
+		{"next 2FA", alice, beginTwoFA(t, authenticator, alice), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := ValidatePasskeyTwoFA(tt.authID, "", tt.assertion, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("ValidatePasskeyTwoFA() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+}
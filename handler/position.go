@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/lexorank"
+)
+
+// errNeedRebalance - the positions around a move cannot be used,
+// e.g. the notes were created before manual ordering existed
+var errNeedRebalance = errors.New("positions need rebalancing")
+
+// appendPosition returns the position after the last note,
+// empty if the last position is malformed
+func appendPosition(last string) string {
+	position, err := lexorank.Between(last, "")
+	if err != nil {
+		return ""
+	}
+	return position
+}
+
+// MoveNote handles jobs for controller.MoveNote
+//
+// - only the moved note is written in the common case
+// - the notes of the user (or the workspace) are rebalanced when
+// the new position gets too long or no position fits between the neighbours
+func MoveNote(userIDAuth uint64, id string, move model.NoteMove, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// does the note exist + does the user have right to modify this note
+	note, err := findNote(user, id, model.WorkspaceRoleEditor)
+	if err != nil {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	owner := store.OwnerOf(note)
+
+	if move.Before == 0 && move.After == 0 {
+		httpResponse.Message = "before or after is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if move.Before == note.NoteID || move.After == note.NoteID {
+		httpResponse.Message = "a note cannot be moved relative to itself"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// the referenced notes must belong to the same user or workspace
+	var before, after model.Note
+	if move.Before != 0 {
+		if before, err = noteStore.FindOne(owner, move.Before); err != nil {
+			httpResponse.Message = "note referenced by before not found"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+	}
+	if move.After != 0 {
+		if after, err = noteStore.FindOne(owner, move.After); err != nil {
+			httpResponse.Message = "note referenced by after not found"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+	}
+
+	position, err := movePosition(owner, move, before, after)
+	if errors.Is(err, errNeedRebalance) {
+		// spread all positions, then try again with the new ones
+		if err = rebalance(owner); err != nil {
+			log.WithError(err).Error("error code: 1241")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+		if move.Before != 0 {
+			before, err = noteStore.FindOne(owner, move.Before)
+		}
+		if err == nil && move.After != 0 {
+			after, err = noteStore.FindOne(owner, move.After)
+		}
+		if err == nil {
+			note, err = noteStore.FindOne(owner, note.NoteID)
+		}
+		if err == nil {
+			position, err = movePosition(owner, move, before, after)
+		}
+	}
+	if errors.Is(err, lexorank.ErrOrder) {
+		httpResponse.Message = "note referenced by after must come before the note referenced by before"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1242")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	noteBefore := note
+	note.Position = position
+	note.UpdatedAt = time.Now()
+	note.Version++
+
+	event := newAuditEvent(userIDAuth, AuditNoteMove, AuditResourceNote, note.NoteID, noteBefore, note, client)
+	if err := noteStore.Update(&note, event); err != nil {
+		log.WithError(err).Error("error code: 1243")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// keep positions short
+	if len(position) > lexorank.MaxLength {
+		if err := rebalance(owner); err != nil {
+			log.WithError(err).Error("error code: 1244")
+		} else if rebalanced, err := noteStore.FindOne(owner, note.NoteID); err == nil {
+			note = rebalanced
+		}
+	}
+
+	localize(&note, userLocation(user))
+	httpResponse.Message = note
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// movePosition computes the position between the referenced notes,
+// a missing neighbour is looked up in the store
+func movePosition(owner store.Owner, move model.NoteMove, before, after model.Note) (string, error) {
+	if move.Before != 0 && before.Position == "" || move.After != 0 && after.Position == "" {
+		return "", errNeedRebalance
+	}
+
+	lower, upper := after.Position, before.Position
+	var err error
+	switch {
+	case move.Before == 0:
+		upper, err = noteStore.AdjacentPosition(owner, lower, true)
+	case move.After == 0:
+		lower, err = noteStore.AdjacentPosition(owner, upper, false)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	position, err := lexorank.Between(lower, upper)
+	if err == nil {
+		return position, nil
+	}
+
+	// neighbours found in the store with equal or malformed positions
+	if move.Before == 0 || move.After == 0 {
+		return "", errNeedRebalance
+	}
+	if errors.Is(err, lexorank.ErrInvalid) || lower == upper {
+		return "", errNeedRebalance
+	}
+	return "", err
+}
+
+// rebalance assigns evenly spaced positions to all notes of an owner,
+// keeping their current order
+func rebalance(owner store.Owner) error {
+	notes, err := noteStore.FindByPosition(owner)
+	if err != nil {
+		return err
+	}
+
+	keys := lexorank.Spread(len(notes))
+	positions := map[uint64]string{}
+	for i, note := range notes {
+		if note.Position != keys[i] {
+			positions[note.NoteID] = keys[i]
+		}
+	}
+	if len(positions) == 0 {
+		return nil
+	}
+	return noteStore.Reorder(owner, positions)
+}
@@ -0,0 +1,396 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/config"
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// jwtClaims - claims of a JWT needed to track its session
+type jwtClaims struct {
+	AuthID    uint64  `json:"authID"`
+	ID        string  `json:"jti"`
+	IssuedAt  float64 `json:"iat"`
+	ExpiresAt float64 `json:"exp"`
+}
+
+// TrackSession records the JWTs issued by a login, a refresh or a
+// 2FA step in the session they belong to
+//
+// - accessJTI, refreshJTI: jti of the JWTs of the request, a pair
+// issued in exchange for them continues their session, otherwise a
+// new session is started
+// - the refresh token of the request is replaced and rejected afterwards
+//
+// the JWTs must not be handed out if an error is returned, CheckSession
+// rejects untracked JWTs
+func TrackSession(accessJTI, refreshJTI string, payload gmodel.JWTPayload, client model.ClientInfo) error {
+	if sessionStore == nil {
+		return nil
+	}
+
+	var authID uint64
+	var expiresAt time.Time
+	tokens := []model.SessionToken{}
+	for _, raw := range []string{payload.AccessJWT, payload.RefreshJWT} {
+		claims, ok := parseJWTClaims(raw)
+		if !ok {
+			continue
+		}
+		authID = claims.AuthID
+		token := model.SessionToken{
+			JTI:       claims.ID,
+			ExpiresAt: time.Unix(int64(claims.ExpiresAt), 0),
+		}
+		if token.ExpiresAt.After(expiresAt) {
+			expiresAt = token.ExpiresAt
+		}
+		tokens = append(tokens, token)
+	}
+	if authID == 0 || len(tokens) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	session, err := findSessionByJTI(refreshJTI, accessJTI)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2211")
+		return err
+	}
+	if err == nil && session.IDAuth == authID && session.RevokedAt == nil {
+		if refreshJTI != "" {
+			session.RefreshedAt = &now
+		}
+		if expiresAt.After(session.ExpiresAt) {
+			session.ExpiresAt = expiresAt
+		}
+		if err := sessionStore.RefreshSession(session, refreshJTI, tokens); err != nil {
+			log.WithError(err).Error("error code: 2212")
+			return err
+		}
+		return nil
+	}
+
+	session = model.Session{
+		CreatedAt: now,
+		IDAuth:    authID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: expiresAt,
+	}
+	if err := sessionStore.CreateSession(&session, tokens); err != nil {
+		log.WithError(err).Error("error code: 2213")
+		return err
+	}
+	return nil
+}
+
+// EndSession revokes the session of the JWTs of a logout
+func EndSession(accessJTI, refreshJTI string) {
+	if sessionStore == nil {
+		return
+	}
+
+	session, err := findSessionByJTI(refreshJTI, accessJTI)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2214")
+		return
+	}
+	if err := sessionStore.RevokeSession(session.SessionID, time.Now()); err != nil {
+		log.WithError(err).Error("error code: 2215")
+	}
+}
+
+// CheckSession handles jobs for controller.RevokedJWTChecker
+//
+// rejects a JWT of a revoked session and a refresh token which was
+// exchanged already
+//
+// - issuedAt: of the JWT, from JWTIssuedAt; an untracked JWT is only
+// accepted if it was issued before sessions were tracked, see
+// SESSION_TRACKING_SINCE
+func CheckSession(jti string, issuedAt time.Time) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if sessionStore == nil || jti == "" {
+		httpStatusCode = http.StatusOK
+		return
+	}
+
+	token, err := sessionStore.FindSessionToken(jti)
+	if errors.Is(err, store.ErrNotFound) {
+		if !issuedAt.IsZero() && issuedAt.Before(config.GetConfig().Session.TrackedSince) {
+			httpStatusCode = http.StatusOK
+			return
+		}
+		httpResponse.Message = "session not found, please log in again"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 2241")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if token.Replaced {
+		httpResponse.Message = "token is revoked, please log in again"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+
+	session, err := sessionStore.FindSession(token.IDSession)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2242")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if err != nil || session.RevokedAt != nil {
+		httpResponse.Message = "session is revoked, please log in again"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetSessions handles jobs for controller.GetSessions
+//
+// - jti: access token of the request, its session is marked as current
+func GetSessions(userIDAuth uint64, jti string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	sessions, err := sessionStore.FindSessions(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2201")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	currentID, err := currentSessionID(jti)
+	if err != nil {
+		log.WithError(err).Error("error code: 2202")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	now := time.Now()
+	active := []model.Session{}
+	for _, session := range sessions {
+		if !session.ExpiresAt.After(now) {
+			continue
+		}
+		session.Device = deviceName(session.UserAgent)
+		session.Current = session.SessionID == currentID
+		active = append(active, session)
+	}
+
+	httpResponse.Message = active
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteSession handles jobs for controller.DeleteSession
+//
+// - id: session ID, raw path parameter
+// - the JWTs of the session are rejected from the next request on
+func DeleteSession(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	sessionID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		httpResponse.Message = "session not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	session, err := sessionStore.FindSession(sessionID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 2221")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	// do not reveal the sessions of other users
+	if err != nil || session.IDAuth != userIDAuth || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		httpResponse.Message = "session not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	if err := sessionStore.RevokeSession(sessionID, time.Now()); err != nil {
+		log.WithError(err).Error("error code: 2222")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendSessionEvent(userIDAuth, session, client)
+
+	httpResponse.Message = "session ID# " + id + " revoked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteSessions handles jobs for controller.DeleteSessions
+//
+// - jti: access token of the request, its session is kept
+// - all other sessions are revoked, log out everywhere else
+func DeleteSessions(userIDAuth uint64, jti string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	currentID, err := currentSessionID(jti)
+	if err != nil {
+		log.WithError(err).Error("error code: 2231")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	sessions, err := sessionStore.FindSessions(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 2232")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	now := time.Now()
+	if err := sessionStore.RevokeSessions(userIDAuth, currentID, now); err != nil {
+		log.WithError(err).Error("error code: 2233")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	for _, session := range sessions {
+		if session.SessionID != currentID && session.ExpiresAt.After(now) {
+			appendSessionEvent(userIDAuth, session, client)
+		}
+	}
+
+	httpResponse.Message = "all other sessions revoked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// findSessionByJTI returns the session of the first tracked JWT
+func findSessionByJTI(jtis ...string) (model.Session, error) {
+	for _, jti := range jtis {
+		if jti == "" {
+			continue
+		}
+		token, err := sessionStore.FindSessionToken(jti)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return model.Session{}, err
+		}
+		return sessionStore.FindSession(token.IDSession)
+	}
+	return model.Session{}, store.ErrNotFound
+}
+
+// currentSessionID returns the ID of the session of a JWT,
+// 0 if it is not tracked
+func currentSessionID(jti string) (uint64, error) {
+	session, err := findSessionByJTI(jti)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return session.SessionID, nil
+}
+
+// parseJWTClaims decodes the claims of a JWT issued by gorest in this
+// request, the signature is not verified
+func parseJWTClaims(raw string) (claims jwtClaims, ok bool) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return
+	}
+	return claims, claims.ID != "" && claims.ExpiresAt > 0
+}
+
+// JWTIssuedAt returns the issue time of a JWT validated by gorest,
+// zero if the raw token is missing or does not have the given jti
+//
+// gorest keeps the jti and the expiry of the JWTs in the context
+// but not their issue time
+func JWTIssuedAt(raw, jti string) time.Time {
+	claims, ok := parseJWTClaims(raw)
+	if !ok || claims.ID != jti || claims.IssuedAt <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(claims.IssuedAt), 0)
+}
+
+// deviceName returns a short description of the browser and the
+// operating system of a user agent, e.g. "Firefox on Windows"
+func deviceName(userAgent string) string {
+	browser := ""
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(userAgent, "curl/"):
+		browser = "curl"
+	}
+
+	system := ""
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "unknown device"
+}
+
+// appendSessionEvent records the revocation of a session in the audit log
+func appendSessionEvent(userIDAuth uint64, session model.Session, client model.ClientInfo) {
+	event := newAuditEvent(userIDAuth, AuditSessionRevoke, AuditResourceSession, session.SessionID, session, nil, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 2251")
+	}
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/richtext"
+	"apidev/lib/settings"
+)
+
+// settingsSchema - settings shared by the clients of a user
+//
+// removing a key or narrowing its declaration is safe, stored values
+// which no longer fit are replaced by the default in responses
+var settingsSchema = settings.Schema{
+	"editor.contentType": {
+		Type:    settings.String,
+		Default: richtext.FormatText,
+		Allowed: []string{richtext.FormatText, richtext.FormatMarkdown, richtext.FormatHTML, richtext.FormatJSON},
+	},
+	"editor.fontSize":   {Type: settings.Int, Default: 14, Min: 8, Max: 32},
+	"editor.spellcheck": {Type: settings.Bool, Default: true},
+	"notes.sort": {
+		Type:    settings.String,
+		Default: "position",
+		Allowed: []string{"position", "createdAt", "updatedAt", "title"},
+	},
+	"notes.view":        {Type: settings.String, Default: "list", Allowed: []string{"list", "grid"}},
+	"sidebar.collapsed": {Type: settings.Bool, Default: false},
+}
+
+// GetSettingsSchema handles jobs for controller.GetSettingsSchema
+func GetSettingsSchema() (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	httpResponse.Message = settingsSchema
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetUserSettings handles jobs for controller.GetUserSettings
+//
+// every declared setting is returned, missing ones with their default
+func GetUserSettings(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, userSettings, httpResponse, httpStatusCode := findUserSettings(userIDAuth)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	presentSettings(user, &userSettings)
+	httpResponse.Message = userSettings
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// ReplaceUserSettings handles jobs for controller.ReplaceUserSettings
+//
+// the stored settings are replaced, omitted keys and null values
+// fall back to their default
+func ReplaceUserSettings(userIDAuth uint64, values map[string]interface{}) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if err := settingsSchema.Validate(values); err != nil {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	user, userSettings, httpResponse, httpStatusCode := findUserSettings(userIDAuth)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	userSettings.Values = map[string]interface{}{}
+	for key, value := range values {
+		if value != nil {
+			userSettings.Values[key] = value
+		}
+	}
+	return saveUserSettings(user, userSettings)
+}
+
+// UpdateUserSettings handles jobs for controller.UpdateUserSettings
+//
+// JSON merge patch (RFC 7396): the given keys are set, a null value
+// resets a key to its default, omitted keys are kept
+func UpdateUserSettings(userIDAuth uint64, values map[string]interface{}) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	if err := settingsSchema.Validate(values); err != nil {
+		httpResponse.Message = err.Error()
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if len(values) == 0 {
+		httpResponse.Message = "no new info to update"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	user, userSettings, httpResponse, httpStatusCode := findUserSettings(userIDAuth)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	if userSettings.Values == nil {
+		userSettings.Values = map[string]interface{}{}
+	}
+	for key, value := range values {
+		if value == nil {
+			delete(userSettings.Values, key)
+			continue
+		}
+		userSettings.Values[key] = value
+	}
+	return saveUserSettings(user, userSettings)
+}
+
+// findUserSettings returns the profile and the stored settings of a user,
+// httpStatusCode is set if they cannot be returned
+func findUserSettings(userIDAuth uint64) (user model.User, userSettings model.UserSettings, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	userSettings, err = userStore.FindSettings(user.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		// nothing stored yet, all defaults
+		userSettings = model.UserSettings{IDUser: user.UserID}
+		err = nil
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1191")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+	}
+	return
+}
+
+// saveUserSettings saves validated settings and returns them merged
+// with the defaults
+func saveUserSettings(user model.User, userSettings model.UserSettings) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	userSettings.UpdatedAt = time.Now()
+	if err := userStore.SaveSettings(&userSettings); err != nil {
+		log.WithError(err).Error("error code: 1192")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	presentSettings(user, &userSettings)
+	httpResponse.Message = userSettings
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// presentSettings merges the defaults into the settings of a user
+// and renders the timestamp in their timezone
+func presentSettings(user model.User, userSettings *model.UserSettings) {
+	userSettings.Values = settingsSchema.Merge(userSettings.Values)
+	localize(userSettings, userLocation(user))
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/avatar"
+	"apidev/lib/dataexport"
+	"apidev/lib/lockout"
+	"apidev/lib/mailer"
+	"apidev/lib/oauthclient"
+	"apidev/lib/webauthn"
+)
+
+// storage of user profiles, notes and the audit log, injected at startup
+var (
+	backend    store.Backend
+	userStore  store.UserStore
+	noteStore  store.NoteStore
+	auditStore store.AuditStore
+	keyStore   store.KeyStore
+
+	credentialStore  store.CredentialStore
+	revocationStore  store.RevocationStore
+	roleStore        store.RoleStore
+	suspensionStore  store.SuspensionStore
+	tokenStore       store.TokenStore
+	identityStore    store.IdentityStore
+	oauthServerStore store.OAuthServerStore
+	sessionStore     store.SessionStore
+	emailTokenStore  store.EmailTokenStore
+	passkeyStore     store.PasskeyStore
+
+	avatarStorage avatar.Storage
+
+	exportStore    store.ExportStore
+	exportArchives dataexport.Storage
+
+	workspaceStore store.WorkspaceStore
+
+	emailSender mailer.Mailer
+
+	oauthProviders = map[string]*oauthclient.Provider{}
+	oauthStateTTL  time.Duration
+
+	relyingParty *webauthn.RelyingParty
+
+	accountLockout *lockout.Limiter
+	ipLockout      *lockout.Limiter
+)
+
+// SetStores injects the storage of user profiles, notes and the audit log
+// used by all handlers
+func SetStores(b store.Backend, users store.UserStore, notes store.NoteStore, audit store.AuditStore) {
+	backend = b
+	userStore = users
+	noteStore = notes
+	auditStore = audit
+}
+
+// SetAuthStore injects one backend for all stores of the accounts
+func SetAuthStore(s store.AuthStore) {
+	SetCredentialStore(s)
+	SetRevocationStore(s)
+	SetRoleStore(s)
+	SetSuspensionStore(s)
+	SetTokenStore(s)
+	SetIdentityStore(s)
+	SetOAuthServerStore(s)
+	SetSessionStore(s)
+	SetEmailTokenStore(s)
+	SetPasskeyStore(s)
+}
+
+// SetKeyStore injects the storage of the public keys of users
+// and the wrapped keys of end-to-end encrypted notes
+func SetKeyStore(s store.KeyStore) {
+	keyStore = s
+}
+
+// SetCredentialStore injects the storage of the credentials of gorest
+func SetCredentialStore(s store.CredentialStore) {
+	credentialStore = s
+}
+
+// SetRevocationStore injects the storage of revoked JWTs
+func SetRevocationStore(s store.RevocationStore) {
+	revocationStore = s
+}
+
+// SetRoleStore injects the storage of the roles of accounts
+func SetRoleStore(s store.RoleStore) {
+	roleStore = s
+}
+
+// SetSuspensionStore injects the storage of suspended accounts
+func SetSuspensionStore(s store.SuspensionStore) {
+	suspensionStore = s
+}
+
+// SetTokenStore injects the storage of personal access tokens
+func SetTokenStore(s store.TokenStore) {
+	tokenStore = s
+}
+
+// SetIdentityStore injects the storage of the identities
+// of the social login
+func SetIdentityStore(s store.IdentityStore) {
+	identityStore = s
+}
+
+// SetOAuthServerStore injects the storage of the clients and grants
+// of the OAuth2 authorization server
+func SetOAuthServerStore(s store.OAuthServerStore) {
+	oauthServerStore = s
+}
+
+// SetSessionStore injects the storage of the sessions of JWTs
+func SetSessionStore(s store.SessionStore) {
+	sessionStore = s
+}
+
+// SetEmailTokenStore injects the storage of the tokens sent by email
+func SetEmailTokenStore(s store.EmailTokenStore) {
+	emailTokenStore = s
+}
+
+// SetPasskeyStore injects the storage of passkeys
+func SetPasskeyStore(s store.PasskeyStore) {
+	passkeyStore = s
+}
+
+// SetAvatarStorage injects the storage of the processed avatars
+func SetAvatarStorage(s avatar.Storage) {
+	avatarStorage = s
+}
+
+// SetExportStore injects the storage of data exports and their archives
+func SetExportStore(exports store.ExportStore, archives dataexport.Storage) {
+	exportStore = exports
+	exportArchives = archives
+}
+
+// SetWorkspaceStore injects the storage of workspaces
+func SetWorkspaceStore(s store.WorkspaceStore) {
+	workspaceStore = s
+}
+
+// SetMailer injects the provider of the emails sent to users
+func SetMailer(m mailer.Mailer) {
+	emailSender = m
+}
+
+// SetOAuthProviders injects the providers of the social login
+// and the time a user has to complete a login
+func SetOAuthProviders(providers []*oauthclient.Provider, stateTTL time.Duration) {
+	oauthProviders = map[string]*oauthclient.Provider{}
+	for _, provider := range providers {
+		oauthProviders[provider.Name] = provider
+	}
+	oauthStateTTL = stateTTL
+}
+
+// SetWebAuthn injects the relying party of the passkeys
+func SetWebAuthn(rp *webauthn.RelyingParty) {
+	relyingParty = rp
+}
+
+// SetLockout injects the throttling of failed logins per account and per IP
+func SetLockout(account, ip *lockout.Limiter) {
+	accountLockout = account
+	ipLockout = ip
+}
+
+// Backend returns the storage backend of user profiles and notes,
+// empty if no store is injected
+func Backend() store.Backend {
+	return backend
+}
+
+// AccountStores reports whether the stores of the accounts are
+// injected, they are not with a storage keeping no accounts
+func AccountStores() bool {
+	return credentialStore != nil && revocationStore != nil && roleStore != nil &&
+		suspensionStore != nil && tokenStore != nil && identityStore != nil &&
+		oauthServerStore != nil && sessionStore != nil && emailTokenStore != nil &&
+		passkeyStore != nil
+}
+
+// findNote returns a note the user may access with the given role:
+// a personal note of the user or a note of a workspace the user
+// is a member of with at least this role
+// - id is the raw path parameter
+func findNote(user model.User, id, role string) (model.Note, error) {
+	noteID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return model.Note{}, store.ErrNotFound
+	}
+	note, err := noteStore.FindByID(noteID)
+	if err != nil {
+		return model.Note{}, err
+	}
+
+	if note.IDWorkspace == nil {
+		if note.IDUser != user.UserID {
+			return model.Note{}, store.ErrNotFound
+		}
+		return note, nil
+	}
+	if _, err := findMember(*note.IDWorkspace, user.UserID, role); err != nil {
+		return model.Note{}, err
+	}
+	return note, nil
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+)
+
+// limits of the sync protocol
+const (
+	SyncPageSizeDefault = 500
+	SyncPageSizeMax     = 1000
+	SyncBatchSizeMax    = 500
+)
+
+// encodeSyncToken builds an opaque cursor from the position
+// of the last note sent to the client
+//
+// notes are ordered by (change_seq, note_id), so the cursor
+// only moves forward; note_id breaks the tie between the notes
+// saved before the change sequence was introduced
+func encodeSyncToken(changeSeq, noteID uint64) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("c%d.%d", changeSeq, noteID)),
+	)
+}
+
+// decodeSyncToken is the inverse of encodeSyncToken
+//
+// the tokens of the former (updated_at, note_id) cursor are rejected,
+// their clients have to sync again from scratch
+func decodeSyncToken(token string) (changeSeq, noteID uint64, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return
+	}
+
+	cursor, ok := strings.CutPrefix(string(raw), "c")
+	seq, id, found := strings.Cut(cursor, ".")
+	if !ok || !found {
+		err = errors.New("unknown sync token format")
+		return
+	}
+	if changeSeq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return
+	}
+	noteID, err = strconv.ParseUint(id, 10, 64)
+	return
+}
+
+// GetSync handles jobs for controller.GetSync
+//
+// - without a token, all existing notes are returned (initial sync)
+// - with a token, all notes created, updated or deleted since then
+func GetSync(userIDAuth uint64, since string, limit int) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	if limit <= 0 || limit > SyncPageSizeMax {
+		limit = SyncPageSizeDefault
+	}
+
+	// tombstones are only relevant for clients which already synced before,
+	// notes of workspaces are not synced
+	var after *store.ChangeCursor
+	if since != "" {
+		changeSeq, noteID, err := decodeSyncToken(since)
+		if err != nil {
+			httpResponse.Message = "invalid sync token"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		after = &store.ChangeCursor{ChangeSeq: changeSeq, NoteID: noteID}
+	}
+
+	// fetch one extra row to find out whether there is another page
+	notes, err := noteStore.FindChanges(user.UserID, after, limit+1)
+	if err != nil {
+		log.WithError(err).Error("error code: 1401")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	result := model.SyncPull{
+		Notes:     []model.Note{},
+		Deleted:   []model.SyncTombstone{},
+		SyncToken: since,
+	}
+	if len(notes) > limit {
+		notes = notes[:limit]
+		result.HasMore = true
+	}
+
+	for _, note := range notes {
+		if note.DeletedAt.Valid {
+			result.Deleted = append(result.Deleted, model.SyncTombstone{
+				NoteID:    note.NoteID,
+				Version:   note.Version,
+				DeletedAt: note.DeletedAt.Time,
+			})
+			continue
+		}
+		result.Notes = append(result.Notes, note)
+	}
+	if len(notes) > 0 {
+		last := notes[len(notes)-1]
+		result.SyncToken = encodeSyncToken(last.ChangeSeq, last.NoteID)
+	}
+
+	httpResponse.Message = result
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// PushSync handles jobs for controller.PushSync
+//
+// - every change is checked against the base version the client saw
+// - diverged notes are reported as conflicts instead of being overwritten
+// - accepted changes and their audit events are saved in a single transaction
+func PushSync(userIDAuth uint64, push model.SyncPush, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	if len(push.Changes) > SyncBatchSizeMax {
+		httpResponse.Message = fmt.Sprintf("too many changes, maximum %d per batch", SyncBatchSizeMax)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	result := model.SyncPushResult{
+		Applied:   []model.SyncApplied{},
+		Conflicts: []model.SyncConflict{},
+		Rejected:  []model.SyncRejected{},
+	}
+	err = noteStore.Sync(func(batch store.SyncBatch) error {
+		for _, change := range push.Changes {
+			var err error
+			switch change.Op {
+			case "create":
+				err = syncCreate(batch, user, change, client, &result)
+			case "update", "delete":
+				err = syncModify(batch, user, change, client, &result)
+			default:
+				result.Rejected = append(result.Rejected, model.SyncRejected{
+					Op:        change.Op,
+					ClientRef: change.ClientRef,
+					NoteID:    change.NoteID,
+					Message:   "unknown operation",
+				})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("error code: 1411")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = result
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// syncCreate saves a note created offline
+func syncCreate(batch store.SyncBatch, user model.User, change model.SyncChange, client model.ClientInfo, result *model.SyncPushResult) error {
+	noteFinal := model.Note{}
+
+	// security: user must not be able to manipulate all fields
+	if msg, _ := applyNote(change.Note, &noteFinal); msg != "" {
+		result.Rejected = append(result.Rejected, model.SyncRejected{
+			Op:        change.Op,
+			ClientRef: change.ClientRef,
+			Message:   msg,
+		})
+		return nil
+	}
+	noteFinal.Version = 1
+	noteFinal.IDUser = user.UserID
+
+	// new notes are appended to the manual order
+	last, err := batch.LastPosition(store.Personal(user.UserID))
+	if err != nil {
+		return err
+	}
+	noteFinal.Position = appendPosition(last)
+
+	event := newAuditEvent(user.IDAuth, AuditNoteCreate, AuditResourceNote, 0, nil, noteFinal, client)
+	if err := batch.Create(&noteFinal, event); err != nil {
+		return err
+	}
+
+	result.Applied = append(result.Applied, model.SyncApplied{
+		Op:        change.Op,
+		ClientRef: change.ClientRef,
+		NoteID:    noteFinal.NoteID,
+		Version:   noteFinal.Version,
+	})
+	return nil
+}
+
+// syncModify updates or deletes a note if it is still
+// at the base version of the client
+func syncModify(batch store.SyncBatch, user model.User, change model.SyncChange, client model.ClientInfo, result *model.SyncPushResult) error {
+	conflict := func(reason string, server *model.Note) {
+		result.Conflicts = append(result.Conflicts, model.SyncConflict{
+			Op:        change.Op,
+			ClientRef: change.ClientRef,
+			NoteID:    change.NoteID,
+			Reason:    reason,
+			Server:    server,
+		})
+	}
+
+	// does the note exist + does the user have right to modify this note
+	noteFinal, err := batch.FindOne(store.Personal(user.UserID), change.NoteID)
+	if err != nil {
+		conflict("not found", nil)
+		return nil
+	}
+	if noteFinal.DeletedAt.Valid {
+		conflict("deleted", nil)
+		return nil
+	}
+	if noteFinal.Version != change.BaseVersion {
+		conflict("version mismatch", &noteFinal)
+		return nil
+	}
+
+	if change.Op == "delete" {
+		event := newAuditEvent(user.IDAuth, AuditNoteDelete, AuditResourceNote, noteFinal.NoteID, noteFinal, nil, client)
+		err = batch.Delete(&noteFinal, change.BaseVersion, event)
+	} else {
+		noteBefore := noteFinal
+
+		// security: user must not be able to manipulate all fields
+		msg, changed := applyNote(change.Note, &noteFinal)
+		if msg != "" {
+			result.Rejected = append(result.Rejected, model.SyncRejected{
+				Op:        change.Op,
+				ClientRef: change.ClientRef,
+				NoteID:    change.NoteID,
+				Message:   msg,
+			})
+			return nil
+		}
+		if !changed {
+			result.Applied = append(result.Applied, model.SyncApplied{
+				Op:        change.Op,
+				ClientRef: change.ClientRef,
+				NoteID:    noteFinal.NoteID,
+				Version:   noteFinal.Version,
+			})
+			return nil
+		}
+
+		event := newAuditEvent(user.IDAuth, AuditNoteUpdate, AuditResourceNote, noteFinal.NoteID, noteBefore, noteFinal, client)
+		err = batch.Update(&noteFinal, change.BaseVersion, event)
+	}
+	if errors.Is(err, store.ErrConflict) {
+		conflict("version mismatch", nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result.Applied = append(result.Applied, model.SyncApplied{
+		Op:        change.Op,
+		ClientRef: change.ClientRef,
+		NoteID:    noteFinal.NoteID,
+		Version:   noteFinal.Version,
+	})
+	return nil
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+
+	"apidev/database/model"
+)
+
+// AvatarPath - route serving the avatars, see controller.GetAvatar
+const AvatarPath = "/api/v1/avatars/"
+
+// timeType - type of the timestamps converted by localize
+var timeType = reflect.TypeOf(time.Time{})
+
+// presentUser prepares a profile for a response
+// - the URL of the avatar includes its version, so it can be cached
+// - timestamps are rendered in the timezone of the user if preferred
+func presentUser(user *model.User) {
+	if user.Avatar != "" {
+		user.AvatarURL = AvatarPath + strconv.FormatUint(user.UserID, 10) + "?v=" + user.Avatar
+	}
+	localize(user, userLocation(*user))
+}
+
+// userLocation returns the timezone the user wants timestamps
+// rendered in, nil to keep UTC
+func userLocation(user model.User) *time.Location {
+	if !user.Preferences.LocalTime || user.Timezone == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// localize converts all timestamps in v to loc
+//
+// - v is a pointer to a struct or a slice of structs
+// - nested and embedded structs are converted, unexported fields are not
+// - nothing happens if loc is nil
+func localize(v interface{}, loc *time.Location) {
+	if loc == nil {
+		return
+	}
+	localizeValue(reflect.ValueOf(v), loc)
+}
+
+// localizeValue walks a value for localize
+func localizeValue(v reflect.Value, loc *time.Location) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			localizeValue(v.Elem(), loc)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			localizeValue(v.Index(i), loc)
+		}
+	case reflect.Struct:
+		if v.Type() == timeType {
+			if t := v.Interface().(time.Time); v.CanSet() && !t.IsZero() {
+				v.Set(reflect.ValueOf(t.In(loc)))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				localizeValue(v.Field(i), loc)
+			}
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pilinux/argon2"
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/scope"
+)
+
+// AccessTokenPrefix - prefix of personal access tokens,
+// the token is the prefix, the token ID, "_" and the secret
+const AccessTokenPrefix = "pat_"
+
+// limits of personal access tokens
+const (
+	AccessTokenNameMaxLength = 100
+	AccessTokenMaxCount      = 50
+)
+
+// AccessTokenTouchInterval - the time a token was last used is
+// saved at most once per interval
+const AccessTokenTouchInterval = time.Minute
+
+// secretLength - random bytes of a secret made by newSecret
+const secretLength = 32
+
+// GetAccessTokens handles jobs for controller.GetAccessTokens
+func GetAccessTokens(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	tokens, err := tokenStore.FindTokens(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 1901")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = tokens
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CreateAccessToken handles jobs for controller.CreateAccessToken
+//
+// - the token is only returned in this response
+// - without expiresAt the token is valid until it is revoked
+func CreateAccessToken(userIDAuth uint64, token model.AccessToken, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	tokenFinal := model.AccessToken{
+		IDAuth:    userIDAuth,
+		Name:      strings.TrimSpace(token.Name),
+		ExpiresAt: token.ExpiresAt,
+	}
+
+	if tokenFinal.Name == "" {
+		httpResponse.Message = "name is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	if utf8.RuneCountInString(tokenFinal.Name) > AccessTokenNameMaxLength {
+		httpResponse.Message = fmt.Sprintf("name must not exceed %d characters", AccessTokenNameMaxLength)
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	scopes, ok := normalizeScopes(token.Scopes)
+	if !ok {
+		httpResponse.Message = "scopes must be one or more of " + strings.Join(scope.Scopes(), ", ")
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+	tokenFinal.Scopes = scopes
+
+	now := time.Now()
+	if tokenFinal.ExpiresAt != nil && !tokenFinal.ExpiresAt.After(now) {
+		httpResponse.Message = "expiresAt must be in the future"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	tokens, err := tokenStore.FindTokens(userIDAuth)
+	if err != nil {
+		log.WithError(err).Error("error code: 1911")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if len(tokens) >= AccessTokenMaxCount {
+		httpResponse.Message = fmt.Sprintf("no more than %d access tokens are allowed, revoke an unused one", AccessTokenMaxCount)
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	secret, hash, err := newSecret()
+	if err != nil {
+		log.WithError(err).Error("error code: 1912")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	tokenFinal.Hash = hash
+	tokenFinal.CreatedAt = now
+
+	// save in DB
+	if err := tokenStore.CreateToken(&tokenFinal); err != nil {
+		log.WithError(err).Error("error code: 1913")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendTokenEvent(userIDAuth, AuditTokenCreate, tokenFinal.TokenID, nil, tokenFinal, client)
+
+	tokenFinal.Token = AccessTokenPrefix + strconv.FormatUint(tokenFinal.TokenID, 10) + "_" + secret
+	httpResponse.Message = tokenFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// DeleteAccessToken handles jobs for controller.DeleteAccessToken
+//
+// - id: token ID, raw path parameter
+func DeleteAccessToken(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	token, err := findAccessToken(userIDAuth, id)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "access token not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1921")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if err := tokenStore.DeleteToken(token.TokenID); err != nil {
+		log.WithError(err).Error("error code: 1922")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	appendTokenEvent(userIDAuth, AuditTokenDelete, token.TokenID, token, nil, client)
+
+	httpResponse.Message = "access token ID# " + id + " revoked!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CheckAccessToken handles jobs for controller.AccessToken
+//
+// - raw: the token sent by the client
+// - required: the scope the requested route is covered by
+//
+// tokens of suspended accounts are rejected, the time the token
+// was last used is updated
+func CheckAccessToken(raw string, required scope.Scope) (token model.AccessToken, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	token, err := verifyAccessToken(raw)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "invalid access token"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1931")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(now) {
+		httpResponse.Message = "access token is expired"
+		httpStatusCode = http.StatusUnauthorized
+		return
+	}
+	if !scope.Allowed(token.Scopes, required) {
+		httpResponse.Message = "access token lacks the scope " + string(required)
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	_, err = suspensionStore.FindSuspension(token.IDAuth)
+	if err == nil {
+		httpResponse.Message = "account is suspended"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		log.WithError(err).Error("error code: 1932")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// a failed update does not reject the request
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= AccessTokenTouchInterval {
+		if err := tokenStore.TouchToken(token.TokenID, now); err != nil {
+			log.WithError(err).Error("error code: 1933")
+		}
+	}
+
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// verifyAccessToken returns the token matching a raw token,
+// ErrNotFound if it is malformed, unknown or the secret is wrong
+func verifyAccessToken(raw string) (model.AccessToken, error) {
+	if !strings.HasPrefix(raw, AccessTokenPrefix) {
+		return model.AccessToken{}, store.ErrNotFound
+	}
+	tokenID, secret, ok := splitSecret(strings.TrimPrefix(raw, AccessTokenPrefix))
+	if !ok {
+		return model.AccessToken{}, store.ErrNotFound
+	}
+
+	token, err := tokenStore.FindToken(tokenID)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+
+	match, err := matchSecret(secret, token.Hash)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+	if !match {
+		return model.AccessToken{}, store.ErrNotFound
+	}
+	return token, nil
+}
+
+// newSecret returns a random secret and its hash,
+// hashed like the passwords of gorest
+func newSecret() (secret, hash string, err error) {
+	b := make([]byte, secretLength)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	hash, err = hashSecret(secret)
+	return
+}
+
+// hashSecret returns the argon2 hash of a secret or a password
+// with the parameters gorest hashes passwords with
+func hashSecret(secret string) (string, error) {
+	configureSecurity := gconfig.GetConfig().Security
+	return argon2.CreateHash(secret, configureSecurity.HashSec, argon2.Params{
+		Memory:      configureSecurity.HashPass.Memory,
+		Iterations:  configureSecurity.HashPass.Iterations,
+		Parallelism: configureSecurity.HashPass.Parallelism,
+		SaltLength:  configureSecurity.HashPass.SaltLength,
+		KeyLength:   configureSecurity.HashPass.KeyLength,
+	})
+}
+
+// matchSecret reports whether a secret matches the hash made by newSecret
+func matchSecret(secret, hash string) (bool, error) {
+	return argon2.ComparePasswordAndHash(secret, gconfig.GetConfig().Security.HashSec, hash)
+}
+
+// splitSecret splits "<id>_<secret>", false if it is malformed
+func splitSecret(raw string) (uint64, string, bool) {
+	parts := strings.SplitN(raw, "_", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return 0, "", false
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, parts[1], true
+}
+
+// normalizeScopes returns the scopes sorted and without duplicates,
+// false if there is none or one is not declared
+func normalizeScopes(scopes []string) ([]string, bool) {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !scope.Valid(s) {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			normalized = append(normalized, s)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, len(normalized) > 0
+}
+
+// findAccessToken returns a token of the user
+// - id is the raw path parameter
+func findAccessToken(userIDAuth uint64, id string) (model.AccessToken, error) {
+	tokenID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return model.AccessToken{}, store.ErrNotFound
+	}
+	token, err := tokenStore.FindToken(tokenID)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+	if token.IDAuth != userIDAuth {
+		return model.AccessToken{}, store.ErrNotFound
+	}
+	return token, nil
+}
+
+// appendTokenEvent records a change of an access token, which is not
+// recorded by the store
+func appendTokenEvent(userIDAuth uint64, action string, tokenID uint64, before, after interface{}, client model.ClientInfo) {
+	event := newAuditEvent(userIDAuth, action, AuditResourceToken, tokenID, before, after, client)
+	if err := auditStore.Append(event); err != nil {
+		log.WithError(err).Error("error code: 1941")
+	}
+}
@@ -3,118 +3,266 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 
-	gdatabase "github.com/pilinux/gorest/database"
 	gmodel "github.com/pilinux/gorest/database/model"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
 
 	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/nickname"
+)
+
+// BioMaxLength - maximum length of the bio of a user in characters
+const BioMaxLength = 500
+
+// LocaleMaxLength - maximum length of a BCP 47 language tag
+const LocaleMaxLength = 35
+
+// allowed display preferences, the empty value is the default
+var (
+	userThemes      = map[string]bool{"": true, "system": true, "light": true, "dark": true}
+	userTimeFormats = map[string]bool{"": true, "24h": true, "12h": true}
 )
 
 // GetUserProfile handles jobs for controller.GetUserProfile
 func GetUserProfile(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	user := model.User{}
-
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&user).Error; err != nil {
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "user profile not found"
 		httpStatusCode = http.StatusNotFound
 		return
 	}
 
 	// return user profile
+	presentUser(&user)
 	httpResponse.Message = user
 	httpStatusCode = http.StatusOK
 	return
 }
 
 // CreateUserProfile handles jobs for controller.CreateUserProfile
-func CreateUserProfile(userIDAuth uint64, user model.User) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
+func CreateUserProfile(userIDAuth uint64, user model.User, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	userFinal := model.User{}
 
-	// remove all leading and trailing white spaces
-	user.NickName = strings.TrimSpace(user.NickName)
-	if user.NickName == "" {
-		httpResponse.Message = "user nickname is required"
+	// security: user must not be able to manipulate all fields
+	if msg, _ := applyUser(user, &userFinal); msg != "" {
+		httpResponse.Message = msg
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
 
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&userFinal).Error; err == nil {
+	if _, err := userStore.FindByAuthID(userIDAuth); err == nil {
 		httpResponse.Message = "user profile found, no need to create a new one"
 		httpStatusCode = http.StatusForbidden
 		return
 	}
 
-	// security: user must not be able to manipulate all fields
-	userFinal.NickName = user.NickName
+	// nicknames are unique
+	if msg, statusCode := claimNickname(model.User{}, &userFinal); msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = statusCode
+		return
+	}
+
 	userFinal.IDAuth = userIDAuth
 
 	// save in DB
-	tx := db.Begin()
-	if err := tx.Create(&userFinal).Error; err != nil {
-		tx.Rollback()
+	event := newAuditEvent(userIDAuth, AuditUserCreate, AuditResourceUser, 0, nil, userFinal, client)
+	err := userStore.Create(&userFinal, event)
+	if errors.Is(err, store.ErrConflict) {
+		// taken concurrently
+		httpResponse.Message = nicknameTaken
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if err != nil {
 		log.WithError(err).Error("error code: 1111")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
 		return
 	}
-	tx.Commit()
 
+	presentUser(&userFinal)
 	httpResponse.Message = userFinal
 	httpStatusCode = http.StatusCreated
 	return
 }
 
 // UpdateUserProfile handles jobs for controller.UpdateUserProfile
-func UpdateUserProfile(userIDAuth uint64, user model.User) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
-	db := gdatabase.GetDB()
-	userFinal := model.User{}
-
-	// remove all leading and trailing white spaces
-	user.NickName = strings.TrimSpace(user.NickName)
-	if user.NickName == "" {
-		httpResponse.Message = "user nickname is required"
-		httpStatusCode = http.StatusBadRequest
-		return
-	}
-
+//
+// omitted fields keep their stored value, empty ones are cleared
+func UpdateUserProfile(userIDAuth uint64, update model.UserUpdate, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
 	// does the user have an existing profile
-	if err := db.Where("id_auth = ?", userIDAuth).First(&userFinal).Error; err != nil {
+	userFinal, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
 		httpResponse.Message = "no user profile found"
 		httpStatusCode = http.StatusNotFound
 		return
 	}
 
+	// security: user must not be able to manipulate all fields
+	userBefore := userFinal
+	msg, changed := applyUser(mergeUser(update, userFinal), &userFinal)
+	if msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
 	// if no new info is received, abort
-	if user.NickName == userFinal.NickName {
+	if !changed {
 		httpResponse.Message = "no new info to update"
 		httpStatusCode = http.StatusBadRequest
 		return
 	}
 
-	// security: user must not be able to manipulate all fields
+	// nicknames are unique, changes are rate-limited
+	if msg, statusCode := claimNickname(userBefore, &userFinal); msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = statusCode
+		return
+	}
+
 	userFinal.UpdatedAt = time.Now()
-	userFinal.NickName = user.NickName
 
 	// update in DB
-	tx := db.Begin()
-	if err := tx.Save(&userFinal).Error; err != nil {
-		tx.Rollback()
+	event := newAuditEvent(userIDAuth, AuditUserUpdate, AuditResourceUser, userFinal.UserID, userBefore, userFinal, client)
+	err = userStore.Update(&userFinal, event)
+	if errors.Is(err, store.ErrConflict) {
+		// taken concurrently
+		httpResponse.Message = nicknameTaken
+		httpStatusCode = http.StatusConflict
+		return
+	}
+	if err != nil {
 		log.WithError(err).Error("error code: 1121")
 		httpResponse.Message = "internal server error"
 		httpStatusCode = http.StatusInternalServerError
 		return
 	}
-	tx.Commit()
+	reserveNickname(userBefore, userFinal)
 
+	presentUser(&userFinal)
 	httpResponse.Message = userFinal
 	httpStatusCode = http.StatusOK
 	return
 }
+
+// mergeUser returns the input of an update of a profile,
+// the omitted fields are taken from the stored profile
+func mergeUser(update model.UserUpdate, user model.User) model.User {
+	if update.NickName != nil {
+		user.NickName = *update.NickName
+	}
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+	if update.Timezone != nil {
+		user.Timezone = *update.Timezone
+	}
+	if update.Locale != nil {
+		user.Locale = *update.Locale
+	}
+	if prefs := update.Preferences; prefs != nil {
+		if prefs.Theme != nil {
+			user.Preferences.Theme = *prefs.Theme
+		}
+		if prefs.TimeFormat != nil {
+			user.Preferences.TimeFormat = *prefs.TimeFormat
+		}
+		if prefs.LocalTime != nil {
+			user.Preferences.LocalTime = *prefs.LocalTime
+		}
+	}
+	return user
+}
+
+// applyUser validates the input of a profile and copies the fields a user
+// is allowed to modify into userFinal
+//
+// - a new or changed nickname must follow the nickname policy,
+// profiles created before it keep their nickname until it is changed
+// - timezone is an IANA time zone name, locale a BCP 47 language tag,
+// both are stored in canonical form
+// - msg describes why the input was rejected
+// - changed reports whether userFinal was modified
+func applyUser(user model.User, userFinal *model.User) (msg string, changed bool) {
+	// remove all leading and trailing white spaces
+	user.NickName = strings.TrimSpace(user.NickName)
+	if user.NickName == "" {
+		msg = "user nickname is required"
+		return
+	}
+	nickKey := userFinal.NickKey
+	if user.NickName != userFinal.NickName {
+		display, key, err := nickname.Normalize(user.NickName)
+		if err != nil {
+			msg = err.Error()
+			return
+		}
+		user.NickName = display
+		nickKey = &key
+	}
+
+	user.Bio = strings.TrimSpace(user.Bio)
+	if utf8.RuneCountInString(user.Bio) > BioMaxLength {
+		msg = fmt.Sprintf("bio must not be longer than %d characters", BioMaxLength)
+		return
+	}
+
+	user.Timezone = strings.TrimSpace(user.Timezone)
+	if user.Timezone != "" {
+		// Local is the zone of the server, not a zone of the user
+		loc, err := time.LoadLocation(user.Timezone)
+		if err != nil || user.Timezone == "Local" {
+			msg = "timezone must be an IANA time zone, e.g. Europe/Berlin"
+			return
+		}
+		user.Timezone = loc.String()
+	}
+
+	user.Locale = strings.TrimSpace(user.Locale)
+	if user.Locale != "" {
+		tag, err := language.Parse(user.Locale)
+		if err != nil || len(tag.String()) > LocaleMaxLength {
+			msg = "locale must be a BCP 47 language tag, e.g. en-US"
+			return
+		}
+		user.Locale = tag.String()
+	}
+
+	prefs := user.Preferences
+	if !userThemes[prefs.Theme] {
+		msg = "preferences.theme must be one of system, light, dark"
+		return
+	}
+	if !userTimeFormats[prefs.TimeFormat] {
+		msg = "preferences.timeFormat must be one of 24h, 12h"
+		return
+	}
+	if prefs.LocalTime && user.Timezone == "" {
+		msg = "preferences.localTime requires a timezone"
+		return
+	}
+
+	changed = user.NickName != userFinal.NickName || user.Bio != userFinal.Bio ||
+		user.Timezone != userFinal.Timezone || user.Locale != userFinal.Locale ||
+		prefs != userFinal.Preferences
+
+	userFinal.NickName = user.NickName
+	userFinal.NickKey = nickKey
+	userFinal.Bio = user.Bio
+	userFinal.Timezone = user.Timezone
+	userFinal.Locale = user.Locale
+	userFinal.Preferences = prefs
+	return
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"apidev/database/model"
+)
+
+func TestGetUserProfile(t *testing.T) {
+	useMemoryStores(t)
+	createProfile(t, 1, "alice")
+
+	tests := []struct {
+		name   string
+		authID uint64
+		want   int
+	}{
+		{"existing profile", 1, http.StatusOK},
+		{"no profile", 2, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := GetUserProfile(tt.authID)
+			if statusCode != tt.want {
+				t.Errorf("GetUserProfile() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateUserProfile(t *testing.T) {
+	useMemoryStores(t)
+	createProfile(t, 1, "alice")
+
+	tests := []struct {
+		name   string
+		authID uint64
+		user   model.User
+		want   int
+	}{
+		{"new profile", 2, model.User{NickName: "bob", Timezone: "Europe/Berlin", Locale: "en-us"}, http.StatusCreated},
+		{"profile exists", 1, model.User{NickName: "alice2"}, http.StatusForbidden},
+		{"nickname taken", 3, model.User{NickName: "Alice"}, http.StatusConflict},
+		{"no nickname", 3, model.User{NickName: " "}, http.StatusBadRequest},
+		{"bio too long", 3, model.User{NickName: "carol", Bio: strings.Repeat("x", BioMaxLength+1)}, http.StatusBadRequest},
+		{"unknown timezone", 3, model.User{NickName: "carol", Timezone: "Mars/Olympus"}, http.StatusBadRequest},
+		{"local timezone", 3, model.User{NickName: "carol", Timezone: "Local"}, http.StatusBadRequest},
+		{"invalid locale", 3, model.User{NickName: "carol", Locale: "not a locale"}, http.StatusBadRequest},
+		{"unknown theme", 3, model.User{NickName: "carol", Preferences: model.UserPreferences{Theme: "pink"}}, http.StatusBadRequest},
+		{"local time without timezone", 3, model.User{NickName: "carol", Preferences: model.UserPreferences{LocalTime: true}}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := CreateUserProfile(tt.authID, tt.user, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("CreateUserProfile() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	user, err := userStore.FindByAuthID(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Timezone != "Europe/Berlin" || user.Locale != "en-US" {
+		t.Errorf("stored profile = %q %q, want the canonical timezone and locale", user.Timezone, user.Locale)
+	}
+}
+
+// optional returns a pointer to the value of an optional field
+func optional(s string) *string {
+	return &s
+}
+
+func TestUpdateUserProfile(t *testing.T) {
+	useMemoryStores(t)
+	createProfile(t, 1, "alice")
+	createProfile(t, 2, "bob")
+
+	tests := []struct {
+		name   string
+		authID uint64
+		update model.UserUpdate
+		want   int
+	}{
+		{"no profile", 3, model.UserUpdate{NickName: optional("carol")}, http.StatusNotFound},
+		{"no nickname", 1, model.UserUpdate{NickName: optional(" ")}, http.StatusBadRequest},
+		{"nothing", 1, model.UserUpdate{}, http.StatusBadRequest},
+		{"unchanged", 1, model.UserUpdate{NickName: optional("alice")}, http.StatusBadRequest},
+		{"nickname of another user", 1, model.UserUpdate{NickName: optional("BOB")}, http.StatusConflict},
+		{"unknown time format", 1, model.UserUpdate{Preferences: &model.UserPreferencesUpdate{TimeFormat: optional("36h")}}, http.StatusBadRequest},
+		{"bio", 1, model.UserUpdate{Bio: optional("hello")}, http.StatusOK},
+		{"timezone", 1, model.UserUpdate{Timezone: optional("Europe/Berlin")}, http.StatusOK},
+		{"new nickname", 1, model.UserUpdate{NickName: optional("alice2")}, http.StatusOK},
+		{"nickname changed too soon", 1, model.UserUpdate{NickName: optional("alice3")}, http.StatusTooManyRequests},
+		{"previous nickname is reserved", 2, model.UserUpdate{NickName: optional("alice")}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := UpdateUserProfile(tt.authID, tt.update, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("UpdateUserProfile() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+		})
+	}
+
+	// the fields omitted by the updates keep their values
+	user, err := userStore.FindByAuthID(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.NickName != "alice2" || user.Bio != "hello" || user.Timezone != "Europe/Berlin" {
+		t.Errorf("stored profile = %q %q %q, want the values of all updates", user.NickName, user.Bio, user.Timezone)
+	}
+}
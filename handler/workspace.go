@@ -0,0 +1,802 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	gconfig "github.com/pilinux/gorest/config"
+	gmodel "github.com/pilinux/gorest/database/model"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/text/unicode/norm"
+
+	"apidev/database/model"
+	"apidev/database/store"
+	"apidev/lib/mailer"
+	"apidev/lib/nickname"
+)
+
+// WorkspaceNameMaxLength - maximum length of the name of a workspace in characters
+const WorkspaceNameMaxLength = 100
+
+// WorkspaceInvitationTTL - time an invitation can be accepted
+const WorkspaceInvitationTTL = 7 * 24 * time.Hour
+
+// workspaceRoleRank - order of the roles, a role includes
+// the permissions of all roles with a lower rank
+var workspaceRoleRank = map[string]int{
+	model.WorkspaceRoleViewer: 1,
+	model.WorkspaceRoleEditor: 2,
+	model.WorkspaceRoleAdmin:  3,
+	model.WorkspaceRoleOwner:  4,
+}
+
+// findMember returns the membership of a user in a workspace
+// if the user has at least the given role
+func findMember(workspaceID, userID uint64, role string) (model.WorkspaceMember, error) {
+	member, err := workspaceStore.FindMember(workspaceID, userID)
+	if err != nil {
+		return model.WorkspaceMember{}, err
+	}
+	if workspaceRoleRank[member.Role] < workspaceRoleRank[role] {
+		return model.WorkspaceMember{}, store.ErrNotFound
+	}
+	return member, nil
+}
+
+// findWorkspaceMember is findMember for the raw path parameter
+// of a workspace
+func findWorkspaceMember(user model.User, id, role string) (model.WorkspaceMember, error) {
+	workspaceID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return model.WorkspaceMember{}, store.ErrNotFound
+	}
+	return findMember(workspaceID, user.UserID, role)
+}
+
+// workspaceAccess returns the profile of a user and their membership
+// in a workspace, httpStatusCode is set if the user is no member
+// or has a lower role than required
+func workspaceAccess(userIDAuth uint64, id, role string) (user model.User, member model.WorkspaceMember, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	// workspaces of other users are not disclosed
+	member, err = findWorkspaceMember(user, id, model.WorkspaceRoleViewer)
+	if err != nil {
+		httpResponse.Message = "workspace not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if workspaceRoleRank[member.Role] < workspaceRoleRank[role] {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+	}
+	return
+}
+
+// GetWorkspaces handles jobs for controller.GetWorkspaces
+//
+// all workspaces the user is a member of, with their role
+func GetWorkspaces(userIDAuth uint64) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	workspaces, err := workspaceStore.FindByMember(user.UserID)
+	if err != nil {
+		log.WithError(err).Error("error code: 1501")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	localize(workspaces, userLocation(user))
+	httpResponse.Message = workspaces
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// GetWorkspace handles jobs for controller.GetWorkspace
+func GetWorkspace(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleViewer)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	workspace, err := workspaceStore.FindOne(member.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1502")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	workspace.Role = member.Role
+	localize(&workspace, userLocation(user))
+	httpResponse.Message = workspace
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CreateWorkspace handles jobs for controller.CreateWorkspace
+//
+// the user creating a workspace becomes its owner
+func CreateWorkspace(userIDAuth uint64, workspace model.Workspace, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	workspaceFinal := model.Workspace{}
+
+	// security: user must not be able to manipulate all fields
+	if msg, _ := applyWorkspace(workspace, &workspaceFinal); msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	owner := model.WorkspaceMember{
+		IDUser: user.UserID,
+		Role:   model.WorkspaceRoleOwner,
+	}
+
+	// save in DB
+	event := newAuditEvent(userIDAuth, AuditWorkspaceCreate, AuditResourceWorkspace, 0, nil, workspaceFinal, client)
+	if err := workspaceStore.Create(&workspaceFinal, &owner, event); err != nil {
+		log.WithError(err).Error("error code: 1511")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	workspaceFinal.Role = owner.Role
+	localize(&workspaceFinal, userLocation(user))
+	httpResponse.Message = workspaceFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// UpdateWorkspace handles jobs for controller.UpdateWorkspace
+//
+// admins and the owner can rename a workspace
+func UpdateWorkspace(userIDAuth uint64, id string, workspace model.Workspace, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleAdmin)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	workspaceFinal, err := workspaceStore.FindOne(member.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1502")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// security: user must not be able to manipulate all fields
+	workspaceBefore := workspaceFinal
+	msg, changed := applyWorkspace(workspace, &workspaceFinal)
+	if msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// if no new info is received, abort
+	if !changed {
+		httpResponse.Message = "no new info to update"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	workspaceFinal.UpdatedAt = time.Now()
+
+	// update in DB
+	event := newAuditEvent(userIDAuth, AuditWorkspaceUpdate, AuditResourceWorkspace, workspaceFinal.WorkspaceID, workspaceBefore, workspaceFinal, client)
+	if err := workspaceStore.Update(&workspaceFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1521")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	workspaceFinal.Role = member.Role
+	localize(&workspaceFinal, userLocation(user))
+	httpResponse.Message = workspaceFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteWorkspace handles jobs for controller.DeleteWorkspace
+//
+// only the owner can delete a workspace, its notes are hard deleted
+func DeleteWorkspace(userIDAuth uint64, id string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	_, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleOwner)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	workspace, err := workspaceStore.FindOne(member.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1502")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	notes, err := noteStore.FindByOwner(store.InWorkspace(workspace.WorkspaceID))
+	if err != nil {
+		log.WithError(err).Error("error code: 1532")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// delete from DB
+	event := newAuditEvent(userIDAuth, AuditWorkspaceDelete, AuditResourceWorkspace, workspace.WorkspaceID, workspace, nil, client)
+	if err := workspaceStore.Delete(workspace, event); err != nil {
+		log.WithError(err).Error("error code: 1531")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	// notes were deleted around the note store, drop cached copies
+	if invalidator, ok := noteStore.(store.Invalidator); ok {
+		for _, note := range notes {
+			invalidator.Invalidate(note.NoteID)
+		}
+	}
+
+	httpResponse.Message = "workspace ID# " + id + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// applyWorkspace validates the input of a workspace and copies the fields
+// a user is allowed to modify into workspaceFinal
+//
+// - msg describes why the input was rejected
+// - changed reports whether workspaceFinal was modified
+func applyWorkspace(workspace model.Workspace, workspaceFinal *model.Workspace) (msg string, changed bool) {
+	// remove all leading and trailing white spaces
+	workspace.Name = strings.TrimSpace(workspace.Name)
+	if workspace.Name == "" {
+		msg = "workspace name is required"
+		return
+	}
+	if utf8.RuneCountInString(workspace.Name) > WorkspaceNameMaxLength {
+		msg = fmt.Sprintf("workspace name must not be longer than %d characters", WorkspaceNameMaxLength)
+		return
+	}
+
+	changed = workspace.Name != workspaceFinal.Name
+	workspaceFinal.Name = workspace.Name
+	return
+}
+
+// GetWorkspaceMembers handles jobs for controller.GetWorkspaceMembers
+func GetWorkspaceMembers(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleViewer)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	members, err := workspaceStore.FindMembers(member.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1541")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	for i := range members {
+		// profiles are purged after their memberships, a missing one
+		// is shown without a nickname
+		if profile, err := userStore.FindByID(members[i].IDUser); err == nil {
+			members[i].NickName = profile.NickName
+		}
+	}
+
+	localize(members, userLocation(user))
+	httpResponse.Message = members
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// UpdateWorkspaceMember handles jobs for controller.UpdateWorkspaceMember
+//
+// - admins and the owner can change the role of members
+// with a lower role than their own
+// - the new role must not be higher than the role of the user,
+// the owner role cannot be given away
+func UpdateWorkspaceMember(userIDAuth uint64, id, memberID string, input model.WorkspaceMember, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, actor, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleAdmin)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	memberFinal, httpResponse, httpStatusCode := findManagedMember(actor, memberID)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	if msg := checkGrantedRole(actor, input.Role); msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// if no new info is received, abort
+	if input.Role == memberFinal.Role {
+		httpResponse.Message = "no new info to update"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	memberBefore := memberFinal
+	memberFinal.Role = input.Role
+
+	// update in DB
+	event := newAuditEvent(userIDAuth, AuditMemberUpdate, AuditResourceMember, memberFinal.IDUser, memberBefore, memberFinal, client)
+	if err := workspaceStore.SaveMember(&memberFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1542")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	localize(&memberFinal, userLocation(user))
+	httpResponse.Message = memberFinal
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeleteWorkspaceMember handles jobs for controller.DeleteWorkspaceMember
+//
+// - every member except the owner can leave a workspace
+// - admins and the owner can remove members with a lower role
+// than their own
+// - notes written by the member stay in the workspace
+func DeleteWorkspaceMember(userIDAuth uint64, id, memberID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, actor, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleViewer)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	member := actor
+	if memberID != strconv.FormatUint(user.UserID, 10) {
+		if workspaceRoleRank[actor.Role] < workspaceRoleRank[model.WorkspaceRoleAdmin] {
+			httpResponse.Message = "user may not have access to perform this task"
+			httpStatusCode = http.StatusForbidden
+			return
+		}
+		member, httpResponse, httpStatusCode = findManagedMember(actor, memberID)
+		if httpStatusCode != 0 {
+			return
+		}
+	} else if member.Role == model.WorkspaceRoleOwner {
+		httpResponse.Message = "the owner cannot leave the workspace, delete it instead"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	// delete from DB
+	event := newAuditEvent(userIDAuth, AuditMemberDelete, AuditResourceMember, member.IDUser, member, nil, client)
+	if err := workspaceStore.DeleteMember(member, event); err != nil {
+		log.WithError(err).Error("error code: 1543")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = "member ID# " + memberID + " removed!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// findManagedMember returns a member of the workspace of the actor
+// whose role is lower than the role of the actor
+//
+// - memberID is the raw path parameter
+func findManagedMember(actor model.WorkspaceMember, memberID string) (member model.WorkspaceMember, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	userID, err := strconv.ParseUint(memberID, 10, 64)
+	if err != nil {
+		httpResponse.Message = "member not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	member, err = workspaceStore.FindMember(actor.IDWorkspace, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		httpResponse.Message = "member not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1544")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	if workspaceRoleRank[member.Role] >= workspaceRoleRank[actor.Role] {
+		httpResponse.Message = "user may not have access to perform this task"
+		httpStatusCode = http.StatusForbidden
+	}
+	return
+}
+
+// checkGrantedRole checks whether the actor may give a role to another user
+//
+// - msg describes why the role cannot be given
+func checkGrantedRole(actor model.WorkspaceMember, role string) (msg string) {
+	if workspaceRoleRank[role] == 0 || role == model.WorkspaceRoleOwner {
+		return "role must be one of admin, editor, viewer"
+	}
+	if workspaceRoleRank[role] > workspaceRoleRank[actor.Role] {
+		return "role must not be higher than your own"
+	}
+	return ""
+}
+
+// GetWorkspaceInvitations handles jobs for controller.GetWorkspaceInvitations
+//
+// pending invitations of a workspace, newest first
+func GetWorkspaceInvitations(userIDAuth uint64, id string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleAdmin)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	invitations, err := workspaceStore.FindInvitations(member.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1551")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	invitations = pendingInvitations(invitations)
+	localize(invitations, userLocation(user))
+	httpResponse.Message = invitations
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// CreateWorkspaceInvitation handles jobs for controller.CreateWorkspaceInvitation
+//
+// - an invitation is addressed either to the nickname of an existing user
+// or to an email address
+// - admins and the owner can invite, the role follows checkGrantedRole
+// - an invitation to an email address is sent to it if an email
+// provider is injected, see sendInvitation
+func CreateWorkspaceInvitation(userIDAuth uint64, id string, invitation model.WorkspaceInvitation, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, actor, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleAdmin)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	if msg := checkGrantedRole(actor, invitation.Role); msg != "" {
+		httpResponse.Message = msg
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	now := time.Now()
+	invitationFinal := model.WorkspaceInvitation{
+		ExpiresAt:   now.Add(WorkspaceInvitationTTL),
+		IDWorkspace: actor.IDWorkspace,
+		Role:        invitation.Role,
+		IDInvitedBy: user.UserID,
+	}
+
+	// remove all leading and trailing white spaces
+	invitation.NickName = strings.TrimSpace(invitation.NickName)
+	invitation.Email = strings.TrimSpace(invitation.Email)
+	if (invitation.NickName == "") == (invitation.Email == "") {
+		httpResponse.Message = "either nickName or email is required"
+		httpStatusCode = http.StatusBadRequest
+		return
+	}
+
+	if invitation.NickName != "" {
+		invitee, err := userStore.FindByNickname(nickname.Key(norm.NFKC.String(invitation.NickName)))
+		if errors.Is(err, store.ErrNotFound) || err == nil && invitee.DeleteAfter != nil {
+			httpResponse.Message = "user not found"
+			httpStatusCode = http.StatusNotFound
+			return
+		}
+		if err != nil {
+			log.WithError(err).Error("error code: 1562")
+			httpResponse.Message = "internal server error"
+			httpStatusCode = http.StatusInternalServerError
+			return
+		}
+
+		if _, err := workspaceStore.FindMember(actor.IDWorkspace, invitee.UserID); err == nil {
+			httpResponse.Message = "user is already a member of the workspace"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+		invitationFinal.IDUser = &invitee.UserID
+		invitationFinal.NickName = invitee.NickName
+	} else {
+		address, err := mail.ParseAddress(invitation.Email)
+		if err != nil || address.Address != invitation.Email {
+			httpResponse.Message = "email must be a valid email address"
+			httpStatusCode = http.StatusBadRequest
+			return
+		}
+		invitationFinal.Email = strings.ToLower(address.Address)
+	}
+
+	// one pending invitation per user or email address
+	pending, err := workspaceStore.FindInvitations(actor.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1551")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	for _, other := range pendingInvitations(pending) {
+		if invitationFinal.IDUser != nil && other.IDUser != nil && *other.IDUser == *invitationFinal.IDUser ||
+			invitationFinal.Email != "" && other.Email == invitationFinal.Email {
+			httpResponse.Message = "invitation already sent"
+			httpStatusCode = http.StatusConflict
+			return
+		}
+	}
+
+	// save in DB
+	event := newAuditEvent(userIDAuth, AuditInvitationCreate, AuditResourceInvitation, 0, nil, invitationFinal, client)
+	if err := workspaceStore.CreateInvitation(&invitationFinal, event); err != nil {
+		log.WithError(err).Error("error code: 1561")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+	if invitationFinal.Email != "" {
+		sendInvitation(user, invitationFinal)
+	}
+
+	localize(&invitationFinal, userLocation(user))
+	httpResponse.Message = invitationFinal
+	httpStatusCode = http.StatusCreated
+	return
+}
+
+// sendInvitation emails an invitation to its address, the invitee
+// finds it with GET my-invitations once logged in with that address;
+// without an email provider, the invitation is only listed there
+//
+// the template gets the variables of EMAIL_HTML_MODEL and
+// - email: address of the recipient
+// - workspace: name of the workspace
+// - inviter: nickname of the user who invited
+// - role: role given by the invitation
+// - days: days until the invitation expires
+func sendInvitation(inviter model.User, invitation model.WorkspaceInvitation) {
+	if emailSender == nil {
+		return
+	}
+	workspace, err := workspaceStore.FindOne(invitation.IDWorkspace)
+	if err != nil {
+		log.WithError(err).Error("error code: 1563")
+		return
+	}
+
+	variables := mailer.ParseModel(gconfig.GetConfig().EmailConf.HTMLModel)
+	variables["email"] = invitation.Email
+	variables["workspace"] = workspace.Name
+	variables["inviter"] = inviter.NickName
+	variables["role"] = invitation.Role
+	variables["days"] = strconv.Itoa(int(WorkspaceInvitationTTL.Hours() / 24))
+
+	ctx, cancel := context.WithTimeout(context.Background(), mailer.RequestTimeout)
+	defer cancel()
+	err = emailSender.Send(ctx, mailer.Message{
+		To:    invitation.Email,
+		Kind:  mailer.KindWorkspaceInvitation,
+		Model: variables,
+	})
+	if err != nil {
+		log.WithError(err).Error("error code: 1564")
+	}
+}
+
+// DeleteWorkspaceInvitation handles jobs for controller.DeleteWorkspaceInvitation
+//
+// admins and the owner can withdraw an invitation
+func DeleteWorkspaceInvitation(userIDAuth uint64, id, invitationID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	_, member, httpResponse, httpStatusCode := workspaceAccess(userIDAuth, id, model.WorkspaceRoleAdmin)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	invitation, httpResponse, httpStatusCode := findInvitation(invitationID, func(invitation model.WorkspaceInvitation) bool {
+		return invitation.IDWorkspace == member.IDWorkspace
+	})
+	if httpStatusCode != 0 {
+		return
+	}
+
+	return deleteInvitation(userIDAuth, invitation, client)
+}
+
+// GetMyInvitations handles jobs for controller.GetMyInvitations
+//
+// pending invitations addressed to the user or to the email address
+// of the logged-in account, newest first
+func GetMyInvitations(userIDAuth uint64, email string) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	invitations, err := workspaceStore.FindInvitationsFor(user.UserID, strings.ToLower(email))
+	if err != nil {
+		log.WithError(err).Error("error code: 1552")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	invitations = pendingInvitations(invitations)
+	for i := range invitations {
+		if workspace, err := workspaceStore.FindOne(invitations[i].IDWorkspace); err == nil {
+			invitations[i].WorkspaceName = workspace.Name
+		}
+	}
+
+	localize(invitations, userLocation(user))
+	httpResponse.Message = invitations
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// AcceptInvitation handles jobs for controller.AcceptInvitation
+//
+// the user joins the workspace with the role of the invitation
+func AcceptInvitation(userIDAuth uint64, email, invitationID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	user, invitation, httpResponse, httpStatusCode := findMyInvitation(userIDAuth, email, invitationID)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	if !invitation.ExpiresAt.After(time.Now()) {
+		httpResponse.Message = "invitation expired"
+		httpStatusCode = http.StatusGone
+		return
+	}
+	if _, err := workspaceStore.FindMember(invitation.IDWorkspace, user.UserID); err == nil {
+		httpResponse.Message = "user is already a member of the workspace"
+		httpStatusCode = http.StatusConflict
+		return
+	}
+
+	member := model.WorkspaceMember{
+		IDWorkspace: invitation.IDWorkspace,
+		IDUser:      user.UserID,
+		Role:        invitation.Role,
+	}
+
+	// save in DB
+	event := newAuditEvent(userIDAuth, AuditMemberCreate, AuditResourceMember, user.UserID, nil, member, client)
+	if err := workspaceStore.Accept(invitation, &member, event); err != nil {
+		log.WithError(err).Error("error code: 1571")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	member.NickName = user.NickName
+	localize(&member, userLocation(user))
+	httpResponse.Message = member
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// DeclineInvitation handles jobs for controller.DeclineInvitation
+func DeclineInvitation(userIDAuth uint64, email, invitationID string, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	_, invitation, httpResponse, httpStatusCode := findMyInvitation(userIDAuth, email, invitationID)
+	if httpStatusCode != 0 {
+		return
+	}
+
+	return deleteInvitation(userIDAuth, invitation, client)
+}
+
+// findMyInvitation returns the profile of a user and an invitation
+// addressed to them or to the email address of the logged-in account
+func findMyInvitation(userIDAuth uint64, email, invitationID string) (user model.User, invitation model.WorkspaceInvitation, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	// does the user have an existing profile
+	user, err := userStore.FindByAuthID(userIDAuth)
+	if err != nil {
+		httpResponse.Message = "no user profile found"
+		httpStatusCode = http.StatusForbidden
+		return
+	}
+
+	email = strings.ToLower(email)
+	invitation, httpResponse, httpStatusCode = findInvitation(invitationID, func(invitation model.WorkspaceInvitation) bool {
+		return invitation.IDUser != nil && *invitation.IDUser == user.UserID ||
+			email != "" && invitation.Email == email
+	})
+	return
+}
+
+// findInvitation returns an invitation the user may access
+//
+// - invitationID is the raw path parameter
+// - invitations of other users are reported as not found
+func findInvitation(invitationID string, allowed func(model.WorkspaceInvitation) bool) (invitation model.WorkspaceInvitation, httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	id, err := strconv.ParseUint(invitationID, 10, 64)
+	if err != nil {
+		httpResponse.Message = "invitation not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+
+	invitation, err = workspaceStore.FindInvitation(id)
+	if errors.Is(err, store.ErrNotFound) || err == nil && !allowed(invitation) {
+		httpResponse.Message = "invitation not found"
+		httpStatusCode = http.StatusNotFound
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("error code: 1553")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+	}
+	return
+}
+
+// deleteInvitation removes a withdrawn or declined invitation
+func deleteInvitation(userIDAuth uint64, invitation model.WorkspaceInvitation, client model.ClientInfo) (httpResponse gmodel.HTTPResponse, httpStatusCode int) {
+	event := newAuditEvent(userIDAuth, AuditInvitationDelete, AuditResourceInvitation, invitation.InvitationID, invitation, nil, client)
+	if err := workspaceStore.DeleteInvitation(invitation, event); err != nil {
+		log.WithError(err).Error("error code: 1581")
+		httpResponse.Message = "internal server error"
+		httpStatusCode = http.StatusInternalServerError
+		return
+	}
+
+	httpResponse.Message = "invitation ID# " + strconv.FormatUint(invitation.InvitationID, 10) + " deleted!"
+	httpStatusCode = http.StatusOK
+	return
+}
+
+// pendingInvitations drops expired invitations, they are removed
+// by PurgeAccounts
+func pendingInvitations(invitations []model.WorkspaceInvitation) []model.WorkspaceInvitation {
+	now := time.Now()
+	pending := []model.WorkspaceInvitation{}
+	for _, invitation := range invitations {
+		if invitation.ExpiresAt.After(now) {
+			pending = append(pending, invitation)
+		}
+	}
+	return pending
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"apidev/database/model"
+	"apidev/lib/mailer"
+)
+
+func TestCreateWorkspaceInvitation(t *testing.T) {
+	useMemoryStores(t)
+	sender := useMemoryMailer(t)
+	createProfile(t, 1, "alice")
+	createProfile(t, 2, "bob")
+
+	resp, statusCode := CreateWorkspace(1, model.Workspace{Name: "Team"}, model.ClientInfo{})
+	if statusCode != http.StatusCreated {
+		t.Fatalf("CreateWorkspace() = %d %v", statusCode, resp.Message)
+	}
+	id := strconv.FormatUint(resp.Message.(model.Workspace).WorkspaceID, 10)
+
+	tests := []struct {
+		name       string
+		invitation model.WorkspaceInvitation
+		want       int
+		sent       int
+	}{
+		{"nickname and email", model.WorkspaceInvitation{NickName: "bob", Email: "bob@example.com", Role: model.WorkspaceRoleEditor}, http.StatusBadRequest, 0},
+		{"invalid email", model.WorkspaceInvitation{Email: "carol", Role: model.WorkspaceRoleEditor}, http.StatusBadRequest, 0},
+		{"nickname", model.WorkspaceInvitation{NickName: "bob", Role: model.WorkspaceRoleEditor}, http.StatusCreated, 0},
+		{"email", model.WorkspaceInvitation{Email: "carol@example.com", Role: model.WorkspaceRoleViewer}, http.StatusCreated, 1},
+		{"email invited twice", model.WorkspaceInvitation{Email: "carol@example.com", Role: model.WorkspaceRoleViewer}, http.StatusConflict, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, statusCode := CreateWorkspaceInvitation(1, id, tt.invitation, model.ClientInfo{})
+			if statusCode != tt.want {
+				t.Errorf("CreateWorkspaceInvitation() = %d %v, want %d", statusCode, resp.Message, tt.want)
+			}
+			if sent := len(sender.Sent()); sent != tt.sent {
+				t.Errorf("sent %d emails, want %d", sent, tt.sent)
+			}
+		})
+	}
+
+	// the invitation is rendered with the templates of this application
+	msg, ok := sender.Last("carol@example.com")
+	if !ok || msg.Kind != mailer.KindWorkspaceInvitation {
+		t.Fatalf("email to carol@example.com = %+v, want an invitation", msg)
+	}
+	templates, err := mailer.NewTemplates("../templates/email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, text, _, err := templates.Render(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(subject, "alice invited you to Team") || !strings.Contains(text, "as viewer") {
+		t.Errorf("invitation email = %q\n%s", subject, text)
+	}
+}
@@ -0,0 +1,160 @@
+// Package avatar turns uploaded profile pictures into square images
+// of standard sizes and stores them
+//
+// uploads are cropped to the centered square and resampled once per
+// size, clients pick the size closest to their display
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"  // decode GIF uploads
+	_ "image/jpeg" // decode JPEG uploads
+	"image/png"
+	"io"
+)
+
+// Sizes - edge lengths in px of the stored images, ascending
+var Sizes = []int{64, 128, 256, 512}
+
+// SizeDefault - size served when the client asks for none
+const SizeDefault = 128
+
+// limits of an upload
+const (
+	MaxUploadSize = 5 << 20 // bytes
+	MaxDimension  = 8192    // px, width and height
+)
+
+// ContentType - format of the stored images
+const ContentType = "image/png"
+
+// errors of Process
+var (
+	ErrTooLarge   = errors.New("avatar must not be larger than 5 MiB")
+	ErrFormat     = errors.New("avatar must be a PNG, JPEG or GIF image")
+	ErrDimensions = errors.New("avatar must not be wider or higher than 8192 px")
+)
+
+// ValidSize reports whether images of the given size are stored
+func ValidSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Process decodes an upload and returns the PNG encoded image
+// for each of Sizes, and a version identifying the upload
+func Process(r io.Reader) (images map[int][]byte, version string, err error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > MaxUploadSize {
+		return nil, "", ErrTooLarge
+	}
+
+	// check the dimensions before the pixels are allocated
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrFormat
+	}
+	if config.Width > MaxDimension || config.Height > MaxDimension || config.Width == 0 || config.Height == 0 {
+		return nil, "", ErrDimensions
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrFormat
+	}
+
+	// resample the largest size from the upload,
+	// the smaller ones from the largest
+	square := crop(src)
+	largest := resize(square, Sizes[len(Sizes)-1])
+
+	images = map[int][]byte{}
+	for i := len(Sizes) - 1; i >= 0; i-- {
+		img := largest
+		if i < len(Sizes)-1 {
+			img = resize(largest, Sizes[i])
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+		images[Sizes[i]] = buf.Bytes()
+	}
+
+	sum := sha256.Sum256(data)
+	return images, hex.EncodeToString(sum[:8]), nil
+}
+
+// crop returns the centered square of an image as RGBA
+func crop(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	edge := b.Dx()
+	if b.Dy() < edge {
+		edge = b.Dy()
+	}
+	offset := image.Pt(b.Min.X+(b.Dx()-edge)/2, b.Min.Y+(b.Dy()-edge)/2)
+
+	dst := image.NewRGBA(image.Rect(0, 0, edge, edge))
+	draw.Draw(dst, dst.Bounds(), src, offset, draw.Src)
+	return dst
+}
+
+// resize resamples a square image to size x size px
+//
+// each pixel is the average of the source pixels it covers (box filter),
+// which keeps downscaled images free of aliasing, the premultiplied
+// alpha of RGBA averages transparent edges correctly
+func resize(src *image.RGBA, size int) *image.RGBA {
+	edge := src.Bounds().Dx()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0, y1 := span(y, size, edge)
+		for x := 0; x < size; x++ {
+			x0, x1 := span(x, size, edge)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					b += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+
+			j := dst.PixOffset(x, y)
+			dst.Pix[j] = uint8(r / n)
+			dst.Pix[j+1] = uint8(g / n)
+			dst.Pix[j+2] = uint8(b / n)
+			dst.Pix[j+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// span returns the source pixels [from, to) covered by
+// destination pixel i, at least one when upscaling
+func span(i, size, edge int) (from, to int) {
+	from = i * edge / size
+	to = (i + 1) * edge / size
+	if to <= from {
+		to = from + 1
+	}
+	return
+}
@@ -0,0 +1,149 @@
+package avatar
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when a user has no avatar
+var ErrNotFound = errors.New("avatar not found")
+
+// Image - a stored avatar of one size
+type Image struct {
+	Data    []byte
+	ModTime time.Time
+}
+
+// Storage - place of the processed avatars, keyed by user ID
+type Storage interface {
+	// Save replaces the avatar of a user with the images of Process
+	Save(userID uint64, images map[int][]byte) error
+	// Load returns the avatar of a user in one size
+	Load(userID uint64, size int) (Image, error)
+	// Delete removes the avatar of a user, no error if there is none
+	Delete(userID uint64) error
+}
+
+// Dir - Storage in a directory of the local file system
+//
+// <dir>/<userID>/<size>.png, when running several instances
+// the directory must be shared
+type Dir struct {
+	path string
+}
+
+// NewDir returns a Storage writing to the given directory,
+// it is created on the first upload
+func NewDir(path string) *Dir {
+	return &Dir{path: path}
+}
+
+// userDir - directory of the avatar of a user
+func (d *Dir) userDir(userID uint64) string {
+	return filepath.Join(d.path, strconv.FormatUint(userID, 10))
+}
+
+// Save writes all sizes, each file is replaced atomically
+func (d *Dir) Save(userID uint64, images map[int][]byte) error {
+	dir := d.userDir(userID)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return err
+	}
+
+	for size, data := range images {
+		file := filepath.Join(dir, strconv.Itoa(size)+".png")
+		tmp, err := os.CreateTemp(dir, ".upload-*")
+		if err != nil {
+			return err
+		}
+		if _, err := tmp.Write(data); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		if err := os.Rename(tmp.Name(), file); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+// Load reads the file of one size
+func (d *Dir) Load(userID uint64, size int) (Image, error) {
+	file := filepath.Join(d.userDir(userID), strconv.Itoa(size)+".png")
+	info, err := os.Stat(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return Image{}, ErrNotFound
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{Data: data, ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the directory of the user
+func (d *Dir) Delete(userID uint64) error {
+	return os.RemoveAll(d.userDir(userID))
+}
+
+// Memory - thread-safe Storage kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type Memory struct {
+	mu     sync.RWMutex
+	images map[uint64]map[int]Image
+}
+
+// NewMemory returns an empty in-memory Storage
+func NewMemory() *Memory {
+	return &Memory{images: map[uint64]map[int]Image{}}
+}
+
+// Save replaces the avatar of a user
+func (m *Memory) Save(userID uint64, images map[int][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	stored := map[int]Image{}
+	for size, data := range images {
+		stored[size] = Image{Data: data, ModTime: now}
+	}
+	m.images[userID] = stored
+	return nil
+}
+
+// Load returns the avatar of a user in one size
+func (m *Memory) Load(userID uint64, size int) (Image, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	img, ok := m.images[userID][size]
+	if !ok {
+		return Image{}, ErrNotFound
+	}
+	return img, nil
+}
+
+// Delete removes the avatar of a user
+func (m *Memory) Delete(userID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.images, userID)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package dataexport packs the data held about a user into
+// a ZIP archive of JSON files and stores it until it is downloaded
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ContentType - format of the archives
+const ContentType = "application/zip"
+
+// Build returns a ZIP archive with one indented JSON file per entry,
+// the names of the files are the keys of files plus ".json"
+//
+// - modTime is set on all files of the archive
+func Build(files map[string]interface{}, modTime time.Time) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for _, name := range names {
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name + ".json",
+			Method:   zip.Deflate,
+			Modified: modTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,128 @@
+package dataexport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrNotFound is returned when an archive does not exist
+var ErrNotFound = errors.New("data export not found")
+
+// Storage - place of the archives, keyed by export ID
+type Storage interface {
+	// Save stores the archive of an export
+	Save(exportID uint64, data []byte) error
+	// Load returns the archive of an export
+	Load(exportID uint64) ([]byte, error)
+	// Delete removes the archive of an export, no error if there is none
+	Delete(exportID uint64) error
+}
+
+// Dir - Storage in a directory of the local file system
+//
+// <dir>/<exportID>.zip, when running several instances
+// the directory must be shared
+type Dir struct {
+	path string
+}
+
+// NewDir returns a Storage writing to the given directory,
+// it is created with the first archive
+func NewDir(path string) *Dir {
+	return &Dir{path: path}
+}
+
+// file - path of the archive of an export
+func (d *Dir) file(exportID uint64) string {
+	return filepath.Join(d.path, strconv.FormatUint(exportID, 10)+".zip")
+}
+
+// Save writes the archive atomically, readable by the owner only
+func (d *Dir) Save(exportID uint64, data []byte) error {
+	if err := os.MkdirAll(d.path, 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(d.path, ".export-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.file(exportID)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Load reads the archive of an export
+func (d *Dir) Load(exportID uint64) ([]byte, error) {
+	data, err := os.ReadFile(d.file(exportID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Delete removes the archive of an export
+func (d *Dir) Delete(exportID uint64) error {
+	err := os.Remove(d.file(exportID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Memory - thread-safe Storage kept in memory
+//
+// for tests and demo mode, nothing is persisted
+type Memory struct {
+	mu       sync.RWMutex
+	archives map[uint64][]byte
+}
+
+// NewMemory returns an empty in-memory Storage
+func NewMemory() *Memory {
+	return &Memory{archives: map[uint64][]byte{}}
+}
+
+// Save stores the archive of an export
+func (m *Memory) Save(exportID uint64, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.archives[exportID] = data
+	return nil
+}
+
+// Load returns the archive of an export
+func (m *Memory) Load(exportID uint64) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	data, ok := m.archives[exportID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+// Delete removes the archive of an export
+func (m *Memory) Delete(exportID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.archives, exportID)
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package geo provides the geometry used by location queries:
+// points, bounding boxes and great-circle distances
+package geo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EarthRadius - mean radius of the earth in km
+const EarthRadius = 6371.0088
+
+// limits of the search radius in km
+const (
+	RadiusDefault = 10.0
+	RadiusMax     = 20015.0 // half the circumference of the earth
+)
+
+// Point - WGS 84 coordinates in degrees
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// BBox - area between two latitudes and two longitudes in degrees
+//
+// MinLng > MaxLng describes a box crossing the antimeridian
+type BBox struct {
+	MinLng float64
+	MinLat float64
+	MaxLng float64
+	MaxLat float64
+}
+
+// Query - filter of a location search
+// - Near: notes within Radius km of the point, ordered by distance
+// - BBox: notes inside the box
+// - both can be combined
+type Query struct {
+	Near   *Point
+	Radius float64
+	BBox   *BBox
+}
+
+// ValidLatLng reports whether coordinates are within range
+func ValidLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 &&
+		!math.IsNaN(lat) && !math.IsNaN(lng)
+}
+
+// ParsePoint parses "lat,lng"
+func ParsePoint(s string) (Point, error) {
+	values, err := parseFloats(s, 2)
+	if err != nil {
+		return Point{}, errors.New("near must be lat,lng")
+	}
+	if !ValidLatLng(values[0], values[1]) {
+		return Point{}, errors.New("near: latitude must be between -90 and 90, longitude between -180 and 180")
+	}
+	return Point{Lat: values[0], Lng: values[1]}, nil
+}
+
+// ParseBBox parses "minLng,minLat,maxLng,maxLat" (GeoJSON order)
+func ParseBBox(s string) (BBox, error) {
+	values, err := parseFloats(s, 4)
+	if err != nil {
+		return BBox{}, errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+	box := BBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	if !ValidLatLng(box.MinLat, box.MinLng) || !ValidLatLng(box.MaxLat, box.MaxLng) {
+		return BBox{}, errors.New("bbox: latitude must be between -90 and 90, longitude between -180 and 180")
+	}
+	if box.MinLat > box.MaxLat {
+		return BBox{}, errors.New("bbox: minLat must not be greater than maxLat")
+	}
+	return box, nil
+}
+
+// ParseQuery builds a query from the raw parameters near, radius and bbox,
+// it returns nil if no location filter is requested
+func ParseQuery(near, radius, bbox string) (*Query, error) {
+	if near == "" && bbox == "" {
+		if radius != "" {
+			return nil, errors.New("radius requires near")
+		}
+		return nil, nil
+	}
+
+	query := &Query{Radius: RadiusDefault}
+	if near != "" {
+		point, err := ParsePoint(near)
+		if err != nil {
+			return nil, err
+		}
+		query.Near = &point
+	}
+	if radius != "" {
+		if query.Near == nil {
+			return nil, errors.New("radius requires near")
+		}
+		r, err := strconv.ParseFloat(radius, 64)
+		if err != nil || r <= 0 || r > RadiusMax || math.IsNaN(r) {
+			return nil, errors.New("radius must be a number of km between 0 and 20015")
+		}
+		query.Radius = r
+	}
+	if bbox != "" {
+		box, err := ParseBBox(bbox)
+		if err != nil {
+			return nil, err
+		}
+		query.BBox = &box
+	}
+	return query, nil
+}
+
+// parseFloats parses n comma separated numbers
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, errors.New("wrong number of values")
+	}
+	values := make([]float64, n)
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Distance returns the great-circle distance between two points in km
+// (haversine formula)
+func Distance(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLng := radians(b.Lng - a.Lng)
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Around returns a box containing all points within radius km of p,
+// used to narrow down candidates before the exact distance is computed
+func Around(p Point, radius float64) BBox {
+	dLat := degrees(radius / EarthRadius)
+	box := BBox{MinLat: p.Lat - dLat, MaxLat: p.Lat + dLat, MinLng: -180, MaxLng: 180}
+
+	// a circle around a pole or larger than a hemisphere
+	// covers all longitudes
+	if box.MinLat <= -90 || box.MaxLat >= 90 || radius/EarthRadius >= math.Pi/2 {
+		box.MinLat = math.Max(box.MinLat, -90)
+		box.MaxLat = math.Min(box.MaxLat, 90)
+		return box
+	}
+
+	dLng := degrees(math.Asin(math.Min(1, math.Sin(radius/EarthRadius)/math.Cos(radians(p.Lat)))))
+	if dLng >= 180 {
+		return box
+	}
+	box.MinLng = wrapLng(p.Lng - dLng)
+	box.MaxLng = wrapLng(p.Lng + dLng)
+	return box
+}
+
+// Contains reports whether a point is inside the box
+func (b BBox) Contains(p Point) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng <= b.MaxLng {
+		return p.Lng >= b.MinLng && p.Lng <= b.MaxLng
+	}
+	// crossing the antimeridian
+	return p.Lng >= b.MinLng || p.Lng <= b.MaxLng
+}
+
+// wrapLng maps a longitude to [-180, 180]
+func wrapLng(lng float64) float64 {
+	for lng < -180 {
+		lng += 360
+	}
+	for lng > 180 {
+		lng -= 360
+	}
+	return lng
+}
+
+// radians converts degrees to radians
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// degrees converts radians to degrees
+func degrees(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
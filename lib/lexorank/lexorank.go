@@ -0,0 +1,138 @@
+// Package lexorank generates sort keys for manually ordered lists
+// (fractional indexing)
+//
+// a key is a base-36 fraction without its leading "0.", a new key
+// between two neighbours can always be found, so moving an item
+// only changes the key of that item
+//
+// the alphabet is limited to digits and upper case letters, so
+// case-insensitive collations of MySQL and PostgreSQL sort keys in
+// the same order as bytes
+package lexorank
+
+import (
+	"errors"
+	"strings"
+)
+
+// Alphabet - digits of a key in ascending order
+const Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// MaxLength - keys longer than this should be rebalanced with Spread
+const MaxLength = 32
+
+// ErrOrder is returned when the bounds are not in ascending order
+var ErrOrder = errors.New("lexorank: lower bound must be smaller than upper bound")
+
+// ErrInvalid is returned for keys with characters outside the alphabet
+// or with a trailing zero
+var ErrInvalid = errors.New("lexorank: invalid key")
+
+// Valid reports whether a key is well-formed, the empty key is not valid
+func Valid(key string) bool {
+	if key == "" || key[len(key)-1] == Alphabet[0] {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(Alphabet, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Between returns a key sorting strictly between a and b
+// - a == "": no lower bound (start of the list)
+// - b == "": no upper bound (end of the list)
+func Between(a, b string) (string, error) {
+	if a != "" && !Valid(a) || b != "" && !Valid(b) {
+		return "", ErrInvalid
+	}
+	if a != "" && b != "" && a >= b {
+		return "", ErrOrder
+	}
+	return midpoint(a, b), nil
+}
+
+// midpoint returns a key between a and b, b == "" stands for 1
+func midpoint(a, b string) string {
+	// keep the common prefix, a is padded with zeros
+	n := 0
+	for n < len(b) && digitAt(a, n) == b[n] {
+		n++
+	}
+	if n > 0 {
+		rest := ""
+		if n < len(a) {
+			rest = a[n:]
+		}
+		return b[:n] + midpoint(rest, b[n:])
+	}
+
+	da := strings.IndexByte(Alphabet, digitAt(a, 0))
+	db := len(Alphabet)
+	if b != "" {
+		db = strings.IndexByte(Alphabet, b[0])
+	}
+
+	// room between the first digits
+	if db-da > 1 {
+		return string(Alphabet[(da+db)/2])
+	}
+
+	// consecutive first digits: the first digit of b alone is smaller
+	// than b if b has more digits
+	if len(b) > 1 {
+		return b[:1]
+	}
+
+	// append to a
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(Alphabet[da]) + midpoint(rest, "")
+}
+
+// digitAt returns the digit of a key at position i, zero past its end
+func digitAt(key string, i int) byte {
+	if i < len(key) {
+		return key[i]
+	}
+	return Alphabet[0]
+}
+
+// Spread returns n evenly spaced keys in ascending order,
+// used to rebalance a list whose keys got too long
+func Spread(n int) []string {
+	keys := make([]string, 0, n)
+	if n <= 0 {
+		return keys
+	}
+
+	// shortest width leaving a gap of at least the size of
+	// the alphabet between two keys
+	base := uint64(len(Alphabet))
+	width, space := 1, base
+	for space < uint64(n+1)*base {
+		width++
+		space *= base
+	}
+
+	step := space / uint64(n+1)
+	for i := 1; i <= n; i++ {
+		keys = append(keys, encode(uint64(i)*step, width))
+	}
+	return keys
+}
+
+// encode writes v as a key of the given width without trailing zeros
+func encode(v uint64, width int) string {
+	digits := make([]byte, width)
+	base := uint64(len(Alphabet))
+	for i := width - 1; i >= 0; i-- {
+		digits[i] = Alphabet[v%base]
+		v /= base
+	}
+	return strings.TrimRight(string(digits), Alphabet[:1])
+}
@@ -0,0 +1,162 @@
+// Package lockout throttles failed attempts to guess a secret, e.g. the
+// password of an account or the logins from an IP
+//
+// the first failures of a key are free, the next ones delay its next
+// attempt by a doubling wait, from a threshold on the key is locked
+// for a doubling duration; the failures are forgotten after a window
+// without failure or when the key is reset
+//
+// an attempt is counted as failed before it is made, so that
+// concurrent attempts cannot pass the throttling all at once
+package lockout
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Policy - when the attempts of a key are delayed or locked
+type Policy struct {
+	// FreeAttempts - failures without delay
+	FreeAttempts int
+	// Delay - wait after the first delayed failure, doubled after each
+	// further one up to MaxDelay
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Threshold - failures which lock the key for Duration, doubled
+	// after each further one up to MaxDuration, 0 disables the lockout
+	Threshold   int
+	Duration    time.Duration
+	MaxDuration time.Duration
+	// Window - failures are forgotten this long after the last one
+	Window time.Duration
+}
+
+// Check validates the policy
+func (p Policy) Check() error {
+	if p.FreeAttempts < 0 || p.Threshold < 0 {
+		return errors.New("lockout: negative attempts")
+	}
+	if p.Threshold > 0 && p.Threshold <= p.FreeAttempts {
+		return errors.New("lockout: the threshold must exceed the free attempts")
+	}
+	if p.Delay < 0 || p.MaxDelay < p.Delay || p.Duration < 0 || p.MaxDuration < p.Duration {
+		return errors.New("lockout: invalid delay or duration")
+	}
+	if p.Window <= 0 {
+		return errors.New("lockout: invalid window")
+	}
+	return nil
+}
+
+// wait returns how long the attempts are rejected after a failure
+// and whether the key is locked
+func (p Policy) wait(failures int64) (time.Duration, bool) {
+	if p.Threshold > 0 && failures >= int64(p.Threshold) {
+		return double(p.Duration, failures-int64(p.Threshold), p.MaxDuration), true
+	}
+	if failures > int64(p.FreeAttempts) {
+		return double(p.Delay, failures-int64(p.FreeAttempts)-1, p.MaxDelay), false
+	}
+	return 0, false
+}
+
+// double returns d doubled n times, at most max
+func double(d time.Duration, n int64, max time.Duration) time.Duration {
+	for ; n > 0 && d < max; n-- {
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// Store - failures and blocks of the keys
+type Store interface {
+	// Reserve counts an attempt of a key as failed before it is made,
+	// unless the key is blocked; both are done atomically, so that
+	// concurrent attempts are counted one after the other
+	//
+	// - ttl: the failures expire this long after the last one
+	// - free: attempts beyond them block the key for hold at once,
+	// until the caller blocks it for the wait of the failure
+	//
+	// returns the failures since the key was reset, or the time the key
+	// is blocked until if the attempt is rejected
+	Reserve(ctx context.Context, key string, ttl time.Duration, free int64, hold time.Duration) (failures int64, blocked time.Time, err error)
+	// Release uncounts a reserved attempt which did not fail,
+	// the block it caused is kept until it expires
+	Release(ctx context.Context, key string) error
+	// Block rejects the attempts of a key until the given time
+	Block(ctx context.Context, key string, until time.Time) error
+	// Reset removes the failures and the block of keys
+	Reset(ctx context.Context, keys ...string) error
+}
+
+// Reservation - an attempt counted as failed before it is made
+type Reservation struct {
+	// RetryAfter - the attempt is rejected, the key is blocked this long
+	RetryAfter time.Duration
+	// Failures - failures of the key if the attempt fails
+	Failures int64
+	// Wait - the attempts are rejected this long if it fails
+	Wait time.Duration
+	// Locked - a failure reaches the threshold, the key is locked for
+	// the first time since its failures were reset or expired
+	Locked bool
+}
+
+// Limiter - throttles the keys of a store with a policy
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+// New returns a Limiter
+func New(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Reserve counts an attempt of a key as failed before it is made and
+// delays or locks the key as if it failed, the attempt must not be
+// made if RetryAfter is set
+//
+// a successful attempt resets the key, another outcome releases it
+func (l *Limiter) Reserve(ctx context.Context, key string) (Reservation, error) {
+	free := int64(l.policy.FreeAttempts)
+	hold, _ := l.policy.wait(free + 1)
+
+	failures, blocked, err := l.store.Reserve(ctx, key, l.policy.Window, free, hold)
+	if err != nil {
+		return Reservation{}, err
+	}
+	if wait := time.Until(blocked); wait > 0 {
+		return Reservation{RetryAfter: wait}, nil
+	}
+
+	wait, locked := l.policy.wait(failures)
+	reservation := Reservation{
+		Failures: failures,
+		Wait:     wait,
+		Locked:   locked && failures == int64(l.policy.Threshold),
+	}
+	if wait > 0 {
+		if err := l.store.Block(ctx, key, time.Now().Add(wait)); err != nil {
+			return reservation, err
+		}
+	}
+	return reservation, nil
+}
+
+// Release uncounts a reserved attempt which neither failed nor
+// succeeded, e.g. an invalid request
+func (l *Limiter) Release(ctx context.Context, key string) error {
+	return l.store.Release(ctx, key)
+}
+
+// Reset forgets the failures of keys, e.g. after a successful attempt
+func (l *Limiter) Reset(ctx context.Context, keys ...string) error {
+	return l.store.Reset(ctx, keys...)
+}
@@ -0,0 +1,105 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval - expired keys are removed at most this often
+const memorySweepInterval = time.Minute
+
+// memoryEntry - failures and block of a key
+type memoryEntry struct {
+	failures  int64
+	expiresAt time.Time
+	blocked   time.Time
+}
+
+// Memory - Store of a single instance, the keys are lost on restart
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+// NewMemory returns an empty Memory store
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*memoryEntry{}}
+}
+
+// Reserve counts an attempt of a key as failed unless it is blocked
+func (m *Memory) Reserve(_ context.Context, key string, ttl time.Duration, free int64, hold time.Duration) (int64, time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now)
+
+	entry := m.entries[key]
+	if entry == nil {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+	if entry.blocked.After(now) {
+		return 0, entry.blocked, nil
+	}
+	if !entry.expiresAt.After(now) {
+		entry.failures = 0
+	}
+	entry.failures++
+	entry.expiresAt = now.Add(ttl)
+	if entry.failures > free && hold > 0 {
+		entry.blocked = now.Add(hold)
+	}
+	return entry.failures, time.Time{}, nil
+}
+
+// Release uncounts a reserved attempt of a key
+func (m *Memory) Release(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry := m.entries[key]; entry != nil && entry.failures > 0 {
+		entry.failures--
+	}
+	return nil
+}
+
+// Block rejects the attempts of a key until the given time
+func (m *Memory) Block(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[key]
+	if entry == nil {
+		entry = &memoryEntry{}
+		m.entries[key] = entry
+	}
+	entry.blocked = until
+	return nil
+}
+
+// Reset removes the failures and the block of keys
+func (m *Memory) Reset(_ context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.entries, key)
+	}
+	return nil
+}
+
+// sweep removes the keys without failures or block
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < memorySweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, entry := range m.entries {
+		if !entry.expiresAt.After(now) && !entry.blocked.After(now) {
+			delete(m.entries, key)
+		}
+	}
+}
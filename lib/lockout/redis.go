@@ -0,0 +1,124 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mediocregopher/radix/v4"
+)
+
+// Redis - Store shared by all instances of the application
+//
+// the failures of a key are a counter, its block a key expiring with it;
+// an attempt is reserved by a script, atomically
+type Redis struct {
+	client  radix.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedis returns a Redis store
+// - prefix: namespace of the keys
+// - timeout: limit of every Redis command
+func NewRedis(client radix.Client, prefix string, timeout time.Duration) *Redis {
+	return &Redis{client: client, prefix: prefix, timeout: timeout}
+}
+
+// reserveScript - checks the block and counts the attempt in one step
+//
+// KEYS: failures, block; ARGV: now, ttl, free attempts, hold in ms
+var reserveScript = radix.NewEvalScript(`
+local blocked = tonumber(redis.call('GET', KEYS[2]) or '0')
+if blocked > tonumber(ARGV[1]) then
+	return {0, blocked}
+end
+local failures = redis.call('INCR', KEYS[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+if failures > tonumber(ARGV[3]) and tonumber(ARGV[4]) > 0 then
+	redis.call('SET', KEYS[2], tonumber(ARGV[1]) + tonumber(ARGV[4]), 'PX', ARGV[4])
+end
+return {failures, 0}
+`)
+
+// releaseScript - uncounts an attempt unless the failures expired
+//
+// KEYS: failures
+var releaseScript = radix.NewEvalScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// Reserve counts an attempt of a key as failed unless it is blocked
+func (r *Redis) Reserve(ctx context.Context, key string, ttl time.Duration, free int64, hold time.Duration) (int64, time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	reply := []int64{}
+	err := r.client.Do(ctx, reserveScript.Cmd(&reply, []string{r.failKey(key), r.blockKey(key)},
+		strconv.FormatInt(time.Now().UnixMilli(), 10),
+		strconv.FormatInt(ttl.Milliseconds(), 10),
+		strconv.FormatInt(free, 10),
+		strconv.FormatInt(hold.Milliseconds(), 10),
+	))
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if len(reply) != 2 {
+		return 0, time.Time{}, errors.New("lockout: unexpected reply of Redis")
+	}
+	if reply[1] > 0 {
+		return 0, time.UnixMilli(reply[1]), nil
+	}
+	return reply[0], time.Time{}, nil
+}
+
+// Release uncounts a reserved attempt of a key
+func (r *Redis) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.client.Do(ctx, releaseScript.Cmd(nil, []string{r.failKey(key)}))
+}
+
+// Block rejects the attempts of a key until the given time
+func (r *Redis) Block(ctx context.Context, key string, until time.Time) error {
+	ttl := time.Until(until).Milliseconds()
+	if ttl <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return r.client.Do(ctx, radix.FlatCmd(nil, "SET", r.blockKey(key), until.UnixMilli(), "PX", ttl))
+}
+
+// Reset removes the failures and the block of keys
+func (r *Redis) Reset(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	prefixed := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, r.failKey(key), r.blockKey(key))
+	}
+	return r.client.Do(ctx, radix.Cmd(nil, "DEL", prefixed...))
+}
+
+// failKey returns the Redis key of the failures of a key
+func (r *Redis) failKey(key string) string {
+	return r.prefix + "lockout:fail:" + key
+}
+
+// blockKey returns the Redis key of the block of a key
+func (r *Redis) blockKey(key string) string {
+	return r.prefix + "lockout:block:" + key
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir - Mailer writing the emails as .eml files into a directory
+// instead of sending them, for air-gapped environments where another
+// system picks them up, and for inspecting the rendered templates
+//
+// <dir>/<time>-<kind>-<random>.eml, readable by the owner only
+type Dir struct {
+	path      string
+	from      string
+	templates *Templates
+}
+
+// NewDir returns a Mailer writing to the given directory,
+// it is created with the first email
+func NewDir(path, from string, templates *Templates) *Dir {
+	return &Dir{path: path, from: from, templates: templates}
+}
+
+// Send writes the email atomically
+func (d *Dir) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	email, err := compose(d.templates, d.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102T150405.000000000Z") + "-" + msg.Kind + "-" + hex.EncodeToString(suffix) + ".eml"
+
+	if err := os.MkdirAll(d.path, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(d.path, ".email-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(email.data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.path, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
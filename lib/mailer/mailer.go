@@ -0,0 +1,99 @@
+// Package mailer sends the emails of this application, each email is
+// built from a template of its kind and the variables of a model
+package mailer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// kinds of emails, each provider has one template per kind
+const (
+	KindVerifyEmail         = "verifyEmail"
+	KindRecoverPassword     = "recoverPassword"
+	KindMagicLink           = "magicLink"
+	KindAccountLocked       = "accountLocked"
+	KindWorkspaceInvitation = "workspaceInvitation"
+)
+
+// ErrProvider is wrapped by the errors of a provider which failed to
+// deliver a message, another attempt may succeed
+var ErrProvider = errors.New("email provider error")
+
+// ErrMessage is wrapped by the errors of a message which cannot be
+// sent by any attempt, e.g. an invalid address or a missing template
+var ErrMessage = errors.New("invalid email")
+
+// Message - an email to one recipient
+type Message struct {
+	To   string
+	Kind string
+	// Model - variables of the template
+	Model map[string]string
+}
+
+// Mailer - an email provider
+type Mailer interface {
+	// Send delivers a message or returns why it could not
+	Send(ctx context.Context, msg Message) error
+}
+
+// ParseModel parses variables given as "key:value;key:value",
+// the format of EMAIL_HTML_MODEL, entries without a key are ignored
+func ParseModel(s string) map[string]string {
+	model := map[string]string{}
+	for _, entry := range strings.Split(s, ";") {
+		key, value, _ := strings.Cut(entry, ":")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		model[key] = strings.TrimSpace(value)
+	}
+	return model
+}
+
+// Memory - Mailer keeping the messages instead of sending them
+//
+// for tests and demo mode, the messages can be read with Sent
+type Memory struct {
+	mu       sync.RWMutex
+	messages []Message
+}
+
+// NewMemory returns a Memory without messages
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send keeps the message
+func (m *Memory) Send(_ context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far, oldest first
+func (m *Memory) Sent() []Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]Message(nil), m.messages...)
+}
+
+// Last returns the latest message sent to an address
+func (m *Memory) Last(to string) (Message, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if strings.EqualFold(m.messages[i].To, to) {
+			return m.messages[i], true
+		}
+	}
+	return Message{}, false
+}
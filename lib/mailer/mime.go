@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// composed - a message rendered into an RFC 5322 email
+type composed struct {
+	from string
+	to   string
+	data []byte
+}
+
+// compose renders a message with the templates into a multipart email
+// with a text and an HTML part
+func compose(templates *Templates, from string, msg Message, date time.Time) (composed, error) {
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return composed{}, fmt.Errorf("%w: sender: %v", ErrMessage, err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return composed{}, fmt.Errorf("%w: recipient: %v", ErrMessage, err)
+	}
+	subject, text, html, err := templates.Render(msg)
+	if err != nil {
+		return composed{}, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return composed{}, err
+	}
+	domain := fromAddr.Address[strings.LastIndex(fromAddr.Address, "@")+1:]
+
+	buf := &bytes.Buffer{}
+	body := multipart.NewWriter(buf)
+	header := []string{
+		"From: " + fromAddr.String(),
+		"To: " + toAddr.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject)),
+		"Date: " + date.Format(time.RFC1123Z),
+		"Message-ID: <" + hex.EncodeToString(id) + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/alternative; boundary=" + body.Boundary(),
+	}
+	buf.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := body.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return composed{}, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return composed{}, err
+		}
+		if err := qp.Close(); err != nil {
+			return composed{}, err
+		}
+	}
+	if err := body.Close(); err != nil {
+		return composed{}, err
+	}
+
+	return composed{from: fromAddr.Address, to: toAddr.Address, data: buf.Bytes()}, nil
+}
@@ -0,0 +1,109 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PostmarkURL - API of Postmark
+const PostmarkURL = "https://api.postmarkapp.com"
+
+// RequestTimeout - time limit of a request to a provider
+// when no Client is set
+const RequestTimeout = 10 * time.Second
+
+// Postmark - Mailer sending with the templates saved on a Postmark server
+type Postmark struct {
+	// Token - server token
+	Token string
+	From  string
+	// Stream - message stream, e.g. outbound
+	Stream     string
+	TrackOpens bool
+	// TrackLinks - None, HtmlAndText, HtmlOnly or TextOnly
+	TrackLinks string
+	// Templates - ID of the template of each kind
+	Templates map[string]int64
+	// Tags - tag of each kind, shown in the statistics of Postmark
+	Tags map[string]string
+
+	// URL - PostmarkURL if empty
+	URL string
+	// Client - HTTP client of all requests, a client with
+	// RequestTimeout if nil
+	Client *http.Client
+}
+
+// postmarkEmail - body of POST /email/withTemplate
+type postmarkEmail struct {
+	From          string            `json:"From"`
+	To            string            `json:"To"`
+	TemplateID    int64             `json:"TemplateId"`
+	TemplateModel map[string]string `json:"TemplateModel"`
+	Tag           string            `json:"Tag,omitempty"`
+	TrackOpens    bool              `json:"TrackOpens"`
+	TrackLinks    string            `json:"TrackLinks,omitempty"`
+	MessageStream string            `json:"MessageStream,omitempty"`
+}
+
+// postmarkResponse - result of POST /email/withTemplate
+type postmarkResponse struct {
+	ErrorCode int    `json:"ErrorCode"`
+	Message   string `json:"Message"`
+}
+
+// Send sends the message with the template of its kind
+func (p *Postmark) Send(ctx context.Context, msg Message) error {
+	templateID := p.Templates[msg.Kind]
+	if templateID == 0 {
+		return fmt.Errorf("%w: no template for %s", ErrMessage, msg.Kind)
+	}
+
+	body, err := json.Marshal(postmarkEmail{
+		From:          p.From,
+		To:            msg.To,
+		TemplateID:    templateID,
+		TemplateModel: msg.Model,
+		Tag:           p.Tags[msg.Kind],
+		TrackOpens:    p.TrackOpens,
+		TrackLinks:    p.TrackLinks,
+		MessageStream: p.Stream,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := p.URL
+	if url == "" {
+		url = PostmarkURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/email/withTemplate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.Token)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: RequestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	result := postmarkResponse{}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&result)
+	if resp.StatusCode != http.StatusOK || result.ErrorCode != 0 {
+		return fmt.Errorf("%w: status %d, code %d: %s", ErrProvider, resp.StatusCode, result.ErrorCode, result.Message)
+	}
+	return nil
+}
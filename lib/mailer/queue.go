@@ -0,0 +1,89 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrQueueFull is returned by Queue.Send when no message can be queued
+var ErrQueueFull = errors.New("email queue is full")
+
+// Queue - Mailer sending through another Mailer in the background
+//
+// Send only queues a message, the workers send it and retry a failure
+// after Delay, then after twice as long each time, until Attempts are
+// used up; a message which can never be sent (ErrMessage) is dropped
+// right away, dropped messages are logged
+type Queue struct {
+	mailer   Mailer
+	messages chan Message
+	attempts int
+	delay    time.Duration
+	timeout  time.Duration
+}
+
+// NewQueue returns a Queue of at most size messages
+// and starts its workers
+//
+// - attempts: tries per message, at least 1
+// - delay: wait before the first retry
+// - timeout: limit of each try
+func NewQueue(m Mailer, size, workers, attempts int, delay, timeout time.Duration) *Queue {
+	if attempts < 1 {
+		attempts = 1
+	}
+	q := &Queue{
+		mailer:   m,
+		messages: make(chan Message, size),
+		attempts: attempts,
+		delay:    delay,
+		timeout:  timeout,
+	}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+	return q
+}
+
+// Send queues the message, ErrQueueFull if there is no room
+func (q *Queue) Send(_ context.Context, msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// work sends the queued messages one after another
+func (q *Queue) work() {
+	for msg := range q.messages {
+		q.deliver(msg)
+	}
+}
+
+// deliver tries to send a message until it succeeds
+// or the attempts are used up
+func (q *Queue) deliver(msg Message) {
+	delay := q.delay
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), q.timeout)
+		err := q.mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if errors.Is(err, ErrMessage) || attempt >= q.attempts {
+			log.WithError(err).WithField("kind", msg.Kind).Error("error code: 2401")
+			return
+		}
+		log.WithError(err).WithField("kind", msg.Kind).Warn("error code: 2402")
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
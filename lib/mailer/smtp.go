@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// TLS modes of an SMTP server
+const (
+	// TLSStartTLS - upgrade the plain connection, usually port 587
+	TLSStartTLS = "starttls"
+	// TLSImplicit - TLS from the start, usually port 465
+	TLSImplicit = "tls"
+	// TLSNone - no encryption, for relays on the local network only
+	TLSNone = "none"
+)
+
+// SMTP - Mailer sending through an SMTP server, the emails are
+// rendered with the local templates
+type SMTP struct {
+	Host string
+	Port int
+	// TLS - TLSStartTLS, TLSImplicit or TLSNone
+	TLS string
+	// Username - PLAIN authentication if set, which net/smtp
+	// refuses without TLS unless the server is localhost
+	Username  string
+	Password  string
+	From      string
+	Templates *Templates
+	// TLSConfig - nil for the defaults with Host as server name
+	TLSConfig *tls.Config
+}
+
+// Send delivers the message to the server,
+// the deadline of ctx limits the whole conversation
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	email, err := compose(s.Templates, s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := s.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: s.Host, MinVersion: tls.VersionTLS12}
+	}
+	if s.TLS == TLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer client.Close()
+
+	if s.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%w: server does not support STARTTLS", ErrProvider)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("%w: %v", ErrProvider, err)
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return fmt.Errorf("%w: %v", ErrProvider, err)
+		}
+	}
+
+	if err := client.Mail(email.from); err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	if err := client.Rcpt(email.to); err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	if _, err := w.Write(email.data); err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	return client.Quit()
+}
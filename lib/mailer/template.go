@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/flosch/pongo2/v6"
+)
+
+// Kinds - all kinds of emails, each of them needs its templates
+var Kinds = []string{KindVerifyEmail, KindRecoverPassword, KindMagicLink, KindAccountLocked, KindWorkspaceInvitation}
+
+// Templates - pongo2 templates of the emails in a directory, rendered
+// by the providers without templates of their own
+//
+// each kind has three templates: <kind>.subject.txt, <kind>.txt and
+// <kind>.html, the variables of the model are escaped in the HTML
+// template only
+type Templates struct {
+	set *pongo2.TemplateSet
+}
+
+// NewTemplates returns the templates in a directory,
+// all templates of all Kinds must exist and compile
+func NewTemplates(dir string) (*Templates, error) {
+	loader, err := pongo2.NewLocalFileSystemLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{set: pongo2.NewSet("email", loader)}
+
+	for _, kind := range Kinds {
+		for _, name := range templateNames(kind) {
+			if _, err := t.set.FromCache(name); err != nil {
+				return nil, fmt.Errorf("email template %s: %w", name, err)
+			}
+		}
+	}
+	return t, nil
+}
+
+// templateNames returns the subject, text and HTML templates of a kind
+func templateNames(kind string) [3]string {
+	return [3]string{kind + ".subject.txt", kind + ".txt", kind + ".html"}
+}
+
+// Render returns the subject, the text and the HTML body of a message
+func (t *Templates) Render(msg Message) (subject, text, html string, err error) {
+	plain := pongo2.Context{}
+	escaped := pongo2.Context{}
+	for key, value := range msg.Model {
+		plain[key] = pongo2.AsSafeValue(value)
+		escaped[key] = value
+	}
+
+	names := templateNames(msg.Kind)
+	rendered := [3]string{}
+	for i, name := range names {
+		tpl, err := t.set.FromCache(name)
+		if err != nil {
+			return "", "", "", fmt.Errorf("%w: template %s: %v", ErrMessage, name, err)
+		}
+		ctx := plain
+		if i == 2 {
+			ctx = escaped
+		}
+		if rendered[i], err = tpl.Execute(ctx); err != nil {
+			return "", "", "", fmt.Errorf("%w: template %s: %v", ErrMessage, name, err)
+		}
+	}
+	return rendered[0], rendered[1], rendered[2], nil
+}
@@ -0,0 +1,113 @@
+// Package nickname implements the policy of user nicknames
+//
+// a nickname is displayed as the user typed it, uniqueness is checked
+// on its key: the case-folded NFKC form, so "Bob", "BOB" and "ｂｏｂ"
+// cannot be taken by different users
+package nickname
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// length limits in characters
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+// errors of Normalize
+var (
+	ErrLength     = errors.New("nickname must be between 3 and 30 characters long")
+	ErrCharacters = errors.New("nickname may only contain letters, digits and single . _ - between them")
+	ErrReserved   = errors.New("nickname is reserved")
+)
+
+// reserved - keys which cannot be taken, compared without separators,
+// so "ad.min" is reserved as well
+var reserved = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"api":           true,
+	"avatar":        true,
+	"avatars":       true,
+	"help":          true,
+	"login":         true,
+	"logout":        true,
+	"me":            true,
+	"moderator":     true,
+	"null":          true,
+	"official":      true,
+	"profile":       true,
+	"profiles":      true,
+	"register":      true,
+	"root":          true,
+	"security":      true,
+	"settings":      true,
+	"staff":         true,
+	"support":       true,
+	"system":        true,
+	"undefined":     true,
+	"user":          true,
+	"users":         true,
+}
+
+// Normalize validates a nickname and returns its display form
+// and its key
+//
+// - leading and trailing white space is removed, compatibility
+// characters (e.g. full-width letters) are replaced by NFKC
+// - letters and digits of any script, separated by single . _ or -
+func Normalize(nickName string) (display, key string, err error) {
+	display = norm.NFKC.String(strings.TrimSpace(nickName))
+
+	n := utf8.RuneCountInString(display)
+	if n < MinLength || n > MaxLength {
+		return "", "", ErrLength
+	}
+
+	prev := '.'
+	for _, r := range display {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		case isSeparator(r) && !isSeparator(prev):
+		default:
+			return "", "", ErrCharacters
+		}
+		prev = r
+	}
+	if isSeparator(prev) {
+		return "", "", ErrCharacters
+	}
+
+	key = Key(display)
+	if reserved[strings.Map(dropSeparator, key)] {
+		return "", "", ErrReserved
+	}
+	return display, key, nil
+}
+
+// Key returns the key of a nickname in display form
+//
+// a Caser is not safe for concurrent use, one is created per call
+func Key(display string) string {
+	return norm.NFKC.String(cases.Fold().String(display))
+}
+
+// isSeparator reports whether r may separate letters and digits
+func isSeparator(r rune) bool {
+	return r == '.' || r == '_' || r == '-'
+}
+
+// dropSeparator removes separators with strings.Map
+func dropSeparator(r rune) rune {
+	if isSeparator(r) {
+		return -1
+	}
+	return r
+}
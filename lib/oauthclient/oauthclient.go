@@ -0,0 +1,378 @@
+// Package oauthclient signs users in with external OAuth2 and OpenID
+// Connect providers using the authorization code flow with PKCE
+//
+// the identity of a user is read with the access token from the userinfo
+// endpoint of OIDC providers or from the user API of GitHub, the ID token
+// is not needed
+package oauthclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// types of providers
+const (
+	TypeOIDC   = "oidc"
+	TypeGitHub = "github"
+)
+
+// endpoints and scopes of GitHub, which does not support OIDC discovery
+const (
+	GitHubAuthURL     = "https://github.com/login/oauth/authorize"
+	GitHubTokenURL    = "https://github.com/login/oauth/access_token"
+	GitHubUserInfoURL = "https://api.github.com/user"
+	GitHubEmailsURL   = "https://api.github.com/user/emails"
+)
+
+// default scopes of each type
+var (
+	ScopesOIDC   = []string{"openid", "email", "profile"}
+	ScopesGitHub = []string{"read:user", "user:email"}
+)
+
+// RequestTimeout - time limit of a request to a provider
+// when no Client is set
+const RequestTimeout = 10 * time.Second
+
+// maxResponseSize - limit of a response read from a provider
+const maxResponseSize = 1 << 20
+
+// ErrProvider is wrapped by all errors returned by a provider
+// or caused by its responses
+var ErrProvider = errors.New("oauth provider error")
+
+// Provider - an OAuth2 provider and the credentials of this
+// application registered there
+type Provider struct {
+	Name         string
+	Type         string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL - callback of this application registered at the provider
+	RedirectURL string
+	Scopes      []string
+
+	// Issuer - OIDC issuer, the endpoints left empty are discovered
+	// from its openid-configuration
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	// EmailsURL - GitHub only, the addresses of the user
+	EmailsURL string
+
+	// Client - HTTP client of all requests, a client with
+	// RequestTimeout if nil
+	Client *http.Client
+
+	mu sync.Mutex
+}
+
+// Identity - a user as known to a provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// SetDefaults sets the default scopes of the type of the provider and
+// the endpoints of GitHub which are left empty
+func (p *Provider) SetDefaults() error {
+	switch p.Type {
+	case TypeOIDC:
+		if len(p.Scopes) == 0 {
+			p.Scopes = ScopesOIDC
+		}
+	case TypeGitHub:
+		if len(p.Scopes) == 0 {
+			p.Scopes = ScopesGitHub
+		}
+		if p.AuthURL == "" {
+			p.AuthURL = GitHubAuthURL
+		}
+		if p.TokenURL == "" {
+			p.TokenURL = GitHubTokenURL
+		}
+		if p.UserInfoURL == "" {
+			p.UserInfoURL = GitHubUserInfoURL
+		}
+		if p.EmailsURL == "" {
+			p.EmailsURL = GitHubEmailsURL
+		}
+	default:
+		return fmt.Errorf("unknown type: %s", p.Type)
+	}
+	return nil
+}
+
+// NewVerifier returns a random PKCE code verifier
+func NewVerifier() (string, error) {
+	return random()
+}
+
+// NewState returns a random value binding a callback to its login
+func NewState() (string, error) {
+	return random()
+}
+
+// Challenge returns the S256 PKCE code challenge of a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// random returns 32 random bytes, base64url encoded
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL of the provider the user is sent to
+func (p *Provider) AuthCodeURL(ctx context.Context, state, verifier string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", Challenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + params.Encode(), nil
+}
+
+// Exchange trades the code of the callback for an access token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	// errors of the token endpoint come with status 400 or, at GitHub, 200
+	status, err := p.do(req, &token)
+	if err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("%w: %s: %s", ErrProvider, token.Error, token.ErrorDescription)
+	}
+	if status != http.StatusOK || token.AccessToken == "" {
+		return "", fmt.Errorf("%w: token endpoint returned status %d without access token", ErrProvider, status)
+	}
+	return token.AccessToken, nil
+}
+
+// Identity returns the user the access token was issued to
+func (p *Provider) Identity(ctx context.Context, accessToken string) (Identity, error) {
+	if err := p.discover(ctx); err != nil {
+		return Identity{}, err
+	}
+	if p.Type == TypeGitHub {
+		return p.gitHubIdentity(ctx, accessToken)
+	}
+
+	var info struct {
+		Subject       string      `json:"sub"`
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"`
+		Name          string      `json:"name"`
+	}
+	if err := p.get(ctx, p.UserInfoURL, accessToken, &info); err != nil {
+		return Identity{}, err
+	}
+	if info.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: userinfo without subject", ErrProvider)
+	}
+
+	// a boolean, or a string at some providers
+	verified := false
+	switch v := info.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified, _ = strconv.ParseBool(v)
+	}
+
+	return Identity{
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: verified,
+		Name:          info.Name,
+	}, nil
+}
+
+// gitHubIdentity returns the GitHub user with the primary address
+func (p *Provider) gitHubIdentity(ctx context.Context, accessToken string) (Identity, error) {
+	var user struct {
+		ID    uint64 `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := p.get(ctx, p.UserInfoURL, accessToken, &user); err != nil {
+		return Identity{}, err
+	}
+	if user.ID == 0 {
+		return Identity{}, fmt.Errorf("%w: user without ID", ErrProvider)
+	}
+
+	identity := Identity{Subject: strconv.FormatUint(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	// the addresses are optional, they are not listed
+	// if the user did not grant the scope user:email
+	if err := p.get(ctx, p.EmailsURL, accessToken, &emails); err != nil {
+		return identity, nil
+	}
+	for _, email := range emails {
+		if email.Primary {
+			identity.Email, identity.EmailVerified = email.Email, email.Verified
+		}
+	}
+	return identity, nil
+}
+
+// discover fills the empty endpoints of an OIDC provider from the
+// openid-configuration of its issuer, a failed discovery is retried
+// with the next call
+func (p *Provider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.AuthURL != "" && p.TokenURL != "" && p.UserInfoURL != "" {
+		return nil
+	}
+	if p.Type != TypeOIDC || p.Issuer == "" {
+		return fmt.Errorf("%w: endpoints of %s are not configured", ErrProvider, p.Name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	var configuration struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	status, err := p.do(req, &configuration)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: discovery returned status %d", ErrProvider, status)
+	}
+	if strings.TrimSuffix(configuration.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return fmt.Errorf("%w: discovery returned issuer %s", ErrProvider, configuration.Issuer)
+	}
+
+	if p.AuthURL == "" {
+		p.AuthURL = configuration.AuthorizationEndpoint
+	}
+	if p.TokenURL == "" {
+		p.TokenURL = configuration.TokenEndpoint
+	}
+	if p.UserInfoURL == "" {
+		p.UserInfoURL = configuration.UserinfoEndpoint
+	}
+	if p.AuthURL == "" || p.TokenURL == "" || p.UserInfoURL == "" {
+		return fmt.Errorf("%w: discovery returned no endpoints", ErrProvider)
+	}
+	return nil
+}
+
+// get reads a JSON resource of the user with the access token
+func (p *Provider) get(ctx context.Context, resource, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resource, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	status, err := p.do(req, v)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrProvider, resource, status)
+	}
+	return nil
+}
+
+// do sends a request and decodes the JSON response into v,
+// unless the status is an error
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: RequestTimeout}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrProvider, err)
+	}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return resp.StatusCode, nil
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("%w: invalid response: %v", ErrProvider, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,107 @@
+package oauthclient_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"apidev/lib/oauthclient"
+	"apidev/lib/oauthclient/oauthclienttest"
+)
+
+const redirectURL = "https://app.example.com/oauth/test/callback"
+
+func newProvider(t *testing.T) (*oauthclient.Provider, *oauthclienttest.Server) {
+	t.Helper()
+
+	server := oauthclienttest.NewServer()
+	t.Cleanup(server.Close)
+
+	provider := &oauthclient.Provider{
+		Name:         "test",
+		Type:         oauthclient.TypeOIDC,
+		ClientID:     oauthclienttest.ClientID,
+		ClientSecret: oauthclienttest.ClientSecret,
+		RedirectURL:  redirectURL,
+		Issuer:       server.URL,
+		Client:       server.Client(),
+	}
+	if err := provider.SetDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	return provider, server
+}
+
+// authorize starts a login and returns the query of its callback
+// and the verifier of the login
+func authorize(t *testing.T, provider *oauthclient.Provider, server *oauthclienttest.Server, user oauthclienttest.User) (url.Values, string) {
+	t.Helper()
+
+	state, err := oauthclient.NewState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := oauthclient.NewVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := provider.AuthCodeURL(context.Background(), state, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params, err := server.Authorize(authURL, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Get("state") != state {
+		t.Fatalf("state = %q, want %q", params.Get("state"), state)
+	}
+	return params, verifier
+}
+
+func TestLogin(t *testing.T) {
+	provider, server := newProvider(t)
+	user := oauthclienttest.User{Subject: "1234", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+
+	params, verifier := authorize(t, provider, server, user)
+	accessToken, err := provider.Exchange(context.Background(), params.Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := provider.Identity(context.Background(), accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := oauthclient.Identity{Subject: "1234", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}
+	if identity != want {
+		t.Errorf("Identity() = %+v, want %+v", identity, want)
+	}
+	if provider.TokenURL != server.URL+"/token" || provider.UserInfoURL != server.URL+"/userinfo" {
+		t.Errorf("discovered endpoints %s %s", provider.TokenURL, provider.UserInfoURL)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	provider, server := newProvider(t)
+	user := oauthclienttest.User{Subject: "1234"}
+
+	params, _ := authorize(t, provider, server, user)
+	otherVerifier, _ := oauthclient.NewVerifier()
+	if _, err := provider.Exchange(context.Background(), params.Get("code"), otherVerifier); !errors.Is(err, oauthclient.ErrProvider) {
+		t.Errorf("Exchange() with the verifier of another login = %v, want %v", err, oauthclient.ErrProvider)
+	}
+
+	params, verifier := authorize(t, provider, server, user)
+	if _, err := provider.Exchange(context.Background(), params.Get("code"), verifier); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), params.Get("code"), verifier); !errors.Is(err, oauthclient.ErrProvider) {
+		t.Errorf("Exchange() of a used code = %v, want %v", err, oauthclient.ErrProvider)
+	}
+
+	if _, err := provider.Identity(context.Background(), "unknown"); !errors.Is(err, oauthclient.ErrProvider) {
+		t.Errorf("Identity() with an unknown access token = %v, want %v", err, oauthclient.ErrProvider)
+	}
+}
@@ -0,0 +1,183 @@
+// Package oauthclienttest provides a mock OpenID Connect provider
+// for tests of the social login
+//
+// the provider serves the discovery, token and userinfo endpoints
+// over HTTP, the consent of a user at the authorization endpoint
+// is simulated by Authorize
+package oauthclienttest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// credentials of the client registered at the provider
+const (
+	ClientID     = "test-client"
+	ClientSecret = "test-secret"
+)
+
+// User - a user signing in at the provider
+type User struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name,omitempty"`
+}
+
+// Server - a mock OIDC provider, its issuer is the URL of the server
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	grants map[string]grant
+	tokens map[string]User
+}
+
+// grant - an authorization code waiting for its exchange
+type grant struct {
+	challenge   string
+	redirectURI string
+	user        User
+}
+
+// NewServer starts a provider, the caller must call Close
+func NewServer() *Server {
+	s := &Server{
+		grants: map[string]grant{},
+		tokens: map[string]User{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.configuration)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/userinfo", s.userInfo)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Authorize simulates the consent of a user at the URL returned by
+// AuthCodeURL and returns the query of the callback with code and state
+func (s *Server) Authorize(authURL string, user User) (url.Values, error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme+"://"+u.Host+u.Path != s.URL+"/authorize" {
+		return nil, errors.New("unknown authorization endpoint")
+	}
+
+	params := u.Query()
+	if params.Get("response_type") != "code" || params.Get("client_id") != ClientID {
+		return nil, errors.New("invalid authorization request")
+	}
+	if params.Get("code_challenge") == "" || params.Get("code_challenge_method") != "S256" {
+		return nil, errors.New("PKCE is required")
+	}
+
+	code, err := random()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.grants[code] = grant{
+		challenge:   params.Get("code_challenge"),
+		redirectURI: params.Get("redirect_uri"),
+		user:        user,
+	}
+	s.mu.Unlock()
+
+	callback := url.Values{}
+	callback.Set("code", code)
+	callback.Set("state", params.Get("state"))
+	return callback, nil
+}
+
+// configuration serves the OIDC discovery
+func (s *Server) configuration(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"userinfo_endpoint":      s.URL + "/userinfo",
+	})
+}
+
+// token exchanges a code for an access token, each code once and only
+// with the verifier of its challenge
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if r.PostFormValue("client_id") != ClientID || r.PostFormValue("client_secret") != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := r.PostFormValue("code")
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || g.redirectURI != r.PostFormValue("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken, err := random()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.tokens[accessToken] = g.user
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+	})
+}
+
+// userInfo returns the user an access token was issued to
+func (s *Server) userInfo(w http.ResponseWriter, r *http.Request) {
+	accessToken, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	user, ok := s.tokens[accessToken]
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// random returns 32 random bytes, base64url encoded
+func random() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,71 @@
+// Package rbac declares the roles of administrators and the permissions
+// each of them grants
+//
+// roles are granted per auth ID, a user without a role has
+// no permission beyond their own data
+package rbac
+
+import "sort"
+
+// Permission - an action on the data of other users
+type Permission string
+
+// permissions checked by the admin routes
+const (
+	UsersRead       Permission = "users.read"
+	UsersSuspend    Permission = "users.suspend"
+	UsersLogout     Permission = "users.logout"
+	ContentModerate Permission = "content.moderate"
+	AuditRead       Permission = "audit.read"
+	RolesManage     Permission = "roles.manage"
+	SystemRead      Permission = "system.read"
+)
+
+// roles
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleSupport   = "support"
+)
+
+// roles - permissions granted by each role
+var roles = map[string][]Permission{
+	RoleAdmin:     {UsersRead, UsersSuspend, UsersLogout, ContentModerate, AuditRead, RolesManage, SystemRead},
+	RoleModerator: {UsersRead, UsersSuspend, ContentModerate},
+	RoleSupport:   {UsersRead, UsersLogout, AuditRead},
+}
+
+// Valid reports whether a role is declared
+func Valid(role string) bool {
+	_, ok := roles[role]
+	return ok
+}
+
+// Roles returns the names of all declared roles in sorted order
+func Roles() []string {
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Permissions returns the permissions granted by a role,
+// nil for an unknown role
+func Permissions(role string) []Permission {
+	return roles[role]
+}
+
+// Allowed reports whether one of the roles grants the permission,
+// unknown roles grant nothing
+func Allowed(granted []string, permission Permission) bool {
+	for _, role := range granted {
+		for _, p := range roles[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package richtext
+
+import "fmt"
+
+// ValidFormat reports whether a format is supported
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatText, FormatMarkdown, FormatHTML, FormatJSON:
+		return true
+	}
+	return false
+}
+
+// Normalize validates a body before it is saved
+// - html: unsupported tags and attributes are removed
+// - json: the document must follow the schema
+// - text, markdown: accepted as they are
+func Normalize(body, format string) (string, error) {
+	switch format {
+	case FormatText, FormatMarkdown:
+		return body, nil
+	case FormatHTML:
+		return SanitizeHTML(body), nil
+	case FormatJSON:
+		if _, err := ParseJSON(body); err != nil {
+			return "", err
+		}
+		return body, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", format)
+}
+
+// SanitizeHTML keeps only the tags and attributes
+// which can be represented in a JSON document
+func SanitizeHTML(body string) string {
+	doc, _ := fromHTML(body)
+	return toHTML(doc)
+}
+
+// Convert converts a body from one format to another
+//
+// all conversions go through the JSON document, the report
+// lists everything which could not be represented in the target
+func Convert(body, from, to string) (string, Report, error) {
+	report := Report{}
+
+	if !ValidFormat(from) {
+		return "", report, fmt.Errorf("unsupported content type %q", from)
+	}
+	if !ValidFormat(to) {
+		return "", report, fmt.Errorf("unsupported target format %q", to)
+	}
+	if from == to {
+		return body, report, nil
+	}
+
+	var doc Node
+	switch from {
+	case FormatText:
+		doc = fromText(body)
+	case FormatMarkdown:
+		var r Report
+		doc, r = fromMarkdown(body)
+		report.merge(r)
+	case FormatHTML:
+		var r Report
+		doc, r = fromHTML(body)
+		report.merge(r)
+	case FormatJSON:
+		var err error
+		if doc, err = ParseJSON(body); err != nil {
+			return "", report, err
+		}
+	}
+
+	switch to {
+	case FormatText:
+		out, r := toText(doc)
+		report.merge(r)
+		return out, report, nil
+	case FormatMarkdown:
+		return toMarkdown(doc), report, nil
+	case FormatHTML:
+		return toHTML(doc), report, nil
+	}
+	return encodeJSON(doc), report, nil
+}
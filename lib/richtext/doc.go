@@ -0,0 +1,273 @@
+// Package richtext validates and converts note bodies between
+// plain text, markdown, sanitized HTML and a structured JSON
+// rich-text document in the style of ProseMirror/TipTap
+package richtext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// supported formats of a note body
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatJSON     = "json"
+)
+
+// maxDepth limits the nesting of a JSON document
+const maxDepth = 32
+
+// Node - node of a JSON document
+type Node struct {
+	Type    string                 `json:"type"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Content []Node                 `json:"content,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Marks   []Mark                 `json:"marks,omitempty"`
+}
+
+// Mark - inline formatting of a text node
+type Mark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// Report - outcome of a conversion
+type Report struct {
+	Lossy    bool     `json:"lossy"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// warn records a loss of information
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Lossy = true
+	msg := fmt.Sprintf(format, args...)
+	for _, w := range r.Warnings {
+		if w == msg {
+			return
+		}
+	}
+	r.Warnings = append(r.Warnings, msg)
+}
+
+// merge adds the findings of another report
+func (r *Report) merge(other Report) {
+	for _, w := range other.Warnings {
+		r.warn("%s", w)
+	}
+}
+
+// children allowed in each node type
+// - block: any block node
+// - inline: text and hardBreak
+var schema = map[string]string{
+	"doc":            "block",
+	"paragraph":      "inline",
+	"heading":        "inline",
+	"blockquote":     "block",
+	"bulletList":     "listItem",
+	"orderedList":    "listItem",
+	"listItem":       "block",
+	"codeBlock":      "text",
+	"horizontalRule": "",
+	"hardBreak":      "",
+	"text":           "",
+}
+
+// block nodes
+var blockNodes = map[string]bool{
+	"paragraph":      true,
+	"heading":        true,
+	"blockquote":     true,
+	"bulletList":     true,
+	"orderedList":    true,
+	"codeBlock":      true,
+	"horizontalRule": true,
+}
+
+// attributes allowed in each node or mark type
+var allowedAttrs = map[string]map[string]bool{
+	"heading":     {"level": true},
+	"orderedList": {"start": true},
+	"codeBlock":   {"language": true},
+	"link":        {"href": true},
+}
+
+// supported marks
+var allowedMarks = map[string]bool{
+	"bold":   true,
+	"italic": true,
+	"strike": true,
+	"code":   true,
+	"link":   true,
+}
+
+// ParseJSON decodes and validates a JSON document
+func ParseJSON(body string) (Node, error) {
+	doc := Node{}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		return doc, errors.New("invalid JSON document: " + err.Error())
+	}
+	if doc.Type != "doc" {
+		return doc, errors.New("invalid JSON document: root node must be of type doc")
+	}
+	if err := validate(doc, 0); err != nil {
+		return doc, errors.New("invalid JSON document: " + err.Error())
+	}
+	return doc, nil
+}
+
+// validate checks a node and its children against the schema
+func validate(node Node, depth int) error {
+	if depth > maxDepth {
+		return errors.New("document is nested too deeply")
+	}
+
+	allowed, ok := schema[node.Type]
+	if !ok {
+		return fmt.Errorf("unknown node type %q", node.Type)
+	}
+
+	for key := range node.Attrs {
+		if !allowedAttrs[node.Type][key] {
+			return fmt.Errorf("unknown attribute %q of %s", key, node.Type)
+		}
+	}
+
+	switch node.Type {
+	case "text":
+		if node.Text == "" {
+			return errors.New("text node must not be empty")
+		}
+		for _, mark := range node.Marks {
+			if err := validateMark(mark); err != nil {
+				return err
+			}
+		}
+	case "heading":
+		level, ok := intAttr(node.Attrs, "level")
+		if !ok || level < 1 || level > 6 {
+			return errors.New("heading level must be between 1 and 6")
+		}
+	case "orderedList":
+		if _, ok := node.Attrs["start"]; ok {
+			if start, ok := intAttr(node.Attrs, "start"); !ok || start < 0 {
+				return errors.New("orderedList start must be a positive number")
+			}
+		}
+	case "codeBlock":
+		if _, ok := node.Attrs["language"]; ok {
+			if _, ok := node.Attrs["language"].(string); !ok {
+				return errors.New("codeBlock language must be a string")
+			}
+		}
+	}
+
+	if node.Type != "text" && (node.Text != "" || len(node.Marks) > 0) {
+		return fmt.Errorf("%s must not have text or marks", node.Type)
+	}
+
+	for _, child := range node.Content {
+		switch allowed {
+		case "block":
+			if !blockNodes[child.Type] {
+				return fmt.Errorf("%s is not allowed in %s", child.Type, node.Type)
+			}
+		case "inline":
+			if child.Type != "text" && child.Type != "hardBreak" {
+				return fmt.Errorf("%s is not allowed in %s", child.Type, node.Type)
+			}
+		case "text":
+			if child.Type != "text" || len(child.Marks) > 0 {
+				return fmt.Errorf("%s only accepts unformatted text", node.Type)
+			}
+		case "listItem":
+			if child.Type != "listItem" {
+				return fmt.Errorf("%s is not allowed in %s", child.Type, node.Type)
+			}
+		default:
+			return fmt.Errorf("%s must not have content", node.Type)
+		}
+
+		if err := validate(child, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateMark checks a mark of a text node
+func validateMark(mark Mark) error {
+	if !allowedMarks[mark.Type] {
+		return fmt.Errorf("unknown mark type %q", mark.Type)
+	}
+	for key := range mark.Attrs {
+		if !allowedAttrs[mark.Type][key] {
+			return fmt.Errorf("unknown attribute %q of %s", key, mark.Type)
+		}
+	}
+	if mark.Type == "link" {
+		href, _ := mark.Attrs["href"].(string)
+		if !SafeURL(href) {
+			return errors.New("link href must be an http, https or mailto URL")
+		}
+	}
+	return nil
+}
+
+// SafeURL reports whether a link target uses an allowed scheme
+func SafeURL(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+// intAttr returns an integer attribute, JSON numbers are decoded as float64
+func intAttr(attrs map[string]interface{}, key string) (int, bool) {
+	switch v := attrs[key].(type) {
+	case float64:
+		if v != float64(int(v)) {
+			return 0, false
+		}
+		return int(v), true
+	case int:
+		return v, true
+	}
+	return 0, false
+}
+
+// stringAttr returns a string attribute or an empty string
+func stringAttr(attrs map[string]interface{}, key string) string {
+	v, _ := attrs[key].(string)
+	return v
+}
+
+// encodeJSON serializes a document
+func encodeJSON(doc Node) string {
+	out, _ := json.Marshal(doc)
+	return string(out)
+}
+
+// hasMark reports whether a text node carries a mark
+func hasMark(node Node, markType string) bool {
+	for _, mark := range node.Marks {
+		if mark.Type == markType {
+			return true
+		}
+	}
+	return false
+}
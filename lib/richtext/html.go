@@ -0,0 +1,431 @@
+package richtext
+
+import (
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// marks of inline HTML elements
+var htmlMarks = map[string]string{
+	"strong": "bold",
+	"b":      "bold",
+	"em":     "italic",
+	"i":      "italic",
+	"s":      "strike",
+	"del":    "strike",
+	"strike": "strike",
+	"code":   "code",
+}
+
+// tags of marks when rendering HTML
+var markTags = map[string]string{
+	"bold":   "strong",
+	"italic": "em",
+	"strike": "s",
+	"code":   "code",
+}
+
+// elements removed together with their content
+var htmlDropped = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"template": true,
+	"noscript": true,
+	"head":     true,
+	"title":    true,
+	"form":     true,
+	"svg":      true,
+	"math":     true,
+}
+
+// attributes kept on each element
+var htmlAttrs = map[string]map[string]bool{
+	"a":    {"href": true},
+	"ol":   {"start": true},
+	"code": {"class": true},
+}
+
+// htmlParser - builds a document from parsed HTML
+type htmlParser struct {
+	report *Report
+}
+
+// fromHTML parses HTML into a document, everything which cannot
+// be represented is dropped or unwrapped and listed in the report
+func fromHTML(body string) (Node, Report) {
+	report := Report{}
+	doc := Node{Type: "doc"}
+
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(body), context)
+	if err != nil {
+		report.warn("invalid HTML")
+		return doc, report
+	}
+
+	p := htmlParser{report: &report}
+	doc.Content = p.blocks(nodes, 0)
+	return doc, report
+}
+
+// checkAttrs reports attributes which are removed
+func (p htmlParser) checkAttrs(n *html.Node) {
+	for _, attr := range n.Attr {
+		if !htmlAttrs[n.Data][attr.Key] {
+			p.report.warn("unsupported attribute %s of <%s> was removed", attr.Key, n.Data)
+		}
+	}
+}
+
+// blocks converts HTML nodes into block nodes,
+// loose inline content is wrapped in paragraphs
+func (p htmlParser) blocks(nodes []*html.Node, depth int) []Node {
+	blocks := []Node{}
+	inline := []*html.Node{}
+
+	flush := func() {
+		if content := trimInline(p.inline(inline, nil, depth)); len(content) > 0 {
+			blocks = append(blocks, Node{Type: "paragraph", Content: content})
+		}
+		inline = inline[:0]
+	}
+
+	for _, n := range nodes {
+		if n.Type != html.ElementNode {
+			if n.Type == html.TextNode {
+				inline = append(inline, n)
+			}
+			continue
+		}
+		if depth > maxDepth {
+			p.report.warn("content nested too deeply was removed")
+			continue
+		}
+		if htmlDropped[n.Data] {
+			p.report.warn("unsupported element <%s> was removed", n.Data)
+			continue
+		}
+		p.checkAttrs(n)
+
+		switch n.Data {
+		case "p":
+			flush()
+			if content := trimInline(p.inline(children(n), nil, depth+1)); len(content) > 0 {
+				blocks = append(blocks, Node{Type: "paragraph", Content: content})
+			}
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			flush()
+			level, _ := strconv.Atoi(n.Data[1:])
+			blocks = append(blocks, Node{
+				Type:    "heading",
+				Attrs:   map[string]interface{}{"level": level},
+				Content: trimInline(p.inline(children(n), nil, depth+1)),
+			})
+		case "blockquote":
+			flush()
+			blocks = append(blocks, Node{Type: "blockquote", Content: p.blocks(children(n), depth+1)})
+		case "ul", "ol":
+			flush()
+			if list := p.list(n, depth+1); len(list.Content) > 0 {
+				blocks = append(blocks, list)
+			}
+		case "pre":
+			flush()
+			blocks = append(blocks, p.codeBlock(n))
+		case "hr":
+			flush()
+			blocks = append(blocks, Node{Type: "horizontalRule"})
+		case "div", "section", "article", "main", "header", "footer", "aside", "nav", "figure", "table", "thead", "tbody", "tr", "td", "th", "dl", "dt", "dd":
+			flush()
+			p.report.warn("unsupported element <%s> was unwrapped", n.Data)
+			blocks = append(blocks, p.blocks(children(n), depth+1)...)
+		default:
+			inline = append(inline, n)
+		}
+	}
+	flush()
+
+	return blocks
+}
+
+// list converts <ul> and <ol>
+func (p htmlParser) list(n *html.Node, depth int) Node {
+	list := Node{Type: "bulletList"}
+	if n.Data == "ol" {
+		list.Type = "orderedList"
+		for _, attr := range n.Attr {
+			if attr.Key != "start" {
+				continue
+			}
+			if start, err := strconv.Atoi(strings.TrimSpace(attr.Val)); err == nil && start >= 0 && start != 1 {
+				list.Attrs = map[string]interface{}{"start": start}
+			}
+		}
+	}
+
+	for _, c := range children(n) {
+		if c.Type == html.TextNode && strings.TrimSpace(c.Data) == "" {
+			continue
+		}
+		if c.Type == html.ElementNode && c.Data == "li" {
+			p.checkAttrs(c)
+			list.Content = append(list.Content, Node{Type: "listItem", Content: p.blocks(children(c), depth+1)})
+			continue
+		}
+		p.report.warn("content of <%s> outside of <li> was moved into a list item", n.Data)
+		list.Content = append(list.Content, Node{Type: "listItem", Content: p.blocks([]*html.Node{c}, depth+1)})
+	}
+
+	return list
+}
+
+// codeBlock converts <pre>, the language is taken from
+// the class language-* of a nested <code>
+func (p htmlParser) codeBlock(n *html.Node) Node {
+	node := Node{Type: "codeBlock"}
+
+	for _, c := range children(n) {
+		if c.Type != html.ElementNode || c.Data != "code" {
+			continue
+		}
+		for _, attr := range c.Attr {
+			if attr.Key != "class" {
+				continue
+			}
+			for _, class := range strings.Fields(attr.Val) {
+				if strings.HasPrefix(class, "language-") {
+					node.Attrs = map[string]interface{}{"language": strings.TrimPrefix(class, "language-")}
+				}
+			}
+		}
+	}
+
+	if text := textContent(n); text != "" {
+		node.Content = []Node{{Type: "text", Text: text}}
+	}
+	return node
+}
+
+// inline converts HTML nodes into inline nodes, all nodes inherit marks
+func (p htmlParser) inline(nodes []*html.Node, marks []Mark, depth int) []Node {
+	out := []Node{}
+
+	for _, n := range nodes {
+		switch n.Type {
+		case html.TextNode:
+			if text := collapseSpace(n.Data); text != "" {
+				out = append(out, Node{Type: "text", Text: text, Marks: copyMarks(marks)})
+			}
+			continue
+		case html.ElementNode:
+		default:
+			continue
+		}
+
+		if depth > maxDepth {
+			p.report.warn("content nested too deeply was removed")
+			continue
+		}
+		if htmlDropped[n.Data] {
+			p.report.warn("unsupported element <%s> was removed", n.Data)
+			continue
+		}
+		p.checkAttrs(n)
+
+		if markType, ok := htmlMarks[n.Data]; ok {
+			if markType == "code" {
+				// code keeps its whitespace
+				if text := textContent(n); text != "" {
+					out = append(out, Node{Type: "text", Text: text, Marks: withMark(marks, Mark{Type: "code"})})
+				}
+				continue
+			}
+			out = append(out, p.inline(children(n), withMark(marks, Mark{Type: markType}), depth+1)...)
+			continue
+		}
+
+		switch n.Data {
+		case "br":
+			out = append(out, Node{Type: "hardBreak"})
+		case "a":
+			href := ""
+			for _, attr := range n.Attr {
+				if attr.Key == "href" {
+					href = strings.TrimSpace(attr.Val)
+				}
+			}
+			if !SafeURL(href) {
+				if href != "" {
+					p.report.warn("links with unsupported URL schemes are converted to text")
+				}
+				out = append(out, p.inline(children(n), marks, depth+1)...)
+				continue
+			}
+			out = append(out, p.inline(children(n), withMark(marks, Mark{Type: "link", Attrs: map[string]interface{}{"href": href}}), depth+1)...)
+		case "img":
+			p.report.warn("images are not supported and were removed")
+		default:
+			p.report.warn("unsupported element <%s> was unwrapped", n.Data)
+			out = append(out, p.inline(children(n), marks, depth+1)...)
+		}
+	}
+
+	return mergeText(out)
+}
+
+// children returns the child nodes of an HTML node
+func children(n *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+// textContent concatenates all text below an HTML node
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+// collapseSpace collapses whitespace like a browser does
+func collapseSpace(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			return " "
+		}
+		return ""
+	}
+
+	out := strings.Join(fields, " ")
+	if strings.TrimLeft(s, " \t\n\r\f") != s {
+		out = " " + out
+	}
+	if strings.TrimRight(s, " \t\n\r\f") != s {
+		out += " "
+	}
+	return out
+}
+
+// trimInline removes whitespace at the start and end of a block
+// and around hard breaks
+func trimInline(nodes []Node) []Node {
+	nodes = mergeText(nodes)
+	for i := range nodes {
+		if nodes[i].Type != "text" || hasMark(nodes[i], "code") {
+			continue
+		}
+		if i == 0 || nodes[i-1].Type == "hardBreak" {
+			nodes[i].Text = strings.TrimLeft(nodes[i].Text, " ")
+		}
+		if i == len(nodes)-1 || nodes[i+1].Type == "hardBreak" {
+			nodes[i].Text = strings.TrimRight(nodes[i].Text, " ")
+		}
+	}
+	return mergeText(nodes)
+}
+
+// toHTML renders a document as HTML
+func toHTML(doc Node) string {
+	blocks := []string{}
+	for _, node := range doc.Content {
+		blocks = append(blocks, htmlBlock(node))
+	}
+	return strings.Join(blocks, "\n")
+}
+
+// htmlBlock renders a block node
+func htmlBlock(node Node) string {
+	var sb strings.Builder
+
+	switch node.Type {
+	case "paragraph":
+		sb.WriteString("<p>" + htmlInline(node.Content) + "</p>")
+	case "heading":
+		level, _ := intAttr(node.Attrs, "level")
+		tag := "h" + strconv.Itoa(level)
+		sb.WriteString("<" + tag + ">" + htmlInline(node.Content) + "</" + tag + ">")
+	case "blockquote":
+		sb.WriteString("<blockquote>")
+		for _, child := range node.Content {
+			sb.WriteString(htmlBlock(child))
+		}
+		sb.WriteString("</blockquote>")
+	case "bulletList", "orderedList":
+		tag := "ul"
+		if node.Type == "orderedList" {
+			tag = "ol"
+			if start, ok := intAttr(node.Attrs, "start"); ok && start != 1 {
+				sb.WriteString(`<ol start="` + strconv.Itoa(start) + `">`)
+			} else {
+				sb.WriteString("<ol>")
+			}
+		} else {
+			sb.WriteString("<ul>")
+		}
+		for _, item := range node.Content {
+			sb.WriteString("<li>")
+			for _, child := range item.Content {
+				sb.WriteString(htmlBlock(child))
+			}
+			sb.WriteString("</li>")
+		}
+		sb.WriteString("</" + tag + ">")
+	case "codeBlock":
+		code := ""
+		for _, child := range node.Content {
+			code += child.Text
+		}
+		sb.WriteString("<pre><code")
+		if language := stringAttr(node.Attrs, "language"); language != "" {
+			sb.WriteString(` class="language-` + html.EscapeString(language) + `"`)
+		}
+		sb.WriteString(">" + html.EscapeString(code) + "</code></pre>")
+	case "horizontalRule":
+		sb.WriteString("<hr>")
+	}
+
+	return sb.String()
+}
+
+// htmlInline renders inline nodes
+func htmlInline(nodes []Node) string {
+	var sb strings.Builder
+	for _, node := range mergeText(nodes) {
+		if node.Type == "hardBreak" {
+			sb.WriteString("<br>")
+			continue
+		}
+
+		out := html.EscapeString(node.Text)
+		marks := sortedMarks(node.Marks)
+		for i := len(marks) - 1; i >= 0; i-- {
+			mark := marks[i]
+			if mark.Type == "link" {
+				out = `<a href="` + html.EscapeString(stringAttr(mark.Attrs, "href")) + `">` + out + "</a>"
+				continue
+			}
+			tag := markTags[mark.Type]
+			out = "<" + tag + ">" + out + "</" + tag + ">"
+		}
+		sb.WriteString(out)
+	}
+	return sb.String()
+}
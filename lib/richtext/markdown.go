@@ -0,0 +1,733 @@
+package richtext
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ASCII punctuation which can be escaped with a backslash
+const mdPunct = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
+// canonical order of marks, outermost first
+var markOrder = map[string]int{
+	"link":   0,
+	"bold":   1,
+	"italic": 2,
+	"strike": 3,
+	"code":   4,
+}
+
+// delimiters of marks in markdown
+var markDelims = map[string]string{
+	"bold":   "**",
+	"italic": "*",
+	"strike": "~~",
+}
+
+var (
+	mdHeading   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:\s+(.*?))?(?:\s+#+)?\s*$`)
+	mdRule      = regexp.MustCompile(`^ {0,3}((?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*([^`\\s]*)")
+	mdListItem  = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])( +|$)(.*)$`)
+	mdTableRule = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)+\|?\s*$`)
+	mdLineStart = regexp.MustCompile(`^(\s*)([#>+-]|\d+[.)])`)
+)
+
+// toMarkdown renders a document as markdown
+func toMarkdown(doc Node) string {
+	return strings.Join(mdBlocks(doc.Content), "\n\n")
+}
+
+// mdBlocks renders block nodes, one string per block
+func mdBlocks(nodes []Node) []string {
+	blocks := []string{}
+	for _, node := range nodes {
+		switch node.Type {
+		case "paragraph":
+			blocks = append(blocks, mdInline(node.Content))
+		case "heading":
+			level, _ := intAttr(node.Attrs, "level")
+			blocks = append(blocks, strings.Repeat("#", level)+" "+mdInline(node.Content))
+		case "blockquote":
+			inner := strings.Join(mdBlocks(node.Content), "\n\n")
+			blocks = append(blocks, prefixLines(inner, "> ", "> "))
+		case "bulletList", "orderedList":
+			blocks = append(blocks, mdList(node))
+		case "codeBlock":
+			code := ""
+			for _, child := range node.Content {
+				code += child.Text
+			}
+			fence := "```"
+			for strings.Contains(code, fence) {
+				fence += "`"
+			}
+			blocks = append(blocks, fence+stringAttr(node.Attrs, "language")+"\n"+code+"\n"+fence)
+		case "horizontalRule":
+			blocks = append(blocks, "---")
+		}
+	}
+	return blocks
+}
+
+// mdList renders the items of a list
+func mdList(list Node) string {
+	start, ok := intAttr(list.Attrs, "start")
+	if !ok {
+		start = 1
+	}
+
+	items := []string{}
+	for i, item := range list.Content {
+		bullet := "- "
+		if list.Type == "orderedList" {
+			bullet = strconv.Itoa(start+i) + ". "
+		}
+		inner := strings.Join(mdBlocks(item.Content), "\n\n")
+		items = append(items, prefixLines(inner, bullet, strings.Repeat(" ", len(bullet))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// mdInline renders inline nodes, marks shared by adjacent
+// nodes are opened and closed only once
+func mdInline(nodes []Node) string {
+	var sb strings.Builder
+	open := []Mark{}
+
+	closeTo := func(n int) {
+		for len(open) > n {
+			mark := open[len(open)-1]
+			if mark.Type == "link" {
+				sb.WriteString("](" + mdHref(stringAttr(mark.Attrs, "href")) + ")")
+			} else {
+				sb.WriteString(markDelims[mark.Type])
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	for _, node := range mdSpaces(mergeText(nodes)) {
+		if node.Type == "hardBreak" {
+			sb.WriteString("\\\n")
+			continue
+		}
+
+		// code is always the innermost mark and rendered per node
+		marks := []Mark{}
+		for _, mark := range sortedMarks(node.Marks) {
+			if mark.Type != "code" {
+				marks = append(marks, mark)
+			}
+		}
+
+		shared := 0
+		for shared < len(open) && shared < len(marks) && sameMarks(open[shared:shared+1], marks[shared:shared+1]) {
+			shared++
+		}
+		closeTo(shared)
+		for _, mark := range marks[shared:] {
+			if mark.Type == "link" {
+				sb.WriteString("[")
+			} else {
+				sb.WriteString(markDelims[mark.Type])
+			}
+			open = append(open, mark)
+		}
+
+		if hasMark(node, "code") {
+			sb.WriteString(mdCode(node.Text))
+		} else {
+			sb.WriteString(mdEscape(node.Text))
+		}
+	}
+	closeTo(0)
+
+	// text looking like the start of a block must be escaped
+	lines := strings.Split(sb.String(), "\n")
+	for i, line := range lines {
+		if m := mdLineStart.FindStringSubmatchIndex(line); m != nil {
+			pos := m[5] - 1
+			if line[m[4]] == '#' || line[m[4]] == '>' || line[m[4]] == '+' || line[m[4]] == '-' {
+				pos = m[4]
+			}
+			lines[i] = line[:pos] + "\\" + line[pos:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// mdSpaces moves spaces at the edges of formatted text out of the
+// marks not shared with the neighbours, emphasis must not start or
+// end with a space
+func mdSpaces(nodes []Node) []Node {
+	out := []Node{}
+	for i, node := range nodes {
+		if node.Type != "text" || len(node.Marks) == 0 || hasMark(node, "code") {
+			out = append(out, node)
+			continue
+		}
+
+		text := strings.TrimLeft(node.Text, " ")
+		if lead := len(node.Text) - len(text); lead > 0 {
+			out = append(out, Node{Type: "text", Text: node.Text[:lead], Marks: commonMarks(nodes, i-1, node.Marks)})
+		}
+		trimmed := strings.TrimRight(text, " ")
+		if trimmed != "" {
+			out = append(out, Node{Type: "text", Text: trimmed, Marks: node.Marks})
+		}
+		if trail := len(text) - len(trimmed); trail > 0 {
+			out = append(out, Node{Type: "text", Text: text[len(trimmed):], Marks: commonMarks(nodes, i+1, node.Marks)})
+		}
+	}
+	return mergeText(out)
+}
+
+// commonMarks returns the leading marks shared with nodes[i]
+func commonMarks(nodes []Node, i int, marks []Mark) []Mark {
+	if i < 0 || i >= len(nodes) || nodes[i].Type != "text" {
+		return nil
+	}
+	a, b := sortedMarks(marks), sortedMarks(nodes[i].Marks)
+	n := 0
+	for n < len(a) && n < len(b) && a[n].Type != "code" && sameMarks(a[n:n+1], b[n:n+1]) {
+		n++
+	}
+	return copyMarks(a[:n])
+}
+
+// mdCode renders a code span
+func mdCode(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	pad := ""
+	// one space on each side is stripped when parsing
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") ||
+		strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ") && strings.TrimSpace(text) != "" {
+		pad = " "
+	}
+	return fence + pad + text + pad + fence
+}
+
+// mdHref renders a link target, targets with spaces or
+// parentheses are enclosed in angle brackets
+func mdHref(href string) string {
+	if strings.ContainsAny(href, " ()<>") {
+		return "<" + strings.NewReplacer("<", "%3C", ">", "%3E").Replace(href) + ">"
+	}
+	return href
+}
+
+// mdEscape escapes characters with a meaning in inline markdown
+func mdEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_[]~<>!", r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// fromMarkdown parses the supported subset of markdown
+// (CommonMark with strikethrough)
+func fromMarkdown(body string) (Node, Report) {
+	report := Report{}
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	doc := Node{Type: "doc", Content: parseMDBlocks(lines, &report)}
+	return doc, report
+}
+
+// parseMDBlocks parses block level markdown
+func parseMDBlocks(lines []string, report *Report) []Node {
+	nodes := []Node{}
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+
+		if strings.TrimSpace(line) == "" {
+			i++
+			continue
+		}
+
+		// fenced code block
+		if m := mdFence.FindStringSubmatch(line); m != nil {
+			fence := m[1]
+			code := []string{}
+			i++
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+				code = append(code, lines[i])
+				i++
+			}
+			i++
+
+			node := Node{Type: "codeBlock"}
+			if m[2] != "" {
+				node.Attrs = map[string]interface{}{"language": m[2]}
+			}
+			if text := strings.Join(code, "\n"); text != "" {
+				node.Content = []Node{{Type: "text", Text: text}}
+			}
+			nodes = append(nodes, node)
+			continue
+		}
+
+		// heading
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			nodes = append(nodes, Node{
+				Type:    "heading",
+				Attrs:   map[string]interface{}{"level": len(m[1])},
+				Content: parseMDInline(m[2], report),
+			})
+			i++
+			continue
+		}
+
+		// horizontal rule
+		if mdRule.MatchString(line) {
+			nodes = append(nodes, Node{Type: "horizontalRule"})
+			i++
+			continue
+		}
+
+		// blockquote
+		if strings.HasPrefix(strings.TrimLeft(line, " "), ">") {
+			quoted := []string{}
+			for i < len(lines) && strings.HasPrefix(strings.TrimLeft(lines[i], " "), ">") {
+				l := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quoted = append(quoted, strings.TrimPrefix(l, " "))
+				i++
+			}
+			nodes = append(nodes, Node{Type: "blockquote", Content: parseMDBlocks(quoted, report)})
+			continue
+		}
+
+		// list
+		if mdListItem.MatchString(line) {
+			var list Node
+			list, i = parseMDList(lines, i, report)
+			nodes = append(nodes, list)
+			continue
+		}
+
+		// table
+		if i+1 < len(lines) && strings.Contains(line, "|") && mdTableRule.MatchString(lines[i+1]) {
+			report.warn("tables are not supported and are converted to paragraphs")
+		}
+
+		// paragraph
+		para := []string{}
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			if len(para) > 0 && startsBlock(lines[i]) {
+				break
+			}
+			para = append(para, lines[i])
+			i++
+		}
+		nodes = append(nodes, Node{Type: "paragraph", Content: parseMDParagraph(para, report)})
+	}
+
+	return nodes
+}
+
+// startsBlock reports whether a line interrupts a paragraph
+func startsBlock(line string) bool {
+	return mdFence.MatchString(line) ||
+		mdHeading.MatchString(line) ||
+		mdRule.MatchString(line) ||
+		strings.HasPrefix(strings.TrimLeft(line, " "), ">") ||
+		mdListItem.MatchString(line)
+}
+
+// parseMDList parses a list starting at lines[i],
+// it returns the list and the index of the next line
+func parseMDList(lines []string, i int, report *Report) (Node, int) {
+	first := mdListItem.FindStringSubmatch(lines[i])
+	ordered := !strings.ContainsAny(first[2], "-*+")
+
+	list := Node{Type: "bulletList"}
+	if ordered {
+		list.Type = "orderedList"
+		if start, _ := strconv.Atoi(strings.TrimRight(first[2], ".)")); start != 1 {
+			list.Attrs = map[string]interface{}{"start": start}
+		}
+	}
+
+	for i < len(lines) {
+		m := mdListItem.FindStringSubmatch(lines[i])
+		if m == nil || ordered == strings.ContainsAny(m[2], "-*+") {
+			break
+		}
+
+		// continuation lines are indented up to the content of the item
+		indent := len(m[1]) + len(m[2]) + len(m[3])
+		if m[3] == "" {
+			indent++
+		}
+		content := []string{m[4]}
+		i++
+
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// a blank line ends the item unless it is followed by indented content
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) >= indent {
+					content = append(content, "")
+					i++
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) >= indent {
+				content = append(content, line[indent:])
+				i++
+				continue
+			}
+			if mdListItem.MatchString(line) || startsBlock(line) {
+				break
+			}
+			// lazy continuation of a paragraph
+			content = append(content, strings.TrimLeft(line, " "))
+			i++
+		}
+
+		list.Content = append(list.Content, Node{Type: "listItem", Content: parseMDBlocks(content, report)})
+
+		// a blank line between items keeps the list going
+		if i+1 < len(lines) && strings.TrimSpace(lines[i]) == "" && mdListItem.MatchString(lines[i+1]) {
+			i++
+		}
+	}
+
+	return list, i
+}
+
+// leadingSpaces counts the spaces at the start of a line
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// parseMDParagraph parses the lines of a paragraph
+// - a trailing backslash or two spaces make a hard break
+// - other line breaks are soft and become spaces
+func parseMDParagraph(lines []string, report *Report) []Node {
+	nodes := []Node{}
+	for i, line := range lines {
+		line = strings.TrimLeft(line, " ")
+		hard := false
+		if i < len(lines)-1 {
+			if trailing := len(line) - len(strings.TrimRight(line, "\\")); trailing%2 == 1 {
+				line = strings.TrimSuffix(line, "\\")
+				hard = true
+			} else if strings.HasSuffix(line, "  ") {
+				hard = true
+			}
+		}
+		line = strings.TrimRight(line, " ")
+		if i < len(lines)-1 && !hard {
+			line += " "
+		}
+
+		nodes = append(nodes, parseMDInline(line, report)...)
+		if hard {
+			nodes = append(nodes, Node{Type: "hardBreak"})
+		}
+	}
+	return mergeText(nodes)
+}
+
+// parseMDInline parses inline markdown
+func parseMDInline(s string, report *Report) []Node {
+	return mergeText(parseMDSpan(s, nil, report))
+}
+
+// parseMDSpan parses inline markdown, all nodes inherit marks
+func parseMDSpan(s string, marks []Mark, report *Report) []Node {
+	nodes := []Node{}
+	var buf strings.Builder
+
+	flush := func() {
+		if buf.Len() > 0 {
+			nodes = append(nodes, Node{Type: "text", Text: buf.String(), Marks: copyMarks(marks)})
+			buf.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		rest := s[i:]
+
+		switch {
+		// escaped punctuation
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(mdPunct, s[i+1]) >= 0:
+			buf.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		// code span
+		case c == '`':
+			run := len(rest) - len(strings.TrimLeft(rest, "`"))
+			fence := rest[:run]
+			if end := strings.Index(rest[run:], fence); end >= 0 {
+				code := rest[run : run+end]
+				if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+					code = code[1 : len(code)-1]
+				}
+				flush()
+				if code != "" {
+					nodes = append(nodes, Node{Type: "text", Text: code, Marks: withMark(marks, Mark{Type: "code"})})
+				}
+				i += run + end + run
+				continue
+			}
+			buf.WriteString(fence)
+			i += run
+			continue
+
+		// image
+		case strings.HasPrefix(rest, "!["):
+			if text, href, n, ok := mdLink(rest[1:]); ok {
+				report.warn("images are not supported and are converted to links")
+				flush()
+				nodes = append(nodes, mdLinkNodes(text, href, marks, report)...)
+				i += 1 + n
+				continue
+			}
+
+		// link
+		case c == '[':
+			if text, href, n, ok := mdLink(rest); ok {
+				flush()
+				nodes = append(nodes, mdLinkNodes(text, href, marks, report)...)
+				i += n
+				continue
+			}
+
+		// autolink or inline HTML
+		case c == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				inner := rest[1:end]
+				if SafeURL(inner) && !strings.ContainsAny(inner, " <") {
+					flush()
+					nodes = append(nodes, Node{Type: "text", Text: inner, Marks: withMark(marks, Mark{Type: "link", Attrs: map[string]interface{}{"href": inner}})})
+					i += end + 1
+					continue
+				}
+				if len(inner) > 0 && (unicode.IsLetter(rune(inner[0])) || inner[0] == '/') {
+					report.warn("inline HTML is not supported and is kept as text")
+				}
+			}
+
+		// bold, italic, strike
+		case c == '*' || c == '_' || strings.HasPrefix(rest, "~~"):
+			if markType, inner, n, ok := mdEmphasis(s, i); ok {
+				flush()
+				nodes = append(nodes, parseMDSpan(inner, withMark(marks, Mark{Type: markType}), report)...)
+				i += n
+				continue
+			}
+		}
+
+		buf.WriteByte(c)
+		i++
+	}
+
+	flush()
+	return nodes
+}
+
+// mdLink parses [text](href) at the start of s and returns
+// the number of bytes consumed
+func mdLink(s string) (text, href string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(s) || s[i+1] != '(' {
+				return
+			}
+			text = s[1:i]
+			dest := s[i+2:]
+
+			// <href> or href with balanced parentheses
+			end := -1
+			if strings.HasPrefix(dest, "<") {
+				if gt := strings.IndexByte(dest, '>'); gt > 0 {
+					if close := strings.IndexByte(dest[gt:], ')'); close >= 0 {
+						href, end = dest[1:gt], gt+close
+					}
+				}
+			} else {
+				parens := 0
+				for j := 0; j < len(dest) && end < 0; j++ {
+					switch dest[j] {
+					case '(':
+						parens++
+					case ')':
+						if parens == 0 {
+							end = j
+						}
+						parens--
+					}
+				}
+				if end >= 0 {
+					href = strings.TrimSpace(dest[:end])
+					// drop an optional title
+					if sp := strings.IndexAny(href, " \t"); sp >= 0 {
+						href = href[:sp]
+					}
+				}
+			}
+			if end < 0 {
+				return
+			}
+			return text, strings.TrimSpace(href), i + 3 + end, true
+		}
+	}
+	return
+}
+
+// mdLinkNodes builds the nodes of a link,
+// unsafe targets are dropped and only the text is kept
+func mdLinkNodes(text, href string, marks []Mark, report *Report) []Node {
+	if !SafeURL(href) {
+		report.warn("links with unsupported URL schemes are converted to text")
+		return parseMDSpan(text, marks, report)
+	}
+	return parseMDSpan(text, withMark(marks, Mark{Type: "link", Attrs: map[string]interface{}{"href": href}}), report)
+}
+
+// mdEmphasis parses an emphasis starting at s[i] and returns
+// its mark type, the inner text and the number of bytes consumed
+func mdEmphasis(s string, i int) (markType, inner string, n int, ok bool) {
+	rest := s[i:]
+	delim := ""
+	switch {
+	case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"):
+		markType, delim = "bold", rest[:2]
+	case strings.HasPrefix(rest, "~~"):
+		markType, delim = "strike", "~~"
+	default:
+		markType, delim = "italic", rest[:1]
+	}
+
+	// underscores inside words are literal
+	if delim[0] == '_' && i > 0 && isWordByte(s[i-1]) {
+		return
+	}
+
+	body := rest[len(delim):]
+	if body == "" || body[0] == ' ' {
+		return
+	}
+
+	for j := 0; j < len(body); j++ {
+		switch {
+		case body[j] == '\\':
+			j++
+		case body[j] == '`':
+			// skip code spans
+			run := len(body[j:]) - len(strings.TrimLeft(body[j:], "`"))
+			if end := strings.Index(body[j+run:], body[j:j+run]); end >= 0 {
+				j += run + end + run - 1
+			} else {
+				j += run - 1
+			}
+		case strings.HasPrefix(body[j:], delim):
+			// a single delimiter must not be part of a double one
+			if len(delim) == 1 && strings.HasPrefix(body[j:], delim+delim) {
+				j++
+				continue
+			}
+			// a longer run closes with its last delimiters
+			if len(delim) == 2 && j+2 < len(body) && body[j+2] == delim[0] {
+				continue
+			}
+			if j == 0 || body[j-1] == ' ' {
+				continue
+			}
+			end := j + len(delim)
+			if delim[0] == '_' && end < len(body) && isWordByte(body[end]) {
+				continue
+			}
+			return markType, body[:j], len(delim) + end, true
+		}
+	}
+	return
+}
+
+// isWordByte reports whether a byte is part of a word
+func isWordByte(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= 0x80
+}
+
+// withMark returns a copy of marks with one more mark
+func withMark(marks []Mark, mark Mark) []Mark {
+	for _, m := range marks {
+		if m.Type == mark.Type {
+			return copyMarks(marks)
+		}
+	}
+	return sortedMarks(append(copyMarks(marks), mark))
+}
+
+// copyMarks returns a copy of marks, nil if empty
+func copyMarks(marks []Mark) []Mark {
+	if len(marks) == 0 {
+		return nil
+	}
+	return append([]Mark{}, marks...)
+}
+
+// sortedMarks returns marks in canonical order
+func sortedMarks(marks []Mark) []Mark {
+	sorted := copyMarks(marks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return markOrder[sorted[i].Type] < markOrder[sorted[j].Type]
+	})
+	return sorted
+}
+
+// mergeText joins adjacent text nodes with the same marks
+func mergeText(nodes []Node) []Node {
+	merged := []Node{}
+	for _, node := range nodes {
+		if node.Type == "text" && node.Text == "" {
+			continue
+		}
+		if n := len(merged); n > 0 && node.Type == "text" && merged[n-1].Type == "text" && sameMarks(merged[n-1].Marks, node.Marks) {
+			merged[n-1].Text += node.Text
+			continue
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// sameMarks reports whether two sets of marks are identical
+func sameMarks(a, b []Mark) bool {
+	a, b = sortedMarks(a), sortedMarks(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type || stringAttr(a[i].Attrs, "href") != stringAttr(b[i].Attrs, "href") {
+			return false
+		}
+	}
+	return true
+}
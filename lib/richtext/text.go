@@ -0,0 +1,146 @@
+package richtext
+
+import (
+	"strconv"
+	"strings"
+)
+
+// fromText builds a document from plain text
+// - blank lines separate paragraphs
+// - single line breaks become hard breaks
+func fromText(body string) Node {
+	doc := Node{Type: "doc"}
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+
+	for _, block := range splitParagraphs(body) {
+		doc.Content = append(doc.Content, Node{Type: "paragraph", Content: textLines(block)})
+	}
+	return doc
+}
+
+// splitParagraphs splits text at blank lines
+func splitParagraphs(body string) []string {
+	blocks := []string{}
+	current := []string{}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, strings.Join(current, "\n"))
+				current = []string{}
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, strings.Join(current, "\n"))
+	}
+	return blocks
+}
+
+// textLines converts lines into text nodes separated by hard breaks
+func textLines(block string) []Node {
+	nodes := []Node{}
+	for i, line := range strings.Split(block, "\n") {
+		if i > 0 {
+			nodes = append(nodes, Node{Type: "hardBreak"})
+		}
+		if line != "" {
+			nodes = append(nodes, Node{Type: "text", Text: line})
+		}
+	}
+	return nodes
+}
+
+// toText renders a document as plain text, all formatting is lost
+func toText(doc Node) (string, Report) {
+	report := Report{}
+	blocks := textBlocks(doc.Content, &report)
+	return strings.Join(blocks, "\n\n"), report
+}
+
+// textBlocks renders block nodes, one string per block
+func textBlocks(nodes []Node, report *Report) []string {
+	blocks := []string{}
+	for _, node := range nodes {
+		switch node.Type {
+		case "paragraph":
+			blocks = append(blocks, textInline(node.Content, report))
+		case "heading":
+			report.warn("headings are converted to paragraphs")
+			blocks = append(blocks, textInline(node.Content, report))
+		case "blockquote":
+			report.warn("blockquotes are converted to prefixed lines")
+			inner := strings.Join(textBlocks(node.Content, report), "\n\n")
+			blocks = append(blocks, prefixLines(inner, "> ", "> "))
+		case "bulletList", "orderedList":
+			report.warn("lists are converted to prefixed lines")
+			blocks = append(blocks, textList(node, report))
+		case "codeBlock":
+			report.warn("code blocks are converted to paragraphs")
+			blocks = append(blocks, textInline(node.Content, report))
+		case "horizontalRule":
+			report.warn("horizontal rules are converted to dashes")
+			blocks = append(blocks, "----")
+		}
+	}
+	return blocks
+}
+
+// textList renders the items of a list with bullets or numbers
+func textList(list Node, report *Report) string {
+	start, ok := intAttr(list.Attrs, "start")
+	if !ok {
+		start = 1
+	}
+
+	items := []string{}
+	for i, item := range list.Content {
+		bullet := "- "
+		if list.Type == "orderedList" {
+			bullet = strconv.Itoa(start+i) + ". "
+		}
+		inner := strings.Join(textBlocks(item.Content, report), "\n")
+		items = append(items, prefixLines(inner, bullet, strings.Repeat(" ", len(bullet))))
+	}
+	return strings.Join(items, "\n")
+}
+
+// textInline renders inline nodes
+func textInline(nodes []Node, report *Report) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		if node.Type == "hardBreak" {
+			sb.WriteString("\n")
+			continue
+		}
+
+		sb.WriteString(node.Text)
+		for _, mark := range node.Marks {
+			if mark.Type == "link" {
+				report.warn("links are converted to text with the URL in brackets")
+				sb.WriteString(" (" + stringAttr(mark.Attrs, "href") + ")")
+				continue
+			}
+			report.warn("%s formatting is removed", mark.Type)
+		}
+	}
+	return sb.String()
+}
+
+// prefixLines prefixes the first line with first and all others with rest
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = first + line
+			continue
+		}
+		if line == "" {
+			lines[i] = strings.TrimRight(rest, " ")
+			continue
+		}
+		lines[i] = rest + line
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,53 @@
+// Package scope declares the scopes of personal access tokens
+//
+// a token is accepted only by the routes covered by one of its scopes,
+// the routes managing accounts, tokens and administration accept
+// no token at all
+package scope
+
+import "sort"
+
+// Scope - the data a personal access token may read or write
+type Scope string
+
+// scopes of personal access tokens
+const (
+	NotesRead    Scope = "notes:read"
+	NotesWrite   Scope = "notes:write"
+	ProfileRead  Scope = "profile:read"
+	ProfileWrite Scope = "profile:write"
+)
+
+// scopes - all declared scopes
+var scopes = map[Scope]bool{
+	NotesRead:    true,
+	NotesWrite:   true,
+	ProfileRead:  true,
+	ProfileWrite: true,
+}
+
+// Valid reports whether a scope is declared
+func Valid(s string) bool {
+	return scopes[Scope(s)]
+}
+
+// Scopes returns the names of all declared scopes in sorted order
+func Scopes() []string {
+	names := make([]string, 0, len(scopes))
+	for s := range scopes {
+		names = append(names, string(s))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Allowed reports whether the scope is one of the granted scopes,
+// a write scope does not include reading
+func Allowed(granted []string, s Scope) bool {
+	for _, g := range granted {
+		if Scope(g) == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+// Package settings validates the settings of users against
+// a schema declared by the server
+//
+// clients store any UI state they want to share between devices,
+// as long as the key is declared: unknown keys and values of the
+// wrong type are rejected, missing keys take their default
+package settings
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Type - JSON type of a setting
+type Type string
+
+// supported types
+const (
+	Bool   Type = "bool"
+	Int    Type = "int"
+	String Type = "string"
+)
+
+// MaxLength - limit of free-form strings in characters
+const MaxLength = 256
+
+// Setting - declaration of one key
+//
+// - Allowed: closed set of values of a String setting
+// - Min, Max: range of an Int setting
+type Setting struct {
+	Type    Type        `json:"type"`
+	Default interface{} `json:"default"`
+	Allowed []string    `json:"allowed,omitempty"`
+	Min     int         `json:"min,omitempty"`
+	Max     int         `json:"max,omitempty"`
+}
+
+// Schema - all settings, keyed by name
+type Schema map[string]Setting
+
+// Validate checks all values, a nil value is allowed and stands
+// for the default
+//
+// the error names the first invalid key in alphabetical order
+func (schema Schema) Validate(values map[string]interface{}) error {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		setting, ok := schema[key]
+		if !ok {
+			return fmt.Errorf("unknown setting: %s", key)
+		}
+		if values[key] == nil {
+			continue
+		}
+		if err := setting.validate(values[key]); err != nil {
+			return fmt.Errorf("%s %s", key, err.Error())
+		}
+	}
+	return nil
+}
+
+// Merge returns the value of every setting, the stored one if it is
+// still valid, otherwise the default
+//
+// stored values of removed keys or changed declarations are dropped
+func (schema Schema) Merge(values map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(schema))
+	for key, setting := range schema {
+		merged[key] = setting.Default
+		if value, ok := values[key]; ok && value != nil && setting.validate(value) == nil {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// validate checks one value, JSON numbers are decoded as float64
+func (setting Setting) validate(value interface{}) error {
+	switch setting.Type {
+	case Bool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+
+	case Int:
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("must be an integer")
+		}
+		if n < float64(setting.Min) || n > float64(setting.Max) {
+			return fmt.Errorf("must be between %d and %d", setting.Min, setting.Max)
+		}
+
+	case String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a string")
+		}
+		if len(setting.Allowed) > 0 {
+			for _, allowed := range setting.Allowed {
+				if s == allowed {
+					return nil
+				}
+			}
+			return fmt.Errorf("must be one of %s", strings.Join(setting.Allowed, ", "))
+		}
+		if utf8.RuneCountInString(s) > MaxLength {
+			return fmt.Errorf("must not be longer than %d characters", MaxLength)
+		}
+
+	default:
+		return fmt.Errorf("has an unsupported type")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package webauthn
+
+import (
+	"errors"
+	"math"
+	"unicode/utf8"
+)
+
+// cborMaxDepth - nesting limit of decoded CBOR items
+const cborMaxDepth = 16
+
+// errCBOR is returned for data which is not CBOR as sent by
+// authenticators: definite lengths, no floats, int or text map keys
+var errCBOR = errors.New("malformed CBOR")
+
+// decodeCBOR decodes the first item of data and returns it with the
+// number of bytes it takes
+//
+// integers are int64, byte strings []byte, text strings string, arrays
+// []interface{}, maps map[interface{}]interface{}, null and undefined nil
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.item(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+// cborDecoder - position in the data being decoded
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// head reads the major type and the argument of the next item
+func (d *cborDecoder) head() (major byte, arg uint64, err error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, errCBOR
+	}
+	b := d.data[d.pos]
+	d.pos++
+	major, info := b>>5, b&0x1f
+
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		n := 1 << (info - 24)
+		if len(d.data)-d.pos < n {
+			return 0, 0, errCBOR
+		}
+		for _, c := range d.data[d.pos : d.pos+n] {
+			arg = arg<<8 | uint64(c)
+		}
+		d.pos += n
+	default:
+		// indefinite lengths
+		return 0, 0, errCBOR
+	}
+	return major, arg, nil
+}
+
+// item decodes the next item
+func (d *cborDecoder) item(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBOR
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	remaining := uint64(len(d.data) - d.pos)
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return int64(arg), nil
+
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errCBOR
+		}
+		return -1 - int64(arg), nil
+
+	case 2, 3:
+		if arg > remaining {
+			return nil, errCBOR
+		}
+		b := d.data[d.pos : d.pos+int(arg)]
+		d.pos += int(arg)
+		if major == 3 {
+			if !utf8.Valid(b) {
+				return nil, errCBOR
+			}
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+
+	case 4:
+		// each item takes at least one byte
+		if arg > remaining {
+			return nil, errCBOR
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+
+	case 5:
+		if arg > remaining/2 {
+			return nil, errCBOR
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			k, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errCBOR
+			}
+			if _, ok := m[k]; ok {
+				return nil, errCBOR
+			}
+			v, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+
+	case 6:
+		// the tag is ignored
+		return d.item(depth + 1)
+
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, errCBOR
+	}
+}
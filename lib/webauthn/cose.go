@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the supported credentials
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// Algorithms - supported algorithms, most preferred first
+var Algorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// rsaMinBits - smallest accepted RSA key
+const rsaMinBits = 2048
+
+// COSE key types, curves and labels
+const (
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+
+	coseLabelKty = 1
+	coseLabelAlg = 3
+)
+
+// errSignature - a signature which does not match
+var errSignature = errors.New("signature does not match")
+
+// parsePublicKey returns the algorithm and the key of a COSE key
+func parsePublicKey(cose []byte) (int64, crypto.PublicKey, error) {
+	v, n, err := decodeCBOR(cose)
+	if err != nil {
+		return 0, nil, err
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok || n != len(cose) {
+		return 0, nil, errCBOR
+	}
+
+	kty, _ := m[int64(coseLabelKty)].(int64)
+	alg, _ := m[int64(coseLabelAlg)].(int64)
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("invalid EC2 key")
+		}
+		// rejects points which are not on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return 0, nil, err
+		}
+		return alg, &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("invalid OKP key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n)*8 < rsaMinBits || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("invalid RSA key")
+		}
+		exponent := new(big.Int).SetBytes(e).Int64()
+		if exponent < 3 || exponent%2 == 0 {
+			return 0, nil, errors.New("invalid RSA exponent")
+		}
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent)}, nil
+	}
+	return 0, nil, fmt.Errorf("key type %d with algorithm %d is not supported", kty, alg)
+}
+
+// verifySignature checks the signature of data by a key of an algorithm
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) error {
+	digest := sha256.Sum256(data)
+	switch alg {
+	case AlgES256:
+		k, ok := key.(*ecdsa.PublicKey)
+		if ok && ecdsa.VerifyASN1(k, digest[:], sig) {
+			return nil
+		}
+	case AlgEdDSA:
+		k, ok := key.(ed25519.PublicKey)
+		if ok && ed25519.Verify(k, data, sig) {
+			return nil
+		}
+	case AlgRS256:
+		k, ok := key.(*rsa.PublicKey)
+		if ok && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("algorithm %d is not supported", alg)
+	}
+	return errSignature
+}
@@ -0,0 +1,588 @@
+// Package webauthn implements the relying party of the WebAuthn
+// registration and authentication ceremonies for passkeys and security
+// keys
+//
+// the options and the responses use the JSON serialization of WebAuthn,
+// so that a browser can pass them to PublicKeyCredential.
+// parseCreationOptionsFromJSON and return credential.toJSON(); the
+// attestation formats none and packed are verified, the certificates of
+// a full attestation are not checked against trust anchors, so the model
+// of an authenticator is not restricted
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// user verification requirements
+const (
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+)
+
+// ceremony types in the client data
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// ChallengeLength - random bytes of a challenge
+const ChallengeLength = 32
+
+// MaxCredentialIDLength - longest credential ID allowed by the standard
+const MaxCredentialIDLength = 1023
+
+// flags of the authenticator data
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackupState    = 0x10
+	flagAttestedData   = 0x40
+	flagExtensionData  = 0x80
+)
+
+// ErrInvalid is wrapped by the errors of a response
+// which fails the verification
+var ErrInvalid = errors.New("invalid WebAuthn response")
+
+// ErrSignCount is returned for an assertion whose signature counter did
+// not increase, the credential may have been cloned
+var ErrSignCount = errors.New("signature counter did not increase")
+
+// oidAAGUID - certificate extension with the AAGUID of the authenticator
+var oidAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// RelyingParty - this application as a WebAuthn relying party
+type RelyingParty struct {
+	// ID - domain the credentials are scoped to, e.g. example.com
+	ID   string
+	Name string
+	// Origins - origins of the frontends using the credentials, on ID
+	// or a subdomain, e.g. https://app.example.com
+	Origins []string
+	// Timeout - of a ceremony in the browser
+	Timeout time.Duration
+	// UserVerification - UserVerificationRequired, Preferred
+	// or Discouraged, Preferred if empty
+	UserVerification string
+}
+
+// Check validates the settings
+func (rp *RelyingParty) Check() error {
+	if rp.ID == "" || strings.ContainsAny(rp.ID, ":/") {
+		return fmt.Errorf("webauthn: invalid RP ID %q", rp.ID)
+	}
+	if len(rp.Origins) == 0 {
+		return errors.New("webauthn: no origin")
+	}
+	for _, origin := range rp.Origins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" || u.Path != "" || (u.Scheme != "https" && u.Hostname() != "localhost") {
+			return fmt.Errorf("webauthn: invalid origin %q", origin)
+		}
+		if host := u.Hostname(); host != rp.ID && !strings.HasSuffix(host, "."+rp.ID) {
+			return fmt.Errorf("webauthn: origin %q is not on the RP ID %s", origin, rp.ID)
+		}
+	}
+	switch rp.UserVerification {
+	case "", UserVerificationRequired, UserVerificationPreferred, UserVerificationDiscouraged:
+	default:
+		return fmt.Errorf("webauthn: invalid user verification %q", rp.UserVerification)
+	}
+	return nil
+}
+
+// userVerification returns the requirement, Preferred by default
+func (rp *RelyingParty) userVerification() string {
+	if rp.UserVerification == "" {
+		return UserVerificationPreferred
+	}
+	return rp.UserVerification
+}
+
+// Base64URL - bytes encoded as unpadded base64url in JSON,
+// padded input is accepted too
+type Base64URL []byte
+
+// MarshalJSON encodes the bytes
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes the bytes, null is nil
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == nil {
+		*b = nil
+		return nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(*s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// RPEntity - the relying party in the creation options
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity - the account a credential is created for
+//
+// ID - user handle, random bytes without personal data
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+// CredentialParameter - an accepted type of credential
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor - a credential to exclude or to allow
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelection - requirements of the authenticator
+type AuthenticatorSelection struct {
+	ResidentKey        string `json:"residentKey"`
+	RequireResidentKey bool   `json:"requireResidentKey"`
+	UserVerification   string `json:"userVerification"`
+}
+
+// CreationOptions - options of navigator.credentials.create
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions - options of navigator.credentials.get
+//
+// without AllowCredentials the user picks a passkey of this relying party
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// AttestationResponse - response of the authenticator to a registration
+type AttestationResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AttestationObject Base64URL `json:"attestationObject"`
+	Transports        []string  `json:"transports,omitempty"`
+}
+
+// Registration - credential returned by navigator.credentials.create
+type Registration struct {
+	ID       string              `json:"id"`
+	RawID    Base64URL           `json:"rawId"`
+	Type     string              `json:"type"`
+	Response AttestationResponse `json:"response"`
+}
+
+// AssertionResponse - response of the authenticator to an authentication
+type AssertionResponse struct {
+	ClientDataJSON    Base64URL `json:"clientDataJSON"`
+	AuthenticatorData Base64URL `json:"authenticatorData"`
+	Signature         Base64URL `json:"signature"`
+	UserHandle        Base64URL `json:"userHandle,omitempty"`
+}
+
+// Assertion - credential returned by navigator.credentials.get
+type Assertion struct {
+	ID       string            `json:"id"`
+	RawID    Base64URL         `json:"rawId"`
+	Type     string            `json:"type"`
+	Response AssertionResponse `json:"response"`
+}
+
+// Credential - a verified new credential, to be saved with the account
+//
+// PublicKey - COSE key, needed to verify the assertions
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	Attestation    string
+	UserVerified   bool
+	BackupEligible bool
+	BackupState    bool
+}
+
+// AssertionResult - a verified assertion
+//
+// UserHandle - the user handle of a discoverable credential,
+// it must be the one the credential was created for
+type AssertionResult struct {
+	SignCount    uint32
+	UserVerified bool
+	BackupState  bool
+	UserHandle   []byte
+}
+
+// NewChallenge returns a random challenge
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, ChallengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// CreationOptions returns the options of a registration
+//
+// - exclude: credentials of the account, not registered again
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor) CreationOptions {
+	params := make([]CredentialParameter, 0, len(Algorithms))
+	for _, alg := range Algorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	if exclude == nil {
+		exclude = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.userVerification(),
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns the options of an authentication
+//
+// - allow: credentials of the account, none for a passkey of any account
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor) RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: rp.userVerification(),
+	}
+}
+
+// ClientChallenge returns the challenge a response was made for,
+// base64url encoded, to find the ceremony it belongs to
+func ClientChallenge(clientDataJSON []byte) (string, error) {
+	data := clientData{}
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return "", fmt.Errorf("%w: client data: %v", ErrInvalid, err)
+	}
+	if data.Challenge == "" {
+		return "", fmt.Errorf("%w: client data without challenge", ErrInvalid)
+	}
+	return data.Challenge, nil
+}
+
+// VerifyRegistration verifies the response to CreationOptions
+// with the challenge and returns the new credential
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, reg Registration) (Credential, error) {
+	if reg.Type != "public-key" {
+		return Credential{}, fmt.Errorf("%w: type %q", ErrInvalid, reg.Type)
+	}
+	if err := rp.checkClientData(reg.Response.ClientDataJSON, typeCreate, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	v, n, err := decodeCBOR(reg.Response.AttestationObject)
+	if err != nil || n != len(reg.Response.AttestationObject) {
+		return Credential{}, fmt.Errorf("%w: attestation object", ErrInvalid)
+	}
+	object, _ := v.(map[interface{}]interface{})
+	format, _ := object["fmt"].(string)
+	statement, _ := object["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := object["authData"].([]byte)
+	if statement == nil {
+		return Credential{}, fmt.Errorf("%w: attestation object", ErrInvalid)
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return Credential{}, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return Credential{}, fmt.Errorf("%w: no attested credential", ErrInvalid)
+	}
+	if !bytes.Equal(authData.credentialID, reg.RawID) {
+		return Credential{}, fmt.Errorf("%w: credential ID does not match", ErrInvalid)
+	}
+	alg, key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: public key: %v", ErrInvalid, err)
+	}
+
+	clientDataHash := sha256.Sum256(reg.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(statement) != 0 {
+			return Credential{}, fmt.Errorf("%w: statement of none attestation", ErrInvalid)
+		}
+	case "packed":
+		if err := verifyPacked(statement, signed, alg, key, authData.aaguid); err != nil {
+			return Credential{}, fmt.Errorf("%w: packed attestation: %v", ErrInvalid, err)
+		}
+	default:
+		return Credential{}, fmt.Errorf("%w: attestation format %q is not supported", ErrInvalid, format)
+	}
+
+	return Credential{
+		ID:             authData.credentialID,
+		PublicKey:      authData.publicKey,
+		Algorithm:      alg,
+		SignCount:      authData.signCount,
+		AAGUID:         authData.aaguid,
+		Transports:     reg.Response.Transports,
+		Attestation:    format,
+		UserVerified:   authData.flags&flagUserVerified != 0,
+		BackupEligible: authData.flags&flagBackupEligible != 0,
+		BackupState:    authData.flags&flagBackupState != 0,
+	}, nil
+}
+
+// VerifyAssertion verifies the response to RequestOptions with the
+// challenge, made by a credential with the saved public key and
+// signature counter
+//
+// ErrSignCount if the counter did not increase, authenticators which
+// do not count always send 0
+func (rp *RelyingParty) VerifyAssertion(challenge, publicKey []byte, signCount uint32, assertion Assertion) (AssertionResult, error) {
+	if assertion.Type != "public-key" {
+		return AssertionResult{}, fmt.Errorf("%w: type %q", ErrInvalid, assertion.Type)
+	}
+	response := assertion.Response
+	if err := rp.checkClientData(response.ClientDataJSON, typeGet, challenge); err != nil {
+		return AssertionResult{}, err
+	}
+
+	authData, err := parseAuthenticatorData(response.AuthenticatorData)
+	if err != nil {
+		return AssertionResult{}, err
+	}
+	if err := rp.checkAuthenticatorData(authData); err != nil {
+		return AssertionResult{}, err
+	}
+
+	alg, key, err := parsePublicKey(publicKey)
+	if err != nil {
+		return AssertionResult{}, fmt.Errorf("%w: public key: %v", ErrInvalid, err)
+	}
+	clientDataHash := sha256.Sum256(response.ClientDataJSON)
+	signed := append(append([]byte(nil), response.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(alg, key, signed, response.Signature); err != nil {
+		return AssertionResult{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+
+	if (authData.signCount != 0 || signCount != 0) && authData.signCount <= signCount {
+		return AssertionResult{}, ErrSignCount
+	}
+
+	return AssertionResult{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&flagUserVerified != 0,
+		BackupState:  authData.flags&flagBackupState != 0,
+		UserHandle:   response.UserHandle,
+	}, nil
+}
+
+// clientData - the collected client data signed by the authenticator
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// checkClientData checks the type, the challenge and the origin
+func (rp *RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	data := clientData{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrInvalid, err)
+	}
+	if data.Type != typ {
+		return fmt.Errorf("%w: client data type %q", ErrInvalid, data.Type)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(data.Challenge, "="))
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return fmt.Errorf("%w: challenge does not match", ErrInvalid)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin request", ErrInvalid)
+	}
+	for _, origin := range rp.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: origin %q is not allowed", ErrInvalid, data.Origin)
+}
+
+// authenticatorData - the parsed authenticator data
+//
+// aaguid, credentialID and publicKey only with flagAttestedData
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData parses the authenticator data, the attested
+// credential and the extensions must take exactly the rest
+func parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	invalid := fmt.Errorf("%w: authenticator data", ErrInvalid)
+	if len(data) < 37 {
+		return authenticatorData{}, invalid
+	}
+	authData := authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+
+	if authData.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return authenticatorData{}, invalid
+		}
+		authData.aaguid = rest[:16]
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > MaxCredentialIDLength || len(rest) < length {
+			return authenticatorData{}, invalid
+		}
+		authData.credentialID = rest[:length]
+		rest = rest[length:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, invalid
+		}
+		authData.publicKey = rest[:n]
+		rest = rest[n:]
+	}
+	if authData.flags&flagExtensionData != 0 {
+		v, n, err := decodeCBOR(rest)
+		if _, ok := v.(map[interface{}]interface{}); err != nil || !ok {
+			return authenticatorData{}, invalid
+		}
+		rest = rest[n:]
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, invalid
+	}
+	return authData, nil
+}
+
+// checkAuthenticatorData checks the RP ID and the user presence
+// and verification
+func (rp *RelyingParty) checkAuthenticatorData(authData authenticatorData) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(authData.rpIDHash, rpIDHash[:]) {
+		return fmt.Errorf("%w: RP ID does not match", ErrInvalid)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return fmt.Errorf("%w: user not present", ErrInvalid)
+	}
+	if rp.userVerification() == UserVerificationRequired && authData.flags&flagUserVerified == 0 {
+		return fmt.Errorf("%w: user not verified", ErrInvalid)
+	}
+	if authData.flags&flagBackupState != 0 && authData.flags&flagBackupEligible == 0 {
+		return fmt.Errorf("%w: backup state without eligibility", ErrInvalid)
+	}
+	return nil
+}
+
+// verifyPacked verifies a packed attestation statement, a self
+// attestation with the credential key or a full one with the key of
+// the certificate
+func verifyPacked(statement map[interface{}]interface{}, signed []byte, credentialAlg int64, credentialKey interface{}, aaguid []byte) error {
+	alg, _ := statement["alg"].(int64)
+	sig, _ := statement["sig"].([]byte)
+	if len(sig) == 0 {
+		return errors.New("no signature")
+	}
+
+	x5c, ok := statement["x5c"].([]interface{})
+	if !ok {
+		if alg != credentialAlg {
+			return errors.New("algorithm does not match the credential")
+		}
+		return verifySignature(alg, credentialKey, signed, sig)
+	}
+
+	if len(x5c) == 0 {
+		return errors.New("empty certificate chain")
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if cert.Version != 3 || cert.IsCA {
+		return errors.New("invalid attestation certificate")
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidAAGUID) {
+			continue
+		}
+		var certAAGUID []byte
+		if _, err := asn1.Unmarshal(ext.Value, &certAAGUID); err != nil || !bytes.Equal(certAAGUID, aaguid) {
+			return errors.New("AAGUID does not match the certificate")
+		}
+	}
+	return verifySignature(alg, cert.PublicKey, signed, sig)
+}
@@ -0,0 +1,251 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"apidev/lib/webauthn"
+	"apidev/lib/webauthn/webauthntest"
+)
+
+const origin = "https://app.example.com"
+
+func newRelyingParty(t *testing.T) *webauthn.RelyingParty {
+	t.Helper()
+
+	rp := &webauthn.RelyingParty{
+		ID:      "example.com",
+		Name:    "Example",
+		Origins: []string{origin},
+		Timeout: time.Minute,
+	}
+	if err := rp.Check(); err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+// register creates a passkey at the authenticator and verifies it
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) webauthn.Credential {
+	t.Helper()
+
+	challenge := newChallenge(t)
+	user := webauthn.UserEntity{ID: []byte("user handle"), Name: "alice", DisplayName: "Alice"}
+	reg, err := authenticator.Create(rp.CreationOptions(challenge, user, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential, err := rp.VerifyRegistration(challenge, reg)
+	if err != nil {
+		t.Fatalf("VerifyRegistration() = %v", err)
+	}
+	return credential
+}
+
+func TestRegistration(t *testing.T) {
+	rp := newRelyingParty(t)
+
+	tests := []struct {
+		name        string
+		attestation bool
+		want        string
+	}{
+		{"no attestation", false, "none"},
+		{"self attestation", true, "packed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator(origin)
+			authenticator.SelfAttestation = tt.attestation
+
+			credential := register(t, rp, authenticator)
+			if credential.Attestation != tt.want || credential.Algorithm != webauthn.AlgES256 || !credential.UserVerified {
+				t.Errorf("credential = %s %d verified %v, want %s %d verified", credential.Attestation, credential.Algorithm, credential.UserVerified, tt.want, webauthn.AlgES256)
+			}
+		})
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	rp := newRelyingParty(t)
+	user := webauthn.UserEntity{ID: []byte("user handle"), Name: "alice", DisplayName: "Alice"}
+
+	tests := []struct {
+		name          string
+		origin        string
+		rpID          string
+		otherResponse bool
+	}{
+		{"other origin", "https://evil.example.net", "", false},
+		{"origin of a sibling domain", "https://example.com.evil.net", "", false},
+		{"other RP ID", origin, "evil.example.net", false},
+		{"challenge of another ceremony", origin, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := webauthntest.NewAuthenticator(tt.origin)
+			challenge := newChallenge(t)
+			options := rp.CreationOptions(challenge, user, nil)
+			if tt.rpID != "" {
+				options.RP.ID = tt.rpID
+			}
+			if tt.otherResponse {
+				options.Challenge = newChallenge(t)
+			}
+
+			reg, err := authenticator.Create(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rp.VerifyRegistration(challenge, reg); !errors.Is(err, webauthn.ErrInvalid) {
+				t.Errorf("VerifyRegistration() = %v, want %v", err, webauthn.ErrInvalid)
+			}
+		})
+	}
+}
+
+func TestAssertion(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator(origin)
+	credential := register(t, rp, authenticator)
+	signCount := credential.SignCount
+
+	for i := 0; i < 2; i++ {
+		challenge := newChallenge(t)
+		assertion, err := authenticator.Get(rp.RequestOptions(challenge, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := rp.VerifyAssertion(challenge, credential.PublicKey, signCount, assertion)
+		if err != nil {
+			t.Fatalf("VerifyAssertion() = %v", err)
+		}
+		if result.SignCount <= signCount || string(result.UserHandle) != "user handle" {
+			t.Errorf("result = %+v, want a higher counter than %d and the user handle", result, signCount)
+		}
+		signCount = result.SignCount
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator(origin)
+	credential := register(t, rp, authenticator)
+	other := register(t, rp, webauthntest.NewAuthenticator(origin))
+
+	tests := []struct {
+		name string
+		// modify changes the options or the authenticator before the assertion
+		modify func(options *webauthn.RequestOptions, authenticator *webauthntest.Authenticator)
+		// signCount - the saved counter of the credential
+		signCount uint32
+		publicKey []byte
+		want      error
+	}{
+		{
+			name: "sign counter goes backwards",
+			modify: func(_ *webauthn.RequestOptions, authenticator *webauthntest.Authenticator) {
+				authenticator.SetSignCount(credential.ID, 4)
+			},
+			signCount: 10,
+			want:      webauthn.ErrSignCount,
+		},
+		{
+			name: "sign counter does not increase",
+			modify: func(_ *webauthn.RequestOptions, authenticator *webauthntest.Authenticator) {
+				authenticator.SetSignCount(credential.ID, 9)
+			},
+			signCount: 10,
+			want:      webauthn.ErrSignCount,
+		},
+		{
+			name: "other origin",
+			modify: func(_ *webauthn.RequestOptions, authenticator *webauthntest.Authenticator) {
+				authenticator.Origin = "https://evil.example.net"
+			},
+			want: webauthn.ErrInvalid,
+		},
+		{
+			name: "other challenge",
+			modify: func(options *webauthn.RequestOptions, _ *webauthntest.Authenticator) {
+				options.Challenge = []byte("another challenge")
+			},
+			want: webauthn.ErrInvalid,
+		},
+		{
+			name:      "key of another credential",
+			publicKey: other.PublicKey,
+			want:      webauthn.ErrInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator.Origin = origin
+			challenge := newChallenge(t)
+			options := rp.RequestOptions(challenge, nil)
+			if tt.modify != nil {
+				tt.modify(&options, authenticator)
+			}
+			publicKey := credential.PublicKey
+			if tt.publicKey != nil {
+				publicKey = tt.publicKey
+			}
+
+			assertion, err := authenticator.Get(options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rp.VerifyAssertion(challenge, publicKey, tt.signCount, assertion); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyAssertion() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssertionOfAnotherRelyingParty(t *testing.T) {
+	rp := newRelyingParty(t)
+	authenticator := webauthntest.NewAuthenticator(origin)
+	credential := register(t, rp, authenticator)
+
+	// a passkey of another RP ID signs with the hash of that ID
+	otherRP := &webauthn.RelyingParty{ID: "app.example.com", Origins: []string{origin}, Timeout: time.Minute}
+	register(t, otherRP, authenticator)
+
+	challenge := newChallenge(t)
+	assertion, err := authenticator.Get(otherRP.RequestOptions(challenge, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion.RawID = credential.ID
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0, assertion); !errors.Is(err, webauthn.ErrInvalid) {
+		t.Errorf("VerifyAssertion() = %v, want %v", err, webauthn.ErrInvalid)
+	}
+}
+
+func TestUserVerificationRequired(t *testing.T) {
+	rp := newRelyingParty(t)
+	rp.UserVerification = webauthn.UserVerificationRequired
+	authenticator := webauthntest.NewAuthenticator(origin)
+	credential := register(t, rp, authenticator)
+
+	authenticator.SkipUserVerification = true
+	challenge := newChallenge(t)
+	assertion, err := authenticator.Get(rp.RequestOptions(challenge, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rp.VerifyAssertion(challenge, credential.PublicKey, 0, assertion); !errors.Is(err, webauthn.ErrInvalid) {
+		t.Errorf("VerifyAssertion() = %v, want %v", err, webauthn.ErrInvalid)
+	}
+}
@@ -0,0 +1,121 @@
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"apidev/lib/webauthn"
+)
+
+// COSE key types, curves and labels of an ES256 key
+const (
+	coseKtyEC2   = 2
+	coseCrvP256  = 1
+	coseLabelKty = 1
+	coseLabelAlg = 3
+)
+
+// cborPair - an entry of a cborMap
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+// cborMap - a map encoded with its entries in the given order,
+// which must be the canonical order of CTAP2 for authenticator data
+type cborMap []cborPair
+
+// encodeCBOR encodes int, int64, []byte, string, []interface{},
+// cborMap and bool values
+func encodeCBOR(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := writeCBOR(buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCBOR writes the encoding of a value
+func writeCBOR(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case int:
+		return writeCBOR(buf, int64(v))
+	case int64:
+		if v < 0 {
+			writeCBORHead(buf, 1, uint64(-1-v))
+		} else {
+			writeCBORHead(buf, 0, uint64(v))
+		}
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCBORHead(buf, 4, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case cborMap:
+		writeCBORHead(buf, 5, uint64(len(v)))
+		for _, pair := range v {
+			if err := writeCBOR(buf, pair.key); err != nil {
+				return err
+			}
+			if err := writeCBOR(buf, pair.value); err != nil {
+				return err
+			}
+		}
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	default:
+		return fmt.Errorf("cbor: cannot encode %T", v)
+	}
+	return nil
+}
+
+// writeCBORHead writes the major type and the argument in the
+// shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(major | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		_ = binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		_ = binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major | 27)
+		_ = binary.Write(buf, binary.BigEndian, arg)
+	}
+}
+
+// encodeES256Key returns the COSE key of an ES256 public key
+func encodeES256Key(key *ecdsa.PublicKey) ([]byte, error) {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+	return encodeCBOR(cborMap{
+		{int64(coseLabelKty), int64(coseKtyEC2)},
+		{int64(coseLabelAlg), webauthn.AlgES256},
+		{int64(-1), int64(coseCrvP256)},
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
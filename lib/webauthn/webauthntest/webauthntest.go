@@ -0,0 +1,251 @@
+// Package webauthntest provides a software authenticator for tests
+// of the WebAuthn ceremonies without a browser
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"apidev/lib/webauthn"
+)
+
+// ceremony types in the client data
+const (
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+)
+
+// flags of the authenticator data
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// ErrNoCredential is returned by Authenticator.Get when it holds no
+// credential for the options
+var ErrNoCredential = errors.New("no credential for the relying party")
+
+// Authenticator - software authenticator with ES256 passkeys
+//
+// it also plays the browser: the responses carry the client data of
+// Origin, the user is always present and verified unless
+// SkipUserVerification is set
+type Authenticator struct {
+	Origin string
+	AAGUID [16]byte
+	// SelfAttestation - packed self attestation instead of none
+	SelfAttestation      bool
+	SkipUserVerification bool
+
+	mu          sync.Mutex
+	credentials []*softCredential
+}
+
+// softCredential - a passkey held by an Authenticator
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator returns an Authenticator without credentials
+// for a frontend at origin
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Create makes a new passkey for the options,
+// like navigator.credentials.create
+func (a *Authenticator) Create(options webauthn.CreationOptions) (webauthn.Registration, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	supported := false
+	for _, param := range options.PubKeyCredParams {
+		supported = supported || param.Alg == webauthn.AlgES256
+	}
+	if !supported {
+		return webauthn.Registration{}, errors.New("ES256 is not accepted")
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RP.ID, excluded.ID) != nil {
+			return webauthn.Registration{}, errors.New("credential already registered")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return webauthn.Registration{}, err
+	}
+	credential := &softCredential{
+		id:         make([]byte, 16),
+		rpID:       options.RP.ID,
+		userHandle: options.User.ID,
+		key:        key,
+	}
+	if _, err := rand.Read(credential.id); err != nil {
+		return webauthn.Registration{}, err
+	}
+	publicKey, err := encodeES256Key(&key.PublicKey)
+	if err != nil {
+		return webauthn.Registration{}, err
+	}
+
+	authData := a.authenticatorData(credential, flagAttestedData)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(credential.id)))
+	authData = append(authData, credential.id...)
+	authData = append(authData, publicKey...)
+
+	clientDataJSON, err := a.clientData(typeCreate, options.Challenge)
+	if err != nil {
+		return webauthn.Registration{}, err
+	}
+	statement := cborMap{}
+	format := "none"
+	if a.SelfAttestation {
+		sig, err := credential.sign(authData, clientDataJSON)
+		if err != nil {
+			return webauthn.Registration{}, err
+		}
+		format = "packed"
+		statement = cborMap{{"alg", webauthn.AlgES256}, {"sig", sig}}
+	}
+	attestationObject, err := encodeCBOR(cborMap{
+		{"fmt", format},
+		{"attStmt", statement},
+		{"authData", authData},
+	})
+	if err != nil {
+		return webauthn.Registration{}, err
+	}
+
+	a.credentials = append(a.credentials, credential)
+	return webauthn.Registration{
+		ID:    base64.RawURLEncoding.EncodeToString(credential.id),
+		RawID: credential.id,
+		Type:  "public-key",
+		Response: webauthn.AttestationResponse{
+			ClientDataJSON:    clientDataJSON,
+			AttestationObject: attestationObject,
+			Transports:        []string{"internal"},
+		},
+	}, nil
+}
+
+// Get signs the challenge of the options with an allowed credential,
+// or the newest passkey of the relying party if none is listed,
+// like navigator.credentials.get
+func (a *Authenticator) Get(options webauthn.RequestOptions) (webauthn.Assertion, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var credential *softCredential
+	for _, allowed := range options.AllowCredentials {
+		if credential = a.find(options.RPID, allowed.ID); credential != nil {
+			break
+		}
+	}
+	if len(options.AllowCredentials) == 0 {
+		for i := len(a.credentials) - 1; i >= 0 && credential == nil; i-- {
+			if a.credentials[i].rpID == options.RPID {
+				credential = a.credentials[i]
+			}
+		}
+	}
+	if credential == nil {
+		return webauthn.Assertion{}, ErrNoCredential
+	}
+
+	credential.signCount++
+	authData := a.authenticatorData(credential, 0)
+	clientDataJSON, err := a.clientData(typeGet, options.Challenge)
+	if err != nil {
+		return webauthn.Assertion{}, err
+	}
+	sig, err := credential.sign(authData, clientDataJSON)
+	if err != nil {
+		return webauthn.Assertion{}, err
+	}
+
+	return webauthn.Assertion{
+		ID:    base64.RawURLEncoding.EncodeToString(credential.id),
+		RawID: credential.id,
+		Type:  "public-key",
+		Response: webauthn.AssertionResponse{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        credential.userHandle,
+		},
+	}, nil
+}
+
+// SetSignCount changes the signature counter of a credential,
+// e.g. to act as a clone of it
+func (a *Authenticator) SetSignCount(credentialID []byte, signCount uint32) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, credential := range a.credentials {
+		if string(credential.id) == string(credentialID) {
+			credential.signCount = signCount
+			return true
+		}
+	}
+	return false
+}
+
+// find returns a credential of the relying party by its ID
+func (a *Authenticator) find(rpID string, id []byte) *softCredential {
+	for _, credential := range a.credentials {
+		if credential.rpID == rpID && string(credential.id) == string(id) {
+			return credential
+		}
+	}
+	return nil
+}
+
+// authenticatorData returns the authenticator data up to the counter
+func (a *Authenticator) authenticatorData(credential *softCredential, flags byte) []byte {
+	flags |= flagUserPresent
+	if !a.SkipUserVerification {
+		flags |= flagUserVerified
+	}
+	rpIDHash := sha256.Sum256([]byte(credential.rpID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, credential.signCount)
+}
+
+// clientData returns the client data of a ceremony
+func (a *Authenticator) clientData(typ string, challenge []byte) ([]byte, error) {
+	return json.Marshal(clientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.Origin,
+	})
+}
+
+// clientData - the collected client data signed by the authenticator
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// sign signs the authenticator data and the hash of the client data
+func (c *softCredential) sign(authData, clientDataJSON []byte) ([]byte, error) {
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	return ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+}
@@ -2,16 +2,39 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"time"
+	_ "time/tzdata" // timezones of user profiles, also in containers without zoneinfo
 
 	gconfig "github.com/pilinux/gorest/config"
 	gdatabase "github.com/pilinux/gorest/database"
 
+	"apidev/config"
+	"apidev/database/cache"
 	"apidev/database/migrate"
+	"apidev/database/store"
+	"apidev/handler"
+	"apidev/lib/avatar"
+	"apidev/lib/dataexport"
+	"apidev/lib/lockout"
+	"apidev/lib/mailer"
+	"apidev/lib/oauthclient"
+	"apidev/lib/webauthn"
 	"apidev/router"
 )
 
 func main() {
+	// storage of user profiles and notes
+	// - default: RDBMS if activated, otherwise MongoDB if activated
+	// - memory: demo mode, nothing is persisted
+	storage := flag.String("storage", "", "storage of user profiles and notes: rdbms, mongo or memory")
+	// grant the admin role to the first administrator and exit,
+	// further roles are granted with the admin API
+	bootstrapAdmin := flag.Uint64("bootstrap-admin", 0, "auth ID of the first administrator, requires RDBMS")
+	flag.Parse()
+
 	// set configs
 	err := gconfig.Config()
 	if err != nil {
@@ -22,6 +45,9 @@ func main() {
 	// read configs
 	configure := gconfig.GetConfig()
 
+	// set application specific configs
+	config.Config()
+
 	if configure.Database.RDBMS.Activate == gconfig.Activated {
 		// Initialize RDBMS client
 		if err := gdatabase.InitDB().Error; err != nil {
@@ -66,6 +92,31 @@ func main() {
 		}
 	}
 
+	// Inject storage of user profiles and notes, and the services of the handlers
+	if err := setHandlers(store.Backend(*storage), configure); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if *bootstrapAdmin != 0 {
+		if configure.Database.RDBMS.Activate != gconfig.Activated || handler.Backend() == "" {
+			fmt.Println("bootstrap-admin requires ACTIVATE_RDBMS=yes")
+			return
+		}
+		if err := handler.BootstrapAdmin(*bootstrapAdmin); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("admin role granted to auth ID", *bootstrapAdmin)
+		return
+	}
+
+	// purge accounts after their grace period and expired data exports
+	// - 0 disables the job, e.g. on all but one instance
+	if interval := config.GetConfig().Deletion.PurgeInterval; handler.Backend() != "" && interval > 0 {
+		handler.StartPurge(interval)
+	}
+
 	r, err := router.SetupRouter(configure)
 	if err != nil {
 		fmt.Println(err)
@@ -78,3 +129,332 @@ func main() {
 		return
 	}
 }
+
+// setHandlers injects the storage and the services used by the handlers
+func setHandlers(backend store.Backend, configure *gconfig.Configuration) error {
+	if err := setStores(backend, configure); err != nil {
+		return err
+	}
+	// no storage: routes for user profiles and notes are disabled
+	if handler.Backend() == "" {
+		return nil
+	}
+	if err := checkStorage(configure); err != nil {
+		return err
+	}
+
+	setAuthStores(configure)
+	if err := setOAuthProviders(); err != nil {
+		return err
+	}
+	if err := setWebAuthn(); err != nil {
+		return err
+	}
+	if err := setLockout(configure); err != nil {
+		return err
+	}
+	return setMailer(configure)
+}
+
+// setStores injects the storage of user profiles, notes, the audit log,
+// workspaces, data exports and avatars into the handlers
+func setStores(backend store.Backend, configure *gconfig.Configuration) error {
+	if backend == "" {
+		switch {
+		case configure.Database.RDBMS.Activate == gconfig.Activated:
+			backend = store.BackendRDBMS
+		case configure.Database.MongoDB.Activate == gconfig.Activated:
+			backend = store.BackendMongo
+		default:
+			// no storage: routes for user profiles and notes are disabled
+			return nil
+		}
+	}
+
+	var users store.UserStore
+	var notes store.NoteStore
+	var audit store.AuditStore
+	var exports store.ExportStore
+	var workspaces store.WorkspaceStore
+
+	switch backend {
+	case store.BackendRDBMS:
+		if configure.Database.RDBMS.Activate != gconfig.Activated {
+			return errors.New("storage rdbms requires ACTIVATE_RDBMS=yes")
+		}
+		db := gdatabase.GetDB()
+		users, notes = store.NewGormUserStore(db), store.NewGormNoteStore(db)
+		audit = store.NewGormAuditStore(db)
+		exports = store.NewGormExportStore(db)
+		workspaces = store.NewGormWorkspaceStore(db)
+		handler.SetKeyStore(store.NewGormKeyStore(db))
+
+	case store.BackendMongo:
+		if configure.Database.MongoDB.Activate != gconfig.Activated {
+			return errors.New("storage mongo requires ACTIVATE_MONGO=yes")
+		}
+		if err := migrate.SetMongoIndexes(*configure); err != nil {
+			return err
+		}
+		db := gdatabase.GetMongo().Database(configure.Database.MongoDB.Env.AppName)
+		ttl := time.Duration(configure.Database.MongoDB.Env.ConnTTL) * time.Second
+		users, notes = store.NewMongoUserStore(db, ttl), store.NewMongoNoteStore(db, ttl)
+		audit = store.NewMongoAuditStore(db, ttl)
+		exports = store.NewMongoExportStore(db, ttl)
+		workspaces = store.NewMongoWorkspaceStore(db, ttl)
+
+	case store.BackendMemory:
+		memoryAudit := store.NewMemoryAuditStore()
+		memoryNotes := store.NewMemoryNoteStore(memoryAudit)
+		users, notes = store.NewMemoryUserStore(memoryAudit), memoryNotes
+		audit = memoryAudit
+		exports = store.NewMemoryExportStore()
+		// deleting a workspace deletes its notes
+		workspaces = store.NewMemoryWorkspaceStore(memoryNotes, memoryAudit)
+
+	default:
+		return fmt.Errorf("unknown storage: %s", backend)
+	}
+
+	if backend != store.BackendMemory {
+		users, notes = cacheStores(users, notes, configure)
+	}
+
+	handler.SetStores(backend, users, notes, audit)
+	handler.SetWorkspaceStore(workspaces)
+
+	// processed avatars and data export archives,
+	// on disk unless nothing is persisted
+	if backend == store.BackendMemory {
+		handler.SetAvatarStorage(avatar.NewMemory())
+		handler.SetExportStore(exports, dataexport.NewMemory())
+	} else {
+		handler.SetAvatarStorage(avatar.NewDir(config.GetConfig().Avatar.Dir))
+		handler.SetExportStore(exports, dataexport.NewDir(config.GetConfig().DataExport.Dir))
+	}
+	return nil
+}
+
+// cacheStores returns the stores of profiles and notes behind a
+// read-through cache if Redis is activated
+// - in-process LRU in front of Redis
+func cacheStores(users store.UserStore, notes store.NoteStore, configure *gconfig.Configuration) (store.UserStore, store.NoteStore) {
+	if configure.Database.REDIS.Activate != gconfig.Activated {
+		return users, notes
+	}
+	configureCache := config.GetConfig().Cache
+	client := *gdatabase.GetRedis()
+	timeout := time.Duration(configure.Database.REDIS.Conn.ConnTTL) * time.Second
+
+	users = store.NewCachedUserStore(users, cache.NewTiered(
+		"users",
+		cache.NewLRU(configureCache.LocalSize, configureCache.LocalTTL),
+		cache.NewRedis(client, "apidev:", configureCache.TTL, timeout),
+	))
+	notes = store.NewCachedNoteStore(notes, cache.NewTiered(
+		"notes",
+		cache.NewLRU(configureCache.LocalSize, configureCache.LocalTTL),
+		cache.NewRedis(client, "apidev:", configureCache.TTL, timeout),
+	))
+	return users, notes
+}
+
+// checkStorage refuses the features the storage does not support,
+// instead of serving them without persisting their data
+// - MongoDB keeps no change sequence of the notes and no keys
+// - the accounts are only stored in RDBMS, or in memory in demo mode
+func checkStorage(configure *gconfig.Configuration) error {
+	configureNotes := config.GetConfig().Notes
+	if handler.Backend() == store.BackendMongo {
+		if configureNotes.DeltaSync {
+			return errors.New("storage mongo does not support DELTA_SYNC, set DELTA_SYNC=no")
+		}
+		if configureNotes.KeySharing {
+			return errors.New("storage mongo does not support E2EE_KEY_SHARING, set E2EE_KEY_SHARING=no")
+		}
+	}
+	if !accountStorage(configure) && config.GetConfig().OAuth2.Activate {
+		return errors.New("ACTIVATE_OAUTH2_SERVER requires ACTIVATE_RDBMS=yes")
+	}
+	return nil
+}
+
+// accountStorage reports whether the accounts can be stored:
+// in RDBMS, or in memory in demo mode
+func accountStorage(configure *gconfig.Configuration) bool {
+	return configure.Database.RDBMS.Activate == gconfig.Activated || handler.Backend() == store.BackendMemory
+}
+
+// setAuthStores injects the stores of the accounts into the handlers:
+// credentials of gorest, revoked JWTs, roles, suspensions, tokens,
+// identities, OAuth2 grants, sessions, email tokens and passkeys
+//
+// nothing is injected without storage of the accounts, the routes
+// needing them are disabled
+func setAuthStores(configure *gconfig.Configuration) {
+	if !accountStorage(configure) {
+		return
+	}
+	var authStore store.AuthStore = store.NewMemoryAuthStore()
+	if configure.Database.RDBMS.Activate == gconfig.Activated {
+		authStore = store.NewGormAuthStore(gdatabase.GetDB())
+	}
+
+	handler.SetAuthStore(authStore)
+}
+
+// setOAuthProviders injects the providers of the social login
+func setOAuthProviders() error {
+	configureOAuth := config.GetConfig().OAuth
+	providers := make([]*oauthclient.Provider, 0, len(configureOAuth.Providers))
+	for _, p := range configureOAuth.Providers {
+		provider := &oauthclient.Provider{
+			Name:         p.Name,
+			Type:         p.Type,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  configureOAuth.RedirectURL + "/" + p.Name + "/callback",
+			Scopes:       p.Scopes,
+			Issuer:       p.Issuer,
+			AuthURL:      p.AuthURL,
+			TokenURL:     p.TokenURL,
+			UserInfoURL:  p.UserInfoURL,
+		}
+		if err := provider.SetDefaults(); err != nil {
+			return fmt.Errorf("oauth provider %s: %w", p.Name, err)
+		}
+		providers = append(providers, provider)
+	}
+	handler.SetOAuthProviders(providers, configureOAuth.StateTTL)
+	return nil
+}
+
+// setWebAuthn injects the relying party of the passkeys if enabled
+func setWebAuthn() error {
+	if configureWebAuthn := config.GetConfig().WebAuthn; configureWebAuthn.Activate {
+		rp := &webauthn.RelyingParty{
+			ID:               configureWebAuthn.RPID,
+			Name:             configureWebAuthn.RPName,
+			Origins:          configureWebAuthn.Origins,
+			Timeout:          configureWebAuthn.Timeout,
+			UserVerification: configureWebAuthn.UserVerification,
+		}
+		if err := rp.Check(); err != nil {
+			return err
+		}
+		handler.SetWebAuthn(rp)
+	}
+	return nil
+}
+
+// setLockout injects the throttling of failed logins if enabled,
+// shared by all instances in Redis
+func setLockout(configure *gconfig.Configuration) error {
+	configureLockout := config.GetConfig().Lockout
+	if !configureLockout.Activate {
+		return nil
+	}
+
+	accountPolicy := lockout.Policy{
+		FreeAttempts: configureLockout.FreeAttempts,
+		Delay:        configureLockout.Delay,
+		MaxDelay:     configureLockout.MaxDelay,
+		Threshold:    configureLockout.Threshold,
+		Duration:     configureLockout.Duration,
+		MaxDuration:  configureLockout.MaxDuration,
+		Window:       configureLockout.Window,
+	}
+	ipPolicy := accountPolicy
+	ipPolicy.FreeAttempts = configureLockout.IPFreeAttempts
+	ipPolicy.Threshold = configureLockout.IPThreshold
+	if err := accountPolicy.Check(); err != nil {
+		return err
+	}
+	if err := ipPolicy.Check(); err != nil {
+		return err
+	}
+
+	var lockoutStore lockout.Store = lockout.NewMemory()
+	if configure.Database.REDIS.Activate == gconfig.Activated {
+		timeout := time.Duration(configure.Database.REDIS.Conn.ConnTTL) * time.Second
+		lockoutStore = lockout.NewRedis(*gdatabase.GetRedis(), "apidev:", timeout)
+	}
+	handler.SetLockout(lockout.New(lockoutStore, accountPolicy), lockout.New(lockoutStore, ipPolicy))
+	return nil
+}
+
+// setMailer injects the provider of the emails sent to users, kept in
+// memory in demo mode; the others send in the background and retry
+// failed emails
+func setMailer(configure *gconfig.Configuration) error {
+	configureEmail := config.GetConfig().Email
+	var emailProvider mailer.Mailer
+	switch {
+	case !configureEmail.Activate:
+	case configureEmail.Provider == "postmark":
+		emailProvider = &mailer.Postmark{
+			Token:      configure.EmailConf.APIToken,
+			From:       configure.EmailConf.AddrFrom,
+			Stream:     configure.EmailConf.DeliveryType,
+			TrackOpens: configure.EmailConf.TrackOpens,
+			TrackLinks: configure.EmailConf.TrackLinks,
+			Templates: map[string]int64{
+				mailer.KindVerifyEmail:         configure.EmailConf.EmailVerificationTemplateID,
+				mailer.KindRecoverPassword:     configure.EmailConf.PasswordRecoverTemplateID,
+				mailer.KindMagicLink:           configureEmail.MagicLink.TemplateID,
+				mailer.KindAccountLocked:       config.GetConfig().Lockout.TemplateID,
+				mailer.KindWorkspaceInvitation: configureEmail.InvitationTemplateID,
+			},
+			Tags: map[string]string{
+				mailer.KindVerifyEmail:         configure.EmailConf.EmailVerificationTag,
+				mailer.KindRecoverPassword:     configure.EmailConf.PasswordRecoverTag,
+				mailer.KindMagicLink:           configureEmail.MagicLink.Tag,
+				mailer.KindAccountLocked:       config.GetConfig().Lockout.Tag,
+				mailer.KindWorkspaceInvitation: configureEmail.InvitationTag,
+			},
+		}
+	case configureEmail.Provider == "smtp" || configureEmail.Provider == "file":
+		templates, err := mailer.NewTemplates(configureEmail.TemplateDir)
+		if err != nil {
+			return err
+		}
+		if configureEmail.Provider == "file" {
+			emailProvider = mailer.NewDir(configureEmail.FileDir, configure.EmailConf.AddrFrom, templates)
+			break
+		}
+
+		switch configureEmail.SMTP.TLS {
+		case mailer.TLSStartTLS, mailer.TLSImplicit, mailer.TLSNone:
+		default:
+			return fmt.Errorf("EMAIL_SMTP_TLS %s is not supported", configureEmail.SMTP.TLS)
+		}
+		emailProvider = &mailer.SMTP{
+			Host:      configureEmail.SMTP.Host,
+			Port:      configureEmail.SMTP.Port,
+			TLS:       configureEmail.SMTP.TLS,
+			Username:  configureEmail.SMTP.Username,
+			Password:  configureEmail.SMTP.Password,
+			From:      configure.EmailConf.AddrFrom,
+			Templates: templates,
+		}
+	default:
+		return fmt.Errorf("email provider %s is not supported", configureEmail.Provider)
+	}
+	switch {
+	case emailProvider != nil:
+		// a few workers, so that one slow email does not hold up the rest
+		handler.SetMailer(mailer.NewQueue(
+			emailProvider,
+			configureEmail.QueueSize,
+			4,
+			configureEmail.RetryAttempts,
+			configureEmail.RetryDelay,
+			mailer.RequestTimeout,
+		))
+	case handler.Backend() == store.BackendMemory:
+		handler.SetMailer(mailer.NewMemory())
+	case configureEmail.VerifyEmail || configureEmail.RecoverPassword || configureEmail.MagicLink.Activate:
+		return errors.New("VERIFY_EMAIL, RECOVER_PASSWORD and MAGIC_LINK require ACTIVATE_EMAIL_SERVICE=yes")
+	}
+	return nil
+}
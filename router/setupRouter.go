@@ -9,7 +9,12 @@ import (
 	gmiddleware "github.com/pilinux/gorest/lib/middleware"
 	gservice "github.com/pilinux/gorest/service"
 
+	"apidev/config"
 	"apidev/controller"
+	"apidev/database/store"
+	"apidev/handler"
+	"apidev/lib/rbac"
+	"apidev/lib/scope"
 )
 
 // SetupRouter sets up all the routes
@@ -79,41 +84,148 @@ func SetupRouter(configure *gconfig.Configuration) (*gin.Engine, error) {
 		))
 	}
 
+	// HTML templates rendered with pongo2,
+	// e.g. the consent screen of the OAuth2 server
+	if configure.ViewConfig.Activate == gconfig.Activated {
+		r.Use(gmiddleware.Pongo2(configure.ViewConfig.Directory))
+	}
+
 	// API Status
 	r.GET("", controller.APIStatus)
 
 	// API:v1
+	// - tokens of purged accounts are rejected after gorest validated them
 	v1 := r.Group("/api/v1/")
 	{
 		// RDBMS
 		if configure.Database.RDBMS.Activate == gconfig.Activated {
+			configureEmail := config.GetConfig().Email
+
 			// Register - no JWT required
-			v1.POST("register", gcontroller.CreateUserAuth)
+			// - if email verification is enabled, send a verification code
+			if configureEmail.VerifyEmail {
+				v1.POST("register", controller.StartEmailVerification(), gcontroller.CreateUserAuth)
+			} else {
+				v1.POST("register", gcontroller.CreateUserAuth)
+			}
 
 			// Login - app issues JWT
 			// - if cookie management is enabled, save tokens on client browser
-			v1.POST("login", gcontroller.Login)
+			// - if the lockout is enabled, failed logins are throttled
+			// per account and per IP
+			// - if email verification is enabled, unverified accounts are rejected
+			// - each login starts a session
+			configureLockout := config.GetConfig().Lockout
+			login := []gin.HandlerFunc{}
+			if configureLockout.Activate {
+				login = append(login, controller.ThrottleLogin())
+			}
+			login = append(login, controller.TrackSession())
+			if configureEmail.VerifyEmail {
+				login = append(login, controller.RequireVerifiedEmail())
+			}
+			v1.POST("login", append(login, gcontroller.Login)...)
+
+			// Magic link - passwordless login by email, no JWT required
+			// - issues the same JWTs as login, 2FA is still required if enabled
+			if configureEmail.MagicLink.Activate {
+				v1.POST("login/magic-link", controller.RequestMagicLink)
+				v1.POST("login/magic-link/verify", controller.MagicLinkLogin)
+			}
+
+			// Passkeys - passwordless login with WebAuthn, no JWT required
+			// - issues the same JWTs as login, the second factor counts as
+			// verified if the authenticator verified the user
+			// - passkeys are added to an account after a login
+			configureWebAuthn := config.GetConfig().WebAuthn
+			if configureWebAuthn.Activate {
+				v1.POST("login/passkey/begin", controller.BeginPasskeyLogin)
+				v1.POST("login/passkey/finish", controller.FinishPasskeyLogin)
+
+				rPasskeys := v1.Group("passkeys")
+				rPasskeys.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rPasskeys.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rPasskeys.GET("", controller.GetPasskeys)
+				rPasskeys.POST("register/begin", controller.BeginPasskeyRegistration)
+				rPasskeys.POST("register/finish", controller.FinishPasskeyRegistration)
+				rPasskeys.DELETE("/:id", controller.DeletePasskey)
+			}
+
+			// Email verification - no JWT required
+			if configureEmail.VerifyEmail {
+				v1.POST("verify", controller.VerifyEmail)
+				v1.POST("resend-verification-email", controller.ResendVerificationEmail)
+			}
+
+			// Password recovery - no JWT required
+			// - a reset ends all logins
+			if configureEmail.RecoverPassword {
+				v1.POST("password/forgot", controller.ForgotPassword)
+				v1.POST("password/reset", controller.ResetPassword)
+			}
 
 			// Logout
 			// - if cookie management is enabled, delete tokens from cookies
 			// - if Redis is enabled, save tokens in a blacklist until TTL
+			// - the session is revoked
 			rLogout := v1.Group("logout")
-			rLogout.Use(gmiddleware.JWT()).Use(gmiddleware.RefreshJWT()).Use(gservice.JWTBlacklistChecker())
-			rLogout.POST("", gcontroller.Logout)
+			rLogout.Use(gmiddleware.JWT()).Use(controller.KeepBody()).Use(gmiddleware.RefreshJWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			rLogout.POST("", controller.EndSession(), gcontroller.Logout)
+
+			// Social login with OAuth2/OIDC providers
+			// - issues the same JWTs as login, creates the account with the first login
+			if len(handler.OAuthProviders()) > 0 {
+				rOAuth := v1.Group("oauth")
+				rOAuth.GET("providers", controller.GetOAuthProviders)
+				rOAuth.GET("/:provider/login", controller.OAuthLogin)
+				rOAuth.GET("/:provider/callback", controller.OAuthCallback)
+
+				rOAuthUser := v1.Group("oauth")
+				rOAuthUser.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rOAuthUser.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rOAuthUser.POST("/:provider/link", controller.LinkOAuthProvider)
+				rOAuthUser.GET("identities", controller.GetOAuthIdentities)
+				rOAuthUser.DELETE("identities/:provider", controller.DeleteOAuthIdentity)
+			}
 
 			// Refresh - app issues new JWT
 			// - if cookie management is enabled, save tokens on client browser
 			rJWT := v1.Group("refresh")
-			rJWT.Use(gmiddleware.RefreshJWT()).Use(gservice.JWTBlacklistChecker())
-			rJWT.POST("", gcontroller.Refresh)
+			rJWT.Use(controller.KeepBody()).Use(gmiddleware.RefreshJWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			rJWT.POST("", controller.TrackSession(), gcontroller.Refresh)
 
 			// Two-factor authentication
 			if configure.Security.Must2FA == gconfig.Activated {
 				r2FA := v1.Group("2fa")
-				r2FA.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker())
+				r2FA.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
 				r2FA.POST("setup", gcontroller.Setup2FA)
-				r2FA.POST("activate", gcontroller.Activate2FA)
-				r2FA.POST("validate", gcontroller.Validate2FA)
+				r2FA.POST("activate", controller.TrackSession(), gcontroller.Activate2FA)
+				if configureLockout.Activate {
+					r2FA.POST("validate", controller.ThrottleTwoFA(), controller.TrackSession(), gcontroller.Validate2FA)
+				} else {
+					r2FA.POST("validate", controller.TrackSession(), gcontroller.Validate2FA)
+				}
+				// a passkey instead of the TOTP, the session is continued
+				if configureWebAuthn.Activate {
+					r2FA.POST("passkey/begin", controller.BeginPasskeyTwoFA)
+					if configureLockout.Activate {
+						r2FA.POST("passkey/validate", controller.ThrottleTwoFA(), controller.ValidatePasskeyTwoFA)
+					} else {
+						r2FA.POST("passkey/validate", controller.ValidatePasskeyTwoFA)
+					}
+				}
 				if configure.Security.Must2FA == gconfig.Activated {
 					r2FA.Use(gmiddleware.TwoFA(
 						configure.Security.TwoFA.Status.On,
@@ -122,12 +234,12 @@ func SetupRouter(configure *gconfig.Configuration) (*gin.Engine, error) {
 					))
 				}
 				// disable 2FA
-				r2FA.POST("deactivate", gcontroller.Deactivate2FA)
+				r2FA.POST("deactivate", controller.TrackSession(), gcontroller.Deactivate2FA)
 			}
 
 			// Update/reset password
 			rPass := v1.Group("password")
-			rPass.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker())
+			rPass.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
 			if configure.Security.Must2FA == gconfig.Activated {
 				rPass.Use(gmiddleware.TwoFA(
 					configure.Security.TwoFA.Status.On,
@@ -140,7 +252,7 @@ func SetupRouter(configure *gconfig.Configuration) (*gin.Engine, error) {
 
 			// Test JWT
 			rTestJWT := v1.Group("test-jwt")
-			rTestJWT.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker())
+			rTestJWT.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
 			if configure.Security.Must2FA == gconfig.Activated {
 				rTestJWT.Use(gmiddleware.TwoFA(
 					configure.Security.TwoFA.Status.On,
@@ -149,10 +261,38 @@ func SetupRouter(configure *gconfig.Configuration) (*gin.Engine, error) {
 				))
 			}
 			rTestJWT.GET("", gexample.AccessResource)
+		}
+
+		// User profiles and notes
+		// - available when a storage is injected into the handlers
+		if handler.Backend() != "" {
+			// User profile, settings and avatar
+			// - personal access tokens with the profile scopes are accepted
+			rProfile := v1.Group("users")
+			if handler.AccountStores() {
+				rProfile.Use(controller.AccessToken(scope.ProfileRead, scope.ProfileWrite))
+			}
+			rProfile.Use(controller.UnlessAccessToken(gmiddleware.JWT())).Use(controller.UnlessAccessToken(gservice.JWTBlacklistChecker())).Use(controller.UnlessAccessToken(controller.RevokedJWTChecker()))
+			if configure.Security.Must2FA == gconfig.Activated {
+				rProfile.Use(controller.UnlessAccessToken(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				)))
+			}
+			rProfile.GET("", controller.GetUserProfile)
+			rProfile.POST("", controller.CreateUserProfile)
+			rProfile.PUT("", controller.UpdateUserProfile)
+			rProfile.GET("settings", controller.GetUserSettings)
+			rProfile.PUT("settings", controller.ReplaceUserSettings)
+			rProfile.PATCH("settings", controller.UpdateUserSettings)
+			rProfile.GET("settings/schema", controller.GetSettingsSchema)
+			rProfile.PUT("avatar", controller.UpdateAvatar)
+			rProfile.DELETE("avatar", controller.DeleteAvatar)
 
-			// User
+			// User account, deletion and data export
 			rUsers := v1.Group("users")
-			rUsers.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker())
+			rUsers.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
 			if configure.Security.Must2FA == gconfig.Activated {
 				rUsers.Use(gmiddleware.TwoFA(
 					configure.Security.TwoFA.Status.On,
@@ -160,25 +300,223 @@ func SetupRouter(configure *gconfig.Configuration) (*gin.Engine, error) {
 					configure.Security.TwoFA.Status.Verified,
 				))
 			}
-			rUsers.GET("", controller.GetUserProfile)
-			rUsers.POST("", controller.CreateUserProfile)
-			rUsers.PUT("", controller.UpdateUserProfile)
+			rUsers.DELETE("", controller.DeleteAccount)
+			rUsers.POST("restore", controller.RestoreAccount)
+			rUsers.GET("data-export", controller.GetDataExports)
+			rUsers.POST("data-export", controller.CreateDataExport)
+			rUsers.GET("data-export/:id", controller.GetDataExport)
+			rUsers.GET("data-export/:id/download", controller.DownloadDataExport)
+
+			// Personal access tokens and sessions
+			// - available when the accounts are stored
+			if handler.AccountStores() {
+				// Personal access tokens for scripts and CI jobs,
+				// managed with a JWT only
+				rTokens := v1.Group("tokens")
+				rTokens.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rTokens.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rTokens.GET("", controller.GetAccessTokens)
+				rTokens.POST("", controller.CreateAccessToken)
+				rTokens.DELETE("/:id", controller.DeleteAccessToken)
+
+				// Sessions - active logins with JWTs
+				// - a revoked session is rejected by RevokedJWTChecker
+				rSessions := v1.Group("sessions")
+				rSessions.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rSessions.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rSessions.GET("", controller.GetSessions)
+				rSessions.DELETE("", controller.DeleteSessions)
+				rSessions.DELETE("/:id", controller.DeleteSession)
+			}
+
+			// OAuth2 authorization server for third-party applications
+			// - their access tokens are accepted like personal access tokens
+			if config.GetConfig().OAuth2.Activate && handler.AccountStores() {
+				// token, revocation and introspection endpoints,
+				// authenticated by the client credentials
+				rOAuth2 := v1.Group("oauth2")
+				rOAuth2.POST("token", controller.OAuthToken)
+				rOAuth2.POST("revoke", controller.RevokeOAuthToken)
+				rOAuth2.POST("introspect", controller.IntrospectOAuthToken)
+
+				// consent, clients and authorizations of the logged-in user
+				rOAuth2User := v1.Group("oauth2")
+				rOAuth2User.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rOAuth2User.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rOAuth2User.GET("authorize", controller.Authorize)
+				rOAuth2User.POST("authorize", controller.Consent)
+				rOAuth2User.GET("clients", controller.GetOAuthClients)
+				rOAuth2User.POST("clients", controller.CreateOAuthClient)
+				rOAuth2User.DELETE("clients/:clientID", controller.DeleteOAuthClient)
+				rOAuth2User.GET("authorizations", controller.GetOAuthAuthorizations)
+				rOAuth2User.DELETE("authorizations/:clientID", controller.DeleteOAuthAuthorization)
+			}
+
+			// Avatars, public for use in img tags
+			rAvatars := v1.Group("avatars")
+			rAvatars.GET("/:userID", controller.GetAvatar)
+
+			// Public profiles and nickname check of the signup form
+			v1.GET("users/nickname-available", controller.CheckNickname)
+			rProfiles := v1.Group("profiles")
+			rProfiles.GET("/:nickName", controller.GetPublicProfile)
 
 			// Note
+			// - personal access tokens with the notes scopes are accepted
 			rNotes := v1.Group("notes")
-			rNotes.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker())
+			if handler.AccountStores() {
+				rNotes.Use(controller.AccessToken(scope.NotesRead, scope.NotesWrite))
+			}
+			rNotes.Use(controller.UnlessAccessToken(gmiddleware.JWT())).Use(controller.UnlessAccessToken(gservice.JWTBlacklistChecker())).Use(controller.UnlessAccessToken(controller.RevokedJWTChecker()))
 			if configure.Security.Must2FA == gconfig.Activated {
-				rNotes.Use(gmiddleware.TwoFA(
+				rNotes.Use(controller.UnlessAccessToken(gmiddleware.TwoFA(
 					configure.Security.TwoFA.Status.On,
 					configure.Security.TwoFA.Status.Off,
 					configure.Security.TwoFA.Status.Verified,
-				))
+				)))
 			}
 			rNotes.GET("", controller.GetNotes)
 			rNotes.GET("/:id", controller.GetNote)
 			rNotes.POST("", controller.CreateNote)
 			rNotes.PUT("/:id", controller.UpdateNote)
 			rNotes.DELETE("/:id", controller.DeleteNote)
+			rNotes.POST("/:id/move", controller.MoveNote)
+			if handler.Backend() == store.BackendRDBMS && config.GetConfig().Notes.KeySharing {
+				// end-to-end encrypted notes shared with other users
+				rNotes.GET("/shared", controller.GetSharedNotes)
+				rNotes.GET("/shared/:id", controller.GetSharedNote)
+				rNotes.GET("/:id/keys", controller.GetNoteKeys)
+				rNotes.POST("/:id/keys", controller.AddNoteKey)
+				rNotes.DELETE("/:id/keys/:noteKeyID", controller.DeleteNoteKey)
+			}
+
+			// Workspaces, their members and invitations
+			rWorkspaces := v1.Group("workspaces")
+			rWorkspaces.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			if configure.Security.Must2FA == gconfig.Activated {
+				rWorkspaces.Use(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				))
+			}
+			rWorkspaces.GET("", controller.GetWorkspaces)
+			rWorkspaces.POST("", controller.CreateWorkspace)
+			rWorkspaces.GET("/invitations", controller.GetMyInvitations)
+			rWorkspaces.POST("/invitations/:invitationID/accept", controller.AcceptInvitation)
+			rWorkspaces.DELETE("/invitations/:invitationID", controller.DeclineInvitation)
+			rWorkspaces.GET("/:id", controller.GetWorkspace)
+			rWorkspaces.PUT("/:id", controller.UpdateWorkspace)
+			rWorkspaces.DELETE("/:id", controller.DeleteWorkspace)
+			rWorkspaces.GET("/:id/members", controller.GetWorkspaceMembers)
+			rWorkspaces.PUT("/:id/members/:userID", controller.UpdateWorkspaceMember)
+			rWorkspaces.DELETE("/:id/members/:userID", controller.DeleteWorkspaceMember)
+			rWorkspaces.GET("/:id/invitations", controller.GetWorkspaceInvitations)
+			rWorkspaces.POST("/:id/invitations", controller.CreateWorkspaceInvitation)
+			rWorkspaces.DELETE("/:id/invitations/:invitationID", controller.DeleteWorkspaceInvitation)
+
+			// Audit log of profile and note changes
+			rAudit := v1.Group("audit")
+			rAudit.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			if configure.Security.Must2FA == gconfig.Activated {
+				rAudit.Use(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				))
+			}
+			rAudit.GET("", controller.GetAuditEvents)
+			rAudit.GET("/all", controller.RequirePermission(rbac.AuditRead), controller.GetAllAuditEvents)
+
+			// Administration, each route requires a permission
+			// granted by a role, see lib/rbac
+			rAdmin := v1.Group("admin")
+			rAdmin.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			if configure.Security.Must2FA == gconfig.Activated {
+				rAdmin.Use(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				))
+			}
+			rAdmin.GET("/users", controller.RequirePermission(rbac.UsersRead), controller.SearchUsers)
+			rAdmin.GET("/users/:authID", controller.RequirePermission(rbac.UsersRead), controller.GetAccount)
+			rAdmin.POST("/users/:authID/suspend", controller.RequirePermission(rbac.UsersSuspend), controller.SuspendAccount)
+			rAdmin.DELETE("/users/:authID/suspend", controller.RequirePermission(rbac.UsersSuspend), controller.UnsuspendAccount)
+			rAdmin.POST("/users/:authID/logout", controller.RequirePermission(rbac.UsersLogout), controller.LogoutAccount)
+			rAdmin.PUT("/users/:authID/roles/:role", controller.RequirePermission(rbac.RolesManage), controller.GrantRole)
+			rAdmin.DELETE("/users/:authID/roles/:role", controller.RequirePermission(rbac.RolesManage), controller.RevokeRole)
+			rAdmin.GET("/roles", controller.RequirePermission(rbac.RolesManage), controller.GetRoleGrants)
+			rAdmin.DELETE("/notes/:id", controller.RequirePermission(rbac.ContentModerate), controller.ModerateNote)
+			if config.GetConfig().Lockout.Activate {
+				rAdmin.DELETE("/users/:authID/lockout", controller.RequirePermission(rbac.UsersSuspend), controller.UnlockAccount)
+				rAdmin.DELETE("/ips/:ip/lockout", controller.RequirePermission(rbac.UsersSuspend), controller.UnlockIP)
+			}
+
+			// Cache statistics, internal to the administrators
+			if configure.Database.REDIS.Activate == gconfig.Activated {
+				rCache := v1.Group("cache")
+				rCache.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+				if configure.Security.Must2FA == gconfig.Activated {
+					rCache.Use(gmiddleware.TwoFA(
+						configure.Security.TwoFA.Status.On,
+						configure.Security.TwoFA.Status.Off,
+						configure.Security.TwoFA.Status.Verified,
+					))
+				}
+				rCache.GET("stats", controller.RequirePermission(rbac.SystemRead), controller.GetCacheStats)
+			}
+		}
+
+		// Features implemented for RDBMS storage only
+		configureNotes := config.GetConfig().Notes
+		if handler.Backend() == store.BackendRDBMS && configureNotes.KeySharing {
+			// Public keys for end-to-end encryption
+			rKeys := v1.Group("keys")
+			rKeys.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			if configure.Security.Must2FA == gconfig.Activated {
+				rKeys.Use(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				))
+			}
+			rKeys.GET("", controller.GetUserKeys)
+			rKeys.POST("", controller.AddUserKey)
+			rKeys.DELETE("/:id", controller.DeleteUserKey)
+			rKeys.GET("/users/:userID", controller.GetPublicKeys)
+		}
+		if handler.Backend() == store.BackendRDBMS && configureNotes.DeltaSync {
+			// Delta sync for offline-first clients
+			rSync := v1.Group("sync")
+			rSync.Use(gmiddleware.JWT()).Use(gservice.JWTBlacklistChecker()).Use(controller.RevokedJWTChecker())
+			if configure.Security.Must2FA == gconfig.Activated {
+				rSync.Use(gmiddleware.TwoFA(
+					configure.Security.TwoFA.Status.On,
+					configure.Security.TwoFA.Status.Off,
+					configure.Security.TwoFA.Status.Verified,
+				))
+			}
+			rSync.GET("", controller.GetSync)
+			rSync.POST("", controller.PushSync)
 		}
 	}
 